@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/cocktailrobots/openbar-server/pkg/buttons"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,6 +18,8 @@ import (
 	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
 	"github.com/cocktailrobots/openbar-server/pkg/db"
 	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/gpio"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
 	"github.com/cocktailrobots/openbar-server/pkg/util/dbutils"
 	"github.com/gocraft/dbr/v2"
 	"github.com/gorilla/mux"
@@ -25,6 +29,14 @@ import (
 
 const (
 	mainBranch = "main"
+
+	pumpUsageSyncInterval = time.Minute
+
+	// maintenanceScheduleInterval is how often scheduled maintenance programs are checked to see if they are due
+	maintenanceScheduleInterval = 30 * time.Second
+
+	// buttonLeaseTime is how long a button's pump keeps running if the main loop stops seeing the button
+	buttonLeaseTime = 500 * time.Millisecond
 )
 
 func installSignalHandler(cancelCtx context.CancelFunc) {
@@ -111,9 +123,17 @@ func run(ctx context.Context, logger *zap.Logger, config *cfg.Config) error {
 	if err != nil {
 		return fmt.Errorf("failed to initialize hardware: %w", err)
 	}
-	defer func() {
-		hardware.TurnPumpsOff(hw)
+
+	watchdog, _ := hw.(*hardware.Watchdog)
+	estop, err := initEStop(config, hw, logger)
+	if err != nil {
 		hw.Close()
+		return fmt.Errorf("failed to initialize e-stop: %w", err)
+	}
+	ctrl := hardware.NewController(estop)
+	defer func() {
+		ctrl.Close()
+		estop.GetReversePin().Close()
 	}()
 
 	// debug hardware changes the iostreams so we need to reinitialize the logger
@@ -132,11 +152,30 @@ func run(ctx context.Context, logger *zap.Logger, config *cfg.Config) error {
 		return fmt.Errorf("failed to initialize database '%s' provider: %w", db.OpenBarDB, err)
 	}
 
+	openbarRtr := mux.NewRouter()
+	openbarAPI := openbarapi.New(logger, openbarDBP, cockDBP, openbarRtr, ctrl, estop)
+	err = openbarAPI.LoadPumpUsage(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load pump usage: %w", err)
+	}
+
 	var eg errgroup.Group
 	eg.Go(func() error {
-		rtr := mux.NewRouter()
-		openbarapi.New(logger, openbarDBP, rtr, hw)
-		return startHttpServer(ctx, config.OpenBarApi, rtr)
+		return startHttpServer(ctx, config.OpenBarApi, openbarRtr)
+	})
+
+	eg.Go(func() error {
+		openbarAPI.SyncPumpUsagePeriodically(ctx, pumpUsageSyncInterval)
+		return nil
+	})
+
+	eg.Go(func() error {
+		return openbarAPI.RunOrderQueue(ctx)
+	})
+
+	eg.Go(func() error {
+		openbarAPI.RunMaintenanceSchedules(ctx, maintenanceScheduleInterval)
+		return nil
 	})
 
 	eg.Go(func() error {
@@ -145,44 +184,82 @@ func run(ctx context.Context, logger *zap.Logger, config *cfg.Config) error {
 		return startHttpServer(ctx, config.CocktailsApi, rtr)
 	})
 
+	buttonLeases := make([]*hardware.Lease, btns.NumButtons())
 	for {
 		select {
 		case <-ctx.Done():
+			openbarAPI.CancelPours()
+
+			err = openbarAPI.SyncPumpUsage(context.Background())
+			if err != nil {
+				log.Println("Error syncing pump usage: ", err.Error())
+			}
+
 			return nil
 		default:
 		}
 
+		if watchdog != nil {
+			watchdog.Heartbeat()
+		}
+
 		err = btns.Update()
 		if err != nil {
 			log.Println("Error updating buttons: ", err.Error())
 		} else {
+			_, estopped := estop.Latched()
 			for i := 0; i < btns.NumButtons(); i++ {
-				if btns.IsPressed(i) {
-					err = hw.Pump(i, hardware.Forward)
-				} else {
-					err = hw.Pump(i, hardware.Off)
-				}
-
+				err = updateButtonPump(ctrl, buttonLeases, i, btns.IsPressed(i) && !estopped)
 				if err != nil {
 					log.Println("Error pumping: ", err.Error())
 				}
 			}
 		}
 
-		hw.Update()
+		estop.Update()
 		time.Sleep(100 * time.Millisecond)
 	}
 
 	return nil
 }
 
+// updateButtonPump runs the pump of button idx while it is pressed. The pump is held with a manual lease which is
+// extended each time the button is seen pressed and released when it isn't, so the pump stops if the loop stalls. A
+// button whose pump is leased to a pour or cleaning is ignored until its pump is free.
+func updateButtonPump(ctrl *hardware.Controller, leases []*hardware.Lease, idx int, pressed bool) error {
+	lease := leases[idx]
+	if !pressed {
+		if lease != nil {
+			lease.Release()
+			leases[idx] = nil
+		}
+
+		return nil
+	}
+
+	if lease != nil && lease.Extend(buttonLeaseTime) == nil {
+		return nil
+	}
+
+	leases[idx] = nil
+	lease, err := ctrl.Acquire(hardware.RequesterManual, []int{idx}, buttonLeaseTime)
+	if errors.Is(err, hardware.ErrPumpBusy) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	leases[idx] = lease
+	return lease.Pump(idx, hardware.Forward)
+}
+
 func initButtons(ctx context.Context, config *cfg.Config, logger *zap.Logger) (buttons.Buttons, error) {
 	if config.Buttons != nil {
 		switch {
 		case config.Buttons.Gpio != nil:
 			logger.Info("Creating GPIO buttons")
 			gpioConfig := config.Buttons.Gpio
-			btns, err := buttons.NewGpioButtons(gpioConfig.Pins, time.Duration(gpioConfig.DebounceNanos), gpioConfig.ActiveLow, gpioConfig.PullUp)
+			btns, err := buttons.NewGpioButtons(gpio.NewChip(gpioConfig.Chip), gpioConfig.Pins, time.Duration(gpioConfig.DebounceNanos), gpioConfig.ActiveLow, gpioConfig.PullUp)
 			if err != nil {
 				return nil, fmt.Errorf("error creating GPIO buttons: %w", err)
 			}
@@ -194,11 +271,38 @@ func initButtons(ctx context.Context, config *cfg.Config, logger *zap.Logger) (b
 	return buttons.NewNullButtons(), nil
 }
 
+// initEStop wraps hw with an emergency stop, watching the configured e-stop input if there is one
+func initEStop(config *cfg.Config, hw hardware.Hardware, logger *zap.Logger) (*hardware.EStop, error) {
+	estop := hardware.NewEStop(hw)
+	if config.EStop != nil {
+		logger.Info("Watching e-stop input", zap.Any("estop", config.EStop))
+		opts := gpio.InputOptions{
+			ActiveLow: config.EStop.ActiveLow,
+			PullUp:    config.EStop.PullUp,
+			Debounce:  time.Duration(config.EStop.DebounceNanos),
+		}
+
+		line, err := gpio.NewChip(config.EStop.Chip).RequestInput(config.EStop.Pin, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error requesting e-stop input: %w", err)
+		}
+
+		estop.WatchInput(line)
+	}
+
+	return estop, nil
+}
+
 func initHardware(ctx context.Context, config *cfg.Config, logger *zap.Logger) (hardware.Hardware, error) {
 	var hw hardware.Hardware
 	var err error
 
-	rp, err := hardware.NewReversePin(config.ReversePin)
+	var rpChip gpio.Chip
+	if config.ReversePin != nil {
+		rpChip = gpio.NewChip(config.ReversePin.Chip)
+	}
+
+	rp, err := hardware.NewReversePin(rpChip, config.ReversePin)
 	if err != nil {
 		return nil, fmt.Errorf("error creating reverse pin: %w", err)
 	}
@@ -217,7 +321,7 @@ func initHardware(ctx context.Context, config *cfg.Config, logger *zap.Logger) (
 		case config.Hardware.Gpio != nil:
 			logger.Info("Creating GPIO hardware")
 			gpioConfig := config.Hardware.Gpio
-			hw, err = hardware.NewGpioHardware(gpioConfig.Pins, rp)
+			hw, err = hardware.NewGpioHardware(gpio.NewChip(gpioConfig.Chip), gpioConfig, rp)
 			if err != nil {
 				return nil, fmt.Errorf("error creating GPIO hardware: %w", err)
 			}
@@ -238,10 +342,57 @@ func initHardware(ctx context.Context, config *cfg.Config, logger *zap.Logger) (
 			}
 
 			logger.Info("Updated relay mapping", zap.Any("relay_mapping", sequentConfig.RelayMapping))
-			hw, err = hardware.NewSR8Hardware(sequentConfig.ExpectedBoardCount, sequentConfig.RelayMapping, rp)
+			bus := i2c.NewBus(i2cBusNum(sequentConfig.Bus))
+			if sequentConfig.AllowMissingBoards {
+				reprobeInterval := time.Duration(sequentConfig.ReprobeIntervalMs) * time.Millisecond
+				hw, err = hardware.NewDegradedSR8Hardware(bus, sequentConfig.ExpectedBoardCount, sequentConfig.RelayMapping, reprobeInterval, rp)
+			} else {
+				hw, err = hardware.NewSR8Hardware(bus, sequentConfig.ExpectedBoardCount, sequentConfig.RelayMapping, rp)
+			}
 			if err != nil {
 				return nil, fmt.Errorf("error creating sequent hardware: %w", err)
 			}
+
+		case config.Hardware.Pwm != nil:
+			logger.Info("Creating PWM hardware", zap.Any("pwm", config.Hardware.Pwm))
+			pwmConfig := config.Hardware.Pwm
+			hw, err = hardware.NewPwmHardware(pwmConfig.Chip, pwmConfig.Channels, pwmConfig.FrequencyHz, rp)
+			if err != nil {
+				return nil, fmt.Errorf("error creating PWM hardware: %w", err)
+			}
+
+		case config.Hardware.PCA9685 != nil:
+			logger.Info("Creating PCA9685 hardware", zap.Any("pca9685", config.Hardware.PCA9685))
+			pcaConfig := config.Hardware.PCA9685
+			hw, err = hardware.NewPCA9685Hardware(i2c.NewBus(i2cBusNum(pcaConfig.Bus)), pcaConfig, rp)
+			if err != nil {
+				return nil, fmt.Errorf("error creating PCA9685 hardware: %w", err)
+			}
+
+		case config.Hardware.MCP23017 != nil:
+			logger.Info("Creating MCP23017 hardware", zap.Any("mcp23017", config.Hardware.MCP23017))
+			mcpConfig := config.Hardware.MCP23017
+			hw, err = hardware.NewMCP23017Hardware(i2c.NewBus(i2cBusNum(mcpConfig.Bus)), mcpConfig, rp)
+			if err != nil {
+				return nil, fmt.Errorf("error creating MCP23017 hardware: %w", err)
+			}
+		}
+	}
+
+	var powerBudget *cfg.PowerBudgetConfig
+	if config.Hardware != nil {
+		powerBudget = config.Hardware.PowerBudget
+	}
+
+	if hardware.SupportsScheduling(hw) {
+		sched, err := hardware.NewScheduler(powerBudget, hw.NumPumps())
+		if err != nil {
+			return nil, fmt.Errorf("error creating pump scheduler: %w", err)
+		}
+
+		err = hardware.SetScheduler(hw, sched)
+		if err != nil {
+			return nil, fmt.Errorf("error setting pump scheduler: %w", err)
 		}
 	}
 
@@ -250,9 +401,27 @@ func initHardware(ctx context.Context, config *cfg.Config, logger *zap.Logger) (
 		return nil, fmt.Errorf("error turning pumps off: %w", err)
 	}
 
+	if config.Hardware != nil && config.Hardware.Watchdog != nil {
+		logger.Info("Starting hardware watchdog", zap.Any("watchdog", config.Hardware.Watchdog))
+		hw, err = hardware.NewWatchdog(hw, config.Hardware.Watchdog)
+		if err != nil {
+			return nil, fmt.Errorf("error creating hardware watchdog: %w", err)
+		}
+	}
+
 	return hw, nil
 }
 
+// i2cBusNum returns the I2C bus to use for a configured bus number, defaulting to bus 1 which is the I2C bus on the
+// Raspberry Pi header
+func i2cBusNum(bus *int) int {
+	if bus == nil {
+		return 1
+	}
+
+	return *bus
+}
+
 func connectToDB(ctx context.Context, database, branch string, config *cfg.Config, multiStatements bool) (*dbr.Connection, error) {
 	if config.DB == nil {
 		return nil, fmt.Errorf("no config provided to connect to")
@@ -286,6 +455,8 @@ func startHttpServer(ctx context.Context, listener *cfg.ListenerConfig, mux http
 	srv := &http.Server{
 		Addr:    addr,
 		Handler: mux,
+		// request contexts are derived from ctx so that long-lived requests, such as event streams, end on shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	go func() {
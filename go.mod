@@ -14,6 +14,7 @@ require (
 	github.com/golang-migrate/migrate/v4 v4.15.2
 	github.com/google/uuid v1.3.1
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/otiai10/copy v1.12.0
 	github.com/stretchr/testify v1.9.0
 	github.com/warthog618/gpiod v0.8.2
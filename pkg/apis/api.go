@@ -17,6 +17,12 @@ var ErrMethodNotAllowed = errors.New("method not allowed")
 var ErrNotFound = errors.New("not found")
 var ErrBadRequest = errors.New("bad request")
 var ErrAlreadyExists = errors.New("already exists")
+var ErrConflict = errors.New("conflict")
+
+// ErrorResponse is the body of a response to a request which failed due to a client error
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
 
 type API struct {
 	logger  *zap.Logger
@@ -66,26 +72,33 @@ func (api *API) Respond(w http.ResponseWriter, r *http.Request, respObj any, err
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	if err != nil {
+		status := http.StatusInternalServerError
 		if errors.Is(err, ErrNotFound) {
-			w.WriteHeader(http.StatusNotFound)
-			return
+			status = http.StatusNotFound
 		} else if errors.Is(err, ErrBadRequest) {
-			w.WriteHeader(http.StatusBadRequest)
-			return
+			status = http.StatusBadRequest
 		} else if errors.Is(err, dbr.ErrNotFound) {
-			w.WriteHeader(http.StatusNotFound)
-			return
+			status = http.StatusNotFound
 		} else if errors.Is(err, ErrAlreadyExists) {
-			w.WriteHeader(http.StatusConflict)
-			return
+			status = http.StatusConflict
+		} else if errors.Is(err, ErrConflict) {
+			status = http.StatusConflict
 		} else if errors.Is(err, ErrMethodNotAllowed) {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
+			status = http.StatusMethodNotAllowed
 		}
 
 		var mysqlErr *mysql.MySQLError
 		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
-			w.WriteHeader(http.StatusConflict)
+			status = http.StatusConflict
+		}
+
+		if status != http.StatusInternalServerError {
+			// client errors include the error message so that the client can tell the user what went wrong
+			w.WriteHeader(status)
+			jsonData, marshalErr := json.Marshal(ErrorResponse{Error: err.Error()})
+			if marshalErr == nil {
+				_, _ = w.Write(jsonData)
+			}
 			return
 		}
 
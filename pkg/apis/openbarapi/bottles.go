@@ -0,0 +1,192 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+	"time"
+)
+
+// BottlesHandler handles requests to /pumps/bottles
+func (api *OpenBarAPI) BottlesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getBottles(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getBottles(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	err := api.SyncPumpUsage(ctx)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var bottlesResp []wire.Bottle
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		bottles, err := openbardb.ListBottles(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		bottlesResp = wire.FromDbBottles(bottles)
+		return nil
+	})
+
+	api.Respond(w, r, bottlesResp, err)
+}
+
+// BottleHandler handles requests to /pumps/{idx}/bottle
+func (api *OpenBarAPI) BottleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getBottle(ctx, w, r)
+	case http.MethodPatch:
+		api.setBottleThreshold(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPatch}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getBottle(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	err = api.SyncPumpUsage(ctx)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var bottleResp wire.Bottle
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		bottle, err := openbardb.GetBottle(ctx, tx, idx)
+		if err != nil {
+			return err
+		}
+
+		bottleResp = wire.FromDbBottles([]openbardb.Bottle{*bottle})[0]
+		return nil
+	})
+
+	api.Respond(w, r, bottleResp, err)
+}
+
+func (api *OpenBarAPI) setBottleThreshold(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var req wire.BottleThreshold
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || (req.LowThresholdMl != nil && *req.LowThresholdMl < 0) {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.SetBottleLowThreshold(ctx, tx, idx, req.LowThresholdMl)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
+
+// BottleReplaceHandler handles requests to /pumps/{idx}/bottle/replace which mark the bottle on a pump as replaced
+func (api *OpenBarAPI) BottleReplaceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodPost:
+		api.replaceBottle(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) replaceBottle(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var req wire.BottleReplaceRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	} else if req.CapacityMl <= 0 {
+		api.Respond(w, r, nil, fmt.Errorf("capacity_ml must be greater than 0: %w", apis.ErrBadRequest))
+		return
+	} else if req.RemainingMl != nil && (*req.RemainingMl < 0 || *req.RemainingMl > req.CapacityMl) {
+		api.Respond(w, r, nil, fmt.Errorf("remaining_ml must be between 0 and capacity_ml: %w", apis.ErrBadRequest))
+		return
+	}
+
+	// make sure volume poured from the old bottle is not subtracted from the new one
+	err = api.SyncPumpUsage(ctx)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.ReplaceBottle(ctx, tx, idx, req.CapacityMl, req.RemainingMl, time.Now())
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
+
+// checkBottles returns an error if the bottle on any of the chosen pumps can't cover the volume requested from it.
+func checkBottles(fluidVolumes []wire.FluidVolume, pumpIndices []idxVolTuple, bottles map[int]openbardb.Bottle) error {
+	for _, idxVol := range pumpIndices {
+		err := checkBottle(fluidVolumes[idxVol.ReqIdx].Fluid, idxVol, bottles)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkBottle returns an error if the bottle on the chosen pump can't cover the volume requested from it.
+func checkBottle(fluid string, idxVol idxVolTuple, bottles map[int]openbardb.Bottle) error {
+	bottle, ok := bottles[idxVol.Idx]
+	if ok && !bottle.CanPour(idxVol.VolMl) {
+		return fmt.Errorf("not enough %s left: the bottle on pump %d has %.0fml remaining but %.0fml was requested: %w", fluid, idxVol.Idx, bottle.RemainingMl, idxVol.VolMl, apis.ErrConflict)
+	}
+
+	return nil
+}
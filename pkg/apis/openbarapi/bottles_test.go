@@ -0,0 +1,81 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"net/http"
+	"time"
+)
+
+func (s *testSuite) TestBottles() {
+	ctx := context.Background()
+	// gin is loaded on two pumps
+	fluids := barFluids()
+	fluids[7].Fluid = util.Ptr("gin")
+	s.setupPumpsAndFluids(ctx, fluids, pumpsOfSpeed(100, 8))
+
+	getBottle := func(idx string) wire.Bottle {
+		respWr := s.handle(http.MethodGet, "/pumps/"+idx+"/bottle", nil)
+		s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+		var bottle wire.Bottle
+		err := json.Unmarshal(respWr.Body(), &bottle)
+		s.Require().NoError(err)
+		return bottle
+	}
+
+	s.Require().False(getBottle("0").Tracked)
+
+	respWr := s.handle(http.MethodPost, "/pumps/0/bottle/replace", wire.BottleReplaceRequest{CapacityMl: 750, RemainingMl: util.Ptr(40.0)})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	respWr = s.handle(http.MethodPost, "/pumps/7/bottle/replace", wire.BottleReplaceRequest{CapacityMl: 750, RemainingMl: util.Ptr(30.0)})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	respWr = s.handle(http.MethodPost, "/pumps/0/bottle/replace", wire.BottleReplaceRequest{CapacityMl: 750, RemainingMl: util.Ptr(800.0)})
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+
+	// neither gin bottle can cover the request
+	makeReq := wire.MakeRequest{FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 50}}}
+	respWr = s.handle(http.MethodPost, "/make", makeReq)
+	s.Require().Equal(http.StatusConflict, respWr.StatusCode())
+
+	var errResp apis.ErrorResponse
+	err := json.Unmarshal(respWr.Body(), &errResp)
+	s.Require().NoError(err)
+	s.Require().Contains(errResp.Error, "not enough gin left")
+
+	thw := s.testHardware()
+	s.Require().Equal(time.Duration(0), thw.TimeRun(0))
+	s.Require().Equal(time.Duration(0), thw.TimeRun(7))
+
+	// the pump whose bottle can cover the request is chosen
+	respWr = s.handle(http.MethodPost, "/pumps/0/bottle/replace", wire.BottleReplaceRequest{CapacityMl: 750})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	respWr = s.handle(http.MethodPatch, "/pumps/0/bottle", wire.BottleThreshold{LowThresholdMl: util.Ptr(710.0)})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodPost, "/make", makeReq)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	s.isClose(500*time.Millisecond, thw.TimeRun(0))
+	s.Require().Equal(time.Duration(0), thw.TimeRun(7))
+
+	bottle := getBottle("0")
+	s.Require().True(bottle.Tracked)
+	s.Require().InDelta(700.0, *bottle.RemainingMl, 1.0)
+	s.Require().True(bottle.Low)
+	s.Require().NotEmpty(bottle.Warning)
+
+	respWr = s.handle(http.MethodGet, "/pumps/bottles", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var bottles []wire.Bottle
+	err = json.Unmarshal(respWr.Body(), &bottles)
+	s.Require().NoError(err)
+	s.Require().Len(bottles, 8)
+	s.Require().False(bottles[1].Tracked)
+	s.Require().Equal(7, bottles[7].Idx)
+	s.Require().InDelta(30.0, *bottles[7].RemainingMl, 0.01)
+	s.Require().False(bottles[7].Low)
+}
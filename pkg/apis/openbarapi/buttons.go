@@ -3,10 +3,14 @@ package openbarapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/cocktailrobots/openbar-server/pkg/apis"
 	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
 	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"go.uber.org/zap"
 	"net/http"
+	"slices"
 	"time"
 )
 
@@ -31,6 +35,11 @@ func (api *OpenBarAPI) setButtonState(ctx context.Context, w http.ResponseWriter
 		return
 	}
 
+	if err := api.checkEStop(); err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
 	duration := 250 * time.Millisecond
 	if req.DurationMs != 0 {
 		duration = time.Duration(req.DurationMs) * time.Millisecond
@@ -52,11 +61,156 @@ func (api *OpenBarAPI) setButtonState(ctx context.Context, w http.ResponseWriter
 		direction = hardware.Backward
 	}
 
+	var opts hardware.RunOptions
+	if len(req.ReversedButtons) > 0 {
+		if req.Async {
+			api.Respond(w, r, nil, fmt.Errorf("reversed buttons can't be held asynchronously: %w", apis.ErrBadRequest))
+			return
+		}
+
+		dirs, err := api.buttonDirections(direction, req.ReversedButtons)
+		if err != nil {
+			api.Respond(w, r, nil, err)
+			return
+		}
+
+		opts.Directions = dirs
+	}
+
 	if req.Async {
-		err = api.ashwr.RunPumps(direction, runTimes)
+		err = api.runAsync(direction, runTimes)
 	} else {
-		err = api.hw.RunForTimes(direction, runTimes)
+		_, err = api.runPour(ctx, direction, runTimes, opts)
+
+		syncErr := api.SyncPumpUsage(context.Background())
+		if syncErr != nil {
+			api.Logger().Info("Error syncing pump usage", zap.Error(syncErr))
+		}
+
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
 	}
 
 	api.Respond(w, r, nil, err)
 }
+
+// runAsync turns the pumps with a time greater than zero on in direction without waiting for them. They are held with a
+// manual lease which expires after the longest time, turning them off. A lease from a previous call holding the same
+// pumps is renewed, otherwise its pumps are stopped first.
+func (api *OpenBarAPI) runAsync(direction hardware.PumpState, times []time.Duration) error {
+	var ttl time.Duration
+	for _, t := range times {
+		ttl = max(ttl, t)
+	}
+
+	if api.renewAsync(direction, times, ttl) {
+		return nil
+	}
+
+	api.stopAsync()
+
+	lease, err := api.acquirePumps(hardware.RequesterManual, times, ttl)
+	if err != nil || lease == nil {
+		return err
+	}
+
+	for _, idx := range lease.Pumps() {
+		if err := api.setPumpDirection(idx, direction); err != nil {
+			lease.Release()
+			return err
+		}
+
+		if err := lease.Pump(idx, direction); err != nil {
+			lease.Release()
+			return err
+		}
+	}
+
+	api.mu.Lock()
+	api.asyncLeases = append(api.asyncLeases, lease)
+	api.mu.Unlock()
+
+	return nil
+}
+
+// renewAsync extends the lease of the pumps started by the previous call to runAsync by ttl and runs them in direction,
+// so pumps held down across calls keep running. It returns false if the lease doesn't hold exactly the pumps with a time
+// greater than zero, or has ended.
+func (api *OpenBarAPI) renewAsync(direction hardware.PumpState, times []time.Duration, ttl time.Duration) bool {
+	api.mu.Lock()
+	leases := api.asyncLeases
+	api.mu.Unlock()
+
+	if len(leases) != 1 || !slices.Equal(leases[0].Pumps(), timedPumps(times)) {
+		return false
+	}
+
+	lease := leases[0]
+	if err := lease.Extend(ttl); err != nil {
+		return false
+	}
+
+	for _, idx := range lease.Pumps() {
+		if err := api.setPumpDirection(idx, direction); err != nil {
+			return false
+		}
+
+		if err := lease.Pump(idx, direction); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stopAsync releases the leases of pumps started with runAsync, turning them off
+func (api *OpenBarAPI) stopAsync() {
+	api.mu.Lock()
+	leases := api.asyncLeases
+	api.asyncLeases = nil
+	api.mu.Unlock()
+
+	for _, lease := range leases {
+		lease.Release()
+	}
+}
+
+// buttonDirections returns the direction of each pump when the reversed buttons run opposite to direction
+func (api *OpenBarAPI) buttonDirections(direction hardware.PumpState, reversed []int) ([]hardware.PumpState, error) {
+	opposite := hardware.Backward
+	if direction == hardware.Backward {
+		opposite = hardware.Forward
+	}
+
+	dirs := make([]hardware.PumpState, api.hw.NumPumps())
+	for i := range dirs {
+		dirs[i] = direction
+	}
+
+	for _, idx := range reversed {
+		if idx < 0 || idx >= len(dirs) {
+			return nil, fmt.Errorf("invalid button %d: %w", idx, apis.ErrBadRequest)
+		} else if !hardware.HasPumpDirection(api.hw, idx) {
+			return nil, fmt.Errorf("pump %d has no direction control: %w", idx, apis.ErrBadRequest)
+		}
+
+		dirs[idx] = opposite
+	}
+
+	return dirs, nil
+}
+
+// setPumpDirection makes pump idx run in direction when it's turned on outside of a run. Pumps without direction control
+// follow the reverse pin shared by every pump, which is set to direction as runs do.
+func (api *OpenBarAPI) setPumpDirection(idx int, direction hardware.PumpState) error {
+	if hardware.HasPumpDirection(api.hw, idx) {
+		return nil
+	}
+
+	if err := api.hw.GetReversePin().SetDirection(direction); err != nil {
+		return fmt.Errorf("error setting the direction of pump %d: %w", idx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package openbarapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+)
+
+func (s *testSuite) TestReversedButtons() {
+	thw := s.testHardware()
+	defer thw.SetHasPumpDirection(2, false)
+
+	state := wire.ButtonState{
+		DepressedButtons: []int{1, 2},
+		ReversedButtons:  []int{2},
+		DurationMs:       50,
+		Forward:          true,
+	}
+
+	respWr := s.handle(http.MethodPost, "/buttons", state)
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+
+	thw.SetHasPumpDirection(2, true)
+	state.Async = true
+	respWr = s.handle(http.MethodPost, "/buttons", state)
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+
+	state.Async = false
+	respWr = s.handle(http.MethodPost, "/buttons", state)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	// time run in either direction is counted
+	s.isClose(50*time.Millisecond, thw.TimeRun(1))
+	s.isClose(50*time.Millisecond, thw.TimeRun(2))
+}
+
+func (s *testSuite) TestButtonLeases() {
+	// pumps leased for cleaning can't be run by buttons
+	lease, err := s.Api.ctrl.Acquire(hardware.RequesterCleaning, []int{1}, time.Second)
+	s.Require().NoError(err)
+
+	state := wire.ButtonState{DepressedButtons: []int{0, 1}, DurationMs: 50, Forward: true}
+	s.Require().Equal(http.StatusConflict, s.postStatus("/buttons", state))
+	state.Async = true
+	s.Require().Equal(http.StatusConflict, s.postStatus("/buttons", state))
+
+	lease.Release()
+	state.DurationMs = 1000
+	s.Require().Equal(http.StatusOK, s.postStatus("/buttons", state))
+
+	// pours preempt pumps run asynchronously by buttons
+	times := make([]time.Duration, s.Api.hw.NumPumps())
+	times[1] = 50 * time.Millisecond
+	runTimes, err := s.Api.runPour(context.Background(), hardware.Forward, times, hardware.RunOptions{})
+	s.Require().NoError(err)
+	s.isClose(50*time.Millisecond, runTimes[1])
+
+	s.Api.mu.Lock()
+	asyncLease := s.Api.asyncLeases[0]
+	s.Api.mu.Unlock()
+	s.Require().ErrorIs(asyncLease.Err(), hardware.ErrLeasePreempted)
+	s.Api.CancelPours()
+}
+
+func (s *testSuite) TestAsyncButtonsRenew() {
+	defer s.Api.stopAsync()
+
+	asyncLease := func() *hardware.Lease {
+		s.Api.mu.Lock()
+		defer s.Api.mu.Unlock()
+
+		s.Require().Len(s.Api.asyncLeases, 1)
+		return s.Api.asyncLeases[0]
+	}
+
+	state := wire.ButtonState{DepressedButtons: []int{0, 1}, DurationMs: 100, Forward: true, Async: true}
+	s.Require().Equal(http.StatusOK, s.postStatus("/buttons", state))
+	lease := asyncLease()
+
+	// holding the same buttons renews the lease rather than stopping and restarting the pumps
+	for i := 0; i < 3; i++ {
+		time.Sleep(60 * time.Millisecond)
+		s.Require().Equal(http.StatusOK, s.postStatus("/buttons", state))
+		s.Require().Same(lease, asyncLease())
+		s.Require().NoError(lease.Err())
+	}
+
+	// changing the buttons releases the lease
+	state.DepressedButtons = []int{1}
+	s.Require().Equal(http.StatusOK, s.postStatus("/buttons", state))
+	s.Require().NotSame(lease, asyncLease())
+	s.Require().ErrorIs(lease.Err(), hardware.ErrLeaseReleased)
+	s.Require().Equal([]int{1}, asyncLease().Pumps())
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
 	"github.com/gocraft/dbr/v2"
 	"net/http"
+	"sort"
 )
 
 func (api *OpenBarAPI) ConfigHandler(w http.ResponseWriter, r *http.Request) {
@@ -61,6 +62,10 @@ func (api *OpenBarAPI) setConfig(ctx context.Context, w http.ResponseWriter, r *
 		return tx.Commit()
 	})
 
+	if err == nil {
+		api.publishConfigChanged(configKeys(reqCfg)...)
+	}
+
 	api.Respond(w, r, nil, err)
 }
 
@@ -82,6 +87,10 @@ func (api *OpenBarAPI) updateConfig(ctx context.Context, w http.ResponseWriter,
 		return tx.Commit()
 	})
 
+	if err == nil {
+		api.publishConfigChanged(configKeys(config)...)
+	}
+
 	api.Respond(w, r, nil, err)
 }
 
@@ -178,6 +187,10 @@ func (api *OpenBarAPI) updateConfigValue(ctx context.Context, w http.ResponseWri
 		return tx.Commit()
 	})
 
+	if err == nil {
+		api.publishConfigChanged(configKey)
+	}
+
 	api.Respond(w, r, nil, err)
 }
 
@@ -224,6 +237,10 @@ func (api *OpenBarAPI) setConfigValue(ctx context.Context, w http.ResponseWriter
 		return tx.Commit()
 	})
 
+	if err == nil {
+		api.publishConfigChanged(configKey)
+	}
+
 	api.Respond(w, r, nil, err)
 }
 
@@ -244,5 +261,20 @@ func (api *OpenBarAPI) deleteConfigValue(ctx context.Context, w http.ResponseWri
 		return tx.Commit()
 	})
 
+	if err == nil {
+		api.publishConfigChanged(configKey)
+	}
+
 	api.Respond(w, r, nil, err)
 }
+
+// configKeys returns the sorted keys of a config map
+func configKeys[T any](cfg map[string]T) []string {
+	keys := make([]string, 0, len(cfg))
+	for k := range cfg {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,188 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/events"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+const defaultEStopEventsLimit = 50
+
+// EStopHandler handles requests to /estop. GET returns the state of the emergency stop and POST triggers it.
+func (api *OpenBarAPI) EStopHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.Respond(w, r, api.estopState(), nil)
+	case http.MethodPost:
+		api.triggerEStop(w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+// EStopResetHandler handles requests to /estop/reset which release the emergency stop
+func (api *OpenBarAPI) EStopResetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodPost:
+		api.resetEStop(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+// EStopEventsHandler handles requests to /estop/events which return the emergency stop events newest first. The
+// number of events returned is set with the limit query parameter.
+func (api *OpenBarAPI) EStopEventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getEStopEvents(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) triggerEStop(w http.ResponseWriter, r *http.Request) {
+	var req wire.EStopRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "e-stop requested"
+	}
+
+	api.estop.Trigger("api", reason)
+	api.Respond(w, r, api.estopState(), nil)
+}
+
+func (api *OpenBarAPI) resetEStop(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if _, latched := api.estop.Latched(); !latched {
+		api.Respond(w, r, api.estopState(), nil)
+		return
+	}
+
+	if err := api.estop.Reset(); err != nil {
+		api.Respond(w, r, nil, fmt.Errorf("%s: %w", err.Error(), apis.ErrConflict))
+		return
+	}
+
+	api.Logger().Info("E-stop reset")
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.ResetEStopEvents(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	state := api.estopState()
+	api.events.Publish(events.EStop, state)
+	api.Respond(w, r, state, err)
+}
+
+func (api *OpenBarAPI) getEStopEvents(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	limit := uint64(defaultEStopEventsLimit)
+	if val := r.URL.Query().Get("limit"); val != "" {
+		var err error
+		limit, err = strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			api.Respond(w, r, nil, fmt.Errorf("invalid limit '%s': %w", val, apis.ErrBadRequest))
+			return
+		}
+	}
+
+	var resp []wire.EStopEvent
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		evts, err := openbardb.ListEStopEvents(ctx, tx, limit)
+		if err != nil {
+			return err
+		}
+
+		resp = wire.FromDbEStopEvents(evts)
+		return nil
+	})
+
+	api.Respond(w, r, resp, err)
+}
+
+func (api *OpenBarAPI) estopState() wire.EStopState {
+	evt, latched := api.estop.Latched()
+	if !latched {
+		return wire.EStopState{}
+	}
+
+	return wire.EStopState{
+		Latched:     true,
+		Source:      evt.Source,
+		Reason:      evt.Reason,
+		TriggeredAt: &evt.At,
+	}
+}
+
+// checkEStop returns a conflict error if the emergency stop is latched
+func (api *OpenBarAPI) checkEStop() error {
+	if evt, latched := api.estop.Latched(); latched {
+		return fmt.Errorf("e-stop triggered by %s must be reset: %w", evt.Source, apis.ErrConflict)
+	}
+
+	return nil
+}
+
+// onEStop is called once the emergency stop has latched and the pumps are off. It cancels in-flight pours and queued
+// orders, and records the event.
+func (api *OpenBarAPI) onEStop(evt hardware.EStopEvent) {
+	pours := api.CancelPours()
+
+	ctx := context.Background()
+	var orders int
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		orders, err = openbardb.CancelQueuedOrders(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		err = openbardb.CreateEStopEvent(ctx, tx, &openbardb.EStopEvent{
+			TriggeredAt: evt.At,
+			Source:      evt.Source,
+			Reason:      &evt.Reason,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		api.Logger().Error("Error recording e-stop", zap.Error(err))
+	}
+
+	api.Logger().Info("E-stop triggered", zap.String("source", evt.Source), zap.String("reason", evt.Reason),
+		zap.Int("cancelled_pours", pours), zap.Int("cancelled_orders", orders))
+	api.events.Publish(events.EStop, api.estopState())
+}
@@ -0,0 +1,97 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"github.com/cocktailrobots/openbar-server/pkg/util/test"
+	"net/http"
+	"time"
+)
+
+func (s *testSuite) postEStop(path string, body any) wire.EStopState {
+	respWr := s.handle(http.MethodPost, path, body)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var state wire.EStopState
+	err := json.Unmarshal(respWr.Body(), &state)
+	s.Require().NoError(err)
+	return state
+}
+
+func (s *testSuite) getEStopEvents() []wire.EStopEvent {
+	respWr := s.handle(http.MethodGet, "/estop/events", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var evts []wire.EStopEvent
+	err := json.Unmarshal(respWr.Body(), &evts)
+	s.Require().NoError(err)
+	return evts
+}
+
+func (s *testSuite) TestEStop() {
+	ctx := context.Background()
+	s.setupPumpsAndFluids(ctx, []openbardb.Fluid{
+		{Idx: 0, Fluid: util.Ptr("gin")},
+		{Idx: 1, Fluid: util.Ptr("vodka")},
+	}, pumpsOfSpeed(100, 8))
+
+	first := s.createOrder(wire.FluidVolume{Fluid: "gin", VolumeMl: 20})
+	second := s.createOrder(wire.FluidVolume{Fluid: "vodka", VolumeMl: 20})
+
+	state := s.postEStop("/estop/reset", nil)
+	s.Require().False(state.Latched)
+
+	// an in-flight pour is stopped when the e-stop is triggered
+	pourDone := make(chan time.Time)
+	go func() {
+		state := wire.ButtonState{DepressedButtons: []int{2}, DurationMs: 5000, Forward: true}
+		req, _ := http.NewRequest(http.MethodPost, "/buttons", test.JsonReaderForObject(state))
+		s.Api.Handle(test.NewResponseWriter(), req)
+		pourDone <- time.Now()
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	triggered := time.Now()
+	state = s.postEStop("/estop", wire.EStopRequest{Reason: "spill"})
+	s.Require().True(state.Latched)
+	s.Require().Equal("api", state.Source)
+	s.Require().Equal("spill", state.Reason)
+	s.Require().NotNil(state.TriggeredAt)
+
+	select {
+	case done := <-pourDone:
+		s.Require().Less(done.Sub(triggered), time.Second)
+	case <-time.After(2 * time.Second):
+		s.Fail("pour wasn't stopped by the e-stop")
+	}
+
+	s.Require().Equal("cancelled", s.getOrder(first.Id).Status)
+	s.Require().Equal("cancelled", s.getOrder(second.Id).Status)
+
+	// triggering again doesn't record another event
+	s.postEStop("/estop", nil)
+	evts := s.getEStopEvents()
+	s.Require().Len(evts, 1)
+	s.Require().Equal("api", evts[0].Source)
+	s.Require().Equal("spill", evts[0].Reason)
+	s.Require().Nil(evts[0].ResetAt)
+
+	// pump commands are refused until the e-stop is reset
+	buttons := wire.ButtonState{DepressedButtons: []int{2}, DurationMs: 20, Forward: true}
+	s.Require().Equal(http.StatusConflict, s.postStatus("/buttons", buttons))
+	s.Require().Equal(http.StatusConflict, s.postStatus("/orders", wire.MakeRequest{FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 20}}}))
+	s.Require().Error(s.Api.hw.Pump(2, hardware.Forward))
+
+	state = s.postEStop("/estop/reset", nil)
+	s.Require().False(state.Latched)
+
+	evts = s.getEStopEvents()
+	s.Require().Len(evts, 1)
+	s.Require().NotNil(evts[0].ResetAt)
+
+	s.Require().Equal(http.StatusOK, s.postStatus("/buttons", buttons))
+}
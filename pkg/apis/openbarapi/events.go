@@ -0,0 +1,80 @@
+package openbarapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/events"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// eventsKeepAliveInterval is how often a comment is written to idle event streams so that proxies and clients don't
+// time out the connection
+const eventsKeepAliveInterval = 15 * time.Second
+
+// EventsHandler handles requests to /events which stream machine events to the client as Server-Sent Events. Each
+// event is written with the event type as the SSE event name and the json encoded event as its data.
+func (api *OpenBarAPI) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method == http.MethodOptions {
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+		return
+	} else if r.Method != http.MethodGet {
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.Respond(w, r, nil, errors.New("streaming is not supported"))
+		return
+	}
+
+	ch, unsubscribe := api.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case evt := <-ch:
+			var data []byte
+			data, err = json.Marshal(evt)
+			if err != nil {
+				api.Logger().Info("Error marshaling event", zap.String("type", string(evt.Type)), zap.Error(err))
+				continue
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", evt.Type, data)
+		}
+
+		if err != nil {
+			api.Logger().Info("Error writing event stream", zap.Error(err))
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+func (api *OpenBarAPI) publishConfigChanged(keys ...string) {
+	api.events.Publish(events.ConfigChanged, wire.ConfigChangedEvent{Keys: keys})
+}
@@ -0,0 +1,84 @@
+package openbarapi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/events"
+	"github.com/cocktailrobots/openbar-server/pkg/util/test"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+func (s *testSuite) TestEvents() {
+	ctx := context.Background()
+	s.setupBar(ctx, 100)
+
+	srv := httptest.NewServer(http.HandlerFunc(s.Api.Handle))
+	defer srv.Close()
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, srv.URL+"/events", nil)
+	s.Require().NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	s.Require().Equal(http.StatusOK, resp.StatusCode)
+	s.Require().Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	evtCh := make(chan events.Event, 128)
+	go func() {
+		defer close(evtCh)
+
+		var evt events.Event
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				if json.Unmarshal([]byte(data), &evt) == nil {
+					evtCh <- evt
+				}
+			}
+		}
+	}()
+
+	s.Require().Eventually(func() bool { return s.Api.events.NumSubscribers() == 1 }, time.Second, 5*time.Millisecond)
+
+	reqJson, err := json.Marshal(wire.MakeRequest{FluidVolumes: []wire.FluidVolume{
+		{Fluid: "gin", VolumeMl: 50},
+		{Fluid: "campari", VolumeMl: 30},
+	}})
+	s.Require().NoError(err)
+
+	makeReq, err := http.NewRequest(http.MethodPost, "/make", bytes.NewBuffer(reqJson))
+	s.Require().NoError(err)
+	respWr := test.NewResponseWriter()
+	s.Api.Handle(respWr, makeReq)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var types []events.Type
+	pumpChanges := 0
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		select {
+		case evt := <-evtCh:
+			if evt.Type == events.PumpState {
+				pumpChanges++
+			} else if len(types) == 0 || types[len(types)-1] != evt.Type {
+				types = append(types, evt.Type)
+			}
+			done = evt.Type == events.PourFinished
+		case <-timeout:
+			s.FailNow("timed out waiting for events", "received %v", types)
+		}
+	}
+
+	s.Require().Equal([]events.Type{events.PourStarted, events.PourProgress, events.PourFinished}, types)
+	s.Require().Equal(4, pumpChanges)
+}
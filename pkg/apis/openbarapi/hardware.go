@@ -0,0 +1,47 @@
+package openbarapi
+
+import (
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"net/http"
+)
+
+func (api *OpenBarAPI) HardwareStatusHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.getHardwareStatus(w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getHardwareStatus(w http.ResponseWriter, r *http.Request) {
+	status := hardware.GetStatus(api.hw)
+	resp := wire.HardwareStatus{
+		Name:   api.hw.Name(),
+		Pumps:  make([]wire.PumpHealth, len(status.Pumps)),
+		Boards: make([]wire.BoardStatus, len(status.Boards)),
+	}
+
+	for i, health := range status.Pumps {
+		resp.Pumps[i] = wire.PumpHealth{Idx: i, Health: health.String()}
+	}
+
+	for i, board := range status.Boards {
+		resp.Boards[i] = wire.BoardStatus{
+			Name:    board.Name,
+			Present: board.Present,
+			Health:  board.Health.String(),
+			Pumps:   board.Pumps,
+		}
+
+		if board.Err != nil {
+			resp.Boards[i].Error = board.Err.Error()
+		}
+	}
+
+	api.Respond(w, r, resp, nil)
+}
@@ -0,0 +1,43 @@
+package openbarapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+)
+
+func (s *testSuite) getHardwareStatus() wire.HardwareStatus {
+	respWr := s.handle(http.MethodGet, "/hardware/status", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var status wire.HardwareStatus
+	err := json.Unmarshal(respWr.Body(), &status)
+	s.Require().NoError(err)
+	return status
+}
+
+func (s *testSuite) TestHardwareStatus() {
+	thw := s.testHardware()
+	defer thw.SetPumpHealth(3, hardware.Healthy)
+
+	status := s.getHardwareStatus()
+	s.Require().Equal("test", status.Name)
+	s.Require().Len(status.Pumps, 8)
+	s.Require().Equal(wire.PumpHealth{Idx: 3, Health: "ok"}, status.Pumps[3])
+	s.Require().Empty(status.Boards)
+
+	thw.SetPumpHealth(3, hardware.WriteFailed)
+	status = s.getHardwareStatus()
+	s.Require().Equal(wire.PumpHealth{Idx: 3, Health: "write-failed"}, status.Pumps[3])
+
+	// pours that would use the faulted pump are refused
+	state := wire.ButtonState{DepressedButtons: []int{3}, DurationMs: 20, Forward: true}
+	respWr := s.handle(http.MethodPost, "/buttons", state)
+	s.Require().Equal(http.StatusConflict, respWr.StatusCode())
+
+	state.DepressedButtons = []int{2}
+	respWr = s.handle(http.MethodPost, "/buttons", state)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+}
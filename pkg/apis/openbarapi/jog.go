@@ -0,0 +1,346 @@
+package openbarapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/gocraft/dbr/v2"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultJogHeartbeatTimeout is how long a jogged pump keeps running after the last heartbeat when the client
+	// doesn't choose a timeout
+	defaultJogHeartbeatTimeout = 500 * time.Millisecond
+	// maxJogHeartbeatTimeout is the longest heartbeat timeout a client can choose
+	maxJogHeartbeatTimeout = 5 * time.Second
+	// jogProgressInterval is how often progress is sent while a pump is being jogged
+	jogProgressInterval = 250 * time.Millisecond
+	// jogWriteTimeout is how long writing a message to a jog client may take before the connection is dropped
+	jogWriteTimeout = time.Second
+)
+
+var jogUpgrader = websocket.Upgrader{
+	// the API is served to clients on any origin, as with the Access-Control-Allow-Origin header on every response
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// jog is a pump being run by a jog client while it holds the pump's manual lease
+type jog struct {
+	lease     *hardware.Lease
+	idx       int
+	direction hardware.PumpState
+	timeout   time.Duration
+	mlPerSec  float64
+	tubeMl    float64
+	runtime   time.Duration
+	start     time.Time
+}
+
+// returnedMl returns the fluid returned to the bottle by jogging the pump backward for ran. The flow rate is only
+// calibrated running forward, so no more than the pump's tube holds is counted.
+func (j *jog) returnedMl(ran time.Duration) float64 {
+	return min(ran.Seconds()*j.mlPerSec, j.tubeMl)
+}
+
+// status returns the status of the jog once its pump has run for ran. Fluid jogged backward is returned to the bottle,
+// so it is dispensed as a negative volume.
+func (j *jog) status(typ string, ran time.Duration) wire.JogStatus {
+	dispensed := ran.Seconds() * j.mlPerSec
+	if j.direction == hardware.Backward {
+		dispensed = -j.returnedMl(ran)
+	}
+
+	return wire.JogStatus{
+		Type:        typ,
+		Pump:        j.idx,
+		Direction:   j.direction.String(),
+		ElapsedMs:   ran.Milliseconds(),
+		DispensedMl: dispensed,
+	}
+}
+
+// progress returns the progress of a running jog. The runtime of a pump is only recorded by the hardware once it's
+// turned off, so progress is estimated from when the pump was turned on.
+func (j *jog) progress() wire.JogStatus {
+	return j.status(wire.JogProgress, time.Since(j.start))
+}
+
+// JogHandler handles requests to /jog which are upgraded to a WebSocket used to jog pumps by hand. The client sends
+// wire.JogMessage messages and the pump it starts runs until it is stopped or a heartbeat is missed, acting as a
+// deadman switch. The server replies with wire.JogStatus messages. Closing the connection stops the pump.
+func (api *OpenBarAPI) JogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+		return
+	} else if r.Method != http.MethodGet {
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+		return
+	}
+
+	conn, err := jogUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already responded with an error
+		api.Logger().Info("Error upgrading jog connection", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	api.runJogSession(r.Context(), conn)
+}
+
+func (api *OpenBarAPI) runJogSession(ctx context.Context, conn *websocket.Conn) {
+	msgs := make(chan wire.JogMessage)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(msgs)
+
+		for {
+			var msg wire.JogMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				var closeErr *websocket.CloseError
+				if !errors.As(err, &closeErr) {
+					api.Logger().Info("Error reading jog message", zap.Error(err))
+				}
+
+				return
+			}
+
+			select {
+			case msgs <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(jogProgressInterval)
+	defer ticker.Stop()
+
+	var current *jog
+	defer func() {
+		if current != nil {
+			api.endJog(current, "disconnected")
+		}
+	}()
+
+	for {
+		var leaseDone <-chan struct{}
+		if current != nil {
+			leaseDone = current.lease.Done()
+		}
+
+		var status wire.JogStatus
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+
+			current, status = api.handleJogMessage(ctx, current, msg)
+		case <-leaseDone:
+			reason := api.jogStopReason(current.lease.Err())
+			status = current.status(wire.JogStopped, api.endJog(current, reason))
+			status.Reason = reason
+			current = nil
+		case <-ticker.C:
+			if current == nil {
+				continue
+			}
+
+			status = current.progress()
+		}
+
+		if status.Type == "" {
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(jogWriteTimeout))
+		if err := conn.WriteJSON(status); err != nil {
+			api.Logger().Info("Error writing jog status", zap.Error(err))
+			return
+		}
+	}
+}
+
+// handleJogMessage acts on a message from a jog client. It returns the jog that is running afterward, and the status to
+// reply with, which has no type if there is nothing to reply.
+func (api *OpenBarAPI) handleJogMessage(ctx context.Context, current *jog, msg wire.JogMessage) (*jog, wire.JogStatus) {
+	switch msg.Type {
+	case wire.JogStart:
+		if current != nil {
+			return current, wire.JogStatus{Type: wire.JogError, Pump: msg.Pump, Error: fmt.Sprintf("pump %d is already being jogged", current.idx)}
+		}
+
+		j, err := api.startJog(ctx, msg)
+		if err != nil {
+			return nil, wire.JogStatus{Type: wire.JogError, Pump: msg.Pump, Error: err.Error()}
+		}
+
+		return j, j.status(wire.JogStarted, 0)
+	case wire.JogHeartbeat:
+		// if the lease has already ended the jog is stopped when its done channel is read
+		if current != nil {
+			current.lease.Extend(current.timeout)
+		}
+
+		return current, wire.JogStatus{}
+	case wire.JogStop:
+		if current == nil {
+			return nil, wire.JogStatus{}
+		}
+
+		reason := "released"
+		status := current.status(wire.JogStopped, api.endJog(current, reason))
+		status.Reason = reason
+		return nil, status
+	default:
+		return current, wire.JogStatus{Type: wire.JogError, Error: fmt.Sprintf("unknown jog message type '%s'", msg.Type)}
+	}
+}
+
+// startJog leases the pump for a jog and turns it on
+func (api *OpenBarAPI) startJog(ctx context.Context, msg wire.JogMessage) (*jog, error) {
+	if msg.Pump < 0 || msg.Pump >= api.hw.NumPumps() {
+		return nil, fmt.Errorf("invalid pump %d", msg.Pump)
+	}
+
+	timeout := defaultJogHeartbeatTimeout
+	if msg.HeartbeatTimeoutMs != 0 {
+		timeout = time.Duration(msg.HeartbeatTimeoutMs) * time.Millisecond
+		if timeout < 0 || timeout > maxJogHeartbeatTimeout {
+			return nil, fmt.Errorf("heartbeat timeout must be between 0 and %s", maxJogHeartbeatTimeout)
+		}
+	}
+
+	direction := hardware.Forward
+	if !msg.Forward {
+		direction = hardware.Backward
+	}
+
+	if err := api.checkEStop(); err != nil {
+		return nil, err
+	}
+
+	times := make([]time.Duration, api.hw.NumPumps())
+	times[msg.Pump] = timeout
+	if err := hardware.CheckPumps(api.hw, times); err != nil {
+		return nil, err
+	}
+
+	var mlPerSec, tubeMl float64
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		pump, err := openbardb.GetPump(ctx, tx, msg.Pump)
+		if errors.Is(err, dbr.ErrNotFound) {
+			// an uncalibrated pump has no flow rate, so no volume is reported
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		mlPerSec = pump.MlPerSec
+		tubeMl = pump.TubeVolumeMl
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lease, err := api.ctrl.Acquire(hardware.RequesterManual, []int{msg.Pump}, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := api.setPumpDirection(msg.Pump, direction); err != nil {
+		lease.Release()
+		return nil, err
+	}
+
+	runtime := api.hw.TimeRun(msg.Pump)
+	if err := lease.Pump(msg.Pump, direction); err != nil {
+		lease.Release()
+		return nil, err
+	}
+
+	j := &jog{
+		lease:     lease,
+		idx:       msg.Pump,
+		direction: direction,
+		timeout:   timeout,
+		mlPerSec:  mlPerSec,
+		tubeMl:    tubeMl,
+		runtime:   runtime,
+		start:     time.Now(),
+	}
+
+	api.mu.Lock()
+	api.jogs[lease] = struct{}{}
+	api.mu.Unlock()
+
+	api.Logger().Info("Jog started", zap.Int("pump", j.idx), zap.String("direction", direction.String()))
+	return j, nil
+}
+
+// endJog releases the lease of a jog, turning its pump off, and returns how long the pump ran. The bottle of a pump
+// jogged backward is credited with the fluid returned to it. A pump following the reverse pin ran forward if a run of
+// other pumps switched the pin back during the jog, in which case the jog is counted as forward.
+func (api *OpenBarAPI) endJog(j *jog, reason string) time.Duration {
+	reversed := hardware.HasPumpDirection(api.hw, j.idx) || api.hw.GetReversePin().Direction() == hardware.Backward
+	j.lease.Release()
+	ran := api.hw.TimeRun(j.idx) - j.runtime
+
+	api.mu.Lock()
+	delete(api.jogs, j.lease)
+	api.mu.Unlock()
+
+	if j.direction == hardware.Backward {
+		if reversed {
+			api.creditBottle(j.idx, ran, j.returnedMl(ran))
+		} else {
+			api.Logger().Info("Jog ran forward as the reverse pin was switched", zap.Int("pump", j.idx))
+			j.direction = hardware.Forward
+		}
+	}
+
+	api.Logger().Info("Jog stopped", zap.Int("pump", j.idx), zap.Duration("ran", ran), zap.String("reason", reason))
+	return ran
+}
+
+// stopJogs releases the leases of every running jog
+func (api *OpenBarAPI) stopJogs() {
+	api.mu.Lock()
+	leases := make([]*hardware.Lease, 0, len(api.jogs))
+	for lease := range api.jogs {
+		leases = append(leases, lease)
+	}
+	api.mu.Unlock()
+
+	for _, lease := range leases {
+		lease.Release()
+	}
+}
+
+// jogStopReason returns why a jog whose lease ended with err was stopped by something other than its client
+func (api *OpenBarAPI) jogStopReason(err error) string {
+	if evt, latched := api.estop.Latched(); latched {
+		return fmt.Sprintf("e-stop triggered by %s", evt.Source)
+	}
+
+	switch {
+	case errors.Is(err, hardware.ErrLeaseExpired):
+		return "heartbeat missed"
+	case errors.Is(err, hardware.ErrLeaseReleased):
+		return "cancelled"
+	default:
+		return err.Error()
+	}
+}
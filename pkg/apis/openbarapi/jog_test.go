@@ -0,0 +1,149 @@
+package openbarapi
+
+import (
+	"context"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"github.com/gocraft/dbr/v2"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+// readJogStatus reads statuses from a jog connection until one that isn't progress arrives
+func (s *testSuite) readJogStatus(conn *websocket.Conn) wire.JogStatus {
+	for {
+		s.Require().NoError(conn.SetReadDeadline(time.Now().Add(2 * time.Second)))
+
+		var status wire.JogStatus
+		s.Require().NoError(conn.ReadJSON(&status))
+		if status.Type != wire.JogProgress {
+			return status
+		}
+	}
+}
+
+func (s *testSuite) TestJog() {
+	ctx := context.Background()
+	s.setupPumpsAndFluids(ctx, []openbardb.Fluid{{Idx: 0, Fluid: util.Ptr("gin")}}, pumpsOfSpeed(10, 8))
+
+	srv := httptest.NewServer(http.HandlerFunc(s.Api.Handle))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/jog", nil)
+	s.Require().NoError(err)
+	defer conn.Close()
+
+	thw := s.testHardware()
+	start := thw.TimeRun(1)
+
+	// the pump runs while heartbeats arrive and stops when released
+	s.Require().NoError(conn.WriteJSON(wire.JogMessage{Type: wire.JogStart, Pump: 1, Forward: true, HeartbeatTimeoutMs: 100}))
+	status := s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStarted, status.Type, status.Error)
+	s.Require().Equal(1, status.Pump)
+
+	for i := 0; i < 6; i++ {
+		time.Sleep(50 * time.Millisecond)
+		s.Require().NoError(conn.WriteJSON(wire.JogMessage{Type: wire.JogHeartbeat}))
+	}
+
+	s.Require().NoError(conn.WriteJSON(wire.JogMessage{Type: wire.JogStop}))
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStopped, status.Type)
+	s.Require().Equal("released", status.Reason)
+	s.Require().InDelta(300, status.ElapsedMs, 50)
+	s.Require().InDelta(300*time.Millisecond, thw.TimeRun(1)-start, float64(50*time.Millisecond))
+	s.Require().InDelta((thw.TimeRun(1)-start).Seconds()*10, status.DispensedMl, 0.01)
+
+	// a missed heartbeat stops the pump, and fluid jogged backward is returned to the bottle, up to the volume of its tube
+	s.setPumpTube(2, 0.2)
+	err = s.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.ReplaceBottle(ctx, tx, 2, 750, util.Ptr(500.0), time.Now())
+		s.Require().NoError(err)
+		return tx.Commit()
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(s.Api.SyncPumpUsage(ctx))
+
+	s.Require().NoError(conn.WriteJSON(wire.JogMessage{Type: wire.JogStart, Pump: 2, HeartbeatTimeoutMs: 50}))
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStarted, status.Type, status.Error)
+	s.Require().Equal(hardware.Backward.String(), status.Direction)
+
+	// the pump has no direction control, so it follows the reverse pin
+	s.Require().Equal(1, thw.GetReversePin().Value())
+
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStopped, status.Type)
+	s.Require().Equal("heartbeat missed", status.Reason)
+	s.Require().Equal(-0.2, status.DispensedMl)
+
+	bottleRemaining := func() float64 {
+		s.Require().NoError(s.Api.SyncPumpUsage(ctx))
+
+		var remaining float64
+		err := s.Transaction(ctx, func(tx *dbr.Tx) error {
+			bottle, err := openbardb.GetBottle(ctx, tx, 2)
+			s.Require().NoError(err)
+			remaining = bottle.RemainingMl
+			return nil
+		})
+		s.Require().NoError(err)
+		return remaining
+	}
+	s.Require().InDelta(500.2, bottleRemaining(), 0.01)
+
+	// a backward jog whose pump follows the reverse pin runs forward if the pin is switched back, so nothing is returned
+	s.Require().NoError(conn.WriteJSON(wire.JogMessage{Type: wire.JogStart, Pump: 2, HeartbeatTimeoutMs: 50}))
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStarted, status.Type, status.Error)
+	s.Require().NoError(thw.GetReversePin().SetDirection(hardware.Forward))
+
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStopped, status.Type)
+	s.Require().Equal(hardware.Forward.String(), status.Direction)
+	s.Require().Greater(status.DispensedMl, 0.0)
+	s.Require().InDelta(500.2-status.DispensedMl, bottleRemaining(), 0.01)
+
+	// pumps leased to pours can't be jogged
+	lease, err := s.Api.ctrl.Acquire(hardware.RequesterPour, []int{3}, time.Second)
+	s.Require().NoError(err)
+	s.Require().NoError(conn.WriteJSON(wire.JogMessage{Type: wire.JogStart, Pump: 3, Forward: true}))
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogError, status.Type)
+	lease.Release()
+
+	// the e-stop stops jogs
+	s.Require().NoError(conn.WriteJSON(wire.JogMessage{Type: wire.JogStart, Pump: 3, Forward: true}))
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStarted, status.Type, status.Error)
+	s.Require().Equal(0, thw.GetReversePin().Value())
+
+	s.Api.estop.Trigger("test", "testing jog")
+	defer s.Api.estop.Reset()
+
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStopped, status.Type)
+	s.Require().Equal("e-stop triggered by test", status.Reason)
+
+	// closing the connection stops the pump
+	s.Require().NoError(s.Api.estop.Reset())
+	s.Require().NoError(conn.WriteJSON(wire.JogMessage{Type: wire.JogStart, Pump: 4, Forward: true, HeartbeatTimeoutMs: 5000}))
+	status = s.readJogStatus(conn)
+	s.Require().Equal(wire.JogStarted, status.Type, status.Error)
+	s.Require().NoError(conn.Close())
+
+	s.Require().Eventually(func() bool {
+		s.Api.mu.Lock()
+		defer s.Api.mu.Unlock()
+		return len(s.Api.jogs) == 0
+	}, time.Second, 10*time.Millisecond)
+	lease, err = s.Api.ctrl.Acquire(hardware.RequesterPour, []int{4}, time.Second)
+	s.Require().NoError(err)
+	lease.Release()
+}
@@ -0,0 +1,547 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/events"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// purgeVolumeFactor is how much more than a pump's tube volume is run backward when purging, so that the tube is
+	// emptied even if the flow rate backward is lower than forward
+	purgeVolumeFactor = 1.5
+	// maxRinseCycles is the most cycles a rinse can run
+	maxRinseCycles = 20
+	// minMaintenanceInterval is the shortest interval a maintenance program can be scheduled to repeat at
+	minMaintenanceInterval = time.Minute
+)
+
+// errMaintenanceRunning is returned when a maintenance program is started while another is running
+var errMaintenanceRunning = fmt.Errorf("a maintenance program is already running: %w", apis.ErrConflict)
+
+// maintenancePlan is how a maintenance program runs its pumps
+type maintenancePlan struct {
+	program   string
+	pumps     []int
+	direction hardware.PumpState
+	steps     []hardware.PourStep
+	byIdx     map[int]openbardb.Pump
+}
+
+// bottleCredit returns how running pump idx for ran is credited to its bottle, and false if it isn't. Priming draws
+// fluid from the bottle into the tube so it isn't credited, rinsing runs water rather than the bottle's fluid, and
+// purging returns the fluid in the tube to the bottle.
+func (p maintenancePlan) bottleCredit(idx int, ran time.Duration) (bottleCredit, bool) {
+	switch p.program {
+	case wire.MaintenanceRinse:
+		return bottleCredit{runtime: ran}, true
+	case wire.MaintenancePurge:
+		pump := p.byIdx[idx]
+		return bottleCredit{runtime: ran, returnedMl: min(ran.Seconds()*pump.MlPerSec, pump.TubeVolumeMl)}, true
+	default:
+		return bottleCredit{}, false
+	}
+}
+
+// MaintenanceHandler handles requests to /maintenance which return the status of the running maintenance program, or
+// the last one to run.
+func (api *OpenBarAPI) MaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		api.Respond(w, r, api.maintenanceStatus(), nil)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+// MaintenanceCancelHandler handles requests to /maintenance/cancel which cancel the running maintenance program
+func (api *OpenBarAPI) MaintenanceCancelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		api.mu.Lock()
+		cancel := api.cancelMaintenance
+		api.mu.Unlock()
+
+		if cancel != nil {
+			cancel()
+		}
+
+		api.Respond(w, r, api.maintenanceStatus(), nil)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+// MaintenanceProgramHandler handles requests to /maintenance/{program}. A POST starts the program with the
+// wire.MaintenanceRequest in the body, and returns once it has started. Its progress is published as pour events, and
+// returned by /maintenance. Maintenance programs lease their pumps for cleaning, which stops any pours using them.
+func (api *OpenBarAPI) MaintenanceProgramHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodPost:
+		api.runMaintenanceProgram(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) runMaintenanceProgram(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	tokens := apis.GetPathTokens(r)
+	if len(tokens) != 2 {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	var req wire.MaintenanceRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	status, _, err := api.startMaintenance(ctx, tokens[1], req, hardware.RequesterCleaning)
+	api.Respond(w, r, status, err)
+}
+
+// MaintenanceSchedulesHandler handles requests to /maintenance/schedules. GET returns every schedule, and POST adds a
+// wire.MaintenanceSchedule.
+func (api *OpenBarAPI) MaintenanceSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getMaintenanceSchedules(ctx, w, r)
+	case http.MethodPost:
+		api.createMaintenanceSchedule(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+// MaintenanceScheduleHandler handles requests to /maintenance/schedules/{id}. DELETE removes the schedule.
+func (api *OpenBarAPI) MaintenanceScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodDelete:
+		api.deleteMaintenanceSchedule(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodDelete}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getMaintenanceSchedules(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	resp := []wire.MaintenanceSchedule{}
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		scheds, err := openbardb.ListMaintenanceSchedules(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		for _, sched := range scheds {
+			wireSched := wire.MaintenanceSchedule{
+				Id:          sched.Id,
+				Program:     sched.Program,
+				NextRunAt:   sched.NextRunAt,
+				IntervalSec: sched.IntervalSec,
+			}
+
+			err = json.Unmarshal([]byte(sched.Params), &wireSched.Params)
+			if err != nil {
+				return fmt.Errorf("invalid params for maintenance schedule '%s': %w", sched.Id, err)
+			}
+
+			resp = append(resp, wireSched)
+		}
+
+		return nil
+	})
+
+	api.Respond(w, r, resp, err)
+}
+
+func (api *OpenBarAPI) createMaintenanceSchedule(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var req wire.MaintenanceSchedule
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	if req.Id != "" {
+		api.Respond(w, r, nil, fmt.Errorf("schedule id is set by the server: %w", apis.ErrBadRequest))
+		return
+	} else if req.NextRunAt.IsZero() {
+		api.Respond(w, r, nil, fmt.Errorf("next_run_at is required: %w", apis.ErrBadRequest))
+		return
+	} else if interval := time.Duration(req.IntervalSec) * time.Second; interval < 0 || (interval > 0 && interval < minMaintenanceInterval) {
+		api.Respond(w, r, nil, fmt.Errorf("interval must be 0 or at least %s: %w", minMaintenanceInterval, apis.ErrBadRequest))
+		return
+	}
+
+	if err := validateMaintenanceRequest(req.Program, req.Params); err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	params, err := json.Marshal(req.Params)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		sched := &openbardb.MaintenanceSchedule{
+			Program:     req.Program,
+			Params:      string(params),
+			NextRunAt:   req.NextRunAt,
+			IntervalSec: req.IntervalSec,
+		}
+
+		err := openbardb.CreateMaintenanceSchedule(ctx, tx, sched)
+		if err != nil {
+			return err
+		}
+
+		req.Id = sched.Id
+		req.NextRunAt = sched.NextRunAt
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, req, err)
+}
+
+func (api *OpenBarAPI) deleteMaintenanceSchedule(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	tokens := apis.GetPathTokens(r)
+	if len(tokens) != 3 {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.DeleteMaintenanceSchedule(ctx, tx, tokens[2])
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
+
+// RunMaintenanceSchedules starts scheduled maintenance programs as they come due, checking every interval until the
+// context is cancelled. Due programs run one at a time, and wait while another maintenance program is running or their
+// pumps are in use by pours.
+func (api *OpenBarAPI) RunMaintenanceSchedules(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		err := api.runDueMaintenance(ctx, time.Now())
+		if err != nil {
+			api.Logger().Info("Error running scheduled maintenance", zap.Error(err))
+		}
+	}
+}
+
+// runDueMaintenance runs the maintenance programs that are due at now, waiting for each to finish
+func (api *OpenBarAPI) runDueMaintenance(ctx context.Context, now time.Time) error {
+	var due []openbardb.MaintenanceSchedule
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		due, err = openbardb.DueMaintenanceSchedules(ctx, tx, now)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, sched := range due {
+		var req wire.MaintenanceRequest
+		var done <-chan struct{}
+		err = json.Unmarshal([]byte(sched.Params), &req)
+		if err == nil {
+			// scheduled programs lease their pumps as pours, so that they don't stop pours which are running
+			_, done, err = api.startMaintenance(ctx, sched.Program, req, hardware.RequesterPour)
+		}
+
+		if errors.Is(err, errMaintenanceRunning) || errors.Is(err, hardware.ErrPumpBusy) {
+			// the schedule stays due, and runs once the running program or pour finishes
+			return nil
+		} else if err != nil {
+			api.Logger().Info("Error starting scheduled maintenance", zap.String("id", sched.Id),
+				zap.String("program", sched.Program), zap.Error(err))
+		}
+
+		err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+			err := openbardb.AdvanceMaintenanceSchedule(ctx, tx, sched, now)
+			if err != nil {
+				return err
+			}
+
+			return tx.Commit()
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if done != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-done:
+			}
+		}
+	}
+
+	return nil
+}
+
+// startMaintenance starts a maintenance program running in the background with its pumps leased to requester. It
+// returns the program's status, and a channel which is closed when it finishes.
+func (api *OpenBarAPI) startMaintenance(ctx context.Context, program string, req wire.MaintenanceRequest, requester hardware.Requester) (wire.MaintenanceStatus, <-chan struct{}, error) {
+	if err := validateMaintenanceRequest(program, req); err != nil {
+		return wire.MaintenanceStatus{}, nil, err
+	}
+
+	if err := api.checkEStop(); err != nil {
+		return wire.MaintenanceStatus{}, nil, err
+	}
+
+	plan, err := api.planMaintenance(ctx, program, req)
+	if err != nil {
+		return wire.MaintenanceStatus{}, nil, err
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	start := time.Now().UTC()
+	status := wire.MaintenanceStatus{
+		Running:   true,
+		Program:   program,
+		Pumps:     plan.pumps,
+		StartedAt: &start,
+		TotalMs:   hardware.StepsDuration(api.hw, plan.steps).Milliseconds(),
+	}
+
+	api.mu.Lock()
+	if api.maintenance.Running {
+		api.mu.Unlock()
+		cancel()
+		return wire.MaintenanceStatus{}, nil, errMaintenanceRunning
+	}
+
+	// the pumps are leased before the program is reported as running, so a program that can't lease them never starts
+	lease, err := api.leaseSteps(requester, plan.steps)
+	if err != nil {
+		api.mu.Unlock()
+		cancel()
+		return wire.MaintenanceStatus{}, nil, err
+	}
+
+	api.maintenance = status
+	api.cancelMaintenance = cancel
+	api.mu.Unlock()
+
+	api.Logger().Info("Maintenance started", zap.String("program", program), zap.Ints("pumps", plan.pumps))
+	api.events.Publish(events.Maintenance, status)
+
+	go func() {
+		defer close(done)
+		api.runMaintenance(runCtx, cancel, plan, lease)
+	}()
+
+	return status, done, nil
+}
+
+func (api *OpenBarAPI) runMaintenance(ctx context.Context, cancel context.CancelFunc, plan maintenancePlan, lease *hardware.Lease) {
+	ran, err := api.runLeaseSteps(ctx, lease, plan.direction, plan.steps, hardware.RunOptions{})
+	cancel()
+
+	for _, idx := range plan.pumps {
+		if idx >= len(ran) {
+			continue
+		}
+
+		if credit, ok := plan.bottleCredit(idx, ran[idx]); ok {
+			api.creditBottle(idx, credit.runtime, credit.returnedMl)
+		}
+	}
+
+	syncErr := api.SyncPumpUsage(context.Background())
+	if syncErr != nil {
+		api.Logger().Info("Error syncing pump usage", zap.Error(syncErr))
+	}
+
+	finished := time.Now().UTC()
+	api.mu.Lock()
+	status := api.maintenance
+	status.Running = false
+	status.FinishedAt = &finished
+	status.ElapsedMs = finished.Sub(*status.StartedAt).Milliseconds()
+	status.Cancelled = errors.Is(err, context.Canceled)
+	if err == nil {
+		status.Progress = 1
+	} else if !status.Cancelled {
+		status.Error = err.Error()
+	}
+
+	api.maintenance = status
+	api.cancelMaintenance = nil
+	api.mu.Unlock()
+
+	api.Logger().Info("Maintenance finished", zap.String("program", status.Program), zap.Bool("cancelled", status.Cancelled),
+		zap.Error(err))
+	api.events.Publish(events.Maintenance, status)
+}
+
+// maintenanceStatus returns the status of the running maintenance program, or the last one to run
+func (api *OpenBarAPI) maintenanceStatus() wire.MaintenanceStatus {
+	api.mu.Lock()
+	status := api.maintenance
+	api.mu.Unlock()
+
+	if status.Running {
+		elapsed := time.Since(*status.StartedAt)
+		status.ElapsedMs = min(elapsed.Milliseconds(), status.TotalMs)
+		status.Progress = 1
+		if status.TotalMs > 0 {
+			status.Progress = float64(status.ElapsedMs) / float64(status.TotalMs)
+		}
+	}
+
+	return status
+}
+
+// validateMaintenanceRequest checks the parameters of a maintenance program, without checking its pumps
+func validateMaintenanceRequest(program string, req wire.MaintenanceRequest) error {
+	switch program {
+	case wire.MaintenancePrime, wire.MaintenancePurge:
+		if req.Cycles != 0 || req.VolumeMl != 0 || req.PauseMs != 0 {
+			return fmt.Errorf("cycles, volume_ml and pause_ms only apply to %s: %w", wire.MaintenanceRinse, apis.ErrBadRequest)
+		}
+	case wire.MaintenanceRinse:
+		if req.Cycles < 0 || req.Cycles > maxRinseCycles {
+			return fmt.Errorf("cycles must be between 0 and %d: %w", maxRinseCycles, apis.ErrBadRequest)
+		} else if req.VolumeMl < 0 || req.PauseMs < 0 {
+			return fmt.Errorf("volume_ml and pause_ms must not be negative: %w", apis.ErrBadRequest)
+		}
+	default:
+		return fmt.Errorf("unknown maintenance program '%s': %w", program, apis.ErrNotFound)
+	}
+
+	return nil
+}
+
+// planMaintenance returns how a maintenance program runs each of its pumps. Every pump needs a flow rate, and a tube
+// volume unless it's rinsed with a given volume.
+func (api *OpenBarAPI) planMaintenance(ctx context.Context, program string, req wire.MaintenanceRequest) (maintenancePlan, error) {
+	var pumps []openbardb.Pump
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		pumps, err = openbardb.ListPumps(ctx, tx)
+		return err
+	})
+
+	if err != nil {
+		return maintenancePlan{}, err
+	}
+
+	byIdx := make(map[int]openbardb.Pump)
+	for _, pump := range pumps {
+		byIdx[pump.Idx] = pump
+	}
+
+	volume := func(pump openbardb.Pump) float64 {
+		switch {
+		case program == wire.MaintenancePurge:
+			return pump.TubeVolumeMl * purgeVolumeFactor
+		case program == wire.MaintenanceRinse && req.VolumeMl > 0:
+			return req.VolumeMl
+		default:
+			return pump.TubeVolumeMl
+		}
+	}
+
+	times := make([]time.Duration, api.hw.NumPumps())
+	plan := maintenancePlan{program: program, direction: hardware.Forward, byIdx: byIdx}
+	if program == wire.MaintenancePurge {
+		plan.direction = hardware.Backward
+	}
+
+	if len(req.Pumps) == 0 {
+		for idx := range times {
+			pump, ok := byIdx[idx]
+			if ok && pump.MlPerSec > 0 && volume(pump) > 0 {
+				plan.pumps = append(plan.pumps, idx)
+				times[idx] = secondsToDuration(volume(pump) / pump.MlPerSec)
+			}
+		}
+
+		if len(plan.pumps) == 0 {
+			return maintenancePlan{}, fmt.Errorf("no pumps have a flow rate and tube volume to %s: %w", program, apis.ErrBadRequest)
+		}
+	} else {
+		for _, idx := range req.Pumps {
+			if idx < 0 || idx >= len(times) {
+				return maintenancePlan{}, fmt.Errorf("invalid pump %d: %w", idx, apis.ErrBadRequest)
+			} else if times[idx] > 0 {
+				return maintenancePlan{}, fmt.Errorf("pump %d is listed more than once: %w", idx, apis.ErrBadRequest)
+			}
+
+			pump := byIdx[idx]
+			if pump.MlPerSec <= 0 {
+				return maintenancePlan{}, fmt.Errorf("pump %d has not been calibrated: %w", idx, apis.ErrBadRequest)
+			} else if volume(pump) <= 0 {
+				return maintenancePlan{}, fmt.Errorf("pump %d has no tube volume: %w", idx, apis.ErrBadRequest)
+			}
+
+			plan.pumps = append(plan.pumps, idx)
+			times[idx] = secondsToDuration(volume(pump) / pump.MlPerSec)
+		}
+	}
+
+	cycles := 1
+	if program == wire.MaintenanceRinse && req.Cycles > 0 {
+		cycles = req.Cycles
+	}
+
+	for i := 0; i < cycles; i++ {
+		step := hardware.PourStep{Times: times}
+		if i > 0 {
+			step.Delay = time.Duration(req.PauseMs) * time.Millisecond
+		}
+
+		plan.steps = append(plan.steps, step)
+	}
+
+	return plan, nil
+}
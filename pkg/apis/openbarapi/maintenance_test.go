@@ -0,0 +1,211 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (s *testSuite) setPumpTube(idx int, volumeMl float64) {
+	respWr := s.handle(http.MethodPatch, "/pumps/"+strconv.Itoa(idx)+"/tube", wire.PumpTube{TubeVolumeMl: volumeMl})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+}
+
+// startMaintenance starts a maintenance program and returns its status once it starts
+func (s *testSuite) startMaintenance(program string, params wire.MaintenanceRequest) wire.MaintenanceStatus {
+	respWr := s.handle(http.MethodPost, "/maintenance/"+program, params)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode(), string(respWr.Body()))
+
+	var status wire.MaintenanceStatus
+	err := json.Unmarshal(respWr.Body(), &status)
+	s.Require().NoError(err)
+	s.Require().True(status.Running)
+	return status
+}
+
+// waitForMaintenance waits for the running maintenance program to finish and returns its status
+func (s *testSuite) waitForMaintenance() wire.MaintenanceStatus {
+	var status wire.MaintenanceStatus
+	s.Require().Eventually(func() bool {
+		respWr := s.handle(http.MethodGet, "/maintenance", nil)
+		s.Require().Equal(http.StatusOK, respWr.StatusCode())
+		s.Require().NoError(json.Unmarshal(respWr.Body(), &status))
+		return !status.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return status
+}
+
+func (s *testSuite) TestMaintenancePrograms() {
+	ctx := context.Background()
+	s.setupPumpsAndFluids(ctx, []openbardb.Fluid{
+		{Idx: 0, Fluid: util.Ptr("gin")},
+		{Idx: 1, Fluid: util.Ptr("vodka")},
+	}, pumpsOfSpeed(100, 8))
+
+	thw := s.testHardware()
+
+	// no pumps have tube volumes
+	s.Require().Equal(http.StatusBadRequest, s.postStatus("/maintenance/prime", wire.MaintenanceRequest{}))
+
+	s.setPumpTube(0, 5)
+	s.setPumpTube(1, 10)
+
+	bottleRemaining := func(idx int) float64 {
+		var remaining float64
+		err := s.Transaction(ctx, func(tx *dbr.Tx) error {
+			bottle, err := openbardb.GetBottle(ctx, tx, idx)
+			s.Require().NoError(err)
+			remaining = bottle.RemainingMl
+			return nil
+		})
+		s.Require().NoError(err)
+		return remaining
+	}
+
+	err := s.Transaction(ctx, func(tx *dbr.Tx) error {
+		for _, idx := range []int{0, 1} {
+			err := openbardb.ReplaceBottle(ctx, tx, idx, 750, util.Ptr(500.0), time.Now())
+			s.Require().NoError(err)
+		}
+
+		return tx.Commit()
+	})
+	s.Require().NoError(err)
+
+	respWr := s.handle(http.MethodGet, "/pumps/1/tube", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	s.Require().JSONEq(`{"idx": 1, "tube_volume_ml": 10}`, string(respWr.Body()))
+
+	// priming fills the tube of every pump with a tube volume
+	status := s.startMaintenance(wire.MaintenancePrime, wire.MaintenanceRequest{})
+	s.Require().Equal([]int{0, 1}, status.Pumps)
+	s.Require().Equal(int64(100), status.TotalMs)
+
+	status = s.waitForMaintenance()
+	s.Require().Equal(wire.MaintenancePrime, status.Program)
+	s.Require().Empty(status.Error)
+	s.Require().Equal(1.0, status.Progress)
+	s.Require().InDelta(50*time.Millisecond, thw.TimeRun(0), float64(20*time.Millisecond))
+	s.Require().InDelta(100*time.Millisecond, thw.TimeRun(1), float64(20*time.Millisecond))
+	s.Require().InDelta(495.0, bottleRemaining(0), 2)
+	s.Require().InDelta(490.0, bottleRemaining(1), 2)
+
+	// purging runs backward, which still counts as pump usage, and returns the fluid in the tube to the bottle
+	status = s.startMaintenance(wire.MaintenancePurge, wire.MaintenanceRequest{Pumps: []int{1}})
+	s.Require().Equal(int64(150), status.TotalMs)
+	status = s.waitForMaintenance()
+	s.Require().Empty(status.Error)
+	s.Require().GreaterOrEqual(status.ElapsedMs, int64(150))
+	s.Require().Less(status.ElapsedMs, int64(300))
+	s.Require().InDelta(250*time.Millisecond, thw.TimeRun(1), float64(30*time.Millisecond))
+	s.Require().InDelta(500.0, bottleRemaining(1), 2)
+
+	// rinsing runs the volume through each pump once per cycle
+	status = s.startMaintenance(wire.MaintenanceRinse, wire.MaintenanceRequest{Pumps: []int{0}, Cycles: 3, VolumeMl: 2, PauseMs: 20})
+	s.Require().Equal(int64(100), status.TotalMs)
+	status = s.waitForMaintenance()
+	s.Require().Empty(status.Error)
+	s.Require().InDelta(110*time.Millisecond, thw.TimeRun(0), float64(30*time.Millisecond))
+	s.Require().InDelta(495.0, bottleRemaining(0), 2)
+
+	s.Require().Equal(http.StatusNotFound, s.postStatus("/maintenance/flush", wire.MaintenanceRequest{}))
+	s.Require().Equal(http.StatusBadRequest, s.postStatus("/maintenance/prime", wire.MaintenanceRequest{Cycles: 2}))
+	s.Require().Equal(http.StatusBadRequest, s.postStatus("/maintenance/prime", wire.MaintenanceRequest{Pumps: []int{2}}))
+	s.Require().Equal(http.StatusBadRequest, s.postStatus("/maintenance/rinse", wire.MaintenanceRequest{Cycles: maxRinseCycles + 1}))
+
+	// only one program runs at a time, and it can be cancelled
+	s.startMaintenance(wire.MaintenanceRinse, wire.MaintenanceRequest{Pumps: []int{0}, VolumeMl: 500})
+	s.Require().Equal(http.StatusConflict, s.postStatus("/maintenance/purge", wire.MaintenanceRequest{}))
+	s.Require().Equal(http.StatusOK, s.postStatus("/maintenance/cancel", nil))
+
+	status = s.waitForMaintenance()
+	s.Require().True(status.Cancelled)
+	s.Require().Empty(status.Error)
+	s.Require().Less(status.ElapsedMs, int64(1000))
+}
+
+func (s *testSuite) TestMaintenanceSchedules() {
+	ctx := context.Background()
+	s.setupPumpsAndFluids(ctx, []openbardb.Fluid{{Idx: 0, Fluid: util.Ptr("gin")}}, pumpsOfSpeed(100, 8))
+	s.setPumpTube(0, 5)
+
+	getSchedules := func() []wire.MaintenanceSchedule {
+		respWr := s.handle(http.MethodGet, "/maintenance/schedules", nil)
+		s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+		var scheds []wire.MaintenanceSchedule
+		s.Require().NoError(json.Unmarshal(respWr.Body(), &scheds))
+		return scheds
+	}
+
+	s.Require().Empty(getSchedules())
+
+	now := time.Now().UTC().Truncate(time.Second)
+	once := wire.MaintenanceSchedule{Program: wire.MaintenancePrime, NextRunAt: now.Add(-time.Minute)}
+	hourly := wire.MaintenanceSchedule{
+		Program:     wire.MaintenanceRinse,
+		Params:      wire.MaintenanceRequest{Pumps: []int{0}, Cycles: 2},
+		NextRunAt:   now.Add(30 * time.Minute),
+		IntervalSec: 60 * 60,
+	}
+	s.Require().Equal(http.StatusOK, s.postStatus("/maintenance/schedules", once))
+	s.Require().Equal(http.StatusOK, s.postStatus("/maintenance/schedules", hourly))
+
+	s.Require().Equal(http.StatusNotFound, s.postStatus("/maintenance/schedules", wire.MaintenanceSchedule{Program: "flush", NextRunAt: now}))
+	s.Require().Equal(http.StatusBadRequest, s.postStatus("/maintenance/schedules", wire.MaintenanceSchedule{Program: wire.MaintenancePrime}))
+	s.Require().Equal(http.StatusBadRequest, s.postStatus("/maintenance/schedules", wire.MaintenanceSchedule{Program: wire.MaintenancePrime, NextRunAt: now, IntervalSec: 1}))
+
+	scheds := getSchedules()
+	s.Require().Len(scheds, 2)
+	s.Require().Equal(wire.MaintenancePrime, scheds[0].Program)
+	s.Require().Equal(hourly.Params, scheds[1].Params)
+
+	// due programs run and are removed if they don't repeat
+	err := s.Api.runDueMaintenance(ctx, now)
+	s.Require().NoError(err)
+
+	status := s.waitForMaintenance()
+	s.Require().Equal(wire.MaintenancePrime, status.Program)
+	s.Require().Empty(status.Error)
+
+	scheds = getSchedules()
+	s.Require().Len(scheds, 1)
+	s.Require().Equal(wire.MaintenanceRinse, scheds[0].Program)
+
+	// programs don't preempt pours of their pumps, and stay due until the pumps are free
+	lease, err := s.Api.ctrl.Acquire(hardware.RequesterPour, []int{0}, time.Second)
+	s.Require().NoError(err)
+	err = s.Api.runDueMaintenance(ctx, now.Add(45*time.Minute))
+	s.Require().NoError(err)
+	s.Require().NoError(lease.Err())
+	s.Require().False(s.Api.maintenanceStatus().Running)
+	s.Require().True(now.Add(30 * time.Minute).Equal(getSchedules()[0].NextRunAt))
+	lease.Release()
+
+	// repeating programs move to their next run
+	err = s.Api.runDueMaintenance(ctx, now.Add(45*time.Minute))
+	s.Require().NoError(err)
+
+	status = s.waitForMaintenance()
+	s.Require().Equal(wire.MaintenanceRinse, status.Program)
+	s.Require().Empty(status.Error)
+
+	scheds = getSchedules()
+	s.Require().Len(scheds, 1)
+	s.Require().True(now.Add(90*time.Minute).Equal(scheds[0].NextRunAt), scheds[0].NextRunAt.String())
+
+	respWr := s.handle(http.MethodDelete, "/maintenance/schedules/"+scheds[0].Id, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodDelete, "/maintenance/schedules/"+scheds[0].Id, nil)
+	s.Require().Equal(http.StatusNotFound, respWr.StatusCode())
+	s.Require().Empty(getSchedules())
+}
@@ -1,14 +1,21 @@
 package openbarapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/cocktailrobots/openbar-server/pkg/apis"
 	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
 	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/events"
 	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
 	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 )
 
@@ -25,106 +32,411 @@ func (api *OpenBarAPI) MakeHandler(w http.ResponseWriter, r *http.Request) {
 
 	var req wire.MakeRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	resp, err := api.makeDrink(ctx, req)
+	api.Respond(w, r, resp, err)
+}
+
+// makeDrink pours the requested fluids. The pour is cancelled if ctx is cancelled or CancelPours is called, in which
+// case the response is marked as cancelled and no error is returned. Any other error is published as an error event.
+// Every attempt is recorded in the pour history.
+func (api *OpenBarAPI) makeDrink(ctx context.Context, req wire.MakeRequest) (*wire.MakeResponse, error) {
+	pour := &openbardb.Pour{
+		PouredAt: time.Now(),
+		RecipeId: req.RecipeId,
+		Outcome:  openbardb.PourCompleted,
+		Fluids:   make([]openbardb.PourFluid, len(req.FluidVolumes)),
+	}
+	for i, fv := range req.FluidVolumes {
+		pour.Fluids[i] = openbardb.PourFluid{Fluid: fv.Fluid, RequestedMl: float64(fv.VolumeMl)}
+	}
+
+	resp, err := api.pourDrink(ctx, req, pour)
+	if err != nil {
+		pour.Outcome = openbardb.PourFailed
+		pour.Error = util.Ptr(err.Error())
+		api.events.Publish(events.Error, wire.ErrorEvent{Message: err.Error()})
+	} else if resp.Cancelled {
+		pour.Outcome = openbardb.PourCancelled
+	}
+
+	// the pour is recorded with a background context so that cancelled pours are still recorded
+	recordErr := api.Transaction(context.Background(), func(tx *dbr.Tx) error {
+		err := openbardb.CreatePour(context.Background(), tx, pour)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	if recordErr != nil {
+		api.Logger().Info("Error recording pour", zap.Error(recordErr))
+	} else if resp != nil {
+		resp.PourId = pour.Id
+	}
+
+	return resp, err
+}
+
+// pourDrink chooses pumps for and pours the requested fluids, filling in the pumps used and volumes dispensed in pour.
+// It waits for any other drink being made to finish first, and the pour is cancelled if ctx is cancelled while waiting.
+func (api *OpenBarAPI) pourDrink(ctx context.Context, req wire.MakeRequest, pour *openbardb.Pour) (*wire.MakeResponse, error) {
+	select {
+	case api.makeTurn <- struct{}{}:
+		defer func() { <-api.makeTurn }()
+	case <-ctx.Done():
+		return &wire.MakeResponse{RunTimesMs: make([]int64, api.hw.NumPumps()), Cancelled: true}, nil
+	}
+
+	state, err := api.loadPourState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pumps := state.pumps
+	if len(pumps) != len(state.fluids) {
+		return nil, fmt.Errorf("pumps and fluids do not match")
+	}
+
+	if len(pumps) != api.hw.NumPumps() {
+		return nil, fmt.Errorf("pumps and hardware do not match")
+	}
+
+	pumpIndices, err := api.getPumpIndices(req, state)
+	if err != nil {
+		return nil, err
+	}
 
-	var pumps []openbardb.Pump
-	var fluids []openbardb.Fluid
-	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+	// a fluid split across pumps is recorded once for each pump it was poured from
+	pour.Fluids = make([]openbardb.PourFluid, len(pumpIndices))
+	for i, idxVol := range pumpIndices {
+		pour.Fluids[i] = openbardb.PourFluid{
+			Fluid:       req.FluidVolumes[idxVol.ReqIdx].Fluid,
+			PumpIdx:     util.Ptr(idxVol.Idx),
+			RequestedMl: idxVol.VolMl,
+		}
+	}
+
+	err = checkBottles(req.FluidVolumes, pumpIndices, state.bottles)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := api.getPumpSteps(req, pumpIndices, state)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	ran, err := api.runPourSteps(ctx, hardware.Forward, steps)
+	pour.DurationMs = time.Since(start).Milliseconds()
+	dispensed := make(map[int]float64)
+	for i, idxVol := range pumpIndices {
+		if idxVol.Idx < len(ran) {
+			pour.Fluids[i].DispensedMl = state.planPumpRun(idxVol).dispensedMl(ran[idxVol.Idx])
+			dispensed[idxVol.Idx] += pour.Fluids[i].DispensedMl
+		}
+	}
+
+	// the flow rate of a pump depends on the speed it ran at, so its usage is the volume its run dispensed
+	for idx, ml := range dispensed {
+		api.recordDispensed(idx, ran[idx], ml)
+	}
+
+	cancelled := errors.Is(err, context.Canceled)
+	if err != nil && !cancelled {
+		return nil, err
+	}
+
+	// usage is synced with a background context so that the runtime of a cancelled pour is still recorded
+	err = api.SyncPumpUsage(context.Background())
+	if err != nil {
+		api.Logger().Info("Error syncing pump usage", zap.Error(err))
+	}
+
+	return &wire.MakeResponse{
+		RunTimesMs: durationsToMs(ran),
+		Cancelled:  cancelled,
+	}, nil
+}
+
+// pourState is everything needed to decide how a drink is poured. speedCals holds the calibrations of each pump below
+// full speed, and finishSpeed and finishVolumeMl are 0 unless finishing is configured.
+type pourState struct {
+	pumps          []openbardb.Pump
+	fluids         []openbardb.Fluid
+	bottles        map[int]openbardb.Bottle
+	mode           string
+	speedSupported bool
+	speedCals      map[int][]openbardb.PumpCalibration
+	finishSpeed    float64
+	finishVolumeMl float64
+}
+
+// loadPourState loads the pumps, the fluids loaded in them, their bottles keyed by pump index, the configured pump
+// selection mode, and on hardware that supports speed the speed calibrations and finish config.
+func (api *OpenBarAPI) loadPourState(ctx context.Context) (pourState, error) {
+	state := pourState{bottles: make(map[int]openbardb.Bottle), speedSupported: hardware.SupportsSpeed(api.hw)}
+	var finishSpeed, finishVolume string
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
 		var err error
-		pumps, err = openbardb.ListPumps(ctx, tx)
+		state.pumps, err = openbardb.ListPumps(ctx, tx)
 		if err != nil {
 			return fmt.Errorf("failed to list pumps: %w", err)
 		}
 
-		fluids, err = openbardb.ListFluids(ctx, tx)
+		state.fluids, err = openbardb.ListFluids(ctx, tx)
 		if err != nil {
 			return fmt.Errorf("failed to list fluids: %w", err)
 		}
 
+		bottleList, err := openbardb.ListBottles(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("failed to list bottles: %w", err)
+		}
+
+		for _, bottle := range bottleList {
+			state.bottles[bottle.Idx] = bottle
+		}
+
+		cfg, err := openbardb.GetConfig(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("failed to get config from db: %w", err)
+		}
+
+		state.mode = cfg[openbardb.PumpSelectionConfigKey]
+		if !state.speedSupported {
+			return nil
+		}
+
+		finishSpeed = cfg[openbardb.FinishSpeedConfigKey]
+		finishVolume = cfg[openbardb.FinishVolumeConfigKey]
+		state.speedCals, err = openbardb.ListSpeedCalibrations(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("failed to list speed calibrations: %w", err)
+		}
+
 		return nil
 	})
 
 	if err != nil {
-		api.Respond(w, r, nil, err)
-		return
+		return pourState{}, err
 	}
 
-	if len(pumps) != len(fluids) {
-		api.Respond(w, r, nil, fmt.Errorf("pumps and fluids do not match"))
-		return
+	switch state.mode {
+	case "":
+		state.mode = openbardb.PumpSelectionLeastUsed
+	case openbardb.PumpSelectionLeastUsed, openbardb.PumpSelectionSplit:
+	default:
+		return pourState{}, fmt.Errorf("invalid value for config key %s: '%s'", openbardb.PumpSelectionConfigKey, state.mode)
 	}
 
-	if len(pumps) != api.hw.NumPumps() {
-		api.Respond(w, r, nil, fmt.Errorf("pumps and hardware do not match"))
-		return
-	}
+	if finishSpeed != "" && finishVolume != "" {
+		state.finishSpeed, err = strconv.ParseFloat(finishSpeed, 64)
+		if err != nil || state.finishSpeed <= 0 || state.finishSpeed > hardware.FullSpeed {
+			return pourState{}, fmt.Errorf("invalid value for config key %s: '%s'", openbardb.FinishSpeedConfigKey, finishSpeed)
+		}
 
-	pumpIndices, err := api.getPumpIndices(req, fluids)
-	if err != nil {
-		api.Respond(w, r, nil, err)
-		return
+		state.finishVolumeMl, err = strconv.ParseFloat(finishVolume, 64)
+		if err != nil || state.finishVolumeMl < 0 {
+			return pourState{}, fmt.Errorf("invalid value for config key %s: '%s'", openbardb.FinishVolumeConfigKey, finishVolume)
+		}
 	}
 
-	timesForPumps, err := api.getPumpTimes(pumpIndices, pumps)
-	if err != nil {
-		api.Respond(w, r, nil, err)
+	return state, nil
+}
+
+// CancelMakeHandler handles requests to /make/cancel which abort any drinks currently being made
+func (api *OpenBarAPI) CancelMakeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions {
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodPost}, w, r)
+		return
+	} else if r.Method != http.MethodPost {
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
 		return
 	}
 
-	err = api.hw.RunForTimes(hardware.Forward, timesForPumps)
-	api.Respond(w, r, nil, err)
+	n := api.CancelPours()
+	api.Respond(w, r, wire.CancelResponse{Cancelled: n}, nil)
 }
 
+// idxVolTuple is the volume to pour from a single pump at the requested speed. ReqIdx is the index of the requested
+// fluid being poured.
 type idxVolTuple struct {
-	Idx   int
-	VolMl uint
+	Idx    int
+	VolMl  float64
+	ReqIdx int
+	Speed  float64
 }
 
-func (api *OpenBarAPI) getPumpIndices(req wire.MakeRequest, fluids []openbardb.Fluid) ([]idxVolTuple, error) {
-	indicesPerFluid := make([][]int, len(req.FluidVolumes))
+// getPumpIndices chooses the pumps to pour each requested fluid from, in the order the fluids were requested.
+func (api *OpenBarAPI) getPumpIndices(req wire.MakeRequest, state pourState) ([]idxVolTuple, error) {
+	var pumpIndices []idxVolTuple
 	for i, fv := range req.FluidVolumes {
-		for _, fluid := range fluids {
-			if *fluid.Fluid == fv.Fluid {
-				indicesPerFluid[i] = append(indicesPerFluid[i], fluid.Idx)
-			}
+		idxVols, ok := api.choosePumps(i, fv, state)
+		if !ok {
+			return nil, fmt.Errorf("fluid %s not found", fv.Fluid)
 		}
+
+		pumpIndices = append(pumpIndices, idxVols...)
 	}
 
-	// choose pumps. If more than one index choose the one that's been run the least
-	indexPerFluid := make([]idxVolTuple, len(req.FluidVolumes))
-	for i, fluidIndices := range indicesPerFluid {
-		if len(fluidIndices) == 0 {
-			return nil, fmt.Errorf("fluid %s not found", req.FluidVolumes[i].Fluid)
+	return pumpIndices, nil
+}
+
+// choosePumps returns the volumes to pour from each pump for the requested fluid at index reqIdx of a request, or
+// false if no pump has the fluid. In split mode the volume is split across every pump with the fluid in proportion to
+// their speed, leaving out pumps whose bottles can't cover their share. Otherwise, or if splitting isn't possible, the
+// fluid is poured from the single pump chosen by choosePump.
+func (api *OpenBarAPI) choosePumps(reqIdx int, fv wire.FluidVolume, state pourState) ([]idxVolTuple, bool) {
+	if state.mode == openbardb.PumpSelectionSplit {
+		speeds := make(map[int]float64)
+		for _, pump := range state.pumps {
+			speeds[pump.Idx] = pump.MlPerSec
+		}
+
+		var candidates []int
+		for _, fluid := range state.fluids {
+			if fluid.Fluid != nil && *fluid.Fluid == fv.Fluid && speeds[fluid.Idx] > 0 {
+				candidates = append(candidates, fluid.Idx)
+			}
 		}
 
-		runtime := time.Duration(0x7fffffffffffffff)
-		for _, idx := range fluidIndices {
-			pumpRuntime := api.hw.TimeRun(idx)
-			if pumpRuntime < runtime {
-				runtime = pumpRuntime
-				indexPerFluid[i] = idxVolTuple{
-					Idx:   idx,
-					VolMl: req.FluidVolumes[i].VolumeMl,
+		for len(candidates) > 1 {
+			totalSpeed := 0.0
+			for _, idx := range candidates {
+				totalSpeed += speeds[idx]
+			}
+
+			var idxVols []idxVolTuple
+			var covered []int
+			for _, idx := range candidates {
+				idxVol := idxVolTuple{Idx: idx, VolMl: float64(fv.VolumeMl) * speeds[idx] / totalSpeed, ReqIdx: reqIdx, Speed: fv.Speed}
+				if bottle, ok := state.bottles[idx]; !ok || bottle.CanPour(idxVol.VolMl) {
+					idxVols = append(idxVols, idxVol)
+					covered = append(covered, idx)
 				}
 			}
+
+			if len(covered) == len(candidates) {
+				return idxVols, true
+			}
+
+			candidates = covered
 		}
 	}
 
-	return indexPerFluid, nil
+	idx, ok := api.choosePump(fv, state.fluids, state.bottles)
+	if !ok {
+		return nil, false
+	}
+
+	return []idxVolTuple{{Idx: idx, VolMl: float64(fv.VolumeMl), ReqIdx: reqIdx, Speed: fv.Speed}}, true
 }
 
-func (api *OpenBarAPI) getPumpTimes(pumpIndicesAndVols []idxVolTuple, pumps []openbardb.Pump) ([]time.Duration, error) {
-	for i, p := range pumps {
+// choosePump returns the index of the pump to pour a fluid from, or false if no pump has the fluid. If more than one
+// pump has the fluid the one that's been run the least is chosen. Pumps whose bottles can't cover the requested volume
+// are only chosen if no other pump has the fluid.
+func (api *OpenBarAPI) choosePump(fv wire.FluidVolume, fluids []openbardb.Fluid, bottles map[int]openbardb.Bottle) (int, bool) {
+	var indices, emptyIndices []int
+	for _, fluid := range fluids {
+		if fluid.Fluid == nil || *fluid.Fluid != fv.Fluid {
+			continue
+		}
+
+		if bottle, ok := bottles[fluid.Idx]; ok && !bottle.CanPour(float64(fv.VolumeMl)) {
+			emptyIndices = append(emptyIndices, fluid.Idx)
+		} else {
+			indices = append(indices, fluid.Idx)
+		}
+	}
+
+	if len(indices) == 0 {
+		indices = emptyIndices
+	}
+
+	if len(indices) == 0 {
+		return 0, false
+	}
+
+	chosen := indices[0]
+	runtime := api.hw.TimeRun(chosen)
+	for _, idx := range indices[1:] {
+		pumpRuntime := api.hw.TimeRun(idx)
+		if pumpRuntime < runtime {
+			runtime = pumpRuntime
+			chosen = idx
+		}
+	}
+
+	return chosen, true
+}
+
+// getPumpRuns returns how each pump is run to pour its volume, indexed by pump. Pumps that aren't used have a run time
+// of 0.
+func (api *OpenBarAPI) getPumpRuns(pumpIndicesAndVols []idxVolTuple, state pourState) ([]pumpRun, error) {
+	for i, p := range state.pumps {
 		if p.Idx != i {
 			return nil, fmt.Errorf("pump indices are not sequential")
 		}
 	}
 
-	timesForPumps := make([]time.Duration, len(pumps))
+	runs := make([]pumpRun, len(state.pumps))
 	for _, idxVol := range pumpIndicesAndVols {
-		pump := pumps[idxVol.Idx]
-		seconds := float64(idxVol.VolMl) / pump.MlPerSec
-		timesForPumps[idxVol.Idx] = time.Duration(seconds * float64(time.Second))
+		err := state.checkSpeed(idxVol.Speed)
+		if err != nil {
+			return nil, err
+		}
+
+		runs[idxVol.Idx] = state.planPumpRun(idxVol)
+	}
+
+	return runs, nil
+}
+
+// getPumpSteps groups the run times of the chosen pumps into steps by the step of the fluid each pump pours. Steps are
+// returned in ascending order, and each is delayed by the request's delay for its step. On hardware that supports speed
+// each step carries the speed profiles of its pumps.
+func (api *OpenBarAPI) getPumpSteps(req wire.MakeRequest, pumpIndicesAndVols []idxVolTuple, state pourState) ([]hardware.PourStep, error) {
+	var stepNums []uint
+	stepToIdxVols := make(map[uint][]idxVolTuple)
+	for _, idxVol := range pumpIndicesAndVols {
+		step := req.FluidVolumes[idxVol.ReqIdx].Step
+		if _, ok := stepToIdxVols[step]; !ok {
+			stepNums = append(stepNums, step)
+		}
+
+		stepToIdxVols[step] = append(stepToIdxVols[step], idxVol)
+	}
+
+	slices.Sort(stepNums)
+	steps := make([]hardware.PourStep, len(stepNums))
+	for i, step := range stepNums {
+		runs, err := api.getPumpRuns(stepToIdxVols[step], state)
+		if err != nil {
+			return nil, err
+		}
+
+		steps[i].Times = make([]time.Duration, len(runs))
+		for idx, run := range runs {
+			steps[i].Times[idx] = run.runTime
+		}
+
+		if state.speedSupported {
+			steps[i].Profiles = make([]hardware.SpeedProfile, len(runs))
+			for idx, run := range runs {
+				steps[i].Profiles[idx] = run.profile
+			}
+		}
+		if int(step) < len(req.StepDelaysMs) {
+			steps[i].Delay = time.Duration(req.StepDelaysMs[step]) * time.Millisecond
+		}
 	}
 
-	return timesForPumps, nil
+	return steps, nil
 }
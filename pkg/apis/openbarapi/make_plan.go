@@ -0,0 +1,124 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"net/http"
+)
+
+// MakePlanHandler handles requests to /make/plan which report how a drink would be made without running any pumps
+func (api *OpenBarAPI) MakePlanHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method == http.MethodOptions {
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodPost}, w, r)
+		return
+	} else if r.Method != http.MethodPost {
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+		return
+	}
+
+	var req wire.MakeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	plan, err := api.planDrink(ctx, req)
+	api.Respond(w, r, plan, err)
+}
+
+// planDrink chooses pumps and run times for the requested fluids the same way pourDrink does. Rather than stopping at
+// the first problem that would prevent the drink from being made, every problem found is reported in the plan,
+// including a latched e-stop and faulted pumps. An error is only returned if the pump state could not be loaded.
+func (api *OpenBarAPI) planDrink(ctx context.Context, req wire.MakeRequest) (*wire.MakePlan, error) {
+	state, err := api.loadPourState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &wire.MakePlan{
+		Fluids:   []wire.PlannedFluid{},
+		Problems: []string{},
+	}
+
+	pumpsValid := true
+	if len(state.pumps) != len(state.fluids) {
+		plan.Problems = append(plan.Problems, "pumps and fluids do not match")
+		pumpsValid = false
+	}
+
+	if len(state.pumps) != api.hw.NumPumps() {
+		plan.Problems = append(plan.Problems, "pumps and hardware do not match")
+		pumpsValid = false
+	}
+
+	var pumpIndices []idxVolTuple
+	var planIndices []int
+	for i, fv := range req.FluidVolumes {
+		idxVols, ok := api.choosePumps(i, fv, state)
+		if !ok {
+			plan.Fluids = append(plan.Fluids, wire.PlannedFluid{Fluid: fv.Fluid, VolumeMl: float64(fv.VolumeMl), Step: fv.Step})
+			plan.Problems = append(plan.Problems, "fluid "+fv.Fluid+" not found")
+			continue
+		}
+
+		for _, idxVol := range idxVols {
+			pumpIndices = append(pumpIndices, idxVol)
+			planIndices = append(planIndices, len(plan.Fluids))
+			plan.Fluids = append(plan.Fluids, wire.PlannedFluid{Fluid: fv.Fluid, VolumeMl: idxVol.VolMl, PumpIdx: util.Ptr(idxVol.Idx), Step: fv.Step})
+
+			err = checkBottle(fv.Fluid, idxVol, state.bottles)
+			if err != nil {
+				plan.Problems = append(plan.Problems, err.Error())
+			}
+		}
+	}
+
+	if err := api.checkEStop(); err != nil {
+		plan.Problems = append(plan.Problems, err.Error())
+	}
+
+	status := hardware.GetStatus(api.hw)
+	faulted := make(map[int]bool)
+	for _, idxVol := range pumpIndices {
+		idx := idxVol.Idx
+		if idx < len(status.Pumps) && status.Pumps[idx] != hardware.Healthy && !faulted[idx] {
+			faulted[idx] = true
+			plan.Problems = append(plan.Problems, fmt.Sprintf("pump %d is %s", idx, status.Pumps[idx]))
+		}
+	}
+
+	if !pumpsValid {
+		return plan, nil
+	}
+
+	steps, err := api.getPumpSteps(req, pumpIndices, state)
+	if err != nil {
+		plan.Problems = append(plan.Problems, err.Error())
+		return plan, nil
+	}
+
+	for i, idxVol := range pumpIndices {
+		run := state.planPumpRun(idxVol)
+		planned := &plan.Fluids[planIndices[i]]
+		planned.RunTimeMs = run.runTime.Milliseconds()
+		planned.ExpectedMl = run.dispensedMl(run.runTime)
+	}
+
+	plan.RunTimesMs = make([]int64, len(state.pumps))
+	for _, step := range steps {
+		for i, runTime := range step.Times {
+			plan.RunTimesMs[i] += runTime.Milliseconds()
+		}
+	}
+	plan.TotalMs = hardware.StepsDuration(api.hw, steps).Milliseconds()
+
+	return plan, nil
+}
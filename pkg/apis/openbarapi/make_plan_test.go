@@ -0,0 +1,89 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+	"time"
+)
+
+func (s *testSuite) TestMakePlan() {
+	ctx := context.Background()
+	pumps := pumpsOfSpeed(100, 8)
+	pumps[3].MlPerSec = 50
+	s.setupPumpsAndFluids(ctx, barFluids(), pumps)
+
+	plan := func(req wire.MakeRequest) wire.MakePlan {
+		respWr := s.handle(http.MethodPost, "/make/plan", req)
+		s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+		var p wire.MakePlan
+		err := json.Unmarshal(respWr.Body(), &p)
+		s.Require().NoError(err)
+		return p
+	}
+
+	p := plan(wire.MakeRequest{FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 30}, {Fluid: "campari", VolumeMl: 20}}})
+	s.Require().Empty(p.Problems)
+	s.Require().Len(p.Fluids, 2)
+	s.Require().Equal(0, *p.Fluids[0].PumpIdx)
+	s.Require().Equal(int64(300), p.Fluids[0].RunTimeMs)
+	s.Require().InDelta(30.0, p.Fluids[0].ExpectedMl, 0.01)
+	s.Require().Equal(3, *p.Fluids[1].PumpIdx)
+	s.Require().Equal(int64(400), p.Fluids[1].RunTimeMs)
+	s.Require().InDelta(20.0, p.Fluids[1].ExpectedMl, 0.01)
+	s.Require().Equal([]int64{300, 0, 0, 400, 0, 0, 0, 0}, p.RunTimesMs)
+	s.Require().Equal(int64(400), p.TotalMs)
+
+	// campari is poured after gin and a delay
+	p = plan(wire.MakeRequest{
+		FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 30}, {Fluid: "campari", VolumeMl: 20, Step: 1}},
+		StepDelaysMs: []uint{0, 100},
+	})
+	s.Require().Empty(p.Problems)
+	s.Require().Equal(uint(1), p.Fluids[1].Step)
+	s.Require().Equal([]int64{300, 0, 0, 400, 0, 0, 0, 0}, p.RunTimesMs)
+	s.Require().Equal(int64(800), p.TotalMs)
+
+	// no pumps are run
+	thw := s.testHardware()
+	for i := 0; i < thw.NumPumps(); i++ {
+		s.Require().Equal(time.Duration(0), thw.TimeRun(i))
+	}
+
+	// every problem is reported
+	err := s.Api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.ReplaceBottle(ctx, tx, 0, 750, util.Ptr(10.0), time.Now())
+		s.Require().NoError(err)
+		return tx.Commit()
+	})
+	s.Require().NoError(err)
+
+	p = plan(wire.MakeRequest{FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 30}, {Fluid: "rum", VolumeMl: 20}}})
+	s.Require().Len(p.Problems, 2)
+	s.Require().Contains(p.Problems[0], "not enough gin left")
+	s.Require().Contains(p.Problems[1], "rum")
+	s.Require().Equal(0, *p.Fluids[0].PumpIdx)
+	s.Require().Nil(p.Fluids[1].PumpIdx)
+	s.Require().Equal(int64(300), p.TotalMs)
+
+	// faulted pumps the drink would use and a latched e-stop are reported
+	thw.SetPumpHealth(3, hardware.WriteFailed)
+	thw.SetPumpHealth(4, hardware.WriteFailed)
+	defer thw.SetPumpHealth(3, hardware.Healthy)
+	defer thw.SetPumpHealth(4, hardware.Healthy)
+
+	s.Require().True(s.Api.estop.Trigger("test", "testing plans"))
+	defer s.Api.estop.Reset()
+
+	p = plan(wire.MakeRequest{FluidVolumes: []wire.FluidVolume{{Fluid: "campari", VolumeMl: 20}}})
+	s.Require().Len(p.Problems, 2)
+	s.Require().Contains(p.Problems[0], "e-stop")
+	s.Require().Contains(p.Problems[1], "pump 3")
+	s.Require().Equal(int64(400), p.TotalMs)
+}
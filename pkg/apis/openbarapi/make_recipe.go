@@ -0,0 +1,187 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/cocktailsdb"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/gocraft/dbr/v2"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MakeRecipeHandler handles requests to /make/recipe/{id}. The recipe is loaded from the cocktails database and its
+// ingredient parts are scaled to the requested volume, or to the default volume from the config.
+func (api *OpenBarAPI) MakeRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method == http.MethodOptions {
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodPost}, w, r)
+		return
+	} else if r.Method != http.MethodPost {
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+		return
+	}
+
+	tokens := apis.GetPathTokens(r)
+	if len(tokens) != 3 {
+		api.Respond(w, r, nil, apis.ErrNotFound)
+		return
+	}
+
+	var req wire.MakeRecipeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	} else if req.VolumeMl < 0 {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	recipe, err := api.getRecipe(ctx, tokens[2])
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	volumeMl := req.VolumeMl
+	if volumeMl == 0 {
+		volumeMl, err = api.defaultVolumeMl(ctx)
+		if err != nil {
+			api.Respond(w, r, nil, err)
+			return
+		}
+	}
+
+	makeReq, err := scaleRecipe(*recipe, volumeMl)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var steps []openbardb.RecipeStep
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		steps, err = openbardb.GetRecipeSteps(ctx, tx, recipe.Id)
+		return err
+	})
+
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	applyRecipeSteps(&makeReq, steps)
+
+	resp, err := api.makeDrink(ctx, makeReq)
+	if resp != nil {
+		resp.FluidVolumes = makeReq.FluidVolumes
+	}
+
+	api.Respond(w, r, resp, err)
+}
+
+// getRecipe loads a recipe from the cocktails database, returning apis.ErrNotFound if it doesn't exist
+func (api *OpenBarAPI) getRecipe(ctx context.Context, id string) (*cocktailsdb.Recipe, error) {
+	var recipes []cocktailsdb.Recipe
+	err := api.cocktailsTxp.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		recipes, err = cocktailsdb.GetRecipesById(ctx, tx, id)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	} else if len(recipes) == 0 {
+		return nil, fmt.Errorf("recipe '%s' not found: %w", id, apis.ErrNotFound)
+	}
+
+	return &recipes[0], nil
+}
+
+func (api *OpenBarAPI) defaultVolumeMl(ctx context.Context) (float64, error) {
+	var cfg map[string]string
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		cfg, err = openbardb.GetConfig(ctx, tx)
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	volumeMl, err := strconv.ParseFloat(cfg[openbardb.DefaultVolConfigKey], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for config key %s: %w", openbardb.DefaultVolConfigKey, err)
+	}
+
+	return volumeMl, nil
+}
+
+// scaleRecipe converts the ingredient parts of a recipe into a MakeRequest for a drink with a total volume of volumeMl.
+// It returns a bad request error if any ingredient would round to 0 ml, rather than making the drink without it.
+func scaleRecipe(recipe cocktailsdb.Recipe, volumeMl float64) (wire.MakeRequest, error) {
+	totalParts := 0.0
+	for _, ing := range recipe.Ingredients {
+		totalParts += ing.Amount
+	}
+
+	if totalParts <= 0 {
+		return wire.MakeRequest{}, fmt.Errorf("recipe %s has no ingredients", recipe.Id)
+	}
+
+	fluidVolumes := make([]wire.FluidVolume, 0, len(recipe.Ingredients))
+	var tooSmall []string
+	for _, ing := range recipe.Ingredients {
+		if ing.Amount <= 0 {
+			continue
+		}
+
+		ml := math.Round(ing.Amount / totalParts * volumeMl)
+		if ml <= 0 {
+			tooSmall = append(tooSmall, ing.IngredientFk)
+			continue
+		}
+
+		fluidVolumes = append(fluidVolumes, wire.FluidVolume{
+			Fluid:    ing.IngredientFk,
+			VolumeMl: uint(ml),
+		})
+	}
+
+	if len(tooSmall) > 0 {
+		return wire.MakeRequest{}, fmt.Errorf("%s would be less than 1 ml of a %g ml %s: %w", strings.Join(tooSmall, ", "), volumeMl, recipe.Id, apis.ErrBadRequest)
+	}
+
+	return wire.MakeRequest{FluidVolumes: fluidVolumes, RecipeId: &recipe.Id}, nil
+}
+
+// applyRecipeSteps sets the step of each fluid in req from the recipe's pour steps, along with the delay before each
+// step. Fluids that aren't in any step are poured in the first step.
+func applyRecipeSteps(req *wire.MakeRequest, steps []openbardb.RecipeStep) {
+	if len(steps) == 0 {
+		return
+	}
+
+	ingredientToStep := make(map[string]uint)
+	req.StepDelaysMs = make([]uint, len(steps))
+	for i, step := range steps {
+		req.StepDelaysMs[i] = uint(step.DelayMs)
+		for _, ing := range step.Ingredients {
+			ingredientToStep[ing] = uint(i)
+		}
+	}
+
+	for i := range req.FluidVolumes {
+		req.FluidVolumes[i].Step = ingredientToStep[req.FluidVolumes[i].Fluid]
+	}
+}
@@ -0,0 +1,124 @@
+package openbarapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/cocktailsdb"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"github.com/cocktailrobots/openbar-server/pkg/util/test"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+)
+
+func (s *testSuite) TestScaleRecipe() {
+	recipe := cocktailsdb.Recipe{
+		Id: "negroni",
+		Ingredients: []cocktailsdb.RecipeIngredient{
+			{IngredientFk: "gin", Amount: 1},
+			{IngredientFk: "campari", Amount: 1},
+			{IngredientFk: "sweet_vermouth", Amount: 2},
+		},
+	}
+
+	req, err := scaleRecipe(recipe, 120)
+	s.Require().NoError(err)
+	s.Require().Equal([]wire.FluidVolume{
+		{Fluid: "gin", VolumeMl: 30},
+		{Fluid: "campari", VolumeMl: 30},
+		{Fluid: "sweet_vermouth", VolumeMl: 60},
+	}, req.FluidVolumes)
+
+	_, err = scaleRecipe(cocktailsdb.Recipe{Id: "empty"}, 120)
+	s.Require().Error(err)
+
+	// ingredients too small to pour at the volume aren't left out of the drink
+	recipe.Ingredients = append(recipe.Ingredients, cocktailsdb.RecipeIngredient{IngredientFk: "bitters", Amount: 0.01})
+	_, err = scaleRecipe(recipe, 120)
+	s.Require().ErrorIs(err, apis.ErrBadRequest)
+	s.Require().ErrorContains(err, "bitters")
+}
+
+func (s *testSuite) TestMakeRecipeHandler() {
+	ctx := context.Background()
+
+	var recipe cocktailsdb.Recipe
+	err := s.CocktailsDB.Transaction(ctx, func(tx *dbr.Tx) error {
+		recipes, err := cocktailsdb.GetRecipes(ctx, tx)
+		s.Require().NoError(err)
+		s.Require().NotEmpty(recipes)
+
+		recipe = recipes[0]
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(recipe.Ingredients)
+	s.Require().LessOrEqual(len(recipe.Ingredients), 8)
+
+	fluids := make([]openbardb.Fluid, 8)
+	for i := range fluids {
+		fluids[i] = openbardb.Fluid{Idx: i, Fluid: util.Ptr("")}
+		if i < len(recipe.Ingredients) {
+			fluids[i].Fluid = util.Ptr(recipe.Ingredients[i].IngredientFk)
+		}
+	}
+
+	// the database is reset for each subtest, so pumps and fluids are set up before every request
+	makeRecipe := func(id string, body any) (int, *wire.MakeResponse) {
+		s.setupPumpsAndFluids(ctx, fluids, pumpsOfSpeed(1000, 8))
+
+		var buf bytes.Buffer
+		if body != nil {
+			reqJson, err := json.Marshal(body)
+			s.Require().NoError(err)
+			buf.Write(reqJson)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, "/make/recipe/"+id, &buf)
+		s.Require().NoError(err)
+
+		respWr := test.NewResponseWriter()
+		s.Api.Handle(respWr, req)
+		if respWr.StatusCode() != http.StatusOK {
+			return respWr.StatusCode(), nil
+		}
+
+		var resp wire.MakeResponse
+		err = json.Unmarshal(respWr.Body(), &resp)
+		s.Require().NoError(err)
+		return respWr.StatusCode(), &resp
+	}
+
+	totalVolume := func(resp *wire.MakeResponse) int {
+		total := 0
+		for _, fv := range resp.FluidVolumes {
+			total += int(fv.VolumeMl)
+		}
+		return total
+	}
+
+	s.Run("requested volume", func() {
+		status, resp := makeRecipe(recipe.Id, wire.MakeRecipeRequest{VolumeMl: 200})
+		s.Require().Equal(http.StatusOK, status)
+		s.Require().InDelta(200, totalVolume(resp), float64(len(recipe.Ingredients)))
+	})
+
+	s.Run("default volume", func() {
+		status, resp := makeRecipe(recipe.Id, nil)
+		s.Require().Equal(http.StatusOK, status)
+		s.Require().InDelta(133, totalVolume(resp), float64(len(recipe.Ingredients)))
+	})
+
+	s.Run("unknown recipe", func() {
+		status, _ := makeRecipe("noexist", nil)
+		s.Require().Equal(http.StatusNotFound, status)
+	})
+
+	s.Run("negative volume", func() {
+		status, _ := makeRecipe(recipe.Id, wire.MakeRecipeRequest{VolumeMl: -1})
+		s.Require().Equal(http.StatusBadRequest, status)
+	})
+}
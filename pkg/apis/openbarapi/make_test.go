@@ -6,11 +6,11 @@ import (
 	"encoding/json"
 	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
 	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
-	"github.com/cocktailrobots/openbar-server/pkg/hardware"
 	"github.com/cocktailrobots/openbar-server/pkg/util"
 	"github.com/cocktailrobots/openbar-server/pkg/util/test"
 	"github.com/gocraft/dbr/v2"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -42,8 +42,8 @@ func (s *testSuite) TestGetPumpIndices() {
 			},
 			idxVolTuples: []idxVolTuple{
 				{Idx: 0, VolMl: 50},
-				{Idx: 3, VolMl: 30},
-				{Idx: 4, VolMl: 40},
+				{Idx: 3, VolMl: 30, ReqIdx: 1},
+				{Idx: 4, VolMl: 40, ReqIdx: 2},
 			},
 		},
 		{
@@ -65,8 +65,8 @@ func (s *testSuite) TestGetPumpIndices() {
 			},
 			idxVolTuples: []idxVolTuple{
 				{Idx: 0, VolMl: 50},
-				{Idx: 1, VolMl: 30},
-				{Idx: 2, VolMl: 40},
+				{Idx: 1, VolMl: 30, ReqIdx: 1},
+				{Idx: 2, VolMl: 40, ReqIdx: 2},
 			},
 		},
 		{
@@ -88,8 +88,8 @@ func (s *testSuite) TestGetPumpIndices() {
 			},
 			idxVolTuples: []idxVolTuple{
 				{Idx: 6, VolMl: 50},
-				{Idx: 7, VolMl: 30},
-				{Idx: 3, VolMl: 40},
+				{Idx: 7, VolMl: 30, ReqIdx: 1},
+				{Idx: 3, VolMl: 40, ReqIdx: 2},
 			},
 			runTimes: func() map[int]time.Duration {
 				m := make(map[int]time.Duration)
@@ -137,8 +137,8 @@ func (s *testSuite) TestGetPumpIndices() {
 			},
 			idxVolTuples: []idxVolTuple{
 				{Idx: 6, VolMl: 50},
-				{Idx: 7, VolMl: 30},
-				{Idx: 3, VolMl: 40},
+				{Idx: 7, VolMl: 30, ReqIdx: 1},
+				{Idx: 3, VolMl: 40, ReqIdx: 2},
 			},
 			runTimes: func() map[int]time.Duration {
 				m := make(map[int]time.Duration)
@@ -155,13 +155,13 @@ func (s *testSuite) TestGetPumpIndices() {
 			req := wire.MakeRequest{FluidVolumes: tt.reqFluidVols}
 
 			if tt.runTimes != nil {
-				testHw := s.Api.hw.(*hardware.TestHardware)
+				testHw := s.testHardware()
 				for idx, dur := range tt.runTimes {
 					testHw.SetRuntime(idx, dur)
 				}
 			}
 
-			idxVolTuples, err := s.Api.getPumpIndices(req, tt.fluids)
+			idxVolTuples, err := s.Api.getPumpIndices(req, pourState{fluids: tt.fluids, mode: openbardb.PumpSelectionLeastUsed})
 
 			if tt.expectErr {
 				s.Require().Error(err)
@@ -173,6 +173,62 @@ func (s *testSuite) TestGetPumpIndices() {
 	}
 }
 
+func (s *testSuite) TestChoosePumpsSplit() {
+	pumps := pumpsOfSpeed(100, 4)
+	pumps[2].MlPerSec = 50
+	fluids := []openbardb.Fluid{
+		{Idx: 0, Fluid: util.Ptr("gin")},
+		{Idx: 1, Fluid: util.Ptr("tonic")},
+		{Idx: 2, Fluid: util.Ptr("tonic")},
+		{Idx: 3, Fluid: util.Ptr("lime_juice")},
+	}
+	tonic := wire.FluidVolume{Fluid: "tonic", VolumeMl: 90}
+
+	tests := []struct {
+		name     string
+		mode     string
+		bottles  map[int]openbardb.Bottle
+		expected []idxVolTuple
+	}{
+		{
+			name:     "least used",
+			mode:     openbardb.PumpSelectionLeastUsed,
+			expected: []idxVolTuple{{Idx: 1, VolMl: 90, ReqIdx: 1}},
+		},
+		{
+			name: "split by speed",
+			mode: openbardb.PumpSelectionSplit,
+			expected: []idxVolTuple{
+				{Idx: 1, VolMl: 60, ReqIdx: 1},
+				{Idx: 2, VolMl: 30, ReqIdx: 1},
+			},
+		},
+		{
+			name: "bottle can't cover its share",
+			mode: openbardb.PumpSelectionSplit,
+			bottles: map[int]openbardb.Bottle{
+				1: {Idx: 1, CapacityMl: util.Ptr(750.0), RemainingMl: 20},
+			},
+			expected: []idxVolTuple{{Idx: 2, VolMl: 90, ReqIdx: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		s.Run(tt.name, func() {
+			state := pourState{pumps: pumps, fluids: fluids, bottles: tt.bottles, mode: tt.mode}
+			idxVols, ok := s.Api.choosePumps(1, tonic, state)
+			s.Require().True(ok)
+			s.Require().Equal(tt.expected, idxVols)
+
+			runs, err := s.Api.getPumpRuns(idxVols, state)
+			s.Require().NoError(err)
+			if len(idxVols) > 1 {
+				s.Require().Equal(runs[1].runTime, runs[2].runTime)
+			}
+		})
+	}
+}
+
 func pumpsOfSpeed(speed int, numPumps int) []openbardb.Pump {
 	pumps := make([]openbardb.Pump, numPumps)
 	for i := range pumps {
@@ -181,7 +237,7 @@ func pumpsOfSpeed(speed int, numPumps int) []openbardb.Pump {
 	return pumps
 }
 
-func (s *testSuite) TestGetPumpTimes() {
+func (s *testSuite) TestGetPumpRuns() {
 	tests := []struct {
 		name      string
 		idxVols   []idxVolTuple
@@ -256,12 +312,16 @@ func (s *testSuite) TestGetPumpTimes() {
 
 	for _, tt := range tests {
 		s.Run(tt.name, func() {
-			times, err := s.Api.getPumpTimes(tt.idxVols, tt.pumps)
+			runs, err := s.Api.getPumpRuns(tt.idxVols, pourState{pumps: tt.pumps})
 
 			if tt.expectErr {
 				s.Require().Error(err)
 			} else {
 				s.Require().NoError(err)
+				times := make([]time.Duration, len(runs))
+				for i, run := range runs {
+					times[i] = run.runTime
+				}
 				s.Require().Equal(tt.expected, times)
 			}
 		})
@@ -323,8 +383,7 @@ func (s *testSuite) TestMakeHandler() {
 
 			s.Require().Equal(http.StatusOK, respWr.StatusCode())
 
-			thw, ok := s.Api.hw.(*hardware.TestHardware)
-			s.Require().True(ok)
+			thw := s.testHardware()
 
 			for i := 0; i < thw.NumPumps(); i++ {
 				s.isClose(tt.expected[i], thw.TimeRun(i))
@@ -335,7 +394,10 @@ func (s *testSuite) TestMakeHandler() {
 
 func (s *testSuite) setupPumpsAndFluids(ctx context.Context, fluids []openbardb.Fluid, pumps []openbardb.Pump) {
 	err := s.Transaction(ctx, func(tx *dbr.Tx) error {
-		err := openbardb.UpdateFluids(ctx, tx, fluids)
+		err := openbardb.UpdateConfig(ctx, tx, map[string]interface{}{openbardb.NumPumpsConfigKey: strconv.Itoa(s.Api.hw.NumPumps())})
+		s.Require().NoError(err)
+
+		err = openbardb.UpdateFluids(ctx, tx, fluids)
 		s.Require().NoError(err)
 
 		err = openbardb.UpdatePumps(ctx, tx, pumps)
@@ -350,3 +412,58 @@ func (s *testSuite) isClose(a, b time.Duration) {
 	diff := a - b
 	s.Require().True((diff >= 0 && diff < 10*time.Millisecond) || (diff < 0 && diff > -10*time.Millisecond), "expected %s to be close to %s, but is %s different", a.String(), b.String(), diff.String())
 }
+
+func (s *testSuite) TestCancelMake() {
+	ctx := context.Background()
+	s.setupBar(ctx, 10)
+
+	reqJson, err := json.Marshal(wire.MakeRequest{FluidVolumes: []wire.FluidVolume{
+		{Fluid: "gin", VolumeMl: 50},
+		{Fluid: "campari", VolumeMl: 1},
+	}})
+	s.Require().NoError(err)
+
+	makeReq, err := http.NewRequest(http.MethodPost, "/make", bytes.NewBuffer(reqJson))
+	s.Require().NoError(err)
+
+	makeRespWr := test.NewResponseWriter()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Api.Handle(makeRespWr, makeReq)
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+
+	req, err := http.NewRequest(http.MethodPost, "/make/cancel", nil)
+	s.Require().NoError(err)
+	respWr := test.NewResponseWriter()
+	s.Api.Handle(respWr, req)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var cancelResp wire.CancelResponse
+	err = json.Unmarshal(respWr.Body(), &cancelResp)
+	s.Require().NoError(err)
+	s.Require().Equal(1, cancelResp.Cancelled)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		s.FailNow("pour was not cancelled")
+	}
+
+	s.Require().Equal(http.StatusOK, makeRespWr.StatusCode())
+
+	var makeResp wire.MakeResponse
+	err = json.Unmarshal(makeRespWr.Body(), &makeResp)
+	s.Require().NoError(err)
+	s.Require().True(makeResp.Cancelled)
+	s.Require().Len(makeResp.RunTimesMs, 8)
+	// allow for scheduling latency between the cancel request and the pumps stopping
+	s.Require().Greater(makeResp.RunTimesMs[0], int64(100))
+	s.Require().Less(makeResp.RunTimesMs[0], int64(400))
+	s.Require().InDelta(100, makeResp.RunTimesMs[3], 25)
+
+	thw := s.testHardware()
+	s.isClose(time.Duration(makeResp.RunTimesMs[0])*time.Millisecond, thw.TimeRun(0))
+}
@@ -1,25 +1,69 @@
 package openbarapi
 
 import (
+	"context"
 	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/events"
 	"github.com/cocktailrobots/openbar-server/pkg/hardware"
 	"github.com/cocktailrobots/openbar-server/pkg/util/dbutils"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"sync"
+	"time"
 )
 
 type OpenBarAPI struct {
 	*apis.API
-	hw    hardware.Hardware
-	ashwr *hardware.AsyncHWRunner
+	cocktailsTxp dbutils.TxProvider
+	hw           hardware.Hardware
+	ctrl         *hardware.Controller
+	estop        *hardware.EStop
+	events       *events.Bus
+
+	mu              *sync.Mutex
+	calibrationRuns map[int]calibrationRun
+	syncedRuntimes  map[int]time.Duration
+	bottleCredits   map[int]bottleCredit
+	dispensedRuns   map[int]dispensedRun
+	pours           map[uint64]context.CancelFunc
+	nextPourId      uint64
+	asyncLeases     []*hardware.Lease
+	jogs            map[*hardware.Lease]struct{}
+
+	maintenance       wire.MaintenanceStatus
+	cancelMaintenance context.CancelFunc
+
+	// makeTurn is held while a drink is made so that direct makes and queued orders take turns with the pumps
+	makeTurn           chan struct{}
+	orderCh            chan struct{}
+	pouringOrderId     string
+	cancelPouringOrder context.CancelFunc
 }
 
-func New(logger *zap.Logger, txp dbutils.TxProvider, rtr *mux.Router, hw hardware.Hardware) *OpenBarAPI {
+// New creates the openbar API. Pumps are run through leases from ctrl, whose hardware should be wrapped by estop so that
+// every pump command goes through the emergency stop.
+func New(logger *zap.Logger, txp, cocktailsTxp dbutils.TxProvider, rtr *mux.Router, ctrl *hardware.Controller, estop *hardware.EStop) *OpenBarAPI {
 	api := &OpenBarAPI{
-		API:   apis.NewAPI(logger, txp, rtr),
-		hw:    hw,
-		ashwr: hardware.NewAsyncHWRunner(hw),
+		API:          apis.NewAPI(logger, txp, rtr),
+		cocktailsTxp: cocktailsTxp,
+		hw:           ctrl.Hardware(),
+		ctrl:         ctrl,
+		estop:        estop,
+		events:       events.NewBus(),
+
+		mu:              &sync.Mutex{},
+		calibrationRuns: make(map[int]calibrationRun),
+		syncedRuntimes:  make(map[int]time.Duration),
+		bottleCredits:   make(map[int]bottleCredit),
+		dispensedRuns:   make(map[int]dispensedRun),
+		pours:           make(map[uint64]context.CancelFunc),
+		jogs:            make(map[*hardware.Lease]struct{}),
+		makeTurn:        make(chan struct{}, 1),
+		orderCh:         make(chan struct{}, 1),
 	}
+	ctrl.OnPumpChange(api.publishPumpState)
+	estop.OnTrigger(api.onEStop)
 
 	rtr.HandleFunc("/", api.DefaultHandler)
 	rtr.HandleFunc("/fluids", api.FluidsHandler)
@@ -29,8 +73,36 @@ func New(logger *zap.Logger, txp dbutils.TxProvider, rtr *mux.Router, hw hardwar
 	rtr.HandleFunc("/menus/{name}", api.MenuHandler)
 	rtr.HandleFunc("/menus/{name}/recipes", api.MenuRecipesHandler)
 	rtr.HandleFunc("/menus/{name}/recipes/{id}", api.MenuRecipeHandler)
+	rtr.HandleFunc("/pumps", api.PumpsHandler)
+	rtr.HandleFunc("/pumps/usage", api.PumpsUsageHandler)
+	rtr.HandleFunc("/pumps/bottles", api.BottlesHandler)
+	rtr.HandleFunc("/pumps/{idx}/calibrate", api.PumpCalibrationHandler)
+	rtr.HandleFunc("/pumps/{idx}/usage", api.PumpUsageHandler)
+	rtr.HandleFunc("/pumps/{idx}/service", api.PumpServiceHandler)
+	rtr.HandleFunc("/pumps/{idx}/bottle", api.BottleHandler)
+	rtr.HandleFunc("/pumps/{idx}/bottle/replace", api.BottleReplaceHandler)
+	rtr.HandleFunc("/pumps/{idx}/tube", api.PumpTubeHandler)
 	rtr.HandleFunc("/make", api.MakeHandler)
+	rtr.HandleFunc("/make/cancel", api.CancelMakeHandler)
+	rtr.HandleFunc("/make/plan", api.MakePlanHandler)
+	rtr.HandleFunc("/make/recipe/{id}", api.MakeRecipeHandler)
+	rtr.HandleFunc("/orders", api.OrdersHandler)
+	rtr.HandleFunc("/orders/{id}", api.OrderHandler)
+	rtr.HandleFunc("/pours", api.PoursHandler)
+	rtr.HandleFunc("/pours/{id}", api.PourHandler)
+	rtr.HandleFunc("/recipes/{id}/steps", api.RecipeStepsHandler)
 	rtr.HandleFunc("/buttons", api.ButtonsHandler)
+	rtr.HandleFunc("/jog", api.JogHandler)
+	rtr.HandleFunc("/maintenance", api.MaintenanceHandler)
+	rtr.HandleFunc("/maintenance/cancel", api.MaintenanceCancelHandler)
+	rtr.HandleFunc("/maintenance/schedules", api.MaintenanceSchedulesHandler)
+	rtr.HandleFunc("/maintenance/schedules/{id}", api.MaintenanceScheduleHandler)
+	rtr.HandleFunc("/maintenance/{program}", api.MaintenanceProgramHandler)
+	rtr.HandleFunc("/hardware/status", api.HardwareStatusHandler)
+	rtr.HandleFunc("/estop", api.EStopHandler)
+	rtr.HandleFunc("/estop/reset", api.EStopResetHandler)
+	rtr.HandleFunc("/estop/events", api.EStopEventsHandler)
+	rtr.HandleFunc("/events", api.EventsHandler)
 	rtr.HandleFunc("/networking", api.NetworkingHandler)
 	rtr.HandleFunc("/shutdown", api.ShutdownHandler)
 
@@ -0,0 +1,303 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+const orderPollInterval = time.Second
+
+// OrdersHandler handles requests to /orders
+func (api *OpenBarAPI) OrdersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getOrders(ctx, w, r)
+	case http.MethodPost:
+		api.createOrder(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getOrders(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var statuses []openbardb.OrderStatus
+	for _, status := range r.URL.Query()["status"] {
+		statuses = append(statuses, openbardb.OrderStatus(status))
+	}
+
+	var ordersResp []wire.Order
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		orders, err := openbardb.ListOrders(ctx, tx, statuses...)
+		if err != nil {
+			return err
+		}
+
+		ordersResp = wire.FromDbOrders(orders)
+		return nil
+	})
+
+	api.Respond(w, r, ordersResp, err)
+}
+
+func (api *OpenBarAPI) createOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var req wire.MakeRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || len(req.FluidVolumes) == 0 {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	if err := api.checkEStop(); err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	order := req.ToDbOrder()
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.CreateOrder(ctx, tx, order)
+		if err != nil {
+			return fmt.Errorf("error creating order: %w", err)
+		}
+
+		return tx.Commit()
+	})
+
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	api.notifyOrderQueue()
+	api.Respond(w, r, wire.FromDbOrders([]openbardb.Order{*order})[0], nil)
+}
+
+// OrderHandler handles requests to /orders/{id}
+func (api *OpenBarAPI) OrderHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getOrder(ctx, w, r)
+	case http.MethodPatch:
+		api.moveOrder(ctx, w, r)
+	case http.MethodDelete:
+		api.cancelOrder(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPatch, http.MethodDelete}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func orderIdFromPath(r *http.Request) (string, error) {
+	tokens := apis.GetPathTokens(r)
+	if len(tokens) != 2 {
+		return "", apis.ErrBadRequest
+	}
+
+	return tokens[1], nil
+}
+
+func (api *OpenBarAPI) getOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id, err := orderIdFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var orderResp wire.Order
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		order, err := openbardb.GetOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		orderResp = wire.FromDbOrders([]openbardb.Order{*order})[0]
+		return nil
+	})
+
+	api.Respond(w, r, orderResp, err)
+}
+
+func (api *OpenBarAPI) moveOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id, err := orderIdFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var req wire.OrderUpdate
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.MoveOrder(ctx, tx, id, req.Position)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
+
+func (api *OpenBarAPI) cancelOrder(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id, err := orderIdFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		order, err := openbardb.GetOrder(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		switch order.Status {
+		case openbardb.OrderQueued:
+			err = openbardb.SetOrderStatus(ctx, tx, id, openbardb.OrderCancelled, "")
+			if err != nil {
+				return err
+			}
+
+			return tx.Commit()
+		case openbardb.OrderPouring:
+			// the order worker records the cancellation once the pour stops
+			api.mu.Lock()
+			defer api.mu.Unlock()
+
+			if api.pouringOrderId != id {
+				return fmt.Errorf("order '%s' is finishing: %w", id, apis.ErrConflict)
+			}
+
+			api.cancelPouringOrder()
+			return nil
+		default:
+			return fmt.Errorf("order '%s' is already %s: %w", id, order.Status, apis.ErrBadRequest)
+		}
+	})
+
+	api.Respond(w, r, nil, err)
+}
+
+func (api *OpenBarAPI) notifyOrderQueue() {
+	select {
+	case api.orderCh <- struct{}{}:
+	default:
+	}
+}
+
+// RunOrderQueue pours queued orders one at a time until the context is cancelled. Orders left pouring by a previous
+// run of the server are marked as failed before the queue starts.
+func (api *OpenBarAPI) RunOrderQueue(ctx context.Context) error {
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.FailInterruptedOrders(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for {
+		poured, err := api.pourNextOrder(ctx)
+		if err != nil {
+			api.Logger().Info("Error pouring order", zap.Error(err))
+		}
+
+		if poured {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-api.orderCh:
+		case <-time.After(orderPollInterval):
+		}
+	}
+}
+
+// pourNextOrder pours the next queued order. It returns false if there were no orders in the queue.
+func (api *OpenBarAPI) pourNextOrder(ctx context.Context) (bool, error) {
+	orderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var order *openbardb.Order
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		order, err = openbardb.NextQueuedOrder(ctx, tx)
+		if err != nil || order == nil {
+			return err
+		}
+
+		err = openbardb.SetOrderStatus(ctx, tx, order.Id, openbardb.OrderPouring, "")
+		if err != nil {
+			return err
+		}
+
+		// the order can be cancelled as soon as it's seen as pouring
+		api.setPouringOrder(order.Id, cancel)
+		return tx.Commit()
+	})
+
+	if err != nil || order == nil {
+		api.setPouringOrder("", nil)
+		return false, err
+	}
+
+	resp, pourErr := api.makeDrink(orderCtx, wire.MakeRequestFromDbOrder(order))
+	api.setPouringOrder("", nil)
+
+	// an order cancelled before its pumps start fails at whichever step of making it noticed the cancellation
+	status := openbardb.OrderDone
+	errMsg := ""
+	if pourErr != nil && orderCtx.Err() == nil {
+		status = openbardb.OrderFailed
+		errMsg = pourErr.Error()
+	} else if pourErr != nil || resp.Cancelled {
+		status = openbardb.OrderCancelled
+	}
+
+	// the status is recorded even if ctx was cancelled so the order isn't left pouring
+	err = api.Transaction(context.Background(), func(tx *dbr.Tx) error {
+		err := openbardb.SetOrderStatus(context.Background(), tx, order.Id, status, errMsg)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	return true, err
+}
+
+// setPouringOrder sets the order being poured and the function which cancels it
+func (api *OpenBarAPI) setPouringOrder(id string, cancel context.CancelFunc) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.pouringOrderId = id
+	api.cancelPouringOrder = cancel
+}
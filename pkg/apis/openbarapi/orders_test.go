@@ -0,0 +1,181 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+	"time"
+)
+
+func (s *testSuite) createOrder(fluidVols ...wire.FluidVolume) wire.Order {
+	respWr := s.handle(http.MethodPost, "/orders", wire.MakeRequest{FluidVolumes: fluidVols})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var order wire.Order
+	err := json.Unmarshal(respWr.Body(), &order)
+	s.Require().NoError(err)
+
+	return order
+}
+
+func (s *testSuite) getOrder(id string) wire.Order {
+	respWr := s.handle(http.MethodGet, "/orders/"+id, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var order wire.Order
+	err := json.Unmarshal(respWr.Body(), &order)
+	s.Require().NoError(err)
+
+	return order
+}
+
+func (s *testSuite) TestOrders() {
+	ctx := context.Background()
+	s.setupBar(ctx, 100)
+
+	first := s.createOrder(wire.FluidVolume{Fluid: "gin", VolumeMl: 20})
+	second := s.createOrder(wire.FluidVolume{Fluid: "unknown", VolumeMl: 20})
+	third := s.createOrder(wire.FluidVolume{Fluid: "campari", VolumeMl: 20})
+	fourth := s.createOrder(wire.FluidVolume{Fluid: "vodka", VolumeMl: 20})
+	s.Require().Equal("queued", first.Status)
+
+	respWr := s.handle(http.MethodPatch, "/orders/"+third.Id, wire.OrderUpdate{Position: 0})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodDelete, "/orders/"+fourth.Id, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodGet, "/orders?status=queued", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var queued []wire.Order
+	err := json.Unmarshal(respWr.Body(), &queued)
+	s.Require().NoError(err)
+	s.Require().Len(queued, 3)
+	s.Require().Equal(third.Id, queued[0].Id)
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- s.Api.RunOrderQueue(ctx)
+	}()
+
+	s.Require().Eventually(func() bool {
+		return s.getOrder(second.Id).Status == "failed"
+	}, 5*time.Second, 50*time.Millisecond)
+	cancel()
+	s.Require().NoError(<-done)
+
+	s.Require().Equal("done", s.getOrder(third.Id).Status)
+	s.Require().Equal("cancelled", s.getOrder(fourth.Id).Status)
+
+	failed := s.getOrder(second.Id)
+	s.Require().Equal("failed", failed.Status)
+	s.Require().NotEmpty(failed.Error)
+
+	done1 := s.getOrder(first.Id)
+	s.Require().NotNil(done1.StartedAt)
+	s.Require().NotNil(done1.FinishedAt)
+
+	respWr = s.handle(http.MethodDelete, "/orders/"+first.Id, nil)
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+}
+
+func (s *testSuite) TestOrdersTakeTurnsWithMakes() {
+	ctx := context.Background()
+	s.setupPumpsAndFluids(ctx, []openbardb.Fluid{{Idx: 0, Fluid: util.Ptr("gin")}}, pumpsOfSpeed(100, 8))
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- s.Api.RunOrderQueue(ctx)
+	}()
+	defer func() {
+		cancel()
+		s.Require().NoError(<-done)
+	}()
+
+	order := s.createOrder(wire.FluidVolume{Fluid: "gin", VolumeMl: 30})
+	s.Require().Eventually(func() bool {
+		return s.getOrder(order.Id).Status == "pouring"
+	}, time.Second, 5*time.Millisecond)
+
+	// a direct make waits for the pouring order rather than failing on its pump
+	respWr := s.handle(http.MethodPost, "/make", wire.MakeRequest{FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 10}}})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var makeResp wire.MakeResponse
+	s.Require().NoError(json.Unmarshal(respWr.Body(), &makeResp))
+	s.Require().False(makeResp.Cancelled)
+	s.isClose(100*time.Millisecond, time.Duration(makeResp.RunTimesMs[0])*time.Millisecond)
+	s.Require().Eventually(func() bool {
+		return s.getOrder(order.Id).Status == "done"
+	}, time.Second, 10*time.Millisecond)
+
+	// an order is cancelled as soon as it's seen pouring
+	order = s.createOrder(wire.FluidVolume{Fluid: "gin", VolumeMl: 100})
+	s.Require().Eventually(func() bool {
+		return s.getOrder(order.Id).Status == "pouring"
+	}, time.Second, 5*time.Millisecond)
+
+	respWr = s.handle(http.MethodDelete, "/orders/"+order.Id, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	s.Require().Eventually(func() bool {
+		return s.getOrder(order.Id).Status == "cancelled"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *testSuite) TestSteppedOrders() {
+	ctx := context.Background()
+	s.setupPumpsAndFluids(ctx, []openbardb.Fluid{{Idx: 0, Fluid: util.Ptr("gin")}, {Idx: 1, Fluid: util.Ptr("tonic")}}, pumpsOfSpeed(100, 8))
+
+	req := wire.MakeRequest{
+		FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 20}, {Fluid: "tonic", VolumeMl: 10, Step: 1, Speed: 0.5}},
+		StepDelaysMs: []uint{0, 300},
+		RecipeId:     util.Ptr("gin-and-tonic"),
+	}
+	respWr := s.handle(http.MethodPost, "/orders", req)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var order wire.Order
+	s.Require().NoError(json.Unmarshal(respWr.Body(), &order))
+
+	// the steps, speeds and recipe of the order are queued with it
+	err := s.Transaction(ctx, func(tx *dbr.Tx) error {
+		dbOrder, err := openbardb.GetOrder(ctx, tx, order.Id)
+		s.Require().NoError(err)
+
+		queued := wire.MakeRequestFromDbOrder(dbOrder)
+		s.Require().ElementsMatch(req.FluidVolumes, queued.FluidVolumes)
+		s.Require().Equal(req.StepDelaysMs, queued.StepDelaysMs)
+		s.Require().Equal(req.RecipeId, queued.RecipeId)
+		return nil
+	})
+	s.Require().NoError(err)
+
+	thw := s.testHardware()
+	tonicRuntime := thw.TimeRun(1)
+	tonicSpeeds := len(thw.SpeedChanges(1))
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	start := time.Now()
+	go func() {
+		done <- s.Api.RunOrderQueue(ctx)
+	}()
+
+	s.Require().Eventually(func() bool {
+		return s.getOrder(order.Id).Status == "done"
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	s.Require().NoError(<-done)
+
+	// tonic is poured at half speed after the gin and the delay of its step
+	s.Require().GreaterOrEqual(time.Since(start), 700*time.Millisecond)
+	s.Require().InDelta(200*time.Millisecond, thw.TimeRun(1)-tonicRuntime, float64(30*time.Millisecond))
+	s.Require().Equal(0.5, thw.SpeedChanges(1)[tonicSpeeds])
+}
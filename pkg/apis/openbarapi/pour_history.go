@@ -0,0 +1,137 @@
+package openbarapi
+
+import (
+	"context"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultPourPageSize = 50
+	maxPourPageSize     = 500
+)
+
+// PoursHandler handles requests to /pours. The history can be filtered with the from and to query parameters, which
+// are RFC 3339 timestamps, and paged with the limit and offset query parameters.
+func (api *OpenBarAPI) PoursHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getPours(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getPours(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	filter, err := pourFilterFromQuery(r.URL.Query())
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	resp := wire.PourPage{
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	}
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		resp.Total, err = openbardb.CountPours(ctx, tx, filter)
+		if err != nil {
+			return err
+		}
+
+		pours, err := openbardb.ListPours(ctx, tx, filter)
+		if err != nil {
+			return err
+		}
+
+		resp.Pours = wire.FromDbPours(pours)
+		return nil
+	})
+
+	api.Respond(w, r, resp, err)
+}
+
+func pourFilterFromQuery(query url.Values) (openbardb.PourFilter, error) {
+	filter := openbardb.PourFilter{Limit: defaultPourPageSize}
+	for _, param := range []string{"from", "to"} {
+		if val := query.Get(param); val != "" {
+			t, err := time.Parse(time.RFC3339, val)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s time '%s': %w", param, val, apis.ErrBadRequest)
+			}
+
+			if param == "from" {
+				filter.From = &t
+			} else {
+				filter.To = &t
+			}
+		}
+	}
+
+	if val := query.Get("limit"); val != "" {
+		limit, err := strconv.ParseUint(val, 10, 64)
+		if err != nil || limit == 0 || limit > maxPourPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d: %w", maxPourPageSize, apis.ErrBadRequest)
+		}
+
+		filter.Limit = limit
+	}
+
+	if val := query.Get("offset"); val != "" {
+		offset, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid offset '%s': %w", val, apis.ErrBadRequest)
+		}
+
+		filter.Offset = offset
+	}
+
+	return filter, nil
+}
+
+// PourHandler handles requests to /pours/{id}
+func (api *OpenBarAPI) PourHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getPour(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getPour(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	tokens := apis.GetPathTokens(r)
+	if len(tokens) != 2 {
+		api.Respond(w, r, nil, apis.ErrNotFound)
+		return
+	}
+
+	var pourResp wire.Pour
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		pour, err := openbardb.GetPour(ctx, tx, tokens[1])
+		if err != nil {
+			return err
+		}
+
+		pourResp = wire.FromDbPours([]openbardb.Pour{*pour})[0]
+		return nil
+	})
+
+	api.Respond(w, r, pourResp, err)
+}
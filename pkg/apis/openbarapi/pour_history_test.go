@@ -0,0 +1,94 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+func (s *testSuite) TestPourHistory() {
+	ctx := context.Background()
+	s.setupBar(ctx, 100)
+
+	getPours := func(query string) wire.PourPage {
+		respWr := s.handle(http.MethodGet, "/pours?"+query, nil)
+		s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+		var page wire.PourPage
+		err := json.Unmarshal(respWr.Body(), &page)
+		s.Require().NoError(err)
+		return page
+	}
+
+	start := time.Now().Add(-time.Second)
+	respWr := s.handle(http.MethodPost, "/make", wire.MakeRequest{
+		FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 20}, {Fluid: "campari", VolumeMl: 10}},
+		RecipeId:     util.Ptr("recipe1"),
+	})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var makeResp wire.MakeResponse
+	err := json.Unmarshal(respWr.Body(), &makeResp)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(makeResp.PourId)
+
+	respWr = s.handle(http.MethodPost, "/make", wire.MakeRequest{FluidVolumes: []wire.FluidVolume{{Fluid: "rum", VolumeMl: 20}}})
+	s.Require().Equal(http.StatusInternalServerError, respWr.StatusCode())
+
+	page := getPours("")
+	s.Require().Equal(2, page.Total)
+	s.Require().Len(page.Pours, 2)
+
+	var completed, failed wire.Pour
+	for _, p := range page.Pours {
+		if p.Id == makeResp.PourId {
+			completed = p
+		} else {
+			failed = p
+		}
+	}
+
+	s.Require().Equal(string(openbardb.PourCompleted), completed.Outcome)
+	s.Require().Equal("recipe1", *completed.RecipeId)
+	s.Require().InDelta(200, completed.DurationMs, 20)
+	s.Require().Len(completed.Fluids, 2)
+	for _, f := range completed.Fluids {
+		if f.Fluid == "gin" {
+			s.Require().Equal(0, *f.PumpIdx)
+			s.Require().InDelta(20.0, f.DispensedMl, 2.0)
+		} else {
+			s.Require().Equal(3, *f.PumpIdx)
+			s.Require().InDelta(10.0, f.DispensedMl, 2.0)
+		}
+	}
+
+	s.Require().Equal(string(openbardb.PourFailed), failed.Outcome)
+	s.Require().Contains(failed.Error, "rum")
+	s.Require().Nil(failed.Fluids[0].PumpIdx)
+
+	respWr = s.handle(http.MethodGet, "/pours/"+makeResp.PourId, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	page = getPours("limit=1&offset=1")
+	s.Require().Equal(2, page.Total)
+	s.Require().Len(page.Pours, 1)
+
+	page = getPours("from=" + url.QueryEscape(start.Add(time.Hour).Format(time.RFC3339)))
+	s.Require().Equal(0, page.Total)
+	s.Require().Empty(page.Pours)
+
+	page = getPours("from=" + url.QueryEscape(start.Format(time.RFC3339)) + "&to=" + url.QueryEscape(start.Add(time.Hour).Format(time.RFC3339)))
+	s.Require().Equal(2, page.Total)
+
+	respWr = s.handle(http.MethodGet, "/pours?limit=0", nil)
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+	respWr = s.handle(http.MethodGet, "/pours?from=yesterday", nil)
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+	respWr = s.handle(http.MethodGet, "/pours/noexist", nil)
+	s.Require().Equal(http.StatusNotFound, respWr.StatusCode())
+}
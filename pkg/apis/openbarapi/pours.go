@@ -0,0 +1,225 @@
+package openbarapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/events"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"time"
+)
+
+const (
+	// pourProgressInterval is how often progress events are published while a pour is running
+	pourProgressInterval = 250 * time.Millisecond
+	// pourLeaseGrace is how much longer than the pour's total time its lease on the pumps lasts
+	pourLeaseGrace = 5 * time.Second
+)
+
+// startPour creates a context for a pour which is cancelled when the request context is cancelled, or when
+// CancelPours is called. The returned function must be called once the pour completes.
+func (api *OpenBarAPI) startPour(ctx context.Context) (context.Context, uint64, func()) {
+	pourCtx, cancel := context.WithCancel(ctx)
+
+	api.mu.Lock()
+	id := api.nextPourId
+	api.nextPourId++
+	api.pours[id] = cancel
+	api.mu.Unlock()
+
+	return pourCtx, id, func() {
+		api.mu.Lock()
+		delete(api.pours, id)
+		api.mu.Unlock()
+
+		cancel()
+	}
+}
+
+// runPour runs the pumps for the given times with opts as a cancellable pour, publishing start, progress and finish
+// events. It returns how long each pump ran.
+func (api *OpenBarAPI) runPour(ctx context.Context, direction hardware.PumpState, times []time.Duration, opts hardware.RunOptions) ([]time.Duration, error) {
+	return api.runLeasedSteps(ctx, hardware.RequesterPour, direction, []hardware.PourStep{{Times: times}}, opts)
+}
+
+// runPourSteps runs the steps of a pour in order as a single cancellable pour, publishing start, progress and finish
+// events. It returns how long each pump ran in total. Pours are refused while the emergency stop is latched, if they
+// would use a faulted pump, and if their pumps are leased to cleaning or another pour. Pumps run manually are stopped.
+func (api *OpenBarAPI) runPourSteps(ctx context.Context, direction hardware.PumpState, steps []hardware.PourStep) ([]time.Duration, error) {
+	return api.runLeasedSteps(ctx, hardware.RequesterPour, direction, steps, hardware.RunOptions{})
+}
+
+// runLeasedSteps runs the steps of a pour like runPourSteps with opts, with its pumps leased to requester. The observer
+// of opts is replaced by one that publishes the pump state changes of the pour.
+func (api *OpenBarAPI) runLeasedSteps(ctx context.Context, requester hardware.Requester, direction hardware.PumpState, steps []hardware.PourStep, opts hardware.RunOptions) ([]time.Duration, error) {
+	lease, err := api.leaseSteps(requester, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	return api.runLeaseSteps(ctx, lease, direction, steps, opts)
+}
+
+// stepTimes returns the total time each pump runs for in steps
+func (api *OpenBarAPI) stepTimes(steps []hardware.PourStep) []time.Duration {
+	times := make([]time.Duration, api.hw.NumPumps())
+	for _, step := range steps {
+		for i := range step.Times {
+			if i < len(times) {
+				times[i] += step.Times[i]
+			}
+		}
+	}
+
+	return times
+}
+
+// leaseSteps checks that the pumps of steps can run, and leases them to requester for long enough to run the steps. It
+// returns a nil lease if the steps run no pumps.
+func (api *OpenBarAPI) leaseSteps(requester hardware.Requester, steps []hardware.PourStep) (*hardware.Lease, error) {
+	if err := api.checkEStop(); err != nil {
+		return nil, err
+	}
+
+	times := api.stepTimes(steps)
+	if err := hardware.CheckPumps(api.hw, times); err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), apis.ErrConflict)
+	}
+
+	return api.acquirePumps(requester, times, hardware.StepsDuration(api.hw, steps)+pourLeaseGrace)
+}
+
+// runLeaseSteps runs the steps of a pour with opts on the pumps of lease, releasing it once they finish. A nil lease
+// runs no pumps, so only the delays of the steps are waited out.
+func (api *OpenBarAPI) runLeaseSteps(ctx context.Context, lease *hardware.Lease, direction hardware.PumpState, steps []hardware.PourStep, opts hardware.RunOptions) ([]time.Duration, error) {
+	if lease != nil {
+		defer lease.Release()
+	}
+
+	times := api.stepTimes(steps)
+	total := hardware.StepsDuration(api.hw, steps)
+	pourCtx, id, endPour := api.startPour(ctx)
+	defer endPour()
+
+	api.events.Publish(events.PourStarted, wire.PourStartedEvent{
+		PourId:     id,
+		RunTimesMs: durationsToMs(times),
+		TotalMs:    total.Milliseconds(),
+	})
+
+	done := make(chan struct{})
+	go api.publishPourProgress(id, total, done)
+
+	opts.Observer = api.publishPumpState
+
+	var ran []time.Duration
+	var err error
+	if lease != nil {
+		ran, err = lease.RunStepsCtx(pourCtx, direction, steps, opts)
+	} else {
+		// no pump runs, so only the delays of the steps are waited out
+		ran, err = hardware.RunStepsCtx(pourCtx, api.hw, direction, steps, opts)
+	}
+	close(done)
+
+	finished := wire.PourFinishedEvent{
+		PourId:     id,
+		RunTimesMs: durationsToMs(ran),
+		Cancelled:  errors.Is(err, context.Canceled),
+	}
+	if err != nil && !finished.Cancelled {
+		finished.Error = err.Error()
+	}
+	api.events.Publish(events.PourFinished, finished)
+
+	return ran, err
+}
+
+// acquirePumps leases every pump with a time greater than zero to requester for ttl. It returns a nil lease if there
+// are no such pumps, and a conflict error if any of them are leased to a requester that can't be preempted.
+func (api *OpenBarAPI) acquirePumps(requester hardware.Requester, times []time.Duration, ttl time.Duration) (*hardware.Lease, error) {
+	pumps := timedPumps(times)
+	if len(pumps) == 0 {
+		return nil, nil
+	}
+
+	lease, err := api.ctrl.Acquire(requester, pumps, ttl)
+	if errors.Is(err, hardware.ErrPumpBusy) {
+		return nil, fmt.Errorf("%w: %w", err, apis.ErrConflict)
+	}
+
+	return lease, err
+}
+
+// timedPumps returns the pumps with a time greater than zero
+func timedPumps(times []time.Duration) []int {
+	var pumps []int
+	for i, t := range times {
+		if t > 0 {
+			pumps = append(pumps, i)
+		}
+	}
+
+	return pumps
+}
+
+func (api *OpenBarAPI) publishPourProgress(id uint64, total time.Duration, done <-chan struct{}) {
+	start := time.Now()
+	ticker := time.NewTicker(pourProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		elapsed := min(time.Since(start), total)
+		progress := 1.0
+		if total > 0 {
+			progress = float64(elapsed) / float64(total)
+		}
+
+		api.events.Publish(events.PourProgress, wire.PourProgressEvent{
+			PourId:    id,
+			ElapsedMs: elapsed.Milliseconds(),
+			TotalMs:   total.Milliseconds(),
+			Progress:  progress,
+		})
+	}
+}
+
+func (api *OpenBarAPI) publishPumpState(idx int, state hardware.PumpState) {
+	api.events.Publish(events.PumpState, wire.PumpStateEvent{
+		Idx:   idx,
+		State: state.String(),
+	})
+}
+
+func durationsToMs(durations []time.Duration) []int64 {
+	ms := make([]int64, len(durations))
+	for i := range durations {
+		ms[i] = durations[i].Milliseconds()
+	}
+
+	return ms
+}
+
+// CancelPours cancels all in-flight pours and stops any pumps started asynchronously or being jogged. It returns the
+// number of pours that were cancelled.
+func (api *OpenBarAPI) CancelPours() int {
+	api.mu.Lock()
+	n := len(api.pours)
+	for id, cancel := range api.pours {
+		cancel()
+		delete(api.pours, id)
+	}
+	api.mu.Unlock()
+
+	api.stopAsync()
+	api.stopJogs()
+	return n
+}
@@ -0,0 +1,309 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// LoadPumpUsage restores the persisted runtime of each pump into the hardware so that pump balancing and usage
+// tracking survive restarts.
+func (api *OpenBarAPI) LoadPumpUsage(ctx context.Context) error {
+	var usage []openbardb.PumpUsage
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		var err error
+		usage, err = openbardb.ListPumpUsage(ctx, tx)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	for _, u := range usage {
+		if u.Idx < 0 || u.Idx >= api.hw.NumPumps() {
+			continue
+		}
+
+		api.hw.SetTimeRun(u.Idx, u.Runtime())
+		api.syncedRuntimes[u.Idx] = u.Runtime()
+	}
+
+	return nil
+}
+
+// bottleCredit is pump runtime which didn't take fluid from the pump's bottle, and fluid which was returned to it
+type bottleCredit struct {
+	runtime    time.Duration
+	returnedMl float64
+}
+
+// creditBottle keeps runtime of pump idx out of the volume the next SyncPumpUsage subtracts from its bottle, and adds
+// returnedMl to the bottle. The runtime still counts as pump usage.
+func (api *OpenBarAPI) creditBottle(idx int, runtime time.Duration, returnedMl float64) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	credit := api.bottleCredits[idx]
+	credit.runtime += runtime
+	credit.returnedMl += returnedMl
+	api.bottleCredits[idx] = credit
+}
+
+// dispensedRun is pump runtime whose dispensed volume is known, such as a pour at a speed other than full speed
+type dispensedRun struct {
+	runtime     time.Duration
+	dispensedMl float64
+}
+
+// recordDispensed has the next SyncPumpUsage count dispensedMl, rather than the full speed flow rate, for runtime of
+// pump idx
+func (api *OpenBarAPI) recordDispensed(idx int, runtime time.Duration, dispensedMl float64) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	run := api.dispensedRuns[idx]
+	run.runtime += runtime
+	run.dispensedMl += dispensedMl
+	api.dispensedRuns[idx] = run
+}
+
+// SyncPumpUsage writes the runtime accumulated by the hardware since the last sync to the database along with the
+// volume dispensed in that time, which is also subtracted from each pump's bottle less any bottle credits. Runtime is
+// counted at the pump's full speed flow rate unless its dispensed volume was recorded.
+func (api *OpenBarAPI) SyncPumpUsage(ctx context.Context) error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	deltas := make(map[int]time.Duration)
+	for i := 0; i < api.hw.NumPumps(); i++ {
+		runtime := api.hw.TimeRun(i)
+		synced := api.syncedRuntimes[i]
+
+		if runtime < synced {
+			// the hardware runtimes were reset
+			api.syncedRuntimes[i] = runtime
+		} else if delta := (runtime - synced).Truncate(time.Millisecond); delta > 0 {
+			deltas[i] = delta
+		}
+	}
+
+	if len(deltas) == 0 && len(api.bottleCredits) == 0 && len(api.dispensedRuns) == 0 {
+		return nil
+	}
+
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		pumps, err := openbardb.ListPumps(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("failed to list pumps: %w", err)
+		}
+
+		for _, pump := range pumps {
+			delta := deltas[pump.Idx]
+			credit := api.bottleCredits[pump.Idx]
+			run := api.dispensedRuns[pump.Idx]
+
+			// a run recorded before the hardware counted its runtime is corrected by the next sync
+			dispensedMl := (delta-run.runtime).Seconds()*pump.MlPerSec + run.dispensedMl
+			if delta > 0 || dispensedMl != 0 {
+				err = openbardb.AddPumpUsage(ctx, tx, pump.Idx, delta, dispensedMl)
+				if err != nil {
+					return err
+				}
+			}
+
+			bottleMl := dispensedMl - credit.runtime.Seconds()*pump.MlPerSec - credit.returnedMl
+			if bottleMl != 0 {
+				err = openbardb.DecrementBottle(ctx, tx, pump.Idx, bottleMl)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Commit()
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to sync pump usage: %w", err)
+	}
+
+	for idx, delta := range deltas {
+		api.syncedRuntimes[idx] += delta
+	}
+
+	clear(api.bottleCredits)
+	clear(api.dispensedRuns)
+
+	return nil
+}
+
+// SyncPumpUsagePeriodically syncs pump usage to the database every interval until the context is cancelled.
+func (api *OpenBarAPI) SyncPumpUsagePeriodically(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		err := api.SyncPumpUsage(ctx)
+		if err != nil {
+			api.Logger().Info("Error syncing pump usage", zap.Error(err))
+		}
+	}
+}
+
+// PumpsUsageHandler handles requests to /pumps/usage
+func (api *OpenBarAPI) PumpsUsageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getPumpsUsage(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getPumpsUsage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	err := api.SyncPumpUsage(ctx)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var usageResp []wire.PumpUsage
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		usage, err := openbardb.ListPumpUsage(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		usageResp = wire.FromDbPumpUsage(usage)
+		return nil
+	})
+
+	api.Respond(w, r, usageResp, err)
+}
+
+// PumpUsageHandler handles requests to /pumps/{idx}/usage
+func (api *OpenBarAPI) PumpUsageHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getPumpUsage(ctx, w, r)
+	case http.MethodPatch:
+		api.setPumpServiceIntervals(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPatch}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getPumpUsage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	err = api.SyncPumpUsage(ctx)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var usageResp wire.PumpUsage
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		usage, err := openbardb.GetPumpUsage(ctx, tx, idx)
+		if err != nil {
+			return err
+		}
+
+		usageResp = wire.FromDbPumpUsage([]openbardb.PumpUsage{*usage})[0]
+		return nil
+	})
+
+	api.Respond(w, r, usageResp, err)
+}
+
+func (api *OpenBarAPI) setPumpServiceIntervals(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var req wire.PumpServiceIntervals
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.SetPumpServiceIntervals(ctx, tx, idx, req.ServiceIntervalMl, req.ServiceIntervalRuntimeMs)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
+
+// PumpServiceHandler handles requests to /pumps/{idx}/service which mark a pump's tubing as replaced
+func (api *OpenBarAPI) PumpServiceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodPost:
+		api.servicePump(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) servicePump(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	// make sure usage prior to the service is not counted against the new tubing
+	err = api.SyncPumpUsage(ctx)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.MarkPumpServiced(ctx, tx, idx, time.Now())
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
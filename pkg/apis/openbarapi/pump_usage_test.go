@@ -0,0 +1,109 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+	"time"
+)
+
+func (s *testSuite) TestPumpUsage() {
+	ctx := context.Background()
+	err := s.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.SetConfig(ctx, tx, map[string]string{openbardb.NumPumpsConfigKey: "8"})
+		s.Require().NoError(err)
+
+		err = openbardb.UpdatePumps(ctx, tx, pumpsOfSpeed(10, 8))
+		s.Require().NoError(err)
+
+		err = openbardb.AddPumpUsage(ctx, tx, 2, 5*time.Second, 50)
+		s.Require().NoError(err)
+
+		return tx.Commit()
+	})
+	s.Require().NoError(err)
+
+	err = s.Api.LoadPumpUsage(ctx)
+	s.Require().NoError(err)
+
+	thw := s.testHardware()
+	s.Require().Equal(5*time.Second, thw.TimeRun(2))
+
+	times := make([]time.Duration, 8)
+	times[2] = 100 * time.Millisecond
+	err = thw.RunForTimes(hardware.Forward, times)
+	s.Require().NoError(err)
+
+	respWr := s.handle(http.MethodPatch, "/pumps/2/usage", wire.PumpServiceIntervals{ServiceIntervalMl: util.Ptr(50.0)})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodGet, "/pumps/usage", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var usage []wire.PumpUsage
+	err = json.Unmarshal(respWr.Body(), &usage)
+	s.Require().NoError(err)
+	s.Require().Len(usage, 8)
+	s.isClose(5100*time.Millisecond, time.Duration(usage[2].RuntimeMs)*time.Millisecond)
+	s.Require().InDelta(51.0, usage[2].DispensedMl, 0.1)
+	s.Require().True(usage[2].NeedsService)
+	s.Require().NotEmpty(usage[2].Warning)
+	s.Require().False(usage[3].NeedsService)
+
+	respWr = s.handle(http.MethodPost, "/pumps/2/service", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodGet, "/pumps/2/usage", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var pumpUsage wire.PumpUsage
+	err = json.Unmarshal(respWr.Body(), &pumpUsage)
+	s.Require().NoError(err)
+	s.Require().False(pumpUsage.NeedsService)
+	s.Require().Equal(0.0, pumpUsage.ServiceDispensedMl)
+	s.Require().NotNil(pumpUsage.ServicedAt)
+}
+
+func (s *testSuite) TestPumpUsageAtSpeed() {
+	ctx := context.Background()
+	s.setupPumpsAndFluids(ctx, []openbardb.Fluid{{Idx: 0, Fluid: util.Ptr("gin")}}, pumpsOfSpeed(100, 8))
+	s.Require().NoError(s.Api.SyncPumpUsage(ctx))
+
+	err := s.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.ReplaceBottle(ctx, tx, 0, 750, util.Ptr(500.0), time.Now())
+		s.Require().NoError(err)
+		return tx.Commit()
+	})
+	s.Require().NoError(err)
+
+	usage := func() wire.PumpUsage {
+		respWr := s.handle(http.MethodGet, "/pumps/0/usage", nil)
+		s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+		var pumpUsage wire.PumpUsage
+		s.Require().NoError(json.Unmarshal(respWr.Body(), &pumpUsage))
+		return pumpUsage
+	}
+	before := usage()
+
+	// at half speed the pump runs twice as long as at full speed, but dispenses the volume requested
+	respWr := s.handle(http.MethodPost, "/make", wire.MakeRequest{FluidVolumes: []wire.FluidVolume{{Fluid: "gin", VolumeMl: 10, Speed: 0.5}}})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	after := usage()
+	s.Require().InDelta(200, after.RuntimeMs-before.RuntimeMs, 30)
+	s.Require().InDelta(10.0, after.DispensedMl-before.DispensedMl, 2)
+
+	err = s.Transaction(ctx, func(tx *dbr.Tx) error {
+		bottle, err := openbardb.GetBottle(ctx, tx, 0)
+		s.Require().NoError(err)
+		s.Require().InDelta(490.0, bottle.RemainingMl, 2)
+		return nil
+	})
+	s.Require().NoError(err)
+}
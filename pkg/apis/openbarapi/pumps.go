@@ -0,0 +1,323 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/gocraft/dbr/v2"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxCalibrationDuration = 60 * time.Second
+
+// calibrationRun is the last calibration run of a pump, waiting for its measured volume
+type calibrationRun struct {
+	duration time.Duration
+	speed    float64
+}
+
+// PumpsHandler handles requests to /pumps
+func (api *OpenBarAPI) PumpsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getPumps(ctx, w, r)
+	case http.MethodPost:
+		api.updatePumps(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPost}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getPumps(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var pumpsResp wire.Pumps
+	err := api.Transaction(ctx, func(tx *dbr.Tx) error {
+		pumps, err := openbardb.ListPumps(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("error getting pumps from db: %w", err)
+		}
+
+		pumpsResp = wire.FromDbPumps(pumps)
+		return nil
+	})
+
+	api.Respond(w, r, pumpsResp, err)
+}
+
+func (api *OpenBarAPI) updatePumps(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	var pumpsReq wire.Pumps
+	err := json.NewDecoder(r.Body).Decode(&pumpsReq)
+	if err != nil {
+		api.Logger().Info("Error decoding request", zap.String("url", r.URL.String()), zap.String("method", r.Method), zap.Error(err))
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.UpdatePumps(ctx, tx, pumpsReq.ToDbPumps())
+		if errors.Is(err, openbardb.ErrInvalidPumpIdx) {
+			return fmt.Errorf("%s: %w", err.Error(), apis.ErrBadRequest)
+		} else if err != nil {
+			return fmt.Errorf("error updating pumps: %w", err)
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
+
+// PumpCalibrationHandler handles requests to /pumps/{idx}/calibrate. Calibrating a pump is a two-step process. A POST
+// runs the pump for a known duration, then a PATCH provides the volume that was measured so the pump's flow rate
+// can be computed and stored. On hardware that supports speed a pump can be calibrated at less than full speed, which
+// is used to pour at that speed without changing the pump's flow rate. A GET returns the pump's calibration history.
+func (api *OpenBarAPI) PumpCalibrationHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getPumpCalibrations(ctx, w, r)
+	case http.MethodPost:
+		api.runPumpCalibration(ctx, w, r)
+	case http.MethodPatch:
+		api.recordPumpCalibration(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPost, http.MethodPatch}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) pumpIdxFromPath(r *http.Request) (int, error) {
+	tokens := apis.GetPathTokens(r)
+	if len(tokens) < 2 {
+		return -1, apis.ErrBadRequest
+	}
+
+	idx, err := strconv.Atoi(tokens[1])
+	if err != nil {
+		return -1, fmt.Errorf("invalid pump index '%s': %w", tokens[1], apis.ErrBadRequest)
+	} else if idx < 0 || idx >= api.hw.NumPumps() {
+		return -1, fmt.Errorf("pump %d: %w", idx, apis.ErrNotFound)
+	}
+
+	return idx, nil
+}
+
+func (api *OpenBarAPI) getPumpCalibrations(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var calsResp []wire.PumpCalibration
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		cals, err := openbardb.ListPumpCalibrations(ctx, tx, idx)
+		if err != nil {
+			return err
+		}
+
+		calsResp = wire.FromDbPumpCalibrations(cals)
+		return nil
+	})
+
+	api.Respond(w, r, calsResp, err)
+}
+
+func (api *OpenBarAPI) runPumpCalibration(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var req wire.CalibrationRunRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	duration := time.Duration(req.DurationMs) * time.Millisecond
+	if duration <= 0 || duration > maxCalibrationDuration {
+		api.Respond(w, r, nil, fmt.Errorf("calibration duration must be between 0 and %s: %w", maxCalibrationDuration, apis.ErrBadRequest))
+		return
+	}
+
+	speed, err := api.calibrationSpeed(req.Speed)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	step := hardware.PourStep{Times: make([]time.Duration, api.hw.NumPumps())}
+	step.Times[idx] = duration
+	if speed != hardware.FullSpeed {
+		step.Profiles = make([]hardware.SpeedProfile, api.hw.NumPumps())
+		step.Profiles[idx].Speed = speed
+	}
+
+	_, err = api.runPourSteps(ctx, hardware.Forward, []hardware.PourStep{step})
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	api.mu.Lock()
+	api.calibrationRuns[idx] = calibrationRun{duration: duration, speed: speed}
+	api.mu.Unlock()
+
+	api.Respond(w, r, req, nil)
+}
+
+// calibrationSpeed returns the speed to calibrate at for the requested speed, where 0 is full speed
+func (api *OpenBarAPI) calibrationSpeed(speed float64) (float64, error) {
+	if speed < 0 || speed > hardware.FullSpeed {
+		return 0, fmt.Errorf("calibration speed must be between 0 and 1: %w", apis.ErrBadRequest)
+	} else if speed == 0 || speed == hardware.FullSpeed {
+		return hardware.FullSpeed, nil
+	} else if !hardware.SupportsSpeed(api.hw) {
+		return 0, fmt.Errorf("%s: %w", hardware.ErrSpeedNotSupported.Error(), apis.ErrBadRequest)
+	}
+
+	return speed, nil
+}
+
+func (api *OpenBarAPI) recordPumpCalibration(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var req wire.CalibrationMeasurementRequest
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	duration := time.Duration(req.DurationMs) * time.Millisecond
+	speed, err := api.calibrationSpeed(req.Speed)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	if duration == 0 {
+		api.mu.Lock()
+		run := api.calibrationRuns[idx]
+		api.mu.Unlock()
+
+		if run.duration == 0 {
+			api.Respond(w, r, nil, fmt.Errorf("no calibration run for pump %d: %w", idx, apis.ErrBadRequest))
+			return
+		}
+
+		duration, speed = run.duration, run.speed
+	}
+
+	cal, err := openbardb.NewPumpCalibration(idx, duration, req.VolumeMl, speed)
+	if err != nil {
+		api.Respond(w, r, nil, fmt.Errorf("%s: %w", err.Error(), apis.ErrBadRequest))
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.CalibratePump(ctx, tx, cal)
+		if err != nil {
+			return fmt.Errorf("error calibrating pump %d: %w", idx, err)
+		}
+
+		return tx.Commit()
+	})
+
+	if err == nil {
+		api.mu.Lock()
+		delete(api.calibrationRuns, idx)
+		api.mu.Unlock()
+	}
+
+	api.Respond(w, r, wire.FromDbPumpCalibrations([]openbardb.PumpCalibration{*cal})[0], err)
+}
+
+// PumpTubeHandler handles requests to /pumps/{idx}/tube. GET returns the volume of the pump's tube, which priming and
+// purging the pump fill and empty, and PATCH sets it.
+func (api *OpenBarAPI) PumpTubeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getPumpTube(ctx, w, r)
+	case http.MethodPatch:
+		api.setPumpTube(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPatch}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func (api *OpenBarAPI) getPumpTube(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	tubeResp := wire.PumpTube{Idx: idx}
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		pump, err := openbardb.GetPump(ctx, tx, idx)
+		if errors.Is(err, dbr.ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		tubeResp = wire.FromDbPumpTube(*pump)
+		return nil
+	})
+
+	api.Respond(w, r, tubeResp, err)
+}
+
+func (api *OpenBarAPI) setPumpTube(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	idx, err := api.pumpIdxFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var req wire.PumpTube
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.TubeVolumeMl < 0 {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.SetPumpTubeVolume(ctx, tx, idx, req.TubeVolumeMl)
+		if errors.Is(err, openbardb.ErrInvalidPumpIdx) {
+			return fmt.Errorf("%s: %w", err.Error(), apis.ErrBadRequest)
+		} else if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	req.Idx = idx
+	api.Respond(w, r, req, err)
+}
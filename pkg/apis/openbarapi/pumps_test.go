@@ -0,0 +1,82 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"net/http"
+	"time"
+)
+
+func (s *testSuite) TestPumpCalibration() {
+	ctx := context.Background()
+	fluids := make([]openbardb.Fluid, 8)
+	for i := range fluids {
+		fluids[i].Idx = i
+	}
+	s.setupPumpsAndFluids(ctx, fluids, pumpsOfSpeed(1, 8))
+
+	respWr := s.handle(http.MethodPatch, "/pumps/3/calibrate", wire.CalibrationMeasurementRequest{VolumeMl: 20})
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodPost, "/pumps/8/calibrate", wire.CalibrationRunRequest{DurationMs: 100})
+	s.Require().Equal(http.StatusNotFound, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodPost, "/pumps/3/calibrate", wire.CalibrationRunRequest{DurationMs: 200})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	thw := s.testHardware()
+	s.isClose(200*time.Millisecond, thw.TimeRun(3))
+
+	respWr = s.handle(http.MethodPatch, "/pumps/3/calibrate", wire.CalibrationMeasurementRequest{VolumeMl: 20})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var cal wire.PumpCalibration
+	err := json.Unmarshal(respWr.Body(), &cal)
+	s.Require().NoError(err)
+	s.Require().Equal(100.0, cal.MlPerSec)
+
+	respWr = s.handle(http.MethodGet, "/pumps", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var pumps wire.Pumps
+	err = json.Unmarshal(respWr.Body(), &pumps)
+	s.Require().NoError(err)
+	s.Require().Len(pumps, 8)
+	s.Require().Equal(100.0, pumps[3].MlPerSec)
+
+	respWr = s.handle(http.MethodPost, "/pumps", wire.Pumps{{Idx: 8, MlPerSec: 10}})
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodGet, "/pumps/3/calibrate", nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var cals []wire.PumpCalibration
+	err = json.Unmarshal(respWr.Body(), &cals)
+	s.Require().NoError(err)
+	s.Require().Len(cals, 1)
+	s.Require().Equal(int64(200), cals[0].DurationMs)
+	s.Require().Equal(1.0, cals[0].Speed)
+
+	respWr = s.handle(http.MethodPost, "/pumps/3/calibrate", wire.CalibrationRunRequest{DurationMs: 100, Speed: 2})
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodPost, "/pumps/3/calibrate", wire.CalibrationRunRequest{DurationMs: 100, Speed: 0.5})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	s.Require().Equal([]float64{0.5, hardware.FullSpeed}, thw.SpeedChanges(3))
+
+	respWr = s.handle(http.MethodPatch, "/pumps/3/calibrate", wire.CalibrationMeasurementRequest{VolumeMl: 4})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	err = json.Unmarshal(respWr.Body(), &cal)
+	s.Require().NoError(err)
+	s.Require().Equal(0.5, cal.Speed)
+	s.Require().Equal(40.0, cal.MlPerSec)
+
+	state, err := s.Api.loadPourState(ctx)
+	s.Require().NoError(err)
+	s.Require().Equal(100.0, state.pumps[3].MlPerSec)
+	s.Require().Len(state.speedCals[3], 1)
+}
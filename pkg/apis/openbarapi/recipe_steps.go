@@ -0,0 +1,146 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+)
+
+// RecipeStepsHandler handles requests to /recipes/{id}/steps which control the order a recipe's ingredients are poured
+// in when it is made with /make/recipe/{id}
+func (api *OpenBarAPI) RecipeStepsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		api.getRecipeSteps(ctx, w, r)
+	case http.MethodPost:
+		api.setRecipeSteps(ctx, w, r)
+	case http.MethodDelete:
+		api.deleteRecipeSteps(ctx, w, r)
+	case http.MethodOptions:
+		api.OptionsResponse([]string{http.MethodOptions, http.MethodGet, http.MethodPost, http.MethodDelete}, w, r)
+	default:
+		api.Respond(w, r, nil, apis.ErrMethodNotAllowed)
+	}
+}
+
+func recipeIdFromPath(r *http.Request) (string, error) {
+	tokens := apis.GetPathTokens(r)
+	if len(tokens) != 3 {
+		return "", apis.ErrNotFound
+	}
+
+	return tokens[1], nil
+}
+
+func (api *OpenBarAPI) getRecipeSteps(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id, err := recipeIdFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	recipe, err := api.getRecipe(ctx, id)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var stepsResp []wire.RecipeStep
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		steps, err := openbardb.GetRecipeSteps(ctx, tx, recipe.Id)
+		if err != nil {
+			return err
+		}
+
+		stepsResp = wire.FromDbRecipeSteps(steps)
+		return nil
+	})
+
+	api.Respond(w, r, stepsResp, err)
+}
+
+func (api *OpenBarAPI) setRecipeSteps(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id, err := recipeIdFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	var steps []wire.RecipeStep
+	err = json.NewDecoder(r.Body).Decode(&steps)
+	if err != nil {
+		api.Respond(w, r, nil, apis.ErrBadRequest)
+		return
+	}
+
+	recipe, err := api.getRecipe(ctx, id)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	inRecipe := make(map[string]bool)
+	for _, ing := range recipe.Ingredients {
+		inRecipe[ing.IngredientFk] = true
+	}
+
+	inStep := make(map[string]bool)
+	for i, step := range steps {
+		if len(step.Ingredients) == 0 {
+			api.Respond(w, r, nil, fmt.Errorf("step %d has no ingredients: %w", i, apis.ErrBadRequest))
+			return
+		} else if step.DelayMs < 0 {
+			api.Respond(w, r, nil, fmt.Errorf("step %d has a negative delay: %w", i, apis.ErrBadRequest))
+			return
+		}
+
+		for _, ing := range step.Ingredients {
+			if !inRecipe[ing] {
+				api.Respond(w, r, nil, fmt.Errorf("%s is not an ingredient of recipe '%s': %w", ing, recipe.Id, apis.ErrBadRequest))
+				return
+			} else if inStep[ing] {
+				api.Respond(w, r, nil, fmt.Errorf("%s is in more than one step: %w", ing, apis.ErrBadRequest))
+				return
+			}
+
+			inStep[ing] = true
+		}
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.SetRecipeSteps(ctx, tx, recipe.Id, wire.ToDbRecipeSteps(steps))
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
+
+func (api *OpenBarAPI) deleteRecipeSteps(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	id, err := recipeIdFromPath(r)
+	if err != nil {
+		api.Respond(w, r, nil, err)
+		return
+	}
+
+	err = api.Transaction(ctx, func(tx *dbr.Tx) error {
+		err := openbardb.DeleteRecipeSteps(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.Commit()
+	})
+
+	api.Respond(w, r, nil, err)
+}
@@ -0,0 +1,99 @@
+package openbarapi
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cocktailrobots/openbar-server/pkg/apis/wire"
+	"github.com/cocktailrobots/openbar-server/pkg/db/cocktailsdb"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"github.com/gocraft/dbr/v2"
+	"net/http"
+	"time"
+)
+
+func (s *testSuite) TestRecipeSteps() {
+	ctx := context.Background()
+
+	var recipe cocktailsdb.Recipe
+	err := s.CocktailsDB.Transaction(ctx, func(tx *dbr.Tx) error {
+		recipes, err := cocktailsdb.GetRecipes(ctx, tx)
+		s.Require().NoError(err)
+
+		for _, r := range recipes {
+			if len(r.Ingredients) >= 2 && len(r.Ingredients) <= 8 {
+				recipe = r
+				break
+			}
+		}
+
+		return nil
+	})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(recipe.Id)
+
+	fluids := make([]openbardb.Fluid, 8)
+	for i := range fluids {
+		fluids[i] = openbardb.Fluid{Idx: i, Fluid: util.Ptr("")}
+		if i < len(recipe.Ingredients) {
+			fluids[i].Fluid = util.Ptr(recipe.Ingredients[i].IngredientFk)
+		}
+	}
+	s.setupPumpsAndFluids(ctx, fluids, pumpsOfSpeed(1000, 8))
+
+	stepsUrl := "/recipes/" + recipe.Id + "/steps"
+	respWr := s.handle(http.MethodGet, stepsUrl, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	s.Require().JSONEq("[]", string(respWr.Body()))
+
+	first := recipe.Ingredients[0].IngredientFk
+	var rest []string
+	for _, ing := range recipe.Ingredients[1:] {
+		rest = append(rest, ing.IngredientFk)
+	}
+
+	steps := []wire.RecipeStep{{Ingredients: rest}, {Ingredients: []string{first}, DelayMs: 100}}
+	respWr = s.handle(http.MethodPost, stepsUrl, steps)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodGet, stepsUrl, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+
+	var stepsResp []wire.RecipeStep
+	err = json.Unmarshal(respWr.Body(), &stepsResp)
+	s.Require().NoError(err)
+	s.Require().Len(stepsResp, 2)
+	s.Require().ElementsMatch(rest, stepsResp[0].Ingredients)
+	s.Require().Equal([]string{first}, stepsResp[1].Ingredients)
+	s.Require().Equal(int64(100), stepsResp[1].DelayMs)
+
+	// the last ingredient is poured after the others and the delay
+	start := time.Now()
+	respWr = s.handle(http.MethodPost, "/make/recipe/"+recipe.Id, wire.MakeRecipeRequest{VolumeMl: 100})
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	s.Require().GreaterOrEqual(time.Since(start), 100*time.Millisecond)
+
+	var makeResp wire.MakeResponse
+	err = json.Unmarshal(respWr.Body(), &makeResp)
+	s.Require().NoError(err)
+	for _, fv := range makeResp.FluidVolumes {
+		if fv.Fluid == first {
+			s.Require().Equal(uint(1), fv.Step)
+		} else {
+			s.Require().Equal(uint(0), fv.Step)
+		}
+	}
+
+	respWr = s.handle(http.MethodPost, stepsUrl, []wire.RecipeStep{{Ingredients: []string{"not_an_ingredient"}}})
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+	respWr = s.handle(http.MethodPost, stepsUrl, []wire.RecipeStep{{Ingredients: []string{first}}, {Ingredients: []string{first}}})
+	s.Require().Equal(http.StatusBadRequest, respWr.StatusCode())
+	respWr = s.handle(http.MethodPost, "/recipes/noexist/steps", steps)
+	s.Require().Equal(http.StatusNotFound, respWr.StatusCode())
+
+	respWr = s.handle(http.MethodDelete, stepsUrl, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	respWr = s.handle(http.MethodGet, stepsUrl, nil)
+	s.Require().Equal(http.StatusOK, respWr.StatusCode())
+	s.Require().JSONEq("[]", string(respWr.Body()))
+}
@@ -0,0 +1,89 @@
+package openbarapi
+
+import (
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"time"
+)
+
+// pumpRun is how a pump is run to pour its volume. The pump runs at profile.Speed with a flow rate of mlPerSec, then
+// at profile.FinishSpeed with a flow rate of finishMlPerSec for the last profile.FinishDuration of its run time.
+type pumpRun struct {
+	runTime        time.Duration
+	profile        hardware.SpeedProfile
+	mlPerSec       float64
+	finishMlPerSec float64
+}
+
+// dispensedMl returns the volume poured by a pump following the run which was stopped after ran
+func (run pumpRun) dispensedMl(ran time.Duration) float64 {
+	mainTime := run.runTime - run.profile.FinishDuration
+	if ran <= mainTime {
+		return ran.Seconds() * run.mlPerSec
+	}
+
+	return mainTime.Seconds()*run.mlPerSec + (ran-mainTime).Seconds()*run.finishMlPerSec
+}
+
+// checkSpeed returns a bad request error if speed isn't a valid speed for a fluid, or if a speed is requested from
+// hardware that can't vary its pump speed. A speed of 0 is full speed.
+func (state pourState) checkSpeed(speed float64) error {
+	if speed < 0 || speed > hardware.FullSpeed {
+		return fmt.Errorf("invalid speed %f: must be between 0 and 1: %w", speed, apis.ErrBadRequest)
+	} else if speed != 0 && !state.speedSupported {
+		return fmt.Errorf("%s: %w", hardware.ErrSpeedNotSupported.Error(), apis.ErrBadRequest)
+	}
+
+	return nil
+}
+
+// flowRate returns the flow rate of pump idx at speed. Between calibrated speeds the rate is interpolated linearly,
+// assuming no flow when stopped and the pump's calibrated flow rate at full speed.
+func (state pourState) flowRate(idx int, speed float64) float64 {
+	mlPerSec := state.pumps[idx].MlPerSec
+	if speed <= 0 || speed >= hardware.FullSpeed {
+		return mlPerSec
+	}
+
+	prevSpeed, prevRate := 0.0, 0.0
+	for _, cal := range state.speedCals[idx] {
+		if speed <= cal.Speed {
+			return prevRate + (cal.MlPerSec-prevRate)*(speed-prevSpeed)/(cal.Speed-prevSpeed)
+		}
+
+		prevSpeed, prevRate = cal.Speed, cal.MlPerSec
+	}
+
+	return prevRate + (mlPerSec-prevRate)*(speed-prevSpeed)/(hardware.FullSpeed-prevSpeed)
+}
+
+// planPumpRun works out how to run a pump to pour its volume at the requested speed. If a finish speed is configured
+// that is slower than the pour, the pump slows to it for the last finish volume of the pour.
+func (state pourState) planPumpRun(idxVol idxVolTuple) pumpRun {
+	speed := idxVol.Speed
+	if speed <= 0 || !state.speedSupported {
+		speed = hardware.FullSpeed
+	}
+
+	run := pumpRun{
+		profile:  hardware.SpeedProfile{Speed: speed},
+		mlPerSec: state.flowRate(idxVol.Idx, speed),
+	}
+
+	mainMl := idxVol.VolMl
+	if state.speedSupported && state.finishSpeed > 0 && state.finishSpeed < speed && state.finishVolumeMl > 0 {
+		finishMl := min(state.finishVolumeMl, idxVol.VolMl)
+		run.profile.FinishSpeed = state.finishSpeed
+		run.finishMlPerSec = state.flowRate(idxVol.Idx, state.finishSpeed)
+		run.profile.FinishDuration = secondsToDuration(finishMl / run.finishMlPerSec)
+		mainMl -= finishMl
+	}
+
+	run.runTime = secondsToDuration(mainMl/run.mlPerSec) + run.profile.FinishDuration
+	return run
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,57 @@
+package openbarapi
+
+import (
+	"github.com/cocktailrobots/openbar-server/pkg/apis"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"time"
+)
+
+func (s *testSuite) TestPlanPumpRun() {
+	state := pourState{
+		pumps:          pumpsOfSpeed(100, 2),
+		speedSupported: true,
+		speedCals: map[int][]openbardb.PumpCalibration{
+			1: {{PumpIdx: 1, Speed: 0.25, MlPerSec: 10}, {PumpIdx: 1, Speed: 0.5, MlPerSec: 40}},
+		},
+	}
+
+	s.Require().Equal(50.0, state.flowRate(0, 0.5))
+	s.Require().Equal(5.0, state.flowRate(1, 0.125))
+	s.Require().Equal(25.0, state.flowRate(1, 0.375))
+	s.Require().Equal(70.0, state.flowRate(1, 0.75))
+	s.Require().Equal(100.0, state.flowRate(1, hardware.FullSpeed))
+
+	run := state.planPumpRun(idxVolTuple{Idx: 0, VolMl: 50})
+	s.Require().Equal(500*time.Millisecond, run.runTime)
+	s.Require().Equal(hardware.SpeedProfile{Speed: hardware.FullSpeed}, run.profile)
+
+	run = state.planPumpRun(idxVolTuple{Idx: 1, VolMl: 20, Speed: 0.5})
+	s.Require().Equal(500*time.Millisecond, run.runTime)
+	s.Require().InDelta(10.0, run.dispensedMl(250*time.Millisecond), 0.001)
+
+	state.finishSpeed = 0.25
+	state.finishVolumeMl = 5
+	run = state.planPumpRun(idxVolTuple{Idx: 1, VolMl: 55})
+	s.Require().Equal(hardware.SpeedProfile{Speed: hardware.FullSpeed, FinishSpeed: 0.25, FinishDuration: 500 * time.Millisecond}, run.profile)
+	s.Require().Equal(time.Second, run.runTime)
+	s.Require().InDelta(50.0, run.dispensedMl(500*time.Millisecond), 0.001)
+	s.Require().InDelta(52.5, run.dispensedMl(750*time.Millisecond), 0.001)
+	s.Require().InDelta(55.0, run.dispensedMl(run.runTime), 0.001)
+
+	// a pour slower than the finish speed doesn't change speed at the end
+	run = state.planPumpRun(idxVolTuple{Idx: 1, VolMl: 5, Speed: 0.125})
+	s.Require().Equal(time.Second, run.runTime)
+	s.Require().Equal(time.Duration(0), run.profile.FinishDuration)
+
+	s.Require().NoError(state.checkSpeed(0.5))
+	s.Require().ErrorIs(state.checkSpeed(1.5), apis.ErrBadRequest)
+
+	state.speedSupported = false
+	s.Require().NoError(state.checkSpeed(0))
+	s.Require().ErrorIs(state.checkSpeed(0.5), apis.ErrBadRequest)
+
+	run = state.planPumpRun(idxVolTuple{Idx: 1, VolMl: 55, Speed: 0.5})
+	s.Require().Equal(550*time.Millisecond, run.runTime)
+	s.Require().Equal(time.Duration(0), run.profile.FinishDuration)
+}
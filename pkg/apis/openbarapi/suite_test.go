@@ -1,9 +1,14 @@
 package openbarapi
 
 import (
+	"context"
+	"net/http"
 	"testing"
+	"time"
 
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
 	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
 	"github.com/cocktailrobots/openbar-server/pkg/util/test"
 
 	"github.com/gorilla/mux"
@@ -14,7 +19,8 @@ import (
 
 type testSuite struct {
 	*test.DBSuite
-	Api *OpenBarAPI
+	CocktailsDB *test.DBSuite
+	Api         *OpenBarAPI
 }
 
 func TestOpenBarApiPackage(t *testing.T) {
@@ -22,19 +28,74 @@ func TestOpenBarApiPackage(t *testing.T) {
 	require.NoError(t, err)
 
 	dbSuite := test.NewDBSuite("openbardb", "test", "../../../schema/openbardb/", "")
-	rp, err := hardware.NewReversePin(nil)
+	rp, err := hardware.NewReversePin(nil, nil)
 	require.NoError(t, err)
 	hw := hardware.NewTestHardware(8, rp)
-	api := New(logger, dbSuite, mux.NewRouter(), hw)
+	cocktailsDBSuite := test.NewDBSuite("cocktails", "test", "", test.FindTestdataDBs())
+	estop := hardware.NewEStop(hw)
+	api := New(logger, dbSuite, cocktailsDBSuite, mux.NewRouter(), hardware.NewController(estop), estop)
 	suite.Run(t, &testSuite{
-		DBSuite: dbSuite,
-		Api:     api,
+		DBSuite:     dbSuite,
+		CocktailsDB: cocktailsDBSuite,
+		Api:         api,
 	})
 }
 
+func (s *testSuite) SetupSuite() {
+	s.DBSuite.SetupSuite()
+	s.CocktailsDB.SetT(s.T())
+	s.CocktailsDB.SetupSuite()
+}
+
+func (s *testSuite) TearDownSuite() {
+	s.CocktailsDB.TearDownSuite()
+	s.DBSuite.TearDownSuite()
+}
+
 // BeforeTest is called before each test. It calls resetToHash to reset the database to the
 // hash of the last commit on the branch.
 func (s *testSuite) BeforeTest(suiteName, testName string) {
 	s.DBSuite.BeforeTest(suiteName, testName)
-	s.Api.hw.(*hardware.TestHardware).ResetRuntimes()
+	s.CocktailsDB.BeforeTest(suiteName, testName)
+	s.testHardware().ResetRuntimes()
+	s.Api.syncedRuntimes = make(map[int]time.Duration)
+}
+
+// testHardware returns the test hardware wrapped by the API's emergency stop
+func (s *testSuite) testHardware() *hardware.TestHardware {
+	return s.Api.estop.Unwrap().(*hardware.TestHardware)
+}
+
+// handle sends a request with body encoded as JSON to the API and returns the response
+func (s *testSuite) handle(method, url string, body any) *test.ResponseWriter {
+	req, err := http.NewRequest(method, url, test.JsonReaderForObject(body))
+	s.Require().NoError(err)
+
+	respWr := test.NewResponseWriter()
+	s.Api.Handle(respWr, req)
+	return respWr
+}
+
+// postStatus posts body to path and returns the status code of the response
+func (s *testSuite) postStatus(path string, body any) int {
+	return s.handle(http.MethodPost, path, body).StatusCode()
+}
+
+// barFluids returns a different fluid for each of the 8 test pumps
+func barFluids() []openbardb.Fluid {
+	return []openbardb.Fluid{
+		{Idx: 0, Fluid: util.Ptr("gin")},
+		{Idx: 1, Fluid: util.Ptr("vodka")},
+		{Idx: 2, Fluid: util.Ptr("tequila")},
+		{Idx: 3, Fluid: util.Ptr("campari")},
+		{Idx: 4, Fluid: util.Ptr("sweet_vermouth")},
+		{Idx: 5, Fluid: util.Ptr("dry_vermouth")},
+		{Idx: 6, Fluid: util.Ptr("triple_sec")},
+		{Idx: 7, Fluid: util.Ptr("lime_juice")},
+	}
+}
+
+// setupBar loads barFluids onto pumps which all pour mlPerSec
+func (s *testSuite) setupBar(ctx context.Context, mlPerSec int) {
+	s.setupPumpsAndFluids(ctx, barFluids(), pumpsOfSpeed(mlPerSec, s.Api.hw.NumPumps()))
 }
@@ -0,0 +1,59 @@
+package wire
+
+import (
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"time"
+)
+
+// Bottle is the inventory state of the bottle feeding a pump. Bottles which are not tracked have no capacity and are
+// never reported as low.
+type Bottle struct {
+	Idx            int        `json:"idx"`
+	Tracked        bool       `json:"tracked"`
+	CapacityMl     *float64   `json:"capacity_ml,omitempty"`
+	RemainingMl    *float64   `json:"remaining_ml,omitempty"`
+	LowThresholdMl *float64   `json:"low_threshold_ml,omitempty"`
+	ReplacedAt     *time.Time `json:"replaced_at,omitempty"`
+	Low            bool       `json:"low"`
+	Warning        string     `json:"warning,omitempty"`
+}
+
+// FromDbBottles converts a list of openbardb.Bottles to a list of Bottles.
+func FromDbBottles(bottles []openbardb.Bottle) []Bottle {
+	b := make([]Bottle, len(bottles))
+	for i := range bottles {
+		b[i] = Bottle{
+			Idx:            bottles[i].Idx,
+			Tracked:        bottles[i].IsTracked(),
+			CapacityMl:     bottles[i].CapacityMl,
+			LowThresholdMl: bottles[i].LowThresholdMl,
+			ReplacedAt:     bottles[i].ReplacedAt,
+			Low:            bottles[i].IsLow(),
+		}
+
+		if b[i].Tracked {
+			remaining := bottles[i].RemainingMl
+			b[i].RemainingMl = &remaining
+		}
+
+		if b[i].Low {
+			b[i].Warning = fmt.Sprintf("the bottle on pump %d has %.0fml remaining. Replace the bottle.", bottles[i].Idx, bottles[i].RemainingMl)
+		}
+	}
+
+	return b
+}
+
+// BottleReplaceRequest is the body of a request to mark the bottle on a pump as replaced. If RemainingMl is omitted
+// the new bottle is assumed to be full.
+type BottleReplaceRequest struct {
+	CapacityMl  float64  `json:"capacity_ml"`
+	RemainingMl *float64 `json:"remaining_ml"`
+}
+
+// BottleThreshold is the body of a request to set the low-stock threshold of a bottle. An omitted threshold disables
+// low-stock warnings.
+type BottleThreshold struct {
+	LowThresholdMl *float64 `json:"low_threshold_ml"`
+}
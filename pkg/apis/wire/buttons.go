@@ -1,7 +1,10 @@
 package wire
 
+// ButtonState is a set of held buttons, each running its pump. ReversedButtons run in the opposite direction to the
+// rest, which requires pumps with their own direction control and isn't supported with Async.
 type ButtonState struct {
 	DepressedButtons []int `json:"depressed_buttons"`
+	ReversedButtons  []int `json:"reversed_buttons"`
 	DurationMs       int   `json:"duration_ms"`
 	Async            bool  `json:"async"`
 	Forward          bool  `json:"forward"`
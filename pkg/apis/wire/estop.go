@@ -0,0 +1,49 @@
+package wire
+
+import (
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"time"
+)
+
+// EStopRequest triggers the emergency stop. Reason is recorded with the event.
+type EStopRequest struct {
+	Reason string `json:"reason"`
+}
+
+// EStopState is the state of the emergency stop. Source, Reason and TriggeredAt describe what latched it, and are only
+// set while it is latched.
+type EStopState struct {
+	Latched     bool       `json:"latched"`
+	Source      string     `json:"source,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+	TriggeredAt *time.Time `json:"triggered_at,omitempty"`
+}
+
+// EStopEvent is a record of the emergency stop being triggered as it will be written to the wire in HTTP responses.
+// ResetAt is nil until the emergency stop is reset.
+type EStopEvent struct {
+	Id          string     `json:"id"`
+	TriggeredAt time.Time  `json:"triggered_at"`
+	Source      string     `json:"source"`
+	Reason      string     `json:"reason,omitempty"`
+	ResetAt     *time.Time `json:"reset_at,omitempty"`
+}
+
+// FromDbEStopEvents converts a list of openbardb.EStopEvents to a list of EStopEvents.
+func FromDbEStopEvents(evts []openbardb.EStopEvent) []EStopEvent {
+	e := make([]EStopEvent, len(evts))
+	for i := range evts {
+		e[i] = EStopEvent{
+			Id:          evts[i].Id,
+			TriggeredAt: evts[i].TriggeredAt,
+			Source:      evts[i].Source,
+			ResetAt:     evts[i].ResetAt,
+		}
+
+		if evts[i].Reason != nil {
+			e[i].Reason = *evts[i].Reason
+		}
+	}
+
+	return e
+}
@@ -0,0 +1,40 @@
+package wire
+
+// PumpStateEvent is published whenever a pump is turned on or off
+type PumpStateEvent struct {
+	Idx   int    `json:"idx"`
+	State string `json:"state"`
+}
+
+// PourStartedEvent is published when the pumps start running for a pour
+type PourStartedEvent struct {
+	PourId     uint64  `json:"pour_id"`
+	RunTimesMs []int64 `json:"run_times_ms"`
+	TotalMs    int64   `json:"total_ms"`
+}
+
+// PourProgressEvent is published periodically while a pour is running. Progress is between 0 and 1.
+type PourProgressEvent struct {
+	PourId    uint64  `json:"pour_id"`
+	ElapsedMs int64   `json:"elapsed_ms"`
+	TotalMs   int64   `json:"total_ms"`
+	Progress  float64 `json:"progress"`
+}
+
+// PourFinishedEvent is published when a pour completes, is cancelled, or fails
+type PourFinishedEvent struct {
+	PourId     uint64  `json:"pour_id"`
+	RunTimesMs []int64 `json:"run_times_ms"`
+	Cancelled  bool    `json:"cancelled"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// ConfigChangedEvent is published when config values are added, changed, or deleted
+type ConfigChangedEvent struct {
+	Keys []string `json:"keys"`
+}
+
+// ErrorEvent is published when the machine fails to make a drink
+type ErrorEvent struct {
+	Message string `json:"message"`
+}
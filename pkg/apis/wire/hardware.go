@@ -0,0 +1,24 @@
+package wire
+
+// PumpHealth is the health of a pump. Health is one of ok, write-failed, readback-mismatch or missing.
+type PumpHealth struct {
+	Idx    int    `json:"idx"`
+	Health string `json:"health"`
+}
+
+// BoardStatus is the health of a board that drives pumps, and the pumps it drives. Present is false for boards that
+// weren't found. Error is the error that faulted the board.
+type BoardStatus struct {
+	Name    string `json:"name"`
+	Present bool   `json:"present"`
+	Health  string `json:"health"`
+	Error   string `json:"error,omitempty"`
+	Pumps   []int  `json:"pumps"`
+}
+
+// HardwareStatus is the health of the pump hardware
+type HardwareStatus struct {
+	Name   string        `json:"name"`
+	Pumps  []PumpHealth  `json:"pumps"`
+	Boards []BoardStatus `json:"boards"`
+}
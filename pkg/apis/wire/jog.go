@@ -0,0 +1,39 @@
+package wire
+
+// Types of JogMessage sent by clients on the /jog WebSocket
+const (
+	JogStart     = "start"
+	JogHeartbeat = "heartbeat"
+	JogStop      = "stop"
+)
+
+// Types of JogStatus sent by the server on the /jog WebSocket
+const (
+	JogStarted  = "started"
+	JogProgress = "progress"
+	JogStopped  = "stopped"
+	JogError    = "error"
+)
+
+// JogMessage is a message sent by a client to jog a pump. A start message runs Pump forward, or backward if Forward is
+// false, for as long as heartbeat messages keep arriving within HeartbeatTimeoutMs of each other. A stop message
+// releases the pump.
+type JogMessage struct {
+	Type               string `json:"type"`
+	Pump               int    `json:"pump"`
+	Forward            bool   `json:"forward"`
+	HeartbeatTimeoutMs int64  `json:"heartbeat_timeout_ms,omitempty"`
+}
+
+// JogStatus is a message sent by the server about the pump being jogged. DispensedMl is the volume dispensed since the
+// jog started, which is negative when the pump runs backward. Reason is why a stopped jog stopped, and Error describes
+// a message that was refused.
+type JogStatus struct {
+	Type        string  `json:"type"`
+	Pump        int     `json:"pump"`
+	Direction   string  `json:"direction,omitempty"`
+	ElapsedMs   int64   `json:"elapsed_ms"`
+	DispensedMl float64 `json:"dispensed_ml"`
+	Reason      string  `json:"reason,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
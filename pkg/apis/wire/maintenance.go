@@ -0,0 +1,62 @@
+package wire
+
+import (
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"time"
+)
+
+// Maintenance programs run at /maintenance/{program}
+const (
+	MaintenancePrime = "prime"
+	MaintenancePurge = "purge"
+	MaintenanceRinse = "rinse"
+)
+
+// MaintenanceRequest is the parameters of a maintenance program. Pumps defaults to every pump with a flow rate and a
+// tube volume. Cycles, VolumeMl and PauseMs are only used by rinse, which runs VolumeMl through each pump, or its tube
+// volume if VolumeMl is 0, Cycles times with a pause of PauseMs between cycles.
+type MaintenanceRequest struct {
+	Pumps    []int   `json:"pumps,omitempty"`
+	Cycles   int     `json:"cycles,omitempty"`
+	VolumeMl float64 `json:"volume_ml,omitempty"`
+	PauseMs  int64   `json:"pause_ms,omitempty"`
+}
+
+// MaintenanceStatus is the state of the running maintenance program, or the last one to run if none is running.
+// Error is set if the program failed.
+type MaintenanceStatus struct {
+	Running    bool       `json:"running"`
+	Program    string     `json:"program,omitempty"`
+	Pumps      []int      `json:"pumps,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ElapsedMs  int64      `json:"elapsed_ms"`
+	TotalMs    int64      `json:"total_ms"`
+	Progress   float64    `json:"progress"`
+	Cancelled  bool       `json:"cancelled,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// MaintenanceSchedule is a maintenance program which runs at NextRunAt, and then every IntervalSec seconds if
+// IntervalSec isn't 0. Id is set by the server when the schedule is created.
+type MaintenanceSchedule struct {
+	Id          string             `json:"id,omitempty"`
+	Program     string             `json:"program"`
+	Params      MaintenanceRequest `json:"params"`
+	NextRunAt   time.Time          `json:"next_run_at"`
+	IntervalSec int64              `json:"interval_sec,omitempty"`
+}
+
+// PumpTube is the volume of the tube between a pump's bottle and the spout
+type PumpTube struct {
+	Idx          int     `json:"idx"`
+	TubeVolumeMl float64 `json:"tube_volume_ml"`
+}
+
+// FromDbPumpTube converts an openbardb.Pump to a PumpTube.
+func FromDbPumpTube(pump openbardb.Pump) PumpTube {
+	return PumpTube{
+		Idx:          pump.Idx,
+		TubeVolumeMl: pump.TubeVolumeMl,
+	}
+}
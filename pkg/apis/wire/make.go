@@ -1,10 +1,60 @@
 package wire
 
+// FluidVolume is the volume of a fluid to pour. Fluids with the same Step are poured together, and steps are poured in
+// ascending order. Speed is the fraction of full speed to pour at, for delicate or foamy fluids, on hardware that
+// supports it. A Speed of 0 is full speed.
 type FluidVolume struct {
-	Fluid    string `json:"fluid"`
-	VolumeMl uint   `json:"volume_ml"`
+	Fluid    string  `json:"fluid"`
+	VolumeMl uint    `json:"volume_ml"`
+	Step     uint    `json:"step,omitempty"`
+	Speed    float64 `json:"speed,omitempty"`
 }
 
+// MakeRequest is a request to pour a drink. StepDelaysMs[n] is how long to wait before step n starts. Steps with no
+// fluids are skipped along with their delay.
 type MakeRequest struct {
 	FluidVolumes []FluidVolume `json:"fluid_volumes"`
+	StepDelaysMs []uint        `json:"step_delays_ms,omitempty"`
+	RecipeId     *string       `json:"recipe_id,omitempty"`
+}
+
+// MakeResponse reports how long each pump ran while making a drink, and whether the pour was cancelled before it
+// completed. PourId identifies the pour in the pour history.
+type MakeResponse struct {
+	PourId       string        `json:"pour_id,omitempty"`
+	RunTimesMs   []int64       `json:"run_times_ms"`
+	Cancelled    bool          `json:"cancelled"`
+	FluidVolumes []FluidVolume `json:"fluid_volumes,omitempty"`
+}
+
+// MakeRecipeRequest is the body of a request to make a drink from a recipe. If VolumeMl is 0 the default volume from
+// the config is used.
+type MakeRecipeRequest struct {
+	VolumeMl float64 `json:"volume_ml"`
+}
+
+// CancelResponse reports the number of pours that were cancelled.
+type CancelResponse struct {
+	Cancelled int `json:"cancelled"`
+}
+
+// PlannedFluid is the volume of a requested fluid that would be poured from a single pump. A fluid that is split across
+// pumps has an entry for each pump. PumpIdx is nil if no pump has the fluid.
+type PlannedFluid struct {
+	Fluid      string  `json:"fluid"`
+	VolumeMl   float64 `json:"volume_ml"`
+	PumpIdx    *int    `json:"pump_idx,omitempty"`
+	Step       uint    `json:"step"`
+	RunTimeMs  int64   `json:"run_time_ms"`
+	ExpectedMl float64 `json:"expected_ml"`
+}
+
+// MakePlan describes what the machine would do to make a drink without running any pumps. RunTimesMs is the total time
+// each pump would run across all steps, and TotalMs includes the delays between steps. The drink can only be made if
+// Problems is empty.
+type MakePlan struct {
+	Fluids     []PlannedFluid `json:"fluids"`
+	RunTimesMs []int64        `json:"run_times_ms"`
+	TotalMs    int64          `json:"total_ms"`
+	Problems   []string       `json:"problems"`
 }
@@ -0,0 +1,91 @@
+package wire
+
+import (
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"time"
+)
+
+// Order is a drink in the order queue as it will be written to the wire in HTTP responses.
+type Order struct {
+	Id           string        `json:"id"`
+	Status       string        `json:"status"`
+	Position     int64         `json:"position"`
+	FluidVolumes []FluidVolume `json:"fluid_volumes"`
+	CreatedAt    time.Time     `json:"created_at"`
+	StartedAt    *time.Time    `json:"started_at,omitempty"`
+	FinishedAt   *time.Time    `json:"finished_at,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// OrderUpdate is the body of a request to move a queued order to a new position in the queue where 0 is the next
+// order to be poured.
+type OrderUpdate struct {
+	Position int `json:"position"`
+}
+
+// ToDbOrder converts a MakeRequest to an openbardb.Order that can be added to the queue. Each fluid is stored with the
+// delay of its step.
+func (mr MakeRequest) ToDbOrder() *openbardb.Order {
+	fluids := make([]openbardb.OrderFluid, len(mr.FluidVolumes))
+	for i, fv := range mr.FluidVolumes {
+		fluids[i] = openbardb.OrderFluid{
+			Fluid:    fv.Fluid,
+			VolumeMl: fv.VolumeMl,
+			Step:     fv.Step,
+			Speed:    fv.Speed,
+		}
+
+		if int(fv.Step) < len(mr.StepDelaysMs) {
+			fluids[i].StepDelayMs = mr.StepDelaysMs[fv.Step]
+		}
+	}
+
+	return &openbardb.Order{Fluids: fluids, RecipeId: mr.RecipeId}
+}
+
+// MakeRequestFromDbOrder converts the fluids of an openbardb.Order to a MakeRequest. Steps with no fluids have no delay,
+// as they are skipped along with their delay when poured.
+func MakeRequestFromDbOrder(order *openbardb.Order) MakeRequest {
+	fvs := make([]FluidVolume, len(order.Fluids))
+	var delays []uint
+	for i, f := range order.Fluids {
+		fvs[i] = FluidVolume{
+			Fluid:    f.Fluid,
+			VolumeMl: f.VolumeMl,
+			Step:     f.Step,
+			Speed:    f.Speed,
+		}
+
+		if f.StepDelayMs != 0 {
+			for len(delays) <= int(f.Step) {
+				delays = append(delays, 0)
+			}
+
+			delays[f.Step] = f.StepDelayMs
+		}
+	}
+
+	return MakeRequest{FluidVolumes: fvs, StepDelaysMs: delays, RecipeId: order.RecipeId}
+}
+
+// FromDbOrders converts a list of openbardb.Orders to a list of Orders.
+func FromDbOrders(orders []openbardb.Order) []Order {
+	o := make([]Order, len(orders))
+	for i := range orders {
+		o[i] = Order{
+			Id:           orders[i].Id,
+			Status:       string(orders[i].Status),
+			Position:     orders[i].Position,
+			FluidVolumes: MakeRequestFromDbOrder(&orders[i]).FluidVolumes,
+			CreatedAt:    orders[i].CreatedAt,
+			StartedAt:    orders[i].StartedAt,
+			FinishedAt:   orders[i].FinishedAt,
+		}
+
+		if orders[i].Error != nil {
+			o[i].Error = *orders[i].Error
+		}
+	}
+
+	return o
+}
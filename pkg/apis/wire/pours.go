@@ -0,0 +1,63 @@
+package wire
+
+import (
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"time"
+)
+
+// PourFluid is the volume of a fluid requested in a pour and how much of it was dispensed.
+type PourFluid struct {
+	Fluid       string  `json:"fluid"`
+	PumpIdx     *int    `json:"pump_idx,omitempty"`
+	RequestedMl float64 `json:"requested_ml"`
+	DispensedMl float64 `json:"dispensed_ml"`
+}
+
+// Pour is an entry in the pour history as it will be written to the wire in HTTP responses.
+type Pour struct {
+	Id         string      `json:"id"`
+	PouredAt   time.Time   `json:"poured_at"`
+	RecipeId   *string     `json:"recipe_id,omitempty"`
+	DurationMs int64       `json:"duration_ms"`
+	Outcome    string      `json:"outcome"`
+	Error      string      `json:"error,omitempty"`
+	Fluids     []PourFluid `json:"fluids"`
+}
+
+// PourPage is a page of the pour history. Total is the number of pours in the requested time range.
+type PourPage struct {
+	Pours  []Pour `json:"pours"`
+	Total  int    `json:"total"`
+	Limit  uint64 `json:"limit"`
+	Offset uint64 `json:"offset"`
+}
+
+// FromDbPours converts a list of openbardb.Pours to a list of Pours.
+func FromDbPours(pours []openbardb.Pour) []Pour {
+	p := make([]Pour, len(pours))
+	for i := range pours {
+		p[i] = Pour{
+			Id:         pours[i].Id,
+			PouredAt:   pours[i].PouredAt,
+			RecipeId:   pours[i].RecipeId,
+			DurationMs: pours[i].DurationMs,
+			Outcome:    string(pours[i].Outcome),
+			Fluids:     make([]PourFluid, len(pours[i].Fluids)),
+		}
+
+		if pours[i].Error != nil {
+			p[i].Error = *pours[i].Error
+		}
+
+		for j, f := range pours[i].Fluids {
+			p[i].Fluids[j] = PourFluid{
+				Fluid:       f.Fluid,
+				PumpIdx:     f.PumpIdx,
+				RequestedMl: f.RequestedMl,
+				DispensedMl: f.DispensedMl,
+			}
+		}
+	}
+
+	return p
+}
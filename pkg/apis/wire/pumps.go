@@ -0,0 +1,130 @@
+package wire
+
+import (
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+	"time"
+)
+
+// Pump is a pump as it will be written to the wire in HTTP responses.
+type Pump struct {
+	Idx      int     `json:"idx"`
+	MlPerSec float64 `json:"ml_per_sec"`
+}
+
+// Pumps is a slice of pumps.
+type Pumps []Pump
+
+// ToDbPumps converts a list of Pumps to a list of openbardb.Pumps.
+func (p Pumps) ToDbPumps() []openbardb.Pump {
+	pumps := make([]openbardb.Pump, len(p))
+	for i := range p {
+		pumps[i] = openbardb.Pump{
+			Idx:      p[i].Idx,
+			MlPerSec: p[i].MlPerSec,
+		}
+	}
+
+	return pumps
+}
+
+// FromDbPumps converts a list of openbardb.Pumps to a list of Pumps.
+func FromDbPumps(pumps []openbardb.Pump) Pumps {
+	p := make(Pumps, len(pumps))
+	for i := range pumps {
+		p[i] = Pump{
+			Idx:      pumps[i].Idx,
+			MlPerSec: pumps[i].MlPerSec,
+		}
+	}
+
+	return p
+}
+
+// CalibrationRunRequest is the body of a request to run a pump for a known amount of time so that the dispensed
+// volume can be measured. Speed is the fraction of full speed to run at, where 0 is full speed.
+type CalibrationRunRequest struct {
+	DurationMs int64   `json:"duration_ms"`
+	Speed      float64 `json:"speed,omitempty"`
+}
+
+// CalibrationMeasurementRequest is the body of a request which provides the volume measured after a calibration run.
+// If DurationMs is 0 the duration and speed of the last calibration run for the pump are used.
+type CalibrationMeasurementRequest struct {
+	VolumeMl   float64 `json:"volume_ml"`
+	DurationMs int64   `json:"duration_ms"`
+	Speed      float64 `json:"speed,omitempty"`
+}
+
+// PumpCalibration is a single entry in a pump's calibration history.
+type PumpCalibration struct {
+	Idx          int       `json:"idx"`
+	CalibratedAt time.Time `json:"calibrated_at"`
+	DurationMs   int64     `json:"duration_ms"`
+	VolumeMl     float64   `json:"volume_ml"`
+	MlPerSec     float64   `json:"ml_per_sec"`
+	Speed        float64   `json:"speed"`
+}
+
+// FromDbPumpCalibrations converts a list of openbardb.PumpCalibrations to a list of PumpCalibrations.
+func FromDbPumpCalibrations(cals []openbardb.PumpCalibration) []PumpCalibration {
+	c := make([]PumpCalibration, len(cals))
+	for i := range cals {
+		c[i] = PumpCalibration{
+			Idx:          cals[i].PumpIdx,
+			CalibratedAt: cals[i].CalibratedAt,
+			DurationMs:   cals[i].DurationMs,
+			VolumeMl:     cals[i].VolumeMl,
+			MlPerSec:     cals[i].MlPerSec,
+			Speed:        cals[i].Speed,
+		}
+	}
+
+	return c
+}
+
+// PumpUsage is the usage and service state of a pump.
+type PumpUsage struct {
+	Idx                      int        `json:"idx"`
+	RuntimeMs                int64      `json:"runtime_ms"`
+	DispensedMl              float64    `json:"dispensed_ml"`
+	ServiceRuntimeMs         int64      `json:"service_runtime_ms"`
+	ServiceDispensedMl       float64    `json:"service_dispensed_ml"`
+	ServicedAt               *time.Time `json:"serviced_at,omitempty"`
+	ServiceIntervalMl        *float64   `json:"service_interval_ml,omitempty"`
+	ServiceIntervalRuntimeMs *int64     `json:"service_interval_runtime_ms,omitempty"`
+	NeedsService             bool       `json:"needs_service"`
+	Warning                  string     `json:"warning,omitempty"`
+}
+
+// FromDbPumpUsage converts a list of openbardb.PumpUsage to a list of PumpUsage.
+func FromDbPumpUsage(usage []openbardb.PumpUsage) []PumpUsage {
+	u := make([]PumpUsage, len(usage))
+	for i := range usage {
+		u[i] = PumpUsage{
+			Idx:                      usage[i].Idx,
+			RuntimeMs:                usage[i].RuntimeMs,
+			DispensedMl:              usage[i].DispensedMl,
+			ServiceRuntimeMs:         usage[i].ServiceRuntimeMs,
+			ServiceDispensedMl:       usage[i].ServiceDispensedMl,
+			ServicedAt:               usage[i].ServicedAt,
+			ServiceIntervalMl:        usage[i].ServiceIntervalMl,
+			ServiceIntervalRuntimeMs: usage[i].ServiceIntervalRuntimeMs,
+			NeedsService:             usage[i].NeedsService(),
+		}
+
+		if u[i].NeedsService {
+			serviceRuntime := time.Duration(usage[i].ServiceRuntimeMs) * time.Millisecond
+			u[i].Warning = fmt.Sprintf("pump %d has dispensed %.0fml over %s since it was last serviced. Replace tubing.", usage[i].Idx, usage[i].ServiceDispensedMl, serviceRuntime.String())
+		}
+	}
+
+	return u
+}
+
+// PumpServiceIntervals is the body of a request to set the thresholds after which a pump needs service. Omitted
+// intervals are disabled.
+type PumpServiceIntervals struct {
+	ServiceIntervalMl        *float64 `json:"service_interval_ml"`
+	ServiceIntervalRuntimeMs *int64   `json:"service_interval_runtime_ms"`
+}
@@ -0,0 +1,40 @@
+package wire
+
+import "github.com/cocktailrobots/openbar-server/pkg/db/openbardb"
+
+// RecipeStep is a group of a recipe's ingredients that are poured together. DelayMs is how long to wait before the step
+// starts.
+type RecipeStep struct {
+	Ingredients []string `json:"ingredients"`
+	DelayMs     int64    `json:"delay_ms"`
+}
+
+// FromDbRecipeSteps converts a list of openbardb.RecipeSteps to a list of RecipeSteps.
+func FromDbRecipeSteps(steps []openbardb.RecipeStep) []RecipeStep {
+	s := make([]RecipeStep, len(steps))
+	for i := range steps {
+		s[i] = RecipeStep{
+			Ingredients: steps[i].Ingredients,
+			DelayMs:     steps[i].DelayMs,
+		}
+
+		if s[i].Ingredients == nil {
+			s[i].Ingredients = []string{}
+		}
+	}
+
+	return s
+}
+
+// ToDbRecipeSteps converts a list of RecipeSteps to a list of openbardb.RecipeSteps.
+func ToDbRecipeSteps(steps []RecipeStep) []openbardb.RecipeStep {
+	s := make([]openbardb.RecipeStep, len(steps))
+	for i := range steps {
+		s[i] = openbardb.RecipeStep{
+			Ingredients: steps[i].Ingredients,
+			DelayMs:     steps[i].DelayMs,
+		}
+	}
+
+	return s
+}
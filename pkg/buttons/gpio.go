@@ -1,21 +1,51 @@
-//go:build !linux
-
 package buttons
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/gpio"
+)
 
-type GpioButtons struct{}
+// GpioButtons reads buttons wired to GPIO lines
+type GpioButtons struct {
+	lines []gpio.Line
+}
 
-func NewGpioButtons(pins []int, debounceDur time.Duration, activeHigh, pullUp bool) (*GpioButtons, error) {
-	return &GpioButtons{}, nil
+// NewGpioButtons requests the lines of chip at pins as inputs. Presses are read as high unless activeLow is set, and
+// changes shorter than debounceDur are ignored.
+func NewGpioButtons(chip gpio.Chip, pins []int, debounceDur time.Duration, activeLow, pullUp bool) (*GpioButtons, error) {
+	opts := gpio.InputOptions{
+		ActiveLow: activeLow,
+		PullUp:    pullUp,
+		Debounce:  debounceDur,
+	}
+
+	btns := &GpioButtons{}
+	for _, pin := range pins {
+		l, err := chip.RequestInput(pin, opts)
+		if err != nil {
+			_ = btns.Close()
+			return nil, fmt.Errorf("error requesting button line: %w", err)
+		}
+
+		btns.lines = append(btns.lines, l)
+	}
+
+	return btns, nil
 }
 
 func (g GpioButtons) NumButtons() int {
-	return 0
+	return len(g.lines)
 }
 
 func (g GpioButtons) IsPressed(idx int) bool {
-	return false
+	val, err := g.lines[idx].Value()
+	if err != nil {
+		panic(err)
+	}
+
+	return val == 1
 }
 
 func (g GpioButtons) Update() error {
@@ -23,5 +53,9 @@ func (g GpioButtons) Update() error {
 }
 
 func (g GpioButtons) Close() error {
+	for _, l := range g.lines {
+		l.Close()
+	}
+
 	return nil
 }
@@ -0,0 +1,72 @@
+package buttons
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/gpio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGpioButtons(t *testing.T) {
+	chip := gpio.NewFakeChip()
+	btns, err := NewGpioButtons(chip, []int{5, 6}, 0, false, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, btns.NumButtons())
+	require.False(t, btns.IsPressed(0))
+
+	chip.Line(6).SetLevel(1)
+	require.False(t, btns.IsPressed(0))
+	require.True(t, btns.IsPressed(1))
+
+	_, err = NewGpioButtons(chip, []int{7, 6}, 0, false, false)
+	require.Error(t, err)
+	require.True(t, chip.Line(7).Closed())
+
+	require.NoError(t, btns.Close())
+	require.True(t, chip.Line(5).Closed())
+	require.True(t, chip.Line(6).Closed())
+}
+
+func TestGpioButtonsActiveLow(t *testing.T) {
+	chip := gpio.NewFakeChip()
+	btns, err := NewGpioButtons(chip, []int{5}, 0, true, true)
+	require.NoError(t, err)
+	defer btns.Close()
+
+	require.Equal(t, 1, chip.Line(5).Level())
+	require.False(t, btns.IsPressed(0))
+
+	chip.Line(5).SetLevel(0)
+	require.True(t, btns.IsPressed(0))
+
+	chip.Line(5).SetLevel(1)
+	require.False(t, btns.IsPressed(0))
+}
+
+func TestGpioButtonsDebounce(t *testing.T) {
+	const debounce = 20 * time.Millisecond
+
+	chip := gpio.NewFakeChip()
+	btns, err := NewGpioButtons(chip, []int{5}, debounce, false, false)
+	require.NoError(t, err)
+	defer btns.Close()
+
+	// a bounce shorter than the debounce period is ignored
+	line := chip.Line(5)
+	line.SetLevel(1)
+	require.False(t, btns.IsPressed(0))
+	line.SetLevel(0)
+	time.Sleep(2 * debounce)
+	require.False(t, btns.IsPressed(0))
+
+	line.SetLevel(1)
+	require.False(t, btns.IsPressed(0))
+	time.Sleep(2 * debounce)
+	require.True(t, btns.IsPressed(0))
+
+	line.SetLevel(0)
+	require.True(t, btns.IsPressed(0))
+	time.Sleep(2 * debounce)
+	require.False(t, btns.IsPressed(0))
+}
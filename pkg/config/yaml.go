@@ -7,9 +7,21 @@ import (
 	"os"
 )
 
+// ReversePinConfig is the GPIO line that sets the direction pumps run in. Chip defaults to gpiochip0.
 type ReversePinConfig struct {
-	Pin         int  `yaml:"pin"`
-	ForwardHigh bool `yaml:"forward-high"`
+	Chip        string `yaml:"chip"`
+	Pin         int    `yaml:"pin"`
+	ForwardHigh bool   `yaml:"forward-high"`
+}
+
+// EStopConfig is the GPIO line of an emergency stop input, which triggers the emergency stop while it reads as active.
+// Chip defaults to gpiochip0.
+type EStopConfig struct {
+	Chip          string `yaml:"chip"`
+	Pin           int    `yaml:"pin"`
+	DebounceNanos int64  `yaml:"debounce-duration"`
+	ActiveLow     bool   `yaml:"active-low"`
+	PullUp        bool   `yaml:"pull-up"`
 }
 
 type DebugHardwareConfig struct {
@@ -17,26 +29,114 @@ type DebugHardwareConfig struct {
 	OutFile  string `yaml:"out-file"`
 }
 
+// GpioHardwareConfig drives pumps from the GPIO lines of a chip. Chip defaults to gpiochip0. Pins is shorthand for pumps
+// that are only switched on and off, one per pin. Pumps that set their own direction are configured with Pumps instead.
 type GpioHardwareConfig struct {
-	Pins []int `yaml:"pins"`
+	Chip  string           `yaml:"chip"`
+	Pins  []int            `yaml:"pins"`
+	Pumps []GpioPumpConfig `yaml:"pumps"`
+}
+
+// GpioPumpConfig is a pump driven by GPIO lines. Pin switches the pump on. A pump with a DirectionPin runs forward with
+// the pin high if ForwardHigh is set, and low otherwise. A pump driven by an H-bridge runs forward with IN1 high,
+// backward with IN2 high and is off with both low, in which case Pin is optional and drives the bridge's enable input.
+type GpioPumpConfig struct {
+	Pin          *int           `yaml:"pin"`
+	DirectionPin *int           `yaml:"direction-pin"`
+	ForwardHigh  bool           `yaml:"forward-high"`
+	HBridge      *HBridgeConfig `yaml:"h-bridge"`
 }
 
+// HBridgeConfig is the pair of GPIO lines driving the inputs of one channel of an H-bridge
+type HBridgeConfig struct {
+	In1 int `yaml:"in1"`
+	In2 int `yaml:"in2"`
+}
+
+// SequentHardwareConfig drives pumps from the relays of Sequent Microsystems Relay8 boards on an I2C bus. Bus defaults
+// to 1. With AllowMissingBoards the expected boards are at stack levels 0 to ExpectedBoardCount-1, and the server starts
+// without any that are missing, re-probing for them every ReprobeIntervalMs which defaults to 5 seconds.
 type SequentHardwareConfig struct {
+	Bus                *int  `yaml:"bus"`
 	ExpectedBoardCount int   `yaml:"expected-board-count"`
 	RelayMapping       []int `yaml:"relay-mapping"`
+	AllowMissingBoards bool  `yaml:"allow-missing-boards"`
+	ReprobeIntervalMs  int   `yaml:"reprobe-interval-ms"`
+}
+
+// PwmHardwareConfig drives pumps from the channels of a Linux sysfs PWM chip. Chip is the name of a chip in
+// /sys/class/pwm or the path to its directory, and defaults to pwmchip0. A FrequencyHz of 0 uses 1kHz.
+type PwmHardwareConfig struct {
+	Chip        string `yaml:"chip"`
+	Channels    []int  `yaml:"channels"`
+	FrequencyHz int    `yaml:"frequency-hz"`
+}
+
+// PCA9685HardwareConfig drives pumps from the 16 PWM channels of one or more PCA9685 boards on an I2C bus, each pump
+// switched by a MOSFET. Bus defaults to 1 and Addresses to the board default of 0x40. ChannelMapping maps each pump to a
+// channel, where channel n is channel n%16 of the board at Addresses[n/16]. DutyCycle is the duty cycle of a pump at
+// full speed and defaults to 1. A FrequencyHz of 0 uses 1kHz.
+type PCA9685HardwareConfig struct {
+	Bus            *int    `yaml:"bus"`
+	Addresses      []int   `yaml:"addresses"`
+	ChannelMapping []int   `yaml:"channel-mapping"`
+	FrequencyHz    int     `yaml:"frequency-hz"`
+	DutyCycle      float64 `yaml:"duty-cycle"`
+}
+
+// MCP23017HardwareConfig drives pumps from the pins of one or more MCP23017 I/O expanders on an I2C bus. Bus defaults
+// to 1 and Addresses to the chip default of 0x20. PinMapping maps each pump to a pin, where pin n is pin n%16 of the chip
+// at Addresses[n/16] with A0-A7 as 0-7 and B0-B7 as 8-15. Pumps on ActiveLowPins are turned on by driving their pin low.
+type MCP23017HardwareConfig struct {
+	Bus           *int  `yaml:"bus"`
+	Addresses     []int `yaml:"addresses"`
+	PinMapping    []int `yaml:"pin-mapping"`
+	ActiveLowPins []int `yaml:"active-low-pins"`
+}
+
+// PowerBudgetConfig limits how many pumps run at once so the power supply isn't overloaded. PumpCurrentAmps is the
+// current drawn by every pump, and PumpCurrentsAmps optionally overrides it for each pump by index. A MaxCurrentAmps or
+// MaxPumps of 0 is unlimited. Pumps are switched on and off in batches of SwitchBatchSize, with SwitchDelayMs between
+// batches.
+type PowerBudgetConfig struct {
+	PumpCurrentAmps  float64   `yaml:"pump-current-amps"`
+	PumpCurrentsAmps []float64 `yaml:"pump-currents-amps"`
+	MaxCurrentAmps   float64   `yaml:"max-current-amps"`
+	MaxPumps         int       `yaml:"max-pumps"`
+	SwitchBatchSize  int       `yaml:"switch-batch-size"`
+	SwitchDelayMs    int       `yaml:"switch-delay-ms"`
+}
+
+// WatchdogConfig configures a software watchdog which forces pumps off independently of whatever turned them on. A
+// pump that stays on for longer than MaxPumpOnTimeMs is forced off, a pour that runs for longer than MaxPourTimeMs is
+// stopped, and every pump is forced off if the server's main loop stops sending heartbeats for HeartbeatTimeoutMs. A
+// limit of 0 is disabled. If Device is set, e.g. to /dev/watchdog, it is kicked while heartbeats are being received so
+// that a hung process triggers a hardware reset.
+type WatchdogConfig struct {
+	MaxPumpOnTimeMs    int    `yaml:"max-pump-on-time-ms"`
+	MaxPourTimeMs      int    `yaml:"max-pour-time-ms"`
+	HeartbeatTimeoutMs int    `yaml:"heartbeat-timeout-ms"`
+	Device             string `yaml:"device"`
 }
 
 type HardwareConfig struct {
-	Debug   *DebugHardwareConfig   `yaml:"debug"`
-	Gpio    *GpioHardwareConfig    `yaml:"gpio"`
-	Sequent *SequentHardwareConfig `yaml:"sequent"`
+	Debug       *DebugHardwareConfig    `yaml:"debug"`
+	Gpio        *GpioHardwareConfig     `yaml:"gpio"`
+	Sequent     *SequentHardwareConfig  `yaml:"sequent"`
+	Pwm         *PwmHardwareConfig      `yaml:"pwm"`
+	PCA9685     *PCA9685HardwareConfig  `yaml:"pca9685"`
+	MCP23017    *MCP23017HardwareConfig `yaml:"mcp23017"`
+	PowerBudget *PowerBudgetConfig      `yaml:"power-budget"`
+	Watchdog    *WatchdogConfig         `yaml:"watchdog"`
 }
 
+// GpioButtonConfig reads buttons from GPIO lines of a chip. Chip defaults to gpiochip0.
 type GpioButtonConfig struct {
-	Pins          []int `yaml:"pins"`
-	DebounceNanos int64 `yaml:"debounce-duration"`
-	ActiveLow     bool  `yaml:"active-low"`
-	PullUp        bool  `yaml:"pull-up"`
+	Chip          string `yaml:"chip"`
+	Pins          []int  `yaml:"pins"`
+	DebounceNanos int64  `yaml:"debounce-duration"`
+	ActiveLow     bool   `yaml:"active-low"`
+	PullUp        bool   `yaml:"pull-up"`
 }
 
 type ButtonConfig struct {
@@ -75,6 +175,7 @@ type Config struct {
 	Hardware     *HardwareConfig   `yaml:"hardware"`
 	ReversePin   *ReversePinConfig `yaml:"reverse-pin"`
 	Buttons      *ButtonConfig     `yaml:"buttons"`
+	EStop        *EStopConfig      `yaml:"estop"`
 	DB           *DBConfig         `yaml:"db"`
 	CocktailsApi *ListenerConfig   `yaml:"cocktails-api"`
 	OpenBarApi   *ListenerConfig   `yaml:"openbar-api"`
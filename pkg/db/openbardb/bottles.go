@@ -0,0 +1,146 @@
+package openbardb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gocraft/dbr/v2"
+	"time"
+)
+
+const (
+	BottlesTable = "bottles"
+
+	capacityMlCol     = "capacity_ml"
+	remainingMlCol    = "remaining_ml"
+	lowThresholdMlCol = "low_threshold_ml"
+	replacedAtCol     = "replaced_at"
+)
+
+// Bottle tracks the bottle feeding a pump. A bottle with no capacity is untracked, and pours from it are never
+// refused.
+type Bottle struct {
+	Idx            int        `db:"idx"`
+	CapacityMl     *float64   `db:"capacity_ml"`
+	RemainingMl    float64    `db:"remaining_ml"`
+	LowThresholdMl *float64   `db:"low_threshold_ml"`
+	ReplacedAt     *time.Time `db:"replaced_at"`
+}
+
+// IsTracked returns true if the bottle's capacity is known
+func (b Bottle) IsTracked() bool {
+	return b.CapacityMl != nil
+}
+
+// IsLow returns true if the bottle is tracked and the remaining volume is at or below its low-stock threshold
+func (b Bottle) IsLow() bool {
+	return b.IsTracked() && b.LowThresholdMl != nil && b.RemainingMl <= *b.LowThresholdMl
+}
+
+// CanPour returns true if the bottle is untracked or has at least volumeMl remaining
+func (b Bottle) CanPour(volumeMl float64) bool {
+	return !b.IsTracked() || b.RemainingMl >= volumeMl
+}
+
+// ListBottles returns the bottles of all pumps ordered by index.
+func ListBottles(ctx context.Context, tx *dbr.Tx) ([]Bottle, error) {
+	var bottles []Bottle
+	_, err := tx.Select("*").From(BottlesTable).OrderBy(idxCol).LoadContext(ctx, &bottles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bottles: %w", err)
+	}
+
+	return bottles, nil
+}
+
+// GetBottle returns the bottle of a single pump. A pump with no bottle row has an untracked bottle.
+func GetBottle(ctx context.Context, tx *dbr.Tx, idx int) (*Bottle, error) {
+	var bottle Bottle
+	err := tx.Select("*").From(BottlesTable).Where(dbr.Eq(idxCol, idx)).LoadOneContext(ctx, &bottle)
+	if errors.Is(err, dbr.ErrNotFound) {
+		_, err = GetPump(ctx, tx, idx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Bottle{Idx: idx}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load bottle for pump %d: %w", idx, err)
+	}
+
+	return &bottle, nil
+}
+
+// ensureBottle inserts an untracked bottle for a pump if it doesn't have one. It fails if the pump doesn't exist.
+func ensureBottle(ctx context.Context, tx *dbr.Tx, idx int) error {
+	_, err := GetPump(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.InsertInto(BottlesTable).Ignore().Columns(idxCol).Values(idx).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert bottle for pump %d: %w", idx, err)
+	}
+
+	return nil
+}
+
+// DecrementBottle subtracts the dispensed volume from the bottle of a pump. A negative volume is returned to the bottle.
+// The remaining volume never drops below zero or rises above the bottle's capacity, and untracked bottles are
+// unaffected.
+func DecrementBottle(ctx context.Context, tx *dbr.Tx, idx int, volumeMl float64) error {
+	_, err := tx.Update(BottlesTable).
+		Set(remainingMlCol, dbr.Expr("LEAST(GREATEST("+remainingMlCol+" - ?, 0), "+capacityMlCol+")", volumeMl)).
+		Where(dbr.And(dbr.Eq(idxCol, idx), dbr.Neq(capacityMlCol, nil))).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to decrement bottle for pump %d: %w", idx, err)
+	}
+
+	return nil
+}
+
+// ReplaceBottle records that a new bottle was connected to a pump. If remainingMl is nil the bottle is assumed full.
+func ReplaceBottle(ctx context.Context, tx *dbr.Tx, idx int, capacityMl float64, remainingMl *float64, at time.Time) error {
+	err := ensureBottle(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+
+	remaining := capacityMl
+	if remainingMl != nil {
+		remaining = *remainingMl
+	}
+
+	_, err = tx.Update(BottlesTable).
+		Set(capacityMlCol, capacityMl).
+		Set(remainingMlCol, remaining).
+		Set(replacedAtCol, at.UTC().Truncate(time.Second)).
+		Where(dbr.Eq(idxCol, idx)).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to replace bottle for pump %d: %w", idx, err)
+	}
+
+	return nil
+}
+
+// SetBottleLowThreshold sets the remaining volume at or below which a bottle is reported as low. A nil threshold
+// disables low-stock warnings for the bottle.
+func SetBottleLowThreshold(ctx context.Context, tx *dbr.Tx, idx int, thresholdMl *float64) error {
+	err := ensureBottle(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Update(BottlesTable).
+		Set(lowThresholdMlCol, thresholdMl).
+		Where(dbr.Eq(idxCol, idx)).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to set low threshold for pump %d: %w", idx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package openbardb
+
+import (
+	"context"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"time"
+)
+
+func (s *testSuite) TestBottles() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	err = SetConfig(ctx, tx, map[string]string{NumPumpsConfigKey: "4"})
+	s.Require().NoError(err)
+
+	bottles, err := ListBottles(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Len(bottles, 4)
+	for i, b := range bottles {
+		s.Require().Equal(i, b.Idx)
+		s.Require().False(b.IsTracked())
+		s.Require().False(b.IsLow())
+		s.Require().True(b.CanPour(1000))
+	}
+
+	// untracked bottles are not decremented
+	err = DecrementBottle(ctx, tx, 0, 50)
+	s.Require().NoError(err)
+	b, err := GetBottle(ctx, tx, 0)
+	s.Require().NoError(err)
+	s.Require().Equal(0.0, b.RemainingMl)
+
+	err = ReplaceBottle(ctx, tx, 0, 750, nil, time.Now())
+	s.Require().NoError(err)
+	err = ReplaceBottle(ctx, tx, 1, 750, util.Ptr(100.0), time.Now())
+	s.Require().NoError(err)
+	err = ReplaceBottle(ctx, tx, 10, 750, nil, time.Now())
+	s.Require().Error(err)
+
+	b, err = GetBottle(ctx, tx, 0)
+	s.Require().NoError(err)
+	s.Require().True(b.IsTracked())
+	s.Require().Equal(750.0, b.RemainingMl)
+	s.Require().NotNil(b.ReplacedAt)
+
+	err = SetBottleLowThreshold(ctx, tx, 1, util.Ptr(80.0))
+	s.Require().NoError(err)
+	err = DecrementBottle(ctx, tx, 1, 30)
+	s.Require().NoError(err)
+
+	b, err = GetBottle(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().Equal(70.0, b.RemainingMl)
+	s.Require().True(b.IsLow())
+	s.Require().True(b.CanPour(70))
+	s.Require().False(b.CanPour(71))
+
+	err = DecrementBottle(ctx, tx, 1, 100)
+	s.Require().NoError(err)
+	b, err = GetBottle(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().Equal(0.0, b.RemainingMl)
+
+	// fluid returned to a bottle never fills it beyond its capacity
+	err = DecrementBottle(ctx, tx, 1, -30)
+	s.Require().NoError(err)
+	b, err = GetBottle(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().Equal(30.0, b.RemainingMl)
+
+	err = DecrementBottle(ctx, tx, 1, -1000)
+	s.Require().NoError(err)
+	b, err = GetBottle(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().Equal(750.0, b.RemainingMl)
+
+	err = SetBottleLowThreshold(ctx, tx, 1, nil)
+	s.Require().NoError(err)
+	b, err = GetBottle(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().False(b.IsLow())
+
+	err = SetConfig(ctx, tx, map[string]string{NumPumpsConfigKey: "2"})
+	s.Require().NoError(err)
+	bottles, err = ListBottles(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Len(bottles, 2)
+}
@@ -0,0 +1,126 @@
+package openbardb
+
+import (
+	"context"
+	"fmt"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"github.com/gocraft/dbr/v2"
+	"time"
+)
+
+const (
+	PumpCalibrationsTable = "pump_calibrations"
+
+	pumpIdxCol      = "pump_idx"
+	calibratedAtCol = "calibrated_at"
+	durationMsCol   = "duration_ms"
+	volumeMlCol     = "volume_ml"
+	speedCol        = "speed"
+)
+
+// PumpCalibration is a single calibration measurement for a pump. The pump was run at Speed for DurationMs and
+// dispensed VolumeMl which resulted in a flow rate of MlPerSec.
+type PumpCalibration struct {
+	PumpIdx      int       `db:"pump_idx"`
+	CalibratedAt time.Time `db:"calibrated_at"`
+	DurationMs   int64     `db:"duration_ms"`
+	VolumeMl     float64   `db:"volume_ml"`
+	MlPerSec     float64   `db:"ml_per_sec"`
+	Speed        float64   `db:"speed"`
+}
+
+// NewPumpCalibration computes the flow rate of a pump which ran at speed for the given duration and dispensed
+// volumeMl.
+func NewPumpCalibration(idx int, duration time.Duration, volumeMl, speed float64) (*PumpCalibration, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("calibration duration must be > 0")
+	} else if volumeMl <= 0 {
+		return nil, fmt.Errorf("calibration volume must be > 0")
+	} else if speed <= 0 || speed > hardware.FullSpeed {
+		return nil, fmt.Errorf("calibration speed must be > 0 and <= 1")
+	}
+
+	return &PumpCalibration{
+		PumpIdx:      idx,
+		CalibratedAt: time.Now().UTC().Truncate(time.Second),
+		DurationMs:   duration.Milliseconds(),
+		VolumeMl:     volumeMl,
+		MlPerSec:     volumeMl / duration.Seconds(),
+		Speed:        speed,
+	}, nil
+}
+
+// CalibratePump records the calibration in the calibration history. A calibration at full speed also updates the
+// pump's ml_per_sec.
+func CalibratePump(ctx context.Context, tx *dbr.Tx, cal *PumpCalibration) error {
+	_, err := GetPump(ctx, tx, cal.PumpIdx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.InsertInto(PumpCalibrationsTable).
+		Columns(pumpIdxCol, calibratedAtCol, durationMsCol, volumeMlCol, mlPerSecCol, speedCol).
+		Record(cal).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert calibration for pump %d: %w", cal.PumpIdx, err)
+	}
+
+	// only calibrations at full speed set the flow rate of a pump
+	if cal.Speed != hardware.FullSpeed {
+		return nil
+	}
+
+	_, err = tx.Update(PumpsTable).Set(mlPerSecCol, cal.MlPerSec).Where(dbr.Eq(idxCol, cal.PumpIdx)).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update ml_per_sec for pump %d: %w", cal.PumpIdx, err)
+	}
+
+	return nil
+}
+
+// ListPumpCalibrations returns the calibration history for a pump ordered from oldest to newest.
+func ListPumpCalibrations(ctx context.Context, tx *dbr.Tx, idx int) ([]PumpCalibration, error) {
+	var cals []PumpCalibration
+	_, err := tx.Select(pumpIdxCol, calibratedAtCol, durationMsCol, volumeMlCol, mlPerSecCol, speedCol).
+		From(PumpCalibrationsTable).
+		Where(dbr.Eq(pumpIdxCol, idx)).
+		OrderBy(calibratedAtCol).
+		OrderBy("id").
+		LoadContext(ctx, &cals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load calibrations for pump %d: %w", idx, err)
+	}
+
+	return cals, nil
+}
+
+// ListSpeedCalibrations returns the latest calibration of each pump at each speed below full speed, keyed by pump index
+// and ordered by speed.
+func ListSpeedCalibrations(ctx context.Context, tx *dbr.Tx) (map[int][]PumpCalibration, error) {
+	var cals []PumpCalibration
+	_, err := tx.Select(pumpIdxCol, calibratedAtCol, durationMsCol, volumeMlCol, mlPerSecCol, speedCol).
+		From(PumpCalibrationsTable).
+		Where(dbr.Lt(speedCol, hardware.FullSpeed)).
+		OrderBy(pumpIdxCol).
+		OrderBy(speedCol).
+		OrderBy(calibratedAtCol).
+		OrderBy("id").
+		LoadContext(ctx, &cals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load speed calibrations: %w", err)
+	}
+
+	pumpToCals := make(map[int][]PumpCalibration)
+	for _, cal := range cals {
+		pumpCals := pumpToCals[cal.PumpIdx]
+		if n := len(pumpCals); n > 0 && pumpCals[n-1].Speed == cal.Speed {
+			// later calibrations at the same speed replace earlier ones
+			pumpCals[n-1] = cal
+		} else {
+			pumpToCals[cal.PumpIdx] = append(pumpCals, cal)
+		}
+	}
+
+	return pumpToCals, nil
+}
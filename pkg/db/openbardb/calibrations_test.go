@@ -0,0 +1,86 @@
+package openbardb
+
+import (
+	"context"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware"
+	"time"
+)
+
+func (s *testSuite) TestPumpCalibrations() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	err = SetConfig(ctx, tx, map[string]string{NumPumpsConfigKey: "4"})
+	s.Require().NoError(err)
+
+	_, err = NewPumpCalibration(0, 0, 10, hardware.FullSpeed)
+	s.Require().Error(err)
+
+	_, err = NewPumpCalibration(0, time.Second, 0, hardware.FullSpeed)
+	s.Require().Error(err)
+
+	_, err = NewPumpCalibration(0, time.Second, 10, 1.5)
+	s.Require().Error(err)
+
+	cal, err := NewPumpCalibration(2, 10*time.Second, 25, hardware.FullSpeed)
+	s.Require().NoError(err)
+	s.Require().Equal(2.5, cal.MlPerSec)
+
+	err = CalibratePump(ctx, tx, cal)
+	s.Require().NoError(err)
+
+	cal, err = NewPumpCalibration(2, 5*time.Second, 15, hardware.FullSpeed)
+	s.Require().NoError(err)
+
+	err = CalibratePump(ctx, tx, cal)
+	s.Require().NoError(err)
+
+	pump, err := GetPump(ctx, tx, 2)
+	s.Require().NoError(err)
+	s.Require().Equal(3.0, pump.MlPerSec)
+
+	for _, vol := range []float64{5, 4} {
+		cal, err = NewPumpCalibration(2, 4*time.Second, vol, 0.5)
+		s.Require().NoError(err)
+
+		err = CalibratePump(ctx, tx, cal)
+		s.Require().NoError(err)
+	}
+
+	cal, err = NewPumpCalibration(2, 4*time.Second, 2, 0.25)
+	s.Require().NoError(err)
+
+	err = CalibratePump(ctx, tx, cal)
+	s.Require().NoError(err)
+
+	pump, err = GetPump(ctx, tx, 2)
+	s.Require().NoError(err)
+	s.Require().Equal(3.0, pump.MlPerSec)
+
+	speedCals, err := ListSpeedCalibrations(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Len(speedCals, 1)
+	s.Require().Len(speedCals[2], 2)
+	s.Require().Equal(0.25, speedCals[2][0].Speed)
+	s.Require().Equal(0.5, speedCals[2][1].Speed)
+	s.Require().Equal(1.0, speedCals[2][1].MlPerSec)
+
+	cals, err := ListPumpCalibrations(ctx, tx, 2)
+	s.Require().NoError(err)
+	s.Require().Len(cals, 5)
+	s.Require().Equal(hardware.FullSpeed, cals[0].Speed)
+	s.Require().Equal(2.5, cals[0].MlPerSec)
+	s.Require().Equal(int64(10000), cals[0].DurationMs)
+	s.Require().Equal(3.0, cals[1].MlPerSec)
+
+	cals, err = ListPumpCalibrations(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().Len(cals, 0)
+
+	cal, err = NewPumpCalibration(7, time.Second, 1, hardware.FullSpeed)
+	s.Require().NoError(err)
+
+	err = CalibratePump(ctx, tx, cal)
+	s.Require().Error(err)
+}
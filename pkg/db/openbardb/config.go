@@ -2,6 +2,7 @@ package openbardb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gocraft/dbr/v2"
 	"strconv"
@@ -14,6 +15,21 @@ const (
 	NumPumpsConfigKey    = "num_pumps"
 	DefaultVolConfigKey  = "default_volume_ml"
 	CurrentMenuConfigKey = "current_menu"
+
+	// PumpSelectionConfigKey sets how pumps are chosen when more than one pump is loaded with a requested fluid
+	PumpSelectionConfigKey = "pump_selection"
+
+	// FinishSpeedConfigKey is the speed pumps slow to for the last FinishVolumeConfigKey ml of each fluid on hardware
+	// that supports speed. Pours finish at full speed if either is unset.
+	FinishSpeedConfigKey  = "finish_speed"
+	FinishVolumeConfigKey = "finish_volume_ml"
+)
+
+const (
+	// PumpSelectionLeastUsed pours each fluid from the pump with the least runtime. This is the default.
+	PumpSelectionLeastUsed = "least_used"
+	// PumpSelectionSplit splits each fluid across all pumps loaded with it in proportion to their speed
+	PumpSelectionSplit = "split"
 )
 
 type RequiredKey struct {
@@ -125,6 +141,24 @@ func DeleteConfigValues(ctx context.Context, tx *dbr.Tx, keys ...string) error {
 	return nil
 }
 
+// getNumPumps returns the configured number of pumps
+func getNumPumps(ctx context.Context, tx *dbr.Tx) (int, error) {
+	var numPumpsStr string
+	err := tx.Select("value").From(configTable).Where(dbr.Eq(keyCol, NumPumpsConfigKey)).LoadOneContext(ctx, &numPumpsStr)
+	if errors.Is(err, dbr.ErrNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to load %s: %w", NumPumpsConfigKey, err)
+	}
+
+	numPumps, err := strconv.Atoi(numPumpsStr)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %w", NumPumpsConfigKey, numPumpsStr, err)
+	}
+
+	return numPumps, nil
+}
+
 func numPumpsUpdated(ctx context.Context, tx *dbr.Tx, numPumpsStr string) error {
 	numPumps, err := strconv.ParseInt(numPumpsStr, 10, 64)
 	if err != nil {
@@ -143,6 +177,16 @@ func numPumpsUpdated(ctx context.Context, tx *dbr.Tx, numPumpsStr string) error
 		return err
 	}
 
+	_, err = tx.DeleteFrom(PumpUsageTable).Where(dbr.Gte(idxCol, numPumps)).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.DeleteFrom(BottlesTable).Where(dbr.Gte(idxCol, numPumps)).ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
 	if numPumps > 0 {
 		ins := tx.InsertInto(PumpsTable).Ignore().Columns(idxCol, mlPerSecCol)
 		for i := 0; i < int(numPumps); i++ {
@@ -159,6 +203,26 @@ func numPumpsUpdated(ctx context.Context, tx *dbr.Tx, numPumpsStr string) error
 			ins = ins.Values(i)
 		}
 
+		_, err = ins.ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		ins = tx.InsertInto(PumpUsageTable).Ignore().Columns(idxCol)
+		for i := int64(0); i < numPumps; i++ {
+			ins = ins.Values(i)
+		}
+
+		_, err = ins.ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		ins = tx.InsertInto(BottlesTable).Ignore().Columns(idxCol)
+		for i := int64(0); i < numPumps; i++ {
+			ins = ins.Values(i)
+		}
+
 		_, err = ins.ExecContext(ctx)
 		return err
 	}
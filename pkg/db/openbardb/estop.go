@@ -0,0 +1,86 @@
+package openbardb
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocraft/dbr/v2"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	EStopEventsTable = "estop_events"
+
+	triggeredAtCol = "triggered_at"
+	sourceCol      = "source"
+	reasonCol      = "reason"
+	resetAtCol     = "reset_at"
+)
+
+// EStopEvent is a record of the emergency stop being triggered. Source is what triggered it, and ResetAt is nil until
+// the emergency stop is reset.
+type EStopEvent struct {
+	Id          string     `db:"id"`
+	TriggeredAt time.Time  `db:"triggered_at"`
+	Source      string     `db:"source"`
+	Reason      *string    `db:"reason"`
+	ResetAt     *time.Time `db:"reset_at"`
+}
+
+// CreateEStopEvent records the emergency stop being triggered. The event's Id is set, and TriggeredAt is set to the
+// current time if it is zero.
+func CreateEStopEvent(ctx context.Context, tx *dbr.Tx, evt *EStopEvent) error {
+	if evt.Id != "" {
+		return fmt.Errorf("e-stop event id must be empty")
+	}
+
+	evt.Id = uuid.New().String()
+	if evt.TriggeredAt.IsZero() {
+		evt.TriggeredAt = time.Now()
+	}
+	evt.TriggeredAt = evt.TriggeredAt.UTC().Truncate(time.Second)
+
+	if evt.Reason != nil && len(*evt.Reason) > 255 {
+		reason := (*evt.Reason)[:255]
+		evt.Reason = &reason
+	}
+
+	_, err := tx.InsertInto(EStopEventsTable).
+		Columns(idCol, triggeredAtCol, sourceCol, reasonCol).
+		Record(evt).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert e-stop event: %w", err)
+	}
+
+	return nil
+}
+
+// ResetEStopEvents records the reset of every emergency stop event that hasn't been reset
+func ResetEStopEvents(ctx context.Context, tx *dbr.Tx) error {
+	_, err := tx.Update(EStopEventsTable).
+		Set(resetAtCol, time.Now().UTC().Truncate(time.Second)).
+		Where(dbr.Eq(resetAtCol, nil)).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reset e-stop events: %w", err)
+	}
+
+	return nil
+}
+
+// ListEStopEvents returns emergency stop events newest first. A limit of 0 returns all events.
+func ListEStopEvents(ctx context.Context, tx *dbr.Tx, limit uint64) ([]EStopEvent, error) {
+	sel := tx.Select("*").From(EStopEventsTable).OrderDesc(triggeredAtCol).OrderAsc(idCol)
+	if limit > 0 {
+		sel = sel.Limit(limit)
+	}
+
+	var evts []EStopEvent
+	_, err := sel.LoadContext(ctx, &evts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load e-stop events: %w", err)
+	}
+
+	return evts, nil
+}
@@ -0,0 +1,49 @@
+package openbardb
+
+import (
+	"context"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"time"
+)
+
+func (s *testSuite) TestEStopEvents() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	evts, err := ListEStopEvents(ctx, tx, 0)
+	s.Require().NoError(err)
+	s.Require().Empty(evts)
+
+	start := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	first := &EStopEvent{TriggeredAt: start, Source: "input"}
+	err = CreateEStopEvent(ctx, tx, first)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(first.Id)
+
+	err = CreateEStopEvent(ctx, tx, first)
+	s.Require().Error(err)
+
+	err = ResetEStopEvents(ctx, tx)
+	s.Require().NoError(err)
+
+	second := &EStopEvent{TriggeredAt: start.Add(time.Hour), Source: "api", Reason: util.Ptr("spill")}
+	err = CreateEStopEvent(ctx, tx, second)
+	s.Require().NoError(err)
+
+	evts, err = ListEStopEvents(ctx, tx, 0)
+	s.Require().NoError(err)
+	s.Require().Len(evts, 2)
+	s.Require().Equal(second.Id, evts[0].Id)
+	s.Require().Equal("api", evts[0].Source)
+	s.Require().Equal("spill", *evts[0].Reason)
+	s.Require().Nil(evts[0].ResetAt)
+	s.Require().Equal(first.Id, evts[1].Id)
+	s.Require().Nil(evts[1].Reason)
+	s.Require().NotNil(evts[1].ResetAt)
+
+	evts, err = ListEStopEvents(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().Len(evts, 1)
+	s.Require().Equal(second.Id, evts[0].Id)
+}
@@ -0,0 +1,123 @@
+package openbardb
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocraft/dbr/v2"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	MaintenanceSchedulesTable = "maintenance_schedules"
+
+	nextRunAtCol = "next_run_at"
+)
+
+// MaintenanceSchedule is a maintenance program which runs at NextRunAt, and then every IntervalSec seconds if
+// IntervalSec isn't 0. Params are the json encoded parameters the program is run with.
+type MaintenanceSchedule struct {
+	Id          string    `db:"id"`
+	Program     string    `db:"program"`
+	Params      string    `db:"params"`
+	NextRunAt   time.Time `db:"next_run_at"`
+	IntervalSec int64     `db:"interval_sec"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Interval returns how often the program repeats, which is 0 if it only runs once
+func (ms MaintenanceSchedule) Interval() time.Duration {
+	return time.Duration(ms.IntervalSec) * time.Second
+}
+
+// CreateMaintenanceSchedule adds a maintenance schedule. The schedule's Id and CreatedAt are set.
+func CreateMaintenanceSchedule(ctx context.Context, tx *dbr.Tx, sched *MaintenanceSchedule) error {
+	if sched.Id != "" {
+		return fmt.Errorf("maintenance schedule id must be empty")
+	} else if sched.IntervalSec < 0 {
+		return fmt.Errorf("maintenance schedule interval must not be negative")
+	}
+
+	sched.Id = uuid.New().String()
+	sched.NextRunAt = sched.NextRunAt.UTC().Truncate(time.Second)
+	sched.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	_, err := tx.InsertInto(MaintenanceSchedulesTable).
+		Columns(idCol, "program", "params", nextRunAtCol, "interval_sec", createdAtCol).
+		Record(sched).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert maintenance schedule: %w", err)
+	}
+
+	return nil
+}
+
+// ListMaintenanceSchedules returns every maintenance schedule ordered by when it next runs
+func ListMaintenanceSchedules(ctx context.Context, tx *dbr.Tx) ([]MaintenanceSchedule, error) {
+	var scheds []MaintenanceSchedule
+	_, err := tx.Select("*").From(MaintenanceSchedulesTable).OrderAsc(nextRunAtCol).OrderAsc(idCol).LoadContext(ctx, &scheds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load maintenance schedules: %w", err)
+	}
+
+	return scheds, nil
+}
+
+// DueMaintenanceSchedules returns the maintenance schedules which were due to run at or before now, ordered by when
+// they were due
+func DueMaintenanceSchedules(ctx context.Context, tx *dbr.Tx, now time.Time) ([]MaintenanceSchedule, error) {
+	var scheds []MaintenanceSchedule
+	_, err := tx.Select("*").
+		From(MaintenanceSchedulesTable).
+		Where(dbr.Lte(nextRunAtCol, now.UTC())).
+		OrderAsc(nextRunAtCol).
+		OrderAsc(idCol).
+		LoadContext(ctx, &scheds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load due maintenance schedules: %w", err)
+	}
+
+	return scheds, nil
+}
+
+// AdvanceMaintenanceSchedule moves a schedule which has come due to the first time after now that it repeats, or
+// deletes it if it doesn't repeat
+func AdvanceMaintenanceSchedule(ctx context.Context, tx *dbr.Tx, sched MaintenanceSchedule, now time.Time) error {
+	interval := sched.Interval()
+	if interval <= 0 {
+		return DeleteMaintenanceSchedule(ctx, tx, sched.Id)
+	}
+
+	next := sched.NextRunAt
+	if missed := now.Sub(next); missed >= 0 {
+		next = next.Add((missed/interval + 1) * interval)
+	}
+
+	_, err := tx.Update(MaintenanceSchedulesTable).
+		Set(nextRunAtCol, next.UTC().Truncate(time.Second)).
+		Where(dbr.Eq(idCol, sched.Id)).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to advance maintenance schedule '%s': %w", sched.Id, err)
+	}
+
+	return nil
+}
+
+// DeleteMaintenanceSchedule deletes a maintenance schedule, returning dbr.ErrNotFound if it doesn't exist
+func DeleteMaintenanceSchedule(ctx context.Context, tx *dbr.Tx, id string) error {
+	res, err := tx.DeleteFrom(MaintenanceSchedulesTable).Where(dbr.Eq(idCol, id)).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete maintenance schedule '%s': %w", id, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows for maintenance schedule '%s': %w", id, err)
+	} else if n == 0 {
+		return dbr.ErrNotFound
+	}
+
+	return nil
+}
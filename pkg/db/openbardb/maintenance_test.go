@@ -0,0 +1,95 @@
+package openbardb
+
+import (
+	"context"
+	"github.com/gocraft/dbr/v2"
+	"time"
+)
+
+func (s *testSuite) TestMaintenanceSchedules() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	scheds, err := ListMaintenanceSchedules(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Empty(scheds)
+
+	start := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	once := &MaintenanceSchedule{Program: "purge", Params: "{}", NextRunAt: start.Add(time.Hour)}
+	err = CreateMaintenanceSchedule(ctx, tx, once)
+	s.Require().NoError(err)
+	s.Require().NotEmpty(once.Id)
+
+	err = CreateMaintenanceSchedule(ctx, tx, once)
+	s.Require().Error(err)
+
+	daily := &MaintenanceSchedule{Program: "rinse", Params: `{"cycles":3}`, NextRunAt: start, IntervalSec: 24 * 60 * 60}
+	err = CreateMaintenanceSchedule(ctx, tx, daily)
+	s.Require().NoError(err)
+
+	scheds, err = ListMaintenanceSchedules(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Len(scheds, 2)
+	s.Require().Equal(daily.Id, scheds[0].Id)
+	s.Require().Equal(`{"cycles":3}`, scheds[0].Params)
+	s.Require().Equal(24*time.Hour, scheds[0].Interval())
+
+	due, err := DueMaintenanceSchedules(ctx, tx, start.Add(30*time.Minute))
+	s.Require().NoError(err)
+	s.Require().Len(due, 1)
+	s.Require().Equal(daily.Id, due[0].Id)
+
+	// repeating schedules move to their next run after now, skipping runs that were missed
+	now := start.Add(50 * time.Hour)
+	due, err = DueMaintenanceSchedules(ctx, tx, now)
+	s.Require().NoError(err)
+	s.Require().Len(due, 2)
+
+	for _, sched := range due {
+		err = AdvanceMaintenanceSchedule(ctx, tx, sched, now)
+		s.Require().NoError(err)
+	}
+
+	scheds, err = ListMaintenanceSchedules(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Len(scheds, 1)
+	s.Require().Equal(daily.Id, scheds[0].Id)
+	s.Require().True(start.Add(72*time.Hour).Equal(scheds[0].NextRunAt), scheds[0].NextRunAt.String())
+
+	err = DeleteMaintenanceSchedule(ctx, tx, daily.Id)
+	s.Require().NoError(err)
+	err = DeleteMaintenanceSchedule(ctx, tx, daily.Id)
+	s.Require().ErrorIs(err, dbr.ErrNotFound)
+}
+
+func (s *testSuite) TestPumpTubeVolume() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	err = SetConfig(ctx, tx, map[string]string{NumPumpsConfigKey: "2"})
+	s.Require().NoError(err)
+
+	err = UpdatePumps(ctx, tx, []Pump{{Idx: 0, MlPerSec: 10}})
+	s.Require().NoError(err)
+
+	err = SetPumpTubeVolume(ctx, tx, 0, 12.5)
+	s.Require().NoError(err)
+	err = SetPumpTubeVolume(ctx, tx, 1, 8)
+	s.Require().NoError(err)
+	err = SetPumpTubeVolume(ctx, tx, 2, 8)
+	s.Require().ErrorIs(err, ErrInvalidPumpIdx)
+
+	// updating flow rates doesn't change tube volumes
+	err = UpdatePumps(ctx, tx, []Pump{{Idx: 0, MlPerSec: 20}})
+	s.Require().NoError(err)
+
+	pump, err := GetPump(ctx, tx, 0)
+	s.Require().NoError(err)
+	s.Require().Equal(Pump{Idx: 0, MlPerSec: 20, TubeVolumeMl: 12.5}, *pump)
+
+	pump, err = GetPump(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().Equal(Pump{Idx: 1, MlPerSec: 1, TubeVolumeMl: 8}, *pump)
+}
@@ -0,0 +1,276 @@
+package openbardb
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocraft/dbr/v2"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	OrdersTable      = "orders"
+	OrderFluidsTable = "order_fluids"
+
+	idCol          = "id"
+	positionCol    = "position"
+	statusCol      = "status"
+	createdAtCol   = "created_at"
+	startedAtCol   = "started_at"
+	finishedAtCol  = "finished_at"
+	errorCol       = "error"
+	orderIdFkCol   = "order_id_fk"
+	stepDelayMsCol = "step_delay_ms"
+)
+
+// OrderStatus is the state of an order in the queue
+type OrderStatus string
+
+const (
+	OrderQueued    OrderStatus = "queued"
+	OrderPouring   OrderStatus = "pouring"
+	OrderDone      OrderStatus = "done"
+	OrderFailed    OrderStatus = "failed"
+	OrderCancelled OrderStatus = "cancelled"
+)
+
+// IsFinished returns true if an order with this status will never be poured
+func (os OrderStatus) IsFinished() bool {
+	return os == OrderDone || os == OrderFailed || os == OrderCancelled
+}
+
+// OrderFluid is the volume of a single fluid in an order, poured in Step after waiting StepDelayMs at the given Speed
+type OrderFluid struct {
+	OrderIdFk   string  `db:"order_id_fk"`
+	Fluid       string  `db:"fluid"`
+	VolumeMl    uint    `db:"volume_ml"`
+	Step        uint    `db:"step"`
+	StepDelayMs uint    `db:"step_delay_ms"`
+	Speed       float64 `db:"speed"`
+}
+
+// Order is a drink waiting to be, being, or that has been poured. Queued orders are poured in order of Position.
+type Order struct {
+	Id         string      `db:"id"`
+	Position   int64       `db:"position"`
+	Status     OrderStatus `db:"status"`
+	CreatedAt  time.Time   `db:"created_at"`
+	StartedAt  *time.Time  `db:"started_at"`
+	FinishedAt *time.Time  `db:"finished_at"`
+	Error      *string     `db:"error"`
+	RecipeId   *string     `db:"recipe_id"`
+
+	Fluids []OrderFluid
+}
+
+// CreateOrder adds an order to the end of the queue. The order's Id, Position, Status and CreatedAt are set.
+func CreateOrder(ctx context.Context, tx *dbr.Tx, order *Order) error {
+	if order.Id != "" {
+		return fmt.Errorf("order id must be empty")
+	} else if len(order.Fluids) == 0 {
+		return fmt.Errorf("order must have at least one fluid")
+	}
+
+	var nextPos int64
+	_, err := tx.Select("COALESCE(MAX("+positionCol+") + 1, 0)").From(OrdersTable).LoadContext(ctx, &nextPos)
+	if err != nil {
+		return fmt.Errorf("failed to get last order position: %w", err)
+	}
+
+	order.Id = uuid.New().String()
+	order.Status = OrderQueued
+	order.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	order.Position = nextPos
+
+	_, err = tx.InsertInto(OrdersTable).Columns(idCol, positionCol, statusCol, createdAtCol, recipeIdCol).Record(order).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert order: %w", err)
+	}
+
+	ins := tx.InsertInto(OrderFluidsTable).Columns(orderIdFkCol, fluidCol, volumeMlCol, stepCol, stepDelayMsCol, speedCol)
+	for i := range order.Fluids {
+		order.Fluids[i].OrderIdFk = order.Id
+		ins = ins.Record(&order.Fluids[i])
+	}
+
+	_, err = ins.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert fluids for order '%s': %w", order.Id, err)
+	}
+
+	return nil
+}
+
+// GetOrder returns the order with the given id
+func GetOrder(ctx context.Context, tx *dbr.Tx, id string) (*Order, error) {
+	var order Order
+	err := tx.Select("*").From(OrdersTable).Where(dbr.Eq(idCol, id)).LoadOneContext(ctx, &order)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order '%s': %w", id, err)
+	}
+
+	_, err = tx.Select("*").From(OrderFluidsTable).Where(dbr.Eq(orderIdFkCol, id)).LoadContext(ctx, &order.Fluids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fluids for order '%s': %w", id, err)
+	}
+
+	return &order, nil
+}
+
+// ListOrders returns the orders with any of the given statuses ordered by position. If no statuses are provided all
+// orders are returned.
+func ListOrders(ctx context.Context, tx *dbr.Tx, statuses ...OrderStatus) ([]Order, error) {
+	sel := tx.Select("*").From(OrdersTable).OrderBy(positionCol)
+	if len(statuses) > 0 {
+		sel = sel.Where(dbr.Eq(statusCol, statuses))
+	}
+
+	var orders []Order
+	_, err := sel.LoadContext(ctx, &orders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load orders: %w", err)
+	}
+
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	ids := make([]string, len(orders))
+	idToIdx := make(map[string]int)
+	for i := range orders {
+		ids[i] = orders[i].Id
+		idToIdx[orders[i].Id] = i
+	}
+
+	var fluids []OrderFluid
+	_, err = tx.Select("*").From(OrderFluidsTable).Where(dbr.Eq(orderIdFkCol, ids)).LoadContext(ctx, &fluids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load order fluids: %w", err)
+	}
+
+	for _, fluid := range fluids {
+		idx := idToIdx[fluid.OrderIdFk]
+		orders[idx].Fluids = append(orders[idx].Fluids, fluid)
+	}
+
+	return orders, nil
+}
+
+// NextQueuedOrder returns the queued order with the lowest position, or nil if the queue is empty
+func NextQueuedOrder(ctx context.Context, tx *dbr.Tx) (*Order, error) {
+	var ids []string
+	_, err := tx.Select(idCol).From(OrdersTable).Where(dbr.Eq(statusCol, OrderQueued)).OrderBy(positionCol).Limit(1).LoadContext(ctx, &ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load next order: %w", err)
+	} else if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return GetOrder(ctx, tx, ids[0])
+}
+
+// SetOrderStatus updates the status of an order. Moving to OrderPouring sets the start time and moving to a finished
+// status sets the finish time. errMsg is only recorded for failed orders.
+func SetOrderStatus(ctx context.Context, tx *dbr.Tx, id string, status OrderStatus, errMsg string) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	upd := tx.Update(OrdersTable).Set(statusCol, status)
+	if status == OrderPouring {
+		upd = upd.Set(startedAtCol, now)
+	} else if status.IsFinished() {
+		upd = upd.Set(finishedAtCol, now)
+	}
+
+	if status == OrderFailed && errMsg != "" {
+		if len(errMsg) > 255 {
+			errMsg = errMsg[:255]
+		}
+
+		upd = upd.Set(errorCol, errMsg)
+	}
+
+	_, err := upd.Where(dbr.Eq(idCol, id)).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update status of order '%s': %w", id, err)
+	}
+
+	return nil
+}
+
+// MoveOrder moves a queued order to the given position within the queued orders, where 0 is the next order to be poured
+func MoveOrder(ctx context.Context, tx *dbr.Tx, id string, newPos int) error {
+	var ids []string
+	_, err := tx.Select(idCol).From(OrdersTable).Where(dbr.Eq(statusCol, OrderQueued)).OrderBy(positionCol).LoadContext(ctx, &ids)
+	if err != nil {
+		return fmt.Errorf("failed to load queued orders: %w", err)
+	}
+
+	curr := -1
+	for i := range ids {
+		if ids[i] == id {
+			curr = i
+			break
+		}
+	}
+
+	if curr == -1 {
+		return fmt.Errorf("queued order '%s': %w", id, dbr.ErrNotFound)
+	}
+
+	if newPos < 0 {
+		newPos = 0
+	} else if newPos >= len(ids) {
+		newPos = len(ids) - 1
+	}
+
+	ids = append(ids[:curr], ids[curr+1:]...)
+	ids = append(ids[:newPos], append([]string{id}, ids[newPos:]...)...)
+
+	var minPos int64
+	_, err = tx.Select("MIN("+positionCol+")").From(OrdersTable).Where(dbr.Eq(statusCol, OrderQueued)).LoadContext(ctx, &minPos)
+	if err != nil {
+		return fmt.Errorf("failed to get first queued order position: %w", err)
+	}
+
+	for i := range ids {
+		_, err = tx.Update(OrdersTable).Set(positionCol, minPos+int64(i)).Where(dbr.Eq(idCol, ids[i])).ExecContext(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to update position of order '%s': %w", ids[i], err)
+		}
+	}
+
+	return nil
+}
+
+// FailInterruptedOrders marks any orders which were being poured when the server stopped as failed
+func FailInterruptedOrders(ctx context.Context, tx *dbr.Tx) error {
+	_, err := tx.Update(OrdersTable).
+		Set(statusCol, OrderFailed).
+		Set(errorCol, "interrupted").
+		Set(finishedAtCol, time.Now().UTC().Truncate(time.Second)).
+		Where(dbr.Eq(statusCol, OrderPouring)).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fail interrupted orders: %w", err)
+	}
+
+	return nil
+}
+
+// CancelQueuedOrders cancels every queued order, returning the number of orders cancelled
+func CancelQueuedOrders(ctx context.Context, tx *dbr.Tx) (int, error) {
+	res, err := tx.Update(OrdersTable).
+		Set(statusCol, OrderCancelled).
+		Set(finishedAtCol, time.Now().UTC().Truncate(time.Second)).
+		Where(dbr.Eq(statusCol, OrderQueued)).
+		ExecContext(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to cancel queued orders: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to cancel queued orders: %w", err)
+	}
+
+	return int(n), nil
+}
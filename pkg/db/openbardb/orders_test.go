@@ -0,0 +1,112 @@
+package openbardb
+
+import (
+	"context"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+)
+
+func (s *testSuite) TestOrders() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	next, err := NextQueuedOrder(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Nil(next)
+
+	err = CreateOrder(ctx, tx, &Order{})
+	s.Require().Error(err)
+
+	var ids []string
+	for _, fluid := range []string{"gin", "vodka", "rum"} {
+		order := &Order{Fluids: []OrderFluid{{Fluid: fluid, VolumeMl: 50}, {Fluid: "tonic", VolumeMl: 100}}}
+		err = CreateOrder(ctx, tx, order)
+		s.Require().NoError(err)
+		s.Require().NotEmpty(order.Id)
+		s.Require().Equal(OrderQueued, order.Status)
+		ids = append(ids, order.Id)
+	}
+
+	order, err := GetOrder(ctx, tx, ids[1])
+	s.Require().NoError(err)
+	s.Require().Equal(OrderQueued, order.Status)
+	s.Require().Len(order.Fluids, 2)
+	s.Require().Nil(order.StartedAt)
+
+	next, err = NextQueuedOrder(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Equal(ids[0], next.Id)
+
+	err = MoveOrder(ctx, tx, ids[2], 0)
+	s.Require().NoError(err)
+
+	orders, err := ListOrders(ctx, tx, OrderQueued)
+	s.Require().NoError(err)
+	s.Require().Len(orders, 3)
+	s.Require().Equal([]string{ids[2], ids[0], ids[1]}, []string{orders[0].Id, orders[1].Id, orders[2].Id})
+	s.Require().Len(orders[0].Fluids, 2)
+
+	err = SetOrderStatus(ctx, tx, ids[2], OrderPouring, "")
+	s.Require().NoError(err)
+
+	order, err = GetOrder(ctx, tx, ids[2])
+	s.Require().NoError(err)
+	s.Require().Equal(OrderPouring, order.Status)
+	s.Require().NotNil(order.StartedAt)
+
+	next, err = NextQueuedOrder(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Equal(ids[0], next.Id)
+
+	err = MoveOrder(ctx, tx, ids[2], 1)
+	s.Require().Error(err)
+
+	err = SetOrderStatus(ctx, tx, ids[0], OrderCancelled, "")
+	s.Require().NoError(err)
+
+	err = FailInterruptedOrders(ctx, tx)
+	s.Require().NoError(err)
+
+	order, err = GetOrder(ctx, tx, ids[2])
+	s.Require().NoError(err)
+	s.Require().Equal(OrderFailed, order.Status)
+	s.Require().NotNil(order.FinishedAt)
+	s.Require().Equal("interrupted", *order.Error)
+
+	orders, err = ListOrders(ctx, tx, OrderQueued)
+	s.Require().NoError(err)
+	s.Require().Len(orders, 1)
+	s.Require().Equal(ids[1], orders[0].Id)
+
+	orders, err = ListOrders(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Len(orders, 3)
+	n, err := CancelQueuedOrders(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Equal(1, n)
+
+	order, err = GetOrder(ctx, tx, ids[1])
+	s.Require().NoError(err)
+	s.Require().Equal(OrderCancelled, order.Status)
+	s.Require().NotNil(order.FinishedAt)
+
+	next, err = NextQueuedOrder(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Nil(next)
+
+	// the steps, delays and speeds of an order's fluids and its recipe are stored with it
+	stepped := &Order{
+		RecipeId: util.Ptr("negroni"),
+		Fluids: []OrderFluid{
+			{Fluid: "gin", VolumeMl: 30},
+			{Fluid: "campari", VolumeMl: 30, Step: 1, StepDelayMs: 500, Speed: 0.5},
+		},
+	}
+	err = CreateOrder(ctx, tx, stepped)
+	s.Require().NoError(err)
+
+	order, err = GetOrder(ctx, tx, stepped.Id)
+	s.Require().NoError(err)
+	s.Require().Equal(stepped.RecipeId, order.RecipeId)
+	s.Require().ElementsMatch(stepped.Fluids, order.Fluids)
+}
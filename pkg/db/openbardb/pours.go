@@ -0,0 +1,179 @@
+package openbardb
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocraft/dbr/v2"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	PoursTable      = "pours"
+	PourFluidsTable = "pour_fluids"
+
+	pouredAtCol    = "poured_at"
+	outcomeCol     = "outcome"
+	pourIdFkCol    = "pour_id_fk"
+	requestedMlCol = "requested_ml"
+)
+
+// PourOutcome is the result of a pour
+type PourOutcome string
+
+const (
+	PourCompleted PourOutcome = "completed"
+	PourCancelled PourOutcome = "cancelled"
+	PourFailed    PourOutcome = "failed"
+)
+
+// PourFluid is the volume of a single fluid requested in a pour, and how much was dispensed by the pump it was poured
+// from. PumpIdx is nil if the pour failed before a pump was chosen.
+type PourFluid struct {
+	PourIdFk    string  `db:"pour_id_fk"`
+	Fluid       string  `db:"fluid"`
+	PumpIdx     *int    `db:"pump_idx"`
+	RequestedMl float64 `db:"requested_ml"`
+	DispensedMl float64 `db:"dispensed_ml"`
+}
+
+// Pour is a record of a drink that was poured, or that the machine attempted to pour.
+type Pour struct {
+	Id         string      `db:"id"`
+	PouredAt   time.Time   `db:"poured_at"`
+	RecipeId   *string     `db:"recipe_id"`
+	DurationMs int64       `db:"duration_ms"`
+	Outcome    PourOutcome `db:"outcome"`
+	Error      *string     `db:"error"`
+
+	Fluids []PourFluid
+}
+
+// PourFilter limits the pours returned by ListPours. Pours are returned newest first. A nil From or To leaves that end
+// of the time range open, and a Limit of 0 returns all pours.
+type PourFilter struct {
+	From   *time.Time
+	To     *time.Time
+	Limit  uint64
+	Offset uint64
+}
+
+func (pf PourFilter) applyTimeRange(sel *dbr.SelectStmt) *dbr.SelectStmt {
+	if pf.From != nil {
+		sel = sel.Where(dbr.Gte(pouredAtCol, pf.From.UTC()))
+	}
+
+	if pf.To != nil {
+		sel = sel.Where(dbr.Lt(pouredAtCol, pf.To.UTC()))
+	}
+
+	return sel
+}
+
+// CreatePour records a pour. The pour's Id is set, and PouredAt is set to the current time if it is zero.
+func CreatePour(ctx context.Context, tx *dbr.Tx, pour *Pour) error {
+	if pour.Id != "" {
+		return fmt.Errorf("pour id must be empty")
+	}
+
+	pour.Id = uuid.New().String()
+	if pour.PouredAt.IsZero() {
+		pour.PouredAt = time.Now()
+	}
+	pour.PouredAt = pour.PouredAt.UTC().Truncate(time.Second)
+
+	if pour.Error != nil && len(*pour.Error) > 255 {
+		errMsg := (*pour.Error)[:255]
+		pour.Error = &errMsg
+	}
+
+	_, err := tx.InsertInto(PoursTable).
+		Columns(idCol, pouredAtCol, recipeIdCol, durationMsCol, outcomeCol, errorCol).
+		Record(pour).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert pour: %w", err)
+	}
+
+	if len(pour.Fluids) == 0 {
+		return nil
+	}
+
+	ins := tx.InsertInto(PourFluidsTable).Columns(pourIdFkCol, fluidCol, pumpIdxCol, requestedMlCol, dispensedMlCol)
+	for i := range pour.Fluids {
+		pour.Fluids[i].PourIdFk = pour.Id
+		ins = ins.Record(&pour.Fluids[i])
+	}
+
+	_, err = ins.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert fluids for pour '%s': %w", pour.Id, err)
+	}
+
+	return nil
+}
+
+// GetPour returns the pour with the given id
+func GetPour(ctx context.Context, tx *dbr.Tx, id string) (*Pour, error) {
+	var pour Pour
+	err := tx.Select("*").From(PoursTable).Where(dbr.Eq(idCol, id)).LoadOneContext(ctx, &pour)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pour '%s': %w", id, err)
+	}
+
+	_, err = tx.Select("*").From(PourFluidsTable).Where(dbr.Eq(pourIdFkCol, id)).LoadContext(ctx, &pour.Fluids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fluids for pour '%s': %w", id, err)
+	}
+
+	return &pour, nil
+}
+
+// CountPours returns the number of pours matching the filter's time range
+func CountPours(ctx context.Context, tx *dbr.Tx, filter PourFilter) (int, error) {
+	var count int
+	_, err := filter.applyTimeRange(tx.Select("COUNT(*)").From(PoursTable)).LoadContext(ctx, &count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pours: %w", err)
+	}
+
+	return count, nil
+}
+
+// ListPours returns the pours matching the filter, newest first
+func ListPours(ctx context.Context, tx *dbr.Tx, filter PourFilter) ([]Pour, error) {
+	sel := filter.applyTimeRange(tx.Select("*").From(PoursTable)).OrderDesc(pouredAtCol).OrderAsc(idCol)
+	if filter.Limit > 0 {
+		sel = sel.Limit(filter.Limit).Offset(filter.Offset)
+	}
+
+	var pours []Pour
+	_, err := sel.LoadContext(ctx, &pours)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pours: %w", err)
+	}
+
+	if len(pours) == 0 {
+		return pours, nil
+	}
+
+	ids := make([]string, len(pours))
+	idToIdx := make(map[string]int)
+	for i := range pours {
+		ids[i] = pours[i].Id
+		idToIdx[pours[i].Id] = i
+	}
+
+	var fluids []PourFluid
+	_, err = tx.Select("*").From(PourFluidsTable).Where(dbr.Eq(pourIdFkCol, ids)).LoadContext(ctx, &fluids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pour fluids: %w", err)
+	}
+
+	for _, fluid := range fluids {
+		idx := idToIdx[fluid.PourIdFk]
+		pours[idx].Fluids = append(pours[idx].Fluids, fluid)
+	}
+
+	return pours, nil
+}
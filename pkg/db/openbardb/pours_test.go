@@ -0,0 +1,72 @@
+package openbardb
+
+import (
+	"context"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"time"
+)
+
+func (s *testSuite) TestPours() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	start := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		pour := &Pour{
+			PouredAt:   start.Add(time.Duration(i) * time.Hour),
+			DurationMs: 1000,
+			Outcome:    PourCompleted,
+			Fluids: []PourFluid{
+				{Fluid: "gin", PumpIdx: util.Ptr(0), RequestedMl: 50, DispensedMl: 50.2},
+				{Fluid: "campari", PumpIdx: util.Ptr(3), RequestedMl: 30, DispensedMl: 29.9},
+			},
+		}
+
+		if i == 4 {
+			pour.RecipeId = util.Ptr("negroni")
+			pour.Outcome = PourFailed
+			pour.Error = util.Ptr("not enough gin left")
+			pour.Fluids = []PourFluid{{Fluid: "gin", RequestedMl: 50}}
+		}
+
+		err = CreatePour(ctx, tx, pour)
+		s.Require().NoError(err)
+		s.Require().NotEmpty(pour.Id)
+	}
+
+	err = CreatePour(ctx, tx, &Pour{Id: "set", Outcome: PourCompleted})
+	s.Require().Error(err)
+
+	pours, err := ListPours(ctx, tx, PourFilter{})
+	s.Require().NoError(err)
+	s.Require().Len(pours, 5)
+	s.Require().Equal(PourFailed, pours[0].Outcome)
+	s.Require().Equal("negroni", *pours[0].RecipeId)
+	s.Require().Len(pours[0].Fluids, 1)
+	s.Require().Nil(pours[0].Fluids[0].PumpIdx)
+	s.Require().Len(pours[1].Fluids, 2)
+
+	pour, err := GetPour(ctx, tx, pours[1].Id)
+	s.Require().NoError(err)
+	s.Require().Equal(start.Add(3*time.Hour), pour.PouredAt.UTC())
+	s.Require().Len(pour.Fluids, 2)
+
+	from := start.Add(time.Hour)
+	to := start.Add(4 * time.Hour)
+	filter := PourFilter{From: &from, To: &to, Limit: 2}
+	count, err := CountPours(ctx, tx, filter)
+	s.Require().NoError(err)
+	s.Require().Equal(3, count)
+
+	pours, err = ListPours(ctx, tx, filter)
+	s.Require().NoError(err)
+	s.Require().Len(pours, 2)
+	s.Require().Equal(start.Add(3*time.Hour), pours[0].PouredAt.UTC())
+
+	filter.Offset = 2
+	pours, err = ListPours(ctx, tx, filter)
+	s.Require().NoError(err)
+	s.Require().Len(pours, 1)
+	s.Require().Equal(start.Add(time.Hour), pours[0].PouredAt.UTC())
+}
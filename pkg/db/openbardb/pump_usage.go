@@ -0,0 +1,140 @@
+package openbardb
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocraft/dbr/v2"
+	"time"
+)
+
+const (
+	PumpUsageTable = "pump_usage"
+
+	runtimeMsCol                = "runtime_ms"
+	dispensedMlCol              = "dispensed_ml"
+	serviceRuntimeMsCol         = "service_runtime_ms"
+	serviceDispensedMlCol       = "service_dispensed_ml"
+	servicedAtCol               = "serviced_at"
+	serviceIntervalMlCol        = "service_interval_ml"
+	serviceIntervalRuntimeMsCol = "service_interval_runtime_ms"
+)
+
+// PumpUsage tracks the cumulative runtime and dispensed volume of a pump over its lifetime, as well as since its
+// tubing was last serviced. The service intervals are optional thresholds which, once exceeded, indicate that the
+// tubing should be replaced.
+type PumpUsage struct {
+	Idx                      int        `db:"idx"`
+	RuntimeMs                int64      `db:"runtime_ms"`
+	DispensedMl              float64    `db:"dispensed_ml"`
+	ServiceRuntimeMs         int64      `db:"service_runtime_ms"`
+	ServiceDispensedMl       float64    `db:"service_dispensed_ml"`
+	ServicedAt               *time.Time `db:"serviced_at"`
+	ServiceIntervalMl        *float64   `db:"service_interval_ml"`
+	ServiceIntervalRuntimeMs *int64     `db:"service_interval_runtime_ms"`
+}
+
+// Runtime returns the total time the pump has been run for
+func (pu PumpUsage) Runtime() time.Duration {
+	return time.Duration(pu.RuntimeMs) * time.Millisecond
+}
+
+// NeedsService returns true if the pump has exceeded either of its service intervals since it was last serviced.
+func (pu PumpUsage) NeedsService() bool {
+	if pu.ServiceIntervalMl != nil && pu.ServiceDispensedMl >= *pu.ServiceIntervalMl {
+		return true
+	}
+
+	if pu.ServiceIntervalRuntimeMs != nil && pu.ServiceRuntimeMs >= *pu.ServiceIntervalRuntimeMs {
+		return true
+	}
+
+	return false
+}
+
+// ListPumpUsage returns the usage of all pumps ordered by index.
+func ListPumpUsage(ctx context.Context, tx *dbr.Tx) ([]PumpUsage, error) {
+	var usage []PumpUsage
+	_, err := tx.Select("*").From(PumpUsageTable).OrderBy(idxCol).LoadContext(ctx, &usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pump usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+// GetPumpUsage returns the usage of a single pump.
+func GetPumpUsage(ctx context.Context, tx *dbr.Tx, idx int) (*PumpUsage, error) {
+	var usage PumpUsage
+	err := tx.Select("*").From(PumpUsageTable).Where(dbr.Eq(idxCol, idx)).LoadOneContext(ctx, &usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load usage for pump %d: %w", idx, err)
+	}
+
+	return &usage, nil
+}
+
+// AddPumpUsage adds the runtime and dispensed volume to a pump's lifetime totals and to its totals since last service.
+func AddPumpUsage(ctx context.Context, tx *dbr.Tx, idx int, runtime time.Duration, volumeMl float64) error {
+	_, err := GetPump(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.InsertInto(PumpUsageTable).Ignore().Columns(idxCol).Values(idx).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert usage for pump %d: %w", idx, err)
+	}
+
+	ms := runtime.Milliseconds()
+	_, err = tx.Update(PumpUsageTable).
+		Set(runtimeMsCol, dbr.Expr(runtimeMsCol+" + ?", ms)).
+		Set(dispensedMlCol, dbr.Expr(dispensedMlCol+" + ?", volumeMl)).
+		Set(serviceRuntimeMsCol, dbr.Expr(serviceRuntimeMsCol+" + ?", ms)).
+		Set(serviceDispensedMlCol, dbr.Expr(serviceDispensedMlCol+" + ?", volumeMl)).
+		Where(dbr.Eq(idxCol, idx)).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to add usage for pump %d: %w", idx, err)
+	}
+
+	return nil
+}
+
+// SetPumpServiceIntervals sets the thresholds after which a pump needs service. A nil interval disables that threshold.
+func SetPumpServiceIntervals(ctx context.Context, tx *dbr.Tx, idx int, intervalMl *float64, intervalRuntimeMs *int64) error {
+	_, err := GetPumpUsage(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Update(PumpUsageTable).
+		Set(serviceIntervalMlCol, intervalMl).
+		Set(serviceIntervalRuntimeMsCol, intervalRuntimeMs).
+		Where(dbr.Eq(idxCol, idx)).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to set service intervals for pump %d: %w", idx, err)
+	}
+
+	return nil
+}
+
+// MarkPumpServiced resets the usage since the last service for a pump.
+func MarkPumpServiced(ctx context.Context, tx *dbr.Tx, idx int, at time.Time) error {
+	_, err := GetPumpUsage(ctx, tx, idx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Update(PumpUsageTable).
+		Set(serviceRuntimeMsCol, 0).
+		Set(serviceDispensedMlCol, 0).
+		Set(servicedAtCol, at.UTC().Truncate(time.Second)).
+		Where(dbr.Eq(idxCol, idx)).
+		ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to mark pump %d serviced: %w", idx, err)
+	}
+
+	return nil
+}
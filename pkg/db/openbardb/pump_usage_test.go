@@ -0,0 +1,75 @@
+package openbardb
+
+import (
+	"context"
+	"github.com/cocktailrobots/openbar-server/pkg/util"
+	"time"
+)
+
+func (s *testSuite) TestPumpUsage() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	err = SetConfig(ctx, tx, map[string]string{NumPumpsConfigKey: "4"})
+	s.Require().NoError(err)
+
+	usage, err := ListPumpUsage(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Len(usage, 4)
+	for i, u := range usage {
+		s.Require().Equal(i, u.Idx)
+		s.Require().Equal(time.Duration(0), u.Runtime())
+		s.Require().False(u.NeedsService())
+	}
+
+	err = AddPumpUsage(ctx, tx, 1, 1500*time.Millisecond, 30)
+	s.Require().NoError(err)
+	err = AddPumpUsage(ctx, tx, 1, 500*time.Millisecond, 10)
+	s.Require().NoError(err)
+
+	u, err := GetPumpUsage(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().Equal(2*time.Second, u.Runtime())
+	s.Require().Equal(40.0, u.DispensedMl)
+	s.Require().Equal(int64(2000), u.ServiceRuntimeMs)
+	s.Require().Equal(40.0, u.ServiceDispensedMl)
+	s.Require().False(u.NeedsService())
+
+	err = SetPumpServiceIntervals(ctx, tx, 1, util.Ptr(40.0), nil)
+	s.Require().NoError(err)
+
+	u, err = GetPumpUsage(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().True(u.NeedsService())
+
+	err = MarkPumpServiced(ctx, tx, 1, time.Now())
+	s.Require().NoError(err)
+
+	u, err = GetPumpUsage(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().False(u.NeedsService())
+	s.Require().NotNil(u.ServicedAt)
+	s.Require().Equal(2*time.Second, u.Runtime())
+	s.Require().Equal(int64(0), u.ServiceRuntimeMs)
+
+	err = SetPumpServiceIntervals(ctx, tx, 1, nil, util.Ptr(int64(1000)))
+	s.Require().NoError(err)
+	err = AddPumpUsage(ctx, tx, 1, time.Second, 20)
+	s.Require().NoError(err)
+
+	u, err = GetPumpUsage(ctx, tx, 1)
+	s.Require().NoError(err)
+	s.Require().True(u.NeedsService())
+
+	err = AddPumpUsage(ctx, tx, 4, time.Second, 20)
+	s.Require().Error(err)
+
+	err = SetConfig(ctx, tx, map[string]string{NumPumpsConfigKey: "2"})
+	s.Require().NoError(err)
+
+	usage, err = ListPumpUsage(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Len(usage, 2)
+	s.Require().Equal(3*time.Second, usage[1].Runtime())
+}
@@ -2,6 +2,7 @@ package openbardb
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gocraft/dbr/v2"
 )
@@ -9,12 +10,19 @@ import (
 const (
 	PumpsTable = "pumps"
 
-	mlPerSecCol = "ml_per_sec"
+	mlPerSecCol     = "ml_per_sec"
+	tubeVolumeMlCol = "tube_volume_ml"
 )
 
+// ErrInvalidPumpIdx is returned when a pump's index isn't less than the configured number of pumps
+var ErrInvalidPumpIdx = errors.New("invalid pump index")
+
+// Pump is a pump's flow rate, and the volume of the tube between its bottle and the spout which is filled when the
+// pump is primed.
 type Pump struct {
-	Idx      int     `db:"idx"`
-	MlPerSec float64 `db:"ml_per_sec"`
+	Idx          int     `db:"idx"`
+	MlPerSec     float64 `db:"ml_per_sec"`
+	TubeVolumeMl float64 `db:"tube_volume_ml"`
 }
 
 func CountPumpRows(ctx context.Context, tx *dbr.Tx) (int, error) {
@@ -37,13 +45,36 @@ func ListPumps(ctx context.Context, tx *dbr.Tx) ([]Pump, error) {
 	return pumps, nil
 }
 
+func GetPump(ctx context.Context, tx *dbr.Tx, idx int) (*Pump, error) {
+	var pump Pump
+	err := tx.Select("*").From(PumpsTable).Where(dbr.Eq(idxCol, idx)).LoadOneContext(ctx, &pump)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pump %d: %w", idx, err)
+	}
+
+	return &pump, nil
+}
+
+// UpdatePumps sets the flow rate of each of the pumps, returning ErrInvalidPumpIdx if any of them aren't one of the
+// configured number of pumps
 func UpdatePumps(ctx context.Context, tx *dbr.Tx, pumps []Pump) error {
+	numPumps, err := getNumPumps(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for i := range pumps {
+		if pumps[i].Idx < 0 || pumps[i].Idx >= numPumps {
+			return fmt.Errorf("pump %d of %d: %w", pumps[i].Idx, numPumps, ErrInvalidPumpIdx)
+		}
+	}
+
 	ins := tx.InsertInto(PumpsTable).Ignore().Columns("idx", "ml_per_sec")
 	for i := range pumps {
 		ins.Record(&pumps[i])
 	}
 
-	_, err := ins.ExecContext(ctx)
+	_, err = ins.ExecContext(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to insert pumps: %w", err)
 	}
@@ -57,3 +88,28 @@ func UpdatePumps(ctx context.Context, tx *dbr.Tx, pumps []Pump) error {
 
 	return nil
 }
+
+// SetPumpTubeVolume sets the volume of a pump's tube, adding the pump if it doesn't exist. It returns ErrInvalidPumpIdx
+// if the pump isn't one of the configured number of pumps.
+func SetPumpTubeVolume(ctx context.Context, tx *dbr.Tx, idx int, volumeMl float64) error {
+	numPumps, err := getNumPumps(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if idx < 0 || idx >= numPumps {
+		return fmt.Errorf("pump %d of %d: %w", idx, numPumps, ErrInvalidPumpIdx)
+	}
+
+	_, err = tx.InsertInto(PumpsTable).Ignore().Columns(idxCol, mlPerSecCol).Values(idx, 0).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert pump %d: %w", idx, err)
+	}
+
+	_, err = tx.Update(PumpsTable).Set(tubeVolumeMlCol, volumeMl).Where(dbr.Eq(idxCol, idx)).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to set tube volume of pump %d: %w", idx, err)
+	}
+
+	return nil
+}
@@ -72,3 +72,21 @@ func (s *testSuite) TestPumps() {
 		{Idx: 9, MlPerSec: 0},
 	}, pumps)
 }
+
+func (s *testSuite) TestUpdatePumpsOutOfRange() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	err = SetConfig(ctx, tx, map[string]string{NumPumpsConfigKey: "4"})
+	s.Require().NoError(err)
+
+	err = UpdatePumps(ctx, tx, []Pump{{Idx: 3, MlPerSec: 10}, {Idx: 4, MlPerSec: 10}})
+	s.Require().ErrorIs(err, ErrInvalidPumpIdx)
+	err = UpdatePumps(ctx, tx, []Pump{{Idx: -1, MlPerSec: 10}})
+	s.Require().ErrorIs(err, ErrInvalidPumpIdx)
+
+	n, err := CountPumpRows(ctx, tx)
+	s.Require().NoError(err)
+	s.Require().Equal(4, n)
+}
@@ -0,0 +1,125 @@
+package openbardb
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocraft/dbr/v2"
+)
+
+const (
+	RecipeStepsTable           = "recipe_steps"
+	RecipeStepIngredientsTable = "recipe_step_ingredients"
+
+	stepCol    = "step"
+	delayMsCol = "delay_ms"
+)
+
+// RecipeStepIngredient is an ingredient poured in a step of a recipe
+type RecipeStepIngredient struct {
+	RecipeId       string `db:"recipe_id"`
+	Step           int    `db:"step"`
+	IngredientName string `db:"ingredient_name"`
+}
+
+// RecipeStep is a group of a recipe's ingredients that are poured together. Steps are poured in order, and DelayMs is
+// how long to wait before the step starts.
+type RecipeStep struct {
+	RecipeId string `db:"recipe_id"`
+	Step     int    `db:"step"`
+	DelayMs  int64  `db:"delay_ms"`
+
+	Ingredients []string
+}
+
+// GetRecipeSteps returns the pour steps of a recipe in order. A recipe with no steps has all of its ingredients poured
+// at once.
+func GetRecipeSteps(ctx context.Context, tx *dbr.Tx, recipeId string) ([]RecipeStep, error) {
+	var steps []RecipeStep
+	_, err := tx.Select("*").From(RecipeStepsTable).Where(dbr.Eq(recipeIdCol, recipeId)).OrderBy(stepCol).LoadContext(ctx, &steps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load steps for recipe '%s': %w", recipeId, err)
+	}
+
+	var ingredients []RecipeStepIngredient
+	_, err = tx.Select("*").From(RecipeStepIngredientsTable).Where(dbr.Eq(recipeIdCol, recipeId)).OrderBy(ingredientNameCol).LoadContext(ctx, &ingredients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load step ingredients for recipe '%s': %w", recipeId, err)
+	}
+
+	stepToIdx := make(map[int]int)
+	for i := range steps {
+		stepToIdx[steps[i].Step] = i
+	}
+
+	for _, ing := range ingredients {
+		idx := stepToIdx[ing.Step]
+		steps[idx].Ingredients = append(steps[idx].Ingredients, ing.IngredientName)
+	}
+
+	return steps, nil
+}
+
+// SetRecipeSteps replaces the pour steps of a recipe. Steps are numbered in the order given, and an ingredient may
+// only appear in one step.
+func SetRecipeSteps(ctx context.Context, tx *dbr.Tx, recipeId string, steps []RecipeStep) error {
+	err := DeleteRecipeSteps(ctx, tx, recipeId)
+	if err != nil {
+		return err
+	}
+
+	if len(steps) == 0 {
+		return nil
+	}
+
+	stepIns := tx.InsertInto(RecipeStepsTable).Columns(recipeIdCol, stepCol, delayMsCol)
+	var ingredients []RecipeStepIngredient
+	for i := range steps {
+		if steps[i].DelayMs < 0 {
+			return fmt.Errorf("step %d of recipe '%s' has a negative delay", i, recipeId)
+		}
+
+		steps[i].RecipeId = recipeId
+		steps[i].Step = i
+		stepIns = stepIns.Record(&steps[i])
+
+		for _, ing := range steps[i].Ingredients {
+			ingredients = append(ingredients, RecipeStepIngredient{RecipeId: recipeId, Step: i, IngredientName: ing})
+		}
+	}
+
+	_, err = stepIns.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert steps for recipe '%s': %w", recipeId, err)
+	}
+
+	if len(ingredients) == 0 {
+		return nil
+	}
+
+	ingIns := tx.InsertInto(RecipeStepIngredientsTable).Columns(recipeIdCol, stepCol, ingredientNameCol)
+	for i := range ingredients {
+		ingIns = ingIns.Record(&ingredients[i])
+	}
+
+	_, err = ingIns.ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert step ingredients for recipe '%s': %w", recipeId, err)
+	}
+
+	return nil
+}
+
+// DeleteRecipeSteps removes the pour steps of a recipe so that all of its ingredients are poured at once
+func DeleteRecipeSteps(ctx context.Context, tx *dbr.Tx, recipeId string) error {
+	_, err := tx.DeleteFrom(RecipeStepIngredientsTable).Where(dbr.Eq(recipeIdCol, recipeId)).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete step ingredients for recipe '%s': %w", recipeId, err)
+	}
+
+	_, err = tx.DeleteFrom(RecipeStepsTable).Where(dbr.Eq(recipeIdCol, recipeId)).ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to delete steps for recipe '%s': %w", recipeId, err)
+	}
+
+	return nil
+}
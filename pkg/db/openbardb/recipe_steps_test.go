@@ -0,0 +1,52 @@
+package openbardb
+
+import (
+	"context"
+)
+
+func (s *testSuite) TestRecipeSteps() {
+	ctx := context.Background()
+	tx, err := s.BeginTx(ctx)
+	s.Require().NoError(err)
+
+	steps, err := GetRecipeSteps(ctx, tx, "g_and_t")
+	s.Require().NoError(err)
+	s.Require().Empty(steps)
+
+	err = SetRecipeSteps(ctx, tx, "g_and_t", []RecipeStep{
+		{Ingredients: []string{"lime_juice", "gin"}},
+		{Ingredients: []string{"tonic"}, DelayMs: 1500},
+	})
+	s.Require().NoError(err)
+
+	err = SetRecipeSteps(ctx, tx, "negroni", []RecipeStep{{Ingredients: []string{"gin", "campari", "sweet_vermouth"}}})
+	s.Require().NoError(err)
+
+	steps, err = GetRecipeSteps(ctx, tx, "g_and_t")
+	s.Require().NoError(err)
+	s.Require().Len(steps, 2)
+	s.Require().Equal(0, steps[0].Step)
+	s.Require().Equal([]string{"gin", "lime_juice"}, steps[0].Ingredients)
+	s.Require().Equal(1, steps[1].Step)
+	s.Require().Equal(int64(1500), steps[1].DelayMs)
+	s.Require().Equal([]string{"tonic"}, steps[1].Ingredients)
+
+	// an ingredient can only be in one step
+	err = SetRecipeSteps(ctx, tx, "g_and_t", []RecipeStep{{Ingredients: []string{"gin"}}, {Ingredients: []string{"gin"}}})
+	s.Require().Error(err)
+
+	err = SetRecipeSteps(ctx, tx, "g_and_t", []RecipeStep{{Ingredients: []string{"gin"}, DelayMs: -1}})
+	s.Require().Error(err)
+
+	err = DeleteRecipeSteps(ctx, tx, "g_and_t")
+	s.Require().NoError(err)
+
+	steps, err = GetRecipeSteps(ctx, tx, "g_and_t")
+	s.Require().NoError(err)
+	s.Require().Empty(steps)
+
+	steps, err = GetRecipeSteps(ctx, tx, "negroni")
+	s.Require().NoError(err)
+	s.Require().Len(steps, 1)
+	s.Require().Len(steps[0].Ingredients, 3)
+}
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type identifies the kind of event being published
+type Type string
+
+const (
+	PumpState     Type = "pump_state"
+	PourStarted   Type = "pour_started"
+	PourProgress  Type = "pour_progress"
+	PourFinished  Type = "pour_finished"
+	ConfigChanged Type = "config_changed"
+	Error         Type = "error"
+	EStop         Type = "estop"
+	Maintenance   Type = "maintenance"
+)
+
+// subscriberBufferSize is the number of events buffered for each subscriber. Events published while a subscriber's
+// buffer is full are dropped for that subscriber so that a slow client can never block the machine.
+const subscriberBufferSize = 64
+
+// Event is a single machine event. Data must be serializable as json.
+type Event struct {
+	Type Type      `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data,omitempty"`
+}
+
+// Bus fans out published events to all current subscribers
+type Bus struct {
+	mu     *sync.Mutex
+	subs   map[uint64]chan Event
+	nextId uint64
+}
+
+// NewBus creates a new event bus with no subscribers
+func NewBus() *Bus {
+	return &Bus{
+		mu:   &sync.Mutex{},
+		subs: make(map[uint64]chan Event),
+	}
+}
+
+// Publish sends an event of the given type to all subscribers without blocking
+func (b *Bus) Publish(eventType Type, data any) {
+	evt := Event{
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ch := range b.subs {
+		select {
+		case ch <- evt:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel which receives all events published from now on, and a function which must be called
+// to unsubscribe. The channel is closed when unsubscribing.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBufferSize)
+
+	b.mu.Lock()
+	id := b.nextId
+	b.nextId++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	once := &sync.Once{}
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+
+			close(ch)
+		})
+	}
+}
+
+// NumSubscribers returns the number of active subscribers
+func (b *Bus) NumSubscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subs)
+}
@@ -0,0 +1,39 @@
+package events
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+
+	// publishing without subscribers is a no-op
+	bus.Publish(Error, "ignored")
+
+	ch1, unsub1 := bus.Subscribe()
+	ch2, unsub2 := bus.Subscribe()
+	require.Equal(t, 2, bus.NumSubscribers())
+
+	bus.Publish(PourStarted, 1)
+	evt := <-ch1
+	require.Equal(t, PourStarted, evt.Type)
+	require.Equal(t, 1, evt.Data)
+	evt = <-ch2
+	require.Equal(t, PourStarted, evt.Type)
+
+	unsub1()
+	unsub1()
+	require.Equal(t, 1, bus.NumSubscribers())
+	_, ok := <-ch1
+	require.False(t, ok)
+
+	// a full subscriber drops events rather than blocking
+	for i := 0; i < subscriberBufferSize*2; i++ {
+		bus.Publish(PourProgress, i)
+	}
+	require.Len(t, ch2, subscriberBufferSize)
+
+	unsub2()
+	require.Equal(t, 0, bus.NumSubscribers())
+}
@@ -0,0 +1,454 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// leaseCheckInterval is how often the controller looks for expired leases
+const leaseCheckInterval = 10 * time.Millisecond
+
+var (
+	// ErrPumpBusy is returned when a pump is leased to a requester that a lease request can't preempt
+	ErrPumpBusy = errors.New("pump is in use")
+	// ErrLeaseExpired ends leases which weren't extended before their time ran out
+	ErrLeaseExpired = errors.New("lease expired")
+	// ErrLeasePreempted ends leases whose pumps were leased to a requester with a higher priority
+	ErrLeasePreempted = errors.New("lease preempted")
+	// ErrLeaseReleased ends leases which were released by their holder
+	ErrLeaseReleased = errors.New("lease released")
+	// ErrControllerClosed ends every lease when the controller is closed, and is returned by requests made after
+	ErrControllerClosed = errors.New("pump controller is closed")
+)
+
+// Requester identifies what a lease on pumps is for. Requesters with a higher priority preempt the leases of those with
+// a lower one, and are refused by those with the same or a higher one.
+type Requester int
+
+const (
+	// RequesterManual runs pumps while buttons are held. It has the lowest priority.
+	RequesterManual Requester = iota + 1
+	// RequesterPour pours drinks
+	RequesterPour
+	// RequesterCleaning runs maintenance programs. It has the highest priority.
+	RequesterCleaning
+)
+
+func (r Requester) String() string {
+	switch r {
+	case RequesterManual:
+		return "manual"
+	case RequesterPour:
+		return "pour"
+	case RequesterCleaning:
+		return "cleaning"
+	default:
+		return "unknown"
+	}
+}
+
+// Controller owns hardware and arbitrates between everything that wants to run its pumps. Pumps are only run through a
+// Lease, which is granted for a set of pumps for a limited time. When a lease ends, because it was released, expired,
+// was preempted, or the controller was closed, any pumps it turned on are turned off.
+type Controller struct {
+	hw Hardware
+
+	mu        *sync.Mutex
+	leases    []*Lease
+	observers []PumpObserver
+	closed    bool
+	runs      *sync.WaitGroup
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewController creates a controller which owns hw, and starts expiring its leases
+func NewController(hw Hardware) *Controller {
+	c := &Controller{
+		hw:      hw,
+		mu:      &sync.Mutex{},
+		leases:  make([]*Lease, hw.NumPumps()),
+		runs:    &sync.WaitGroup{},
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go c.expireLeases()
+	return c
+}
+
+// Hardware returns the hardware owned by the controller. Pumps should only be run through leases.
+func (c *Controller) Hardware() Hardware {
+	return c.hw
+}
+
+// OnPumpChange registers obs to be notified whenever a lease turns a pump on or off with Lease.Pump, or a pump is
+// turned off because its lease ended. Pours notify the observer of their RunOptions instead.
+func (c *Controller) OnPumpChange(obs PumpObserver) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.observers = append(c.observers, obs)
+}
+
+// Acquire leases pumps to requester for ttl. Leases on any of the pumps held by requesters with a lower priority are
+// preempted, and if any of them are held by a requester with the same or a higher priority an error wrapping
+// ErrPumpBusy is returned.
+func (c *Controller) Acquire(requester Requester, pumps []int, ttl time.Duration) (*Lease, error) {
+	if len(pumps) == 0 {
+		return nil, errors.New("a lease must have at least one pump")
+	} else if ttl <= 0 {
+		return nil, fmt.Errorf("invalid lease time %s", ttl)
+	}
+
+	for _, idx := range pumps {
+		if idx < 0 || idx >= len(c.leases) {
+			return nil, fmt.Errorf("invalid pump index %d", idx)
+		}
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrControllerClosed
+	}
+
+	for _, idx := range pumps {
+		if held := c.leases[idx]; held != nil && held.requester >= requester {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("pump %d is leased for %s: %w", idx, held.requester, ErrPumpBusy)
+		}
+	}
+
+	var preempted []*Lease
+	for _, idx := range pumps {
+		held := c.leases[idx]
+		if held != nil && c.clear(held, fmt.Errorf("preempted by %s: %w", requester, ErrLeasePreempted)) {
+			preempted = append(preempted, held)
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	l := &Lease{
+		c:         c,
+		requester: requester,
+		pumps:     append([]int(nil), pumps...),
+		ctx:       ctx,
+		cancel:    cancel,
+		expires:   time.Now().Add(ttl),
+		on:        make(map[int]PumpState),
+		finished:  make(chan struct{}),
+	}
+
+	for _, idx := range pumps {
+		c.leases[idx] = l
+	}
+	c.mu.Unlock()
+
+	for _, held := range preempted {
+		log.Printf("%s lease on pumps %v preempted by %s", held.requester, held.pumps, requester)
+		c.finish(held)
+	}
+
+	return l, nil
+}
+
+// Close ends every lease, waits for running pours to stop, turns every pump off and closes the hardware
+func (c *Controller) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.closed = true
+	var leases []*Lease
+	for _, l := range c.leases {
+		if l != nil && c.clear(l, ErrControllerClosed) {
+			leases = append(leases, l)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, l := range leases {
+		c.finish(l)
+	}
+
+	c.runs.Wait()
+	close(c.done)
+	<-c.stopped
+
+	if err := TurnPumpsOff(c.hw); err != nil {
+		log.Println("error turning pumps off:", err)
+	}
+
+	return c.hw.Close()
+}
+
+func (c *Controller) expireLeases() {
+	defer close(c.stopped)
+
+	ticker := time.NewTicker(leaseCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		var expired []*Lease
+		c.mu.Lock()
+		for _, l := range c.leases {
+			if l != nil && now.After(l.expires) && c.clear(l, ErrLeaseExpired) {
+				expired = append(expired, l)
+			}
+		}
+		c.mu.Unlock()
+
+		for _, l := range expired {
+			c.finish(l)
+		}
+	}
+}
+
+// clear ends l with cause and frees its pumps, returning false if it had already ended. The controller's lock must be
+// held.
+func (c *Controller) clear(l *Lease, cause error) bool {
+	if l.ended {
+		return false
+	}
+
+	l.ended = true
+	l.cancel(cause)
+	l.pours.stopAll(l.endedErr())
+	for _, idx := range l.pumps {
+		if c.leases[idx] == l {
+			c.leases[idx] = nil
+		}
+	}
+
+	return true
+}
+
+// finish turns off the pumps turned on by a lease that has been cleared
+func (c *Controller) finish(l *Lease) {
+	defer close(l.finished)
+
+	c.mu.Lock()
+	on := l.on
+	l.on = make(map[int]PumpState)
+	c.mu.Unlock()
+
+	var turnedOff []int
+	for idx, state := range on {
+		if state == Off {
+			continue
+		}
+
+		if err := c.hw.Pump(idx, Off); err != nil {
+			log.Printf("error turning pump %d off at the end of its lease: %s", idx, err.Error())
+			continue
+		}
+
+		turnedOff = append(turnedOff, idx)
+	}
+
+	if len(turnedOff) == 0 {
+		return
+	}
+
+	// the lease holder may never update the hardware again, so the pumps have to be written off here
+	c.hw.Update()
+	for _, idx := range turnedOff {
+		c.notify(idx, Off)
+	}
+}
+
+func (c *Controller) notify(idx int, state PumpState) {
+	c.mu.Lock()
+	observers := append([]PumpObserver(nil), c.observers...)
+	c.mu.Unlock()
+
+	for _, obs := range observers {
+		obs(idx, state)
+	}
+}
+
+// Lease is the right to run a set of pumps until it ends. Its context is cancelled with the reason it ended.
+type Lease struct {
+	c         *Controller
+	requester Requester
+	pumps     []int
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	pours     pourRegistry
+	finished  chan struct{}
+
+	// expires, ended and on are guarded by the controller's lock
+	expires time.Time
+	ended   bool
+	on      map[int]PumpState
+}
+
+// Requester returns who the lease was granted to
+func (l *Lease) Requester() Requester {
+	return l.requester
+}
+
+// Pumps returns the pumps held by the lease
+func (l *Lease) Pumps() []int {
+	return append([]int(nil), l.pumps...)
+}
+
+// Context returns a context which is cancelled when the lease ends
+func (l *Lease) Context() context.Context {
+	return l.ctx
+}
+
+// Done returns a channel which is closed when the lease ends
+func (l *Lease) Done() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// Err returns why the lease ended, or nil if it hasn't
+func (l *Lease) Err() error {
+	if l.ctx.Err() == nil {
+		return nil
+	}
+
+	return context.Cause(l.ctx)
+}
+
+// Extend gives the lease ttl more time from now
+func (l *Lease) Extend(ttl time.Duration) error {
+	l.c.mu.Lock()
+	defer l.c.mu.Unlock()
+
+	if l.ended {
+		return l.endedErr()
+	}
+
+	l.expires = time.Now().Add(ttl)
+	return nil
+}
+
+// Release ends the lease, returning once any pumps it turned on are off, even if it had already ended
+func (l *Lease) Release() {
+	l.c.mu.Lock()
+	cleared := l.c.clear(l, ErrLeaseReleased)
+	l.c.mu.Unlock()
+
+	if cleared {
+		l.c.finish(l)
+	}
+
+	<-l.finished
+}
+
+// Pump turns a pump held by the lease off or on in the given direction
+func (l *Lease) Pump(idx int, state PumpState) error {
+	c := l.c
+	c.mu.Lock()
+	err := l.check(idx)
+	prev := l.on[idx]
+	c.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := c.hw.Pump(idx, state); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	ended := l.ended
+	if !ended {
+		l.on[idx] = state
+	}
+	c.mu.Unlock()
+
+	// the lease may have ended while the pump was being turned on, after its pumps were turned off
+	if ended && state != Off {
+		if err := c.hw.Pump(idx, Off); err != nil {
+			log.Printf("error turning pump %d off at the end of its lease: %s", idx, err.Error())
+		}
+
+		c.hw.Update()
+		return l.endedErr()
+	}
+
+	if state != prev && (state != Off || prev != Undefined) {
+		c.notify(idx, state)
+	}
+
+	return nil
+}
+
+// RunStepsCtx runs the steps of a pour with opts on the pumps held by the lease, stopping when ctx is cancelled or the
+// lease ends. Every pump the steps run must be held by the lease.
+func (l *Lease) RunStepsCtx(ctx context.Context, direction PumpState, steps []PourStep, opts RunOptions) ([]time.Duration, error) {
+	c := l.c
+
+	// the pour is added before checking the lease, so a lease that ends either fails the check or stops the pour
+	runCtx, stop := l.pours.add(ctx)
+	defer stop(nil)
+
+	c.mu.Lock()
+	err := l.checkSteps(steps)
+	if err == nil {
+		c.runs.Add(1)
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	defer c.runs.Done()
+
+	ran, err := RunStepsCtx(runCtx, c.hw, direction, steps, opts)
+	return ran, pourStoppedErr(ctx, err, context.Cause(runCtx))
+}
+
+// check returns an error if the lease can't run pump idx. The controller's lock must be held.
+func (l *Lease) check(idx int) error {
+	if l.ended {
+		return l.endedErr()
+	}
+
+	for _, held := range l.pumps {
+		if held == idx {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("pump %d is not held by the %s lease", idx, l.requester)
+}
+
+// checkSteps returns an error if the lease can't run every pump the steps run. The controller's lock must be held.
+func (l *Lease) checkSteps(steps []PourStep) error {
+	for _, step := range steps {
+		for idx, t := range step.Times {
+			if t > 0 {
+				if err := l.check(idx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// endedErr returns why the lease ended
+func (l *Lease) endedErr() error {
+	return fmt.Errorf("%s lease ended: %w", l.requester, context.Cause(l.ctx))
+}
@@ -0,0 +1,238 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/sequent"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestController(t *testing.T) (*Controller, *TestHardware) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw := NewTestHardware(4, rp)
+	return NewController(hw), hw
+}
+
+func TestControllerPriority(t *testing.T) {
+	c, hw := newTestController(t)
+	defer c.Close()
+
+	manual, err := c.Acquire(RequesterManual, []int{0, 1}, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, manual.Pump(0, Forward))
+	require.NoError(t, manual.Pump(1, Forward))
+
+	// requesters with the same priority are refused
+	_, err = c.Acquire(RequesterManual, []int{1}, time.Second)
+	require.True(t, errors.Is(err, ErrPumpBusy))
+
+	// a pour preempts the manual lease, turning its pumps off
+	pour, err := c.Acquire(RequesterPour, []int{1, 2}, time.Second)
+	require.NoError(t, err)
+	require.True(t, errors.Is(manual.Err(), ErrLeasePreempted))
+	require.Equal(t, Off, testPumpState(hw, 0))
+	require.Equal(t, Off, testPumpState(hw, 1))
+	require.True(t, errors.Is(manual.Pump(0, Forward), ErrLeasePreempted))
+	require.True(t, errors.Is(manual.Extend(time.Second), ErrLeasePreempted))
+
+	_, err = c.Acquire(RequesterManual, []int{0, 2}, time.Second)
+	require.True(t, errors.Is(err, ErrPumpBusy))
+	_, err = c.Acquire(RequesterPour, []int{2}, time.Second)
+	require.True(t, errors.Is(err, ErrPumpBusy))
+
+	// pumps not held by a lease can't be run with it
+	require.Error(t, pour.Pump(0, Forward))
+	require.Equal(t, Off, testPumpState(hw, 0))
+
+	cleaning, err := c.Acquire(RequesterCleaning, []int{2}, time.Second)
+	require.NoError(t, err)
+	require.True(t, errors.Is(pour.Err(), ErrLeasePreempted))
+	require.Equal(t, []int{2}, cleaning.Pumps())
+
+	// pumps freed by a preempted lease can be leased again
+	manual, err = c.Acquire(RequesterManual, []int{0, 1}, time.Second)
+	require.NoError(t, err)
+	manual.Release()
+	require.True(t, errors.Is(manual.Err(), ErrLeaseReleased))
+
+	_, err = c.Acquire(RequesterManual, nil, time.Second)
+	require.Error(t, err)
+	_, err = c.Acquire(RequesterManual, []int{4}, time.Second)
+	require.Error(t, err)
+}
+
+func TestControllerExpiry(t *testing.T) {
+	c, hw := newTestController(t)
+	defer c.Close()
+
+	lease, err := c.Acquire(RequesterManual, []int{0}, 50*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, lease.Pump(0, Forward))
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(25 * time.Millisecond)
+		require.NoError(t, lease.Extend(50*time.Millisecond))
+	}
+	require.Equal(t, Forward, testPumpState(hw, 0))
+
+	select {
+	case <-lease.Done():
+	case <-time.After(time.Second):
+		require.Fail(t, "lease didn't expire")
+	}
+
+	require.True(t, errors.Is(lease.Err(), ErrLeaseExpired))
+	require.Equal(t, Off, testPumpState(hw, 0))
+
+	_, err = c.Acquire(RequesterManual, []int{0}, time.Second)
+	require.NoError(t, err)
+}
+
+func TestControllerUpdatesHardware(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	board := sequent.AddFakeRelay8(bus, 0, false)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	mapping := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	hw, err := NewSR8Hardware(bus, 1, mapping, rp)
+	require.NoError(t, err)
+
+	c := NewController(hw)
+	defer c.Close()
+
+	expiring, err := c.Acquire(RequesterManual, []int{0}, 50*time.Millisecond)
+	require.NoError(t, err)
+	released, err := c.Acquire(RequesterManual, []int{1}, time.Second)
+	require.NoError(t, err)
+
+	require.NoError(t, expiring.Pump(0, Forward))
+	require.NoError(t, released.Pump(1, Forward))
+	hw.Update()
+	require.Equal(t, sequent.Relay8States{}.Set(0, true).Set(1, true), sequent.FakeRelay8States(board))
+
+	// the relays of pumps turned off when a lease ends are written without the holder updating the hardware
+	released.Release()
+	require.Equal(t, sequent.Relay8States{}.Set(0, true), sequent.FakeRelay8States(board))
+
+	<-expiring.Done()
+	require.Eventually(t, func() bool {
+		return sequent.FakeRelay8States(board) == sequent.Relay8States{}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestControllerRunSteps(t *testing.T) {
+	c, hw := newTestController(t)
+	defer c.Close()
+
+	lease, err := c.Acquire(RequesterPour, []int{0, 1}, time.Second)
+	require.NoError(t, err)
+
+	_, err = lease.RunStepsCtx(context.Background(), Forward, []PourStep{{Times: []time.Duration{0, 0, 10 * time.Millisecond, 0}}}, RunOptions{})
+	require.Error(t, err)
+	require.Equal(t, time.Duration(0), hw.TimeRun(2))
+
+	// an unleased pump in an early step fails the pour even when later steps only use leased pumps
+	_, err = lease.RunStepsCtx(context.Background(), Forward, []PourStep{
+		{Times: []time.Duration{0, 0, 10 * time.Millisecond, 0}},
+		{Times: []time.Duration{10 * time.Millisecond, 0, 0, 0}},
+	}, RunOptions{})
+	require.Error(t, err)
+	require.Equal(t, time.Duration(0), hw.TimeRun(0))
+	require.Equal(t, time.Duration(0), hw.TimeRun(2))
+
+	ran, err := lease.RunStepsCtx(context.Background(), Forward, []PourStep{{Times: []time.Duration{20 * time.Millisecond, 10 * time.Millisecond, 0, 0}}}, RunOptions{})
+	require.NoError(t, err)
+	require.InDelta(t, 20*time.Millisecond, ran[0], float64(10*time.Millisecond))
+
+	// a pour whose lease is preempted fails rather than being cancelled
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(30 * time.Millisecond)
+		_, err := c.Acquire(RequesterCleaning, []int{1}, time.Second)
+		require.NoError(t, err)
+	}()
+
+	start := time.Now()
+	ran, err = lease.RunStepsCtx(context.Background(), Forward, []PourStep{{Times: []time.Duration{time.Second, time.Second, 0, 0}}}, RunOptions{})
+	wg.Wait()
+
+	require.True(t, errors.Is(err, ErrLeasePreempted))
+	require.False(t, errors.Is(err, context.Canceled))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.InDelta(t, 30*time.Millisecond, ran[1], float64(20*time.Millisecond))
+	require.Equal(t, Off, testPumpState(hw, 0))
+	require.Equal(t, Off, testPumpState(hw, 1))
+}
+
+func TestControllerLeaseDuringPour(t *testing.T) {
+	c, hw := newTestController(t)
+	defer c.Close()
+
+	pour, err := c.Acquire(RequesterPour, []int{0}, time.Second)
+	require.NoError(t, err)
+
+	manual, err := c.Acquire(RequesterManual, []int{1}, time.Second)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := pour.RunStepsCtx(context.Background(), Forward, []PourStep{{Times: []time.Duration{300 * time.Millisecond, 0, 0, 0}}}, RunOptions{})
+		done <- err
+	}()
+
+	require.Eventually(t, func() bool {
+		return testPumpState(hw, 0) == Forward
+	}, time.Second, time.Millisecond)
+
+	// pumps that aren't part of the pour can be switched, and their leases released, while it runs
+	start := time.Now()
+	require.NoError(t, manual.Pump(1, Forward))
+	require.Equal(t, Forward, testPumpState(hw, 1))
+	manual.Release()
+	require.Equal(t, Off, testPumpState(hw, 1))
+	require.Less(t, time.Since(start), 100*time.Millisecond)
+	require.Equal(t, Forward, testPumpState(hw, 0))
+
+	require.NoError(t, <-done)
+	require.Equal(t, Off, testPumpState(hw, 0))
+}
+
+func TestControllerObserverAndClose(t *testing.T) {
+	c, hw := newTestController(t)
+
+	var mu sync.Mutex
+	var changes []PumpState
+	c.OnPumpChange(func(idx int, state PumpState) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, state)
+	})
+
+	lease, err := c.Acquire(RequesterManual, []int{3}, time.Second)
+	require.NoError(t, err)
+	require.NoError(t, lease.Pump(3, Backward))
+	require.NoError(t, lease.Pump(3, Backward))
+
+	require.NoError(t, c.Close())
+	require.True(t, errors.Is(lease.Err(), ErrControllerClosed))
+	require.Equal(t, Off, testPumpState(hw, 3))
+
+	mu.Lock()
+	require.Equal(t, []PumpState{Backward, Off}, changes)
+	mu.Unlock()
+
+	_, err = c.Acquire(RequesterCleaning, []int{0}, time.Second)
+	require.True(t, errors.Is(err, ErrControllerClosed))
+	require.NoError(t, c.Close())
+}
@@ -1,6 +1,7 @@
 package hardware
 
 import (
+	"context"
 	"fmt"
 	"github.com/cocktailrobots/openbar-server/pkg/util/ncurses"
 	"github.com/gbin/goncurses"
@@ -18,7 +19,10 @@ type stateChange struct {
 
 // DebugHardware is the hardware implementation for debugging
 type DebugHardware struct {
+	schedulerHolder
+
 	mu          *sync.Mutex
+	runMu       *sync.Mutex
 	numPumps    int
 	outFilePath string
 
@@ -66,6 +70,7 @@ func NewDebugHardware(numPumps int, outFilePath string, rp *ReversePin) (*DebugH
 
 	return &DebugHardware{
 		mu:          &sync.Mutex{},
+		runMu:       &sync.Mutex{},
 		numPumps:    numPumps,
 		outFilePath: outFilePath,
 		initialOut:  initialOut,
@@ -125,7 +130,7 @@ func (h *DebugHardware) pump(idx int, state PumpState) error {
 	newState := state
 	if currState != newState {
 		now := time.Now()
-		if currState == Forward {
+		if currState.running() {
 			h.runTimes[idx] += now.Sub(h.state[idx].changedAt)
 		}
 
@@ -190,12 +195,30 @@ func (h *DebugHardware) TimeRun(idx int) time.Duration {
 	return h.runTimes[idx]
 }
 
-// RunForTimes runs the pumps for the given times
-func (h *DebugHardware) RunForTimes(direction PumpState, times []time.Duration) error {
+// SetTimeRun sets the total time the pump has been run for
+func (h *DebugHardware) SetTimeRun(idx int, runtime time.Duration) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	return runForTimes(h, direction, times)
+	if idx < 0 || idx >= h.numPumps {
+		panic(fmt.Errorf("invalid pump index %d", idx))
+	}
+
+	h.runTimes[idx] = runtime
+}
+
+// RunForTimes runs the pumps for the given times
+func (h *DebugHardware) RunForTimes(direction PumpState, times []time.Duration) error {
+	_, err := h.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
+}
+
+// RunForTimesCtx runs the pumps for the given times until they complete or the context is cancelled
+func (h *DebugHardware) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	h.runMu.Lock()
+	defer h.runMu.Unlock()
+
+	return runForTimes(ctx, h, h.mu, direction, times, opts)
 }
 
 // GetReversePin gets the reverse Pin object
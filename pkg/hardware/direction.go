@@ -0,0 +1,48 @@
+package hardware
+
+import (
+	"fmt"
+	"time"
+)
+
+// DirectionController is implemented by hardware where some pumps set their own direction rather than following the
+// reverse pin. Which pumps have direction control is fixed when the hardware is created, so it is safe to call without
+// locking.
+type DirectionController interface {
+	// HasPumpDirection returns true if pump idx sets its own direction
+	HasPumpDirection(idx int) bool
+}
+
+// HasPumpDirection returns true if pump idx of hw sets its own direction, so it can run in a different direction from
+// the other pumps
+func HasPumpDirection(hw Hardware, idx int) bool {
+	dc, ok := unwrap(hw).(DirectionController)
+	return ok && dc.HasPumpDirection(idx)
+}
+
+// pumpDirections returns the direction each pump runs in when runForTimes is called with direction, times and the
+// pump directions of its RunOptions
+func pumpDirections(hw Hardware, direction PumpState, times []time.Duration, optDirs []PumpState) ([]PumpState, error) {
+	dirs := make([]PumpState, len(times))
+	for i := range dirs {
+		dirs[i] = direction
+	}
+
+	if optDirs == nil {
+		return dirs, nil
+	} else if len(optDirs) != len(times) {
+		return nil, fmt.Errorf("expected %d pump directions, but got %d", len(times), len(optDirs))
+	}
+
+	for i, dir := range optDirs {
+		if dir != Forward && dir != Backward {
+			return nil, fmt.Errorf("invalid direction %s for pump %d", dir, i)
+		} else if dir != direction && times[i] > 0 && !HasPumpDirection(hw, i) {
+			return nil, fmt.Errorf("pump %d can't run %s while the other pumps run %s as it has no direction control", i, dir, direction)
+		}
+
+		dirs[i] = dir
+	}
+
+	return dirs, nil
+}
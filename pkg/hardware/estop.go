@@ -0,0 +1,235 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/gpio"
+)
+
+// estopPollInterval is how often an emergency stop input is read
+const estopPollInterval = 10 * time.Millisecond
+
+// ErrEStopped is wrapped by the errors returned when pumps are asked to run while the emergency stop is latched
+var ErrEStopped = errors.New("emergency stop is latched")
+
+// EStopEvent describes what triggered the emergency stop
+type EStopEvent struct {
+	Source string
+	Reason string
+	At     time.Time
+}
+
+// EStop wraps hardware with a latching emergency stop. Triggering it cancels any pours running on the hardware and
+// turns every pump off, and from then on every request to turn a pump on is refused until Reset is called. It can be
+// triggered by calling Trigger, or by an input line watched with WatchInput.
+type EStop struct {
+	Hardware
+
+	mu       *sync.Mutex
+	latched  *EStopEvent
+	input    gpio.Line
+	pours    pourRegistry
+	handlers []func(EStopEvent)
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+var _ Hardware = (*EStop)(nil)
+
+// NewEStop wraps hw with an emergency stop which isn't latched
+func NewEStop(hw Hardware) *EStop {
+	return &EStop{
+		Hardware: hw,
+		mu:       &sync.Mutex{},
+		done:     make(chan struct{}),
+	}
+}
+
+// Unwrap returns the hardware the emergency stop wraps
+func (e *EStop) Unwrap() Hardware {
+	return e.Hardware
+}
+
+// OnTrigger registers fn to be called with the event whenever the emergency stop latches. It is called after the pumps
+// have been turned off.
+func (e *EStop) OnTrigger(fn func(EStopEvent)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.handlers = append(e.handlers, fn)
+}
+
+// WatchInput triggers the emergency stop whenever line reads as active. While the line is active the emergency stop
+// can't be reset. The line is closed when the emergency stop is closed.
+func (e *EStop) WatchInput(line gpio.Line) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.input != nil {
+		return
+	}
+
+	e.input = line
+	e.stopped = make(chan struct{})
+	go e.pollInput(line)
+}
+
+func (e *EStop) pollInput(line gpio.Line) {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(estopPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		}
+
+		val, err := line.Value()
+		if err != nil {
+			log.Println("error reading e-stop input:", err)
+		} else if val != 0 {
+			e.Trigger("input", "e-stop input activated")
+		}
+	}
+}
+
+// Trigger latches the emergency stop, cancelling running pours and turning every pump off. It returns false if the
+// emergency stop was already latched.
+func (e *EStop) Trigger(source, reason string) bool {
+	evt := EStopEvent{Source: source, Reason: reason, At: time.Now()}
+
+	e.mu.Lock()
+	if e.latched != nil {
+		e.mu.Unlock()
+		return false
+	}
+
+	e.latched = &evt
+	handlers := append([]func(EStopEvent){}, e.handlers...)
+	e.mu.Unlock()
+
+	log.Printf("e-stop triggered by %s: %s", source, reason)
+	e.pours.stopAll(fmt.Errorf("triggered by %s: %w", source, ErrEStopped))
+
+	err := TurnPumpsOff(e.Hardware)
+
+	// hardware that stages pump changes only writes them on update, which has to happen even if a pump failed to turn off
+	e.Hardware.Update()
+	if err != nil {
+		log.Println("error turning pumps off for e-stop:", err)
+	}
+
+	for _, fn := range handlers {
+		fn(evt)
+	}
+
+	return true
+}
+
+// Reset releases the emergency stop so that pumps can run again. It fails if the emergency stop input is still active.
+func (e *EStop) Reset() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.input != nil {
+		val, err := e.input.Value()
+		if err != nil {
+			return fmt.Errorf("error reading e-stop input: %w", err)
+		} else if val != 0 {
+			return errors.New("e-stop input is still active")
+		}
+	}
+
+	e.latched = nil
+	return nil
+}
+
+// Latched returns the event that latched the emergency stop, and false if it isn't latched
+func (e *EStop) Latched() (EStopEvent, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.latched == nil {
+		return EStopEvent{}, false
+	}
+
+	return *e.latched, true
+}
+
+// Close stops watching the emergency stop input, closes it, and closes the hardware it wraps
+func (e *EStop) Close() error {
+	close(e.done)
+
+	e.mu.Lock()
+	input, stopped := e.input, e.stopped
+	e.mu.Unlock()
+
+	if input != nil {
+		<-stopped
+		if err := input.Close(); err != nil {
+			log.Println("error closing e-stop input:", err)
+		}
+	}
+
+	return e.Hardware.Close()
+}
+
+func (e *EStop) checkLatched() error {
+	if evt, ok := e.Latched(); ok {
+		return fmt.Errorf("triggered by %s: %w", evt.Source, ErrEStopped)
+	}
+
+	return nil
+}
+
+func (e *EStop) Pump(idx int, state PumpState) error {
+	if state == Off {
+		return e.Hardware.Pump(idx, state)
+	}
+
+	if err := e.checkLatched(); err != nil {
+		return err
+	}
+
+	if err := e.Hardware.Pump(idx, state); err != nil {
+		return err
+	}
+
+	// the emergency stop may have latched while the pump was being turned on, after it turned the pump off
+	if err := e.checkLatched(); err != nil {
+		if offErr := e.Hardware.Pump(idx, Off); offErr != nil {
+			log.Println("error turning pump off for e-stop:", offErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (e *EStop) RunForTimes(direction PumpState, times []time.Duration) error {
+	_, err := e.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
+}
+
+func (e *EStop) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	pourCtx, stop := e.pours.add(ctx)
+	defer stop(nil)
+
+	// the pour is added before checking the latch, so a trigger either latched first or stops the pour
+	if err := e.checkLatched(); err != nil {
+		return nil, err
+	}
+
+	ran, err := e.Hardware.RunForTimesCtx(pourCtx, direction, times, opts)
+	return ran, pourStoppedErr(ctx, err, context.Cause(pourCtx))
+}
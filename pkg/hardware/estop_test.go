@@ -0,0 +1,141 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/gpio"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/sequent"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEStop(t *testing.T) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw := NewTestHardware(4, rp)
+	estop := NewEStop(hw)
+	defer estop.Close()
+
+	var evts []EStopEvent
+	estop.OnTrigger(func(evt EStopEvent) {
+		evts = append(evts, evt)
+	})
+
+	require.NoError(t, estop.Pump(0, Forward))
+
+	pourErr := make(chan error)
+	go func() {
+		_, err := estop.RunForTimesCtx(context.Background(), Forward, []time.Duration{0, time.Second, 0, 0}, RunOptions{})
+		pourErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	require.True(t, estop.Trigger("api", "spill"))
+	require.False(t, estop.Trigger("api", "again"))
+
+	select {
+	case err := <-pourErr:
+		require.True(t, errors.Is(err, ErrEStopped))
+		require.False(t, errors.Is(err, context.Canceled))
+	case <-time.After(time.Second):
+		require.Fail(t, "pour wasn't stopped")
+	}
+
+	for i := 0; i < hw.NumPumps(); i++ {
+		require.Equal(t, Off, testPumpState(hw, i))
+	}
+
+	require.Len(t, evts, 1)
+	require.Equal(t, "api", evts[0].Source)
+	require.Equal(t, "spill", evts[0].Reason)
+
+	evt, latched := estop.Latched()
+	require.True(t, latched)
+	require.Equal(t, evts[0], evt)
+
+	require.True(t, errors.Is(estop.Pump(0, Forward), ErrEStopped))
+	require.NoError(t, estop.Pump(0, Off))
+	_, err = estop.RunForTimesCtx(context.Background(), Forward, []time.Duration{10 * time.Millisecond, 0, 0, 0}, RunOptions{})
+	require.True(t, errors.Is(err, ErrEStopped))
+
+	require.NoError(t, estop.Reset())
+	_, latched = estop.Latched()
+	require.False(t, latched)
+	require.NoError(t, estop.Pump(0, Forward))
+	require.NoError(t, estop.RunForTimes(Forward, []time.Duration{0, 10 * time.Millisecond, 0, 0}))
+}
+
+// failingPumpHardware fails to switch a single pump
+type failingPumpHardware struct {
+	Hardware
+	fail int
+}
+
+func (f failingPumpHardware) Pump(idx int, state PumpState) error {
+	if idx == f.fail {
+		return errors.New("pump failed")
+	}
+
+	return f.Hardware.Pump(idx, state)
+}
+
+func TestEStopUpdatesHardware(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	board := sequent.AddFakeRelay8(bus, 0, false)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	mapping := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	hw, err := NewSR8Hardware(bus, 1, mapping, rp)
+	require.NoError(t, err)
+
+	estop := NewEStop(failingPumpHardware{Hardware: hw, fail: 1})
+	defer estop.Close()
+
+	require.NoError(t, estop.Pump(0, Forward))
+	estop.Update()
+	require.Equal(t, sequent.Relay8States{}.Set(0, true), sequent.FakeRelay8States(board))
+
+	// the relays are written even though turning pump 1 off fails
+	require.True(t, estop.Trigger("api", "spill"))
+	require.Equal(t, sequent.Relay8States{}, sequent.FakeRelay8States(board))
+}
+
+func TestEStopInput(t *testing.T) {
+	chip := gpio.NewFakeChip()
+	line, err := chip.RequestInput(5, gpio.InputOptions{ActiveLow: true, PullUp: true})
+	require.NoError(t, err)
+
+	hw := NewTestHardware(4, nil)
+	estop := NewEStop(hw)
+	estop.WatchInput(line)
+
+	require.NoError(t, estop.Pump(1, Forward))
+	time.Sleep(3 * estopPollInterval)
+	_, latched := estop.Latched()
+	require.False(t, latched)
+
+	chip.Line(5).SetLevel(0)
+	time.Sleep(3 * estopPollInterval)
+	evt, latched := estop.Latched()
+	require.True(t, latched)
+	require.Equal(t, "input", evt.Source)
+	require.Equal(t, Off, testPumpState(hw, 1))
+
+	// the e-stop can't be reset while the input is active
+	require.Error(t, estop.Reset())
+
+	chip.Line(5).SetLevel(1)
+	require.NoError(t, estop.Reset())
+	time.Sleep(3 * estopPollInterval)
+	_, latched = estop.Latched()
+	require.False(t, latched)
+
+	require.NoError(t, estop.Close())
+	require.True(t, chip.Line(5).Closed())
+}
@@ -1,56 +1,310 @@
-//go:build !linux
-
 package hardware
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/gpio"
 )
 
-type GpioHardware struct {
-	rp *ReversePin
+var _ Hardware = &GpioHardware{}
+var _ DirectionController = &GpioHardware{}
+
+// pump is a pump driven by GPIO lines. enable switches the pump on. A pump with a direction line or an H-bridge sets its
+// own direction, while other pumps run the same way in either direction and rely on the reverse pin.
+type pump struct {
+	enable     gpio.Line
+	direction  gpio.Line
+	forwardVal int
+	in1        gpio.Line
+	in2        gpio.Line
+	state      PumpState
+	updatedAt  time.Time
 }
 
-func (s *GpioHardware) Name() string {
-	return "sequent-relay8"
+func (p pump) String() string {
+	return fmt.Sprintf("%s for %f seconds", p.state.String(), time.Since(p.updatedAt).Seconds())
 }
 
-func (s *GpioHardware) Close() error {
+func newGpioPump(chip gpio.Chip, config cfg.GpioPumpConfig) (pump, error) {
+	p := pump{state: Off, updatedAt: time.Now()}
+	if config.Pin == nil && config.HBridge == nil {
+		return p, fmt.Errorf("no pin or h-bridge configured")
+	} else if config.DirectionPin != nil && config.HBridge != nil {
+		return p, fmt.Errorf("a direction pin and an h-bridge can't both be configured")
+	}
+
+	var err error
+	if config.DirectionPin != nil {
+		if config.ForwardHigh {
+			p.forwardVal = 1
+		}
+
+		p.direction, err = chip.RequestOutput(*config.DirectionPin, p.forwardVal)
+		if err != nil {
+			return p, fmt.Errorf("error requesting direction line: %w", err)
+		}
+	}
+
+	if config.HBridge != nil {
+		p.in1, err = chip.RequestOutput(config.HBridge.In1, 0)
+		if err == nil {
+			p.in2, err = chip.RequestOutput(config.HBridge.In2, 0)
+		}
+
+		if err != nil {
+			p.close()
+			return p, fmt.Errorf("error requesting h-bridge line: %w", err)
+		}
+	}
+
+	if config.Pin != nil {
+		p.enable, err = chip.RequestOutput(*config.Pin, 0)
+		if err != nil {
+			p.close()
+			return p, fmt.Errorf("error requesting pump line: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *pump) hasDirection() bool {
+	return p.direction != nil || p.in1 != nil
+}
+
+// set changes the state of the pump. A pump that changes direction is switched off first so it never runs the wrong way.
+func (p *pump) set(state PumpState) error {
+	switch state {
+	case Off, Forward, Backward:
+	default:
+		return fmt.Errorf("unknown state %d", state)
+	}
+
+	if p.state != Off && state != Off && state != p.state {
+		if err := p.write(Off); err != nil {
+			return err
+		}
+	}
+
+	return p.write(state)
+}
+
+// write sets the lines of the pump for state, switching the pump off before the direction lines are changed and on
+// after they have been set
+func (p *pump) write(state PumpState) error {
+	if state == Off && p.enable != nil {
+		if err := p.enable.SetValue(0); err != nil {
+			return fmt.Errorf("error switching pump off: %w", err)
+		}
+	}
+
+	if state != Off && p.direction != nil {
+		val := p.forwardVal
+		if state == Backward {
+			val = 1 - p.forwardVal
+		}
+
+		if err := p.direction.SetValue(val); err != nil {
+			return fmt.Errorf("error setting direction line: %w", err)
+		}
+	}
+
+	if p.in1 != nil {
+		// the input being driven low is changed first so both are never high at once
+		in1, in2 := boolToInt(state == Forward), boolToInt(state == Backward)
+		first, firstVal, second, secondVal := p.in1, in1, p.in2, in2
+		if in1 == 1 {
+			first, firstVal, second, secondVal = p.in2, in2, p.in1, in1
+		}
+
+		if err := first.SetValue(firstVal); err != nil {
+			return fmt.Errorf("error setting h-bridge line: %w", err)
+		} else if err := second.SetValue(secondVal); err != nil {
+			return fmt.Errorf("error setting h-bridge line: %w", err)
+		}
+	}
+
+	if state != Off && p.enable != nil {
+		if err := p.enable.SetValue(1); err != nil {
+			return fmt.Errorf("error switching pump on: %w", err)
+		}
+	}
+
 	return nil
 }
 
-func (s *GpioHardware) NumPumps() int {
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+
 	return 0
 }
 
-func (s *GpioHardware) Pump(idx int, state PumpState) error {
-	return nil
+func (p *pump) close() error {
+	var firstErr error
+	for _, l := range []gpio.Line{p.enable, p.direction, p.in1, p.in2} {
+		if l == nil {
+			continue
+		}
+
+		if err := l.Close(); firstErr == nil && err != nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
 }
 
-func (s *GpioHardware) pump(idx int, state PumpState) error {
-	return nil
+// GpioHardware drives each pump from GPIO lines, such as the pins of the Raspberry Pi header. Pumps configured with a
+// direction pin or an H-bridge set their own direction, see DirectionController.
+type GpioHardware struct {
+	schedulerHolder
+
+	mu       *sync.Mutex
+	runMu    *sync.Mutex
+	pumps    []pump
+	runTimes []time.Duration
+	rp       *ReversePin
 }
 
-func (s *GpioHardware) Update() {
-	s.update()
+// NewGpioHardware requests the lines of chip for the pumps described by config as outputs with every pump off
+func NewGpioHardware(chip gpio.Chip, config *cfg.GpioHardwareConfig, rp *ReversePin) (*GpioHardware, error) {
+	pumpConfigs := config.Pumps
+	if len(config.Pins) > 0 {
+		if len(pumpConfigs) > 0 {
+			return nil, fmt.Errorf("pins and pumps can't both be configured")
+		}
+
+		for _, pin := range config.Pins {
+			pin := pin
+			pumpConfigs = append(pumpConfigs, cfg.GpioPumpConfig{Pin: &pin})
+		}
+	}
+
+	g := &GpioHardware{
+		mu:       &sync.Mutex{},
+		runMu:    &sync.Mutex{},
+		runTimes: make([]time.Duration, len(pumpConfigs)),
+		rp:       rp,
+	}
+
+	for i, pumpConfig := range pumpConfigs {
+		p, err := newGpioPump(chip, pumpConfig)
+		if err != nil {
+			_ = g.Close()
+			return nil, fmt.Errorf("error configuring pump %d: %w", i, err)
+		}
+
+		g.pumps = append(g.pumps, p)
+	}
+
+	return g, nil
 }
 
-func (s *GpioHardware) update() {
+func (g *GpioHardware) Name() string {
+	return "GPIO"
 }
 
-func (s *GpioHardware) TimeRun(idx int) time.Duration {
-	return 0
+func (g *GpioHardware) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var firstErr error
+	for i := range g.pumps {
+		err := g.pumps[i].close()
+		if firstErr == nil && err != nil {
+			firstErr = fmt.Errorf("error closing lines of pump %d: %w", i, err)
+		}
+	}
+
+	return firstErr
+}
+
+func (g *GpioHardware) NumPumps() int {
+	return len(g.pumps)
 }
 
-func (s *GpioHardware) RunForTimes(direction PumpState, times []time.Duration) error {
+func (g *GpioHardware) Pump(idx int, state PumpState) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.pump(idx, state)
+}
+
+func (g *GpioHardware) pump(idx int, state PumpState) error {
+	if idx < 0 || idx >= g.NumPumps() {
+		return fmt.Errorf("invalid pump index %d", idx)
+	}
+
+	now := time.Now()
+	if curr := g.pumps[idx].state; curr.running() && state != curr {
+		g.runTimes[idx] += now.Sub(g.pumps[idx].updatedAt)
+	}
+
+	p := &g.pumps[idx]
+	if err := p.set(state); err != nil {
+		return fmt.Errorf("error setting pump %d to state %s: %w", idx, state, err)
+	}
+
+	p.state = state
+	p.updatedAt = now
 	return nil
 }
 
-func (s *GpioHardware) GetReversePin() *ReversePin {
-	return s.rp
+// HasPumpDirection returns true if pump idx has a direction pin or an H-bridge
+func (g *GpioHardware) HasPumpDirection(idx int) bool {
+	return idx >= 0 && idx < g.NumPumps() && g.pumps[idx].hasDirection()
+}
+
+func (g *GpioHardware) Update() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.update()
+}
+
+func (g *GpioHardware) update() {
+}
+
+func (g *GpioHardware) TimeRun(idx int) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if idx < 0 || idx >= g.NumPumps() {
+		panic(fmt.Errorf("invalid pump index %d", idx))
+	}
+
+	return g.runTimes[idx]
+}
+
+func (g *GpioHardware) SetTimeRun(idx int, runtime time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if idx < 0 || idx >= g.NumPumps() {
+		panic(fmt.Errorf("invalid pump index %d", idx))
+	}
+
+	g.runTimes[idx] = runtime
+}
+
+func (g *GpioHardware) RunForTimes(direction PumpState, times []time.Duration) error {
+	_, err := g.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
+}
+
+func (g *GpioHardware) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	g.runMu.Lock()
+	defer g.runMu.Unlock()
+
+	return runForTimes(ctx, g, g.mu, direction, times, opts)
 }
 
-func NewGpioHardware(pins []int, rp *ReversePin) (*GpioHardware, error) {
-	return &GpioHardware{
-		rp: rp,
-	}, nil
+func (g *GpioHardware) GetReversePin() *ReversePin {
+	return g.rp
 }
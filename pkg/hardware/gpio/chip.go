@@ -0,0 +1,26 @@
+//go:build !linux
+
+package gpio
+
+import "fmt"
+
+type unsupportedChip struct {
+	name string
+}
+
+// NewChip returns a chip that fails to request any line, as GPIO is only supported on Linux
+func NewChip(name string) Chip {
+	if name == "" {
+		name = DefaultChip
+	}
+
+	return unsupportedChip{name: name}
+}
+
+func (c unsupportedChip) RequestOutput(offset int, value int) (Line, error) {
+	return nil, fmt.Errorf("error requesting line %d of %s as output: GPIO is only supported on linux", offset, c.name)
+}
+
+func (c unsupportedChip) RequestInput(offset int, opts InputOptions) (Line, error) {
+	return nil, fmt.Errorf("error requesting line %d of %s as input: GPIO is only supported on linux", offset, c.name)
+}
@@ -0,0 +1,55 @@
+package gpio
+
+import (
+	"fmt"
+
+	"github.com/warthog618/gpiod"
+)
+
+type linuxChip struct {
+	name string
+}
+
+// NewChip returns the Linux GPIO chip with the given name, such as gpiochip0. An empty name uses DefaultChip.
+func NewChip(name string) Chip {
+	if name == "" {
+		name = DefaultChip
+	}
+
+	return linuxChip{name: name}
+}
+
+func (c linuxChip) RequestOutput(offset int, value int) (Line, error) {
+	l, err := gpiod.RequestLine(c.name, offset, gpiod.AsOutput(value))
+	if err != nil {
+		return nil, fmt.Errorf("error requesting line %d of %s as output: %w", offset, c.name, err)
+	}
+
+	return l, nil
+}
+
+func (c linuxChip) RequestInput(offset int, opts InputOptions) (Line, error) {
+	options := []gpiod.LineReqOption{gpiod.AsInput}
+	if opts.ActiveLow {
+		options = append(options, gpiod.AsActiveLow)
+	} else {
+		options = append(options, gpiod.AsActiveHigh)
+	}
+
+	if opts.PullUp {
+		options = append(options, gpiod.WithPullUp)
+	} else {
+		options = append(options, gpiod.WithPullDown)
+	}
+
+	if opts.Debounce > 0 {
+		options = append(options, gpiod.WithDebounce(opts.Debounce))
+	}
+
+	l, err := gpiod.RequestLine(c.name, offset, options...)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting line %d of %s as input: %w", offset, c.name, err)
+	}
+
+	return l, nil
+}
@@ -0,0 +1,169 @@
+package gpio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakeChip is an in-memory Chip for testing. Any line can be requested, but a line can only be held by one requester
+// at a time.
+type FakeChip struct {
+	mu    *sync.Mutex
+	lines map[int]*FakeLine
+}
+
+// NewFakeChip creates a FakeChip with no lines requested
+func NewFakeChip() *FakeChip {
+	return &FakeChip{
+		mu:    &sync.Mutex{},
+		lines: make(map[int]*FakeLine),
+	}
+}
+
+// Line returns the line at offset, or nil if it has never been requested
+func (c *FakeChip) Line(offset int) *FakeLine {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lines[offset]
+}
+
+func (c *FakeChip) RequestOutput(offset int, value int) (Line, error) {
+	return c.request(offset, &FakeLine{
+		mu:     &sync.Mutex{},
+		offset: offset,
+		output: true,
+		level:  value,
+		values: []int{value},
+	})
+}
+
+func (c *FakeChip) RequestInput(offset int, opts InputOptions) (Line, error) {
+	level := 0
+	if opts.PullUp {
+		level = 1
+	}
+
+	return c.request(offset, &FakeLine{
+		mu:        &sync.Mutex{},
+		offset:    offset,
+		activeLow: opts.ActiveLow,
+		debounce:  opts.Debounce,
+		level:     level,
+		settled:   level,
+	})
+}
+
+func (c *FakeChip) request(offset int, l *FakeLine) (Line, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if prev, ok := c.lines[offset]; ok && !prev.Closed() {
+		return nil, fmt.Errorf("line %d is busy", offset)
+	}
+
+	c.lines[offset] = l
+	return l, nil
+}
+
+// FakeLine emulates a GPIO line. Outputs record every value set on them. The level of an input's pin is set with
+// SetLevel, and reads of it are inverted if the line is active low and debounced the way the kernel debounces them.
+type FakeLine struct {
+	mu        *sync.Mutex
+	offset    int
+	output    bool
+	activeLow bool
+	debounce  time.Duration
+	level     int
+	settled   int
+	changedAt time.Time
+	values    []int
+	closed    bool
+}
+
+// Level returns the physical level of the line's pin
+func (l *FakeLine) Level() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.level
+}
+
+// SetLevel drives the pin of an input line to level, as a button or sensor wired to it would
+func (l *FakeLine) SetLevel(level int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.settled = l.debounced(now)
+	l.level = level
+	l.changedAt = now
+}
+
+// Values returns every value an output line has been set to, starting with its initial value
+func (l *FakeLine) Values() []int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]int(nil), l.values...)
+}
+
+// Closed returns true if the line has been released
+func (l *FakeLine) Closed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.closed
+}
+
+// debounced returns the level of the pin once it has held it for the debounce period, or the level it last held for
+// that long
+func (l *FakeLine) debounced(now time.Time) int {
+	if now.Sub(l.changedAt) >= l.debounce {
+		return l.level
+	}
+
+	return l.settled
+}
+
+func (l *FakeLine) Value() (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return 0, fmt.Errorf("line %d is closed", l.offset)
+	} else if l.output {
+		return l.level, nil
+	}
+
+	val := l.debounced(time.Now())
+	if l.activeLow {
+		val = 1 - val
+	}
+
+	return val, nil
+}
+
+func (l *FakeLine) SetValue(value int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return fmt.Errorf("line %d is closed", l.offset)
+	} else if !l.output {
+		return fmt.Errorf("line %d is an input", l.offset)
+	}
+
+	l.level = value
+	l.values = append(l.values, value)
+	return nil
+}
+
+func (l *FakeLine) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	return nil
+}
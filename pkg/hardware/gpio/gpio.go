@@ -0,0 +1,41 @@
+// Package gpio provides an interface to the lines of a GPIO chip so that pumps, buttons and the reverse pin can be run
+// against real hardware or an in-memory fake.
+package gpio
+
+import "time"
+
+// DefaultChip is the chip with the GPIO pins of the Raspberry Pi header
+const DefaultChip = "gpiochip0"
+
+// Line is a requested GPIO line
+type Line interface {
+	// Value returns the logical value of the line, 0 or 1
+	Value() (int, error)
+
+	// SetValue sets the value of an output line
+	SetValue(value int) error
+
+	// Close releases the line
+	Close() error
+}
+
+// InputOptions configure a line requested as an input
+type InputOptions struct {
+	// ActiveLow inverts the value of the line, so a low pin reads as 1
+	ActiveLow bool
+
+	// PullUp biases the pin high when nothing drives it. Otherwise it is pulled down.
+	PullUp bool
+
+	// Debounce is how long the pin must hold a level before the line reports it. 0 disables debouncing.
+	Debounce time.Duration
+}
+
+// Chip requests lines from a GPIO chip
+type Chip interface {
+	// RequestOutput requests the line at offset as an output set to value
+	RequestOutput(offset int, value int) (Line, error)
+
+	// RequestInput requests the line at offset as an input
+	RequestInput(offset int, opts InputOptions) (Line, error)
+}
@@ -0,0 +1,164 @@
+package hardware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/gpio"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGpioHardware(t *testing.T) {
+	chip := gpio.NewFakeChip()
+	rp, err := NewReversePin(chip, &cfg.ReversePinConfig{Pin: 4})
+	require.NoError(t, err)
+
+	_, err = NewGpioHardware(chip, &cfg.GpioHardwareConfig{Pins: []int{17, 4}}, rp)
+	require.Error(t, err)
+	require.True(t, chip.Line(17).Closed())
+
+	hw, err := NewGpioHardware(chip, &cfg.GpioHardwareConfig{Pins: []int{17, 27, 22}}, rp)
+	require.NoError(t, err)
+	require.Equal(t, 3, hw.NumPumps())
+	for _, pin := range []int{17, 27, 22} {
+		require.Equal(t, 0, chip.Line(pin).Level())
+	}
+
+	require.NoError(t, hw.Pump(1, Forward))
+	require.Equal(t, []int{0, 1}, chip.Line(27).Values())
+	require.Equal(t, 0, chip.Line(17).Level())
+	require.Error(t, hw.Pump(3, Forward))
+	require.False(t, hw.HasPumpDirection(1))
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, hw.Pump(1, Off))
+	require.Equal(t, []int{0, 1, 0}, chip.Line(27).Values())
+	require.GreaterOrEqual(t, hw.TimeRun(1), 10*time.Millisecond)
+
+	err = hw.RunForTimes(Forward, []time.Duration{0, 0, 5 * time.Millisecond})
+	require.NoError(t, err)
+	require.Contains(t, chip.Line(22).Values(), 1)
+	require.Equal(t, 0, chip.Line(22).Level())
+
+	require.NoError(t, hw.Close())
+	require.True(t, chip.Line(22).Closed())
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestGpioHardwareDirection(t *testing.T) {
+	chip := gpio.NewFakeChip()
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	_, err = NewGpioHardware(chip, &cfg.GpioHardwareConfig{Pins: []int{1}, Pumps: []cfg.GpioPumpConfig{{Pin: intPtr(2)}}}, rp)
+	require.Error(t, err)
+
+	_, err = NewGpioHardware(chip, &cfg.GpioHardwareConfig{Pumps: []cfg.GpioPumpConfig{{DirectionPin: intPtr(2)}}}, rp)
+	require.Error(t, err)
+
+	_, err = NewGpioHardware(chip, &cfg.GpioHardwareConfig{Pumps: []cfg.GpioPumpConfig{
+		{Pin: intPtr(1), DirectionPin: intPtr(2), HBridge: &cfg.HBridgeConfig{In1: 3, In2: 4}},
+	}}, rp)
+	require.Error(t, err)
+
+	hw, err := NewGpioHardware(chip, &cfg.GpioHardwareConfig{Pumps: []cfg.GpioPumpConfig{
+		{Pin: intPtr(10)},
+		{Pin: intPtr(11), DirectionPin: intPtr(12), ForwardHigh: true},
+		{HBridge: &cfg.HBridgeConfig{In1: 13, In2: 14}},
+	}}, rp)
+	require.NoError(t, err)
+	defer hw.Close()
+
+	require.False(t, hw.HasPumpDirection(0))
+	require.True(t, hw.HasPumpDirection(1))
+	require.True(t, hw.HasPumpDirection(2))
+	require.Equal(t, 1, chip.Line(12).Level())
+
+	// pumps without direction control run the same in either direction
+	require.NoError(t, hw.Pump(0, Backward))
+	require.Equal(t, 1, chip.Line(10).Level())
+
+	require.NoError(t, hw.Pump(1, Backward))
+	require.Equal(t, 0, chip.Line(12).Level())
+	require.Equal(t, 1, chip.Line(11).Level())
+
+	// changing direction switches the pump off first
+	require.NoError(t, hw.Pump(1, Forward))
+	require.Equal(t, []int{0, 1, 0, 1}, chip.Line(11).Values())
+	require.Equal(t, 1, chip.Line(12).Level())
+
+	require.NoError(t, hw.Pump(2, Forward))
+	require.Equal(t, 1, chip.Line(13).Level())
+	require.Equal(t, 0, chip.Line(14).Level())
+	require.NoError(t, hw.Pump(2, Backward))
+	require.Equal(t, 0, chip.Line(13).Level())
+	require.Equal(t, 1, chip.Line(14).Level())
+	require.NoError(t, hw.Pump(2, Off))
+	require.Equal(t, 0, chip.Line(13).Level())
+	require.Equal(t, 0, chip.Line(14).Level())
+	require.Equal(t, []int{0, 1, 0, 0, 0}, chip.Line(13).Values())
+	require.Equal(t, []int{0, 0, 0, 1, 0}, chip.Line(14).Values())
+
+	require.NoError(t, TurnPumpsOff(hw))
+	numWrites := len(chip.Line(14).Values())
+
+	// pumps with direction control can run against the reverse pin, but other pumps can't
+	var states []PumpState
+	opts := RunOptions{
+		Observer: func(idx int, state PumpState) {
+			if idx == 2 && state != Off {
+				states = append(states, state)
+			}
+		},
+		Directions: []PumpState{Forward, Forward, Backward},
+	}
+	times := []time.Duration{5 * time.Millisecond, 0, 5 * time.Millisecond}
+	_, err = hw.RunForTimesCtx(context.Background(), Forward, times, opts)
+	require.NoError(t, err)
+	require.Equal(t, []PumpState{Backward}, states)
+	require.Contains(t, chip.Line(14).Values()[numWrites:], 1)
+
+	_, err = hw.RunForTimesCtx(context.Background(), Backward, times, opts)
+	require.Error(t, err)
+
+	opts.Directions = []PumpState{Forward, Backward}
+	_, err = hw.RunForTimesCtx(context.Background(), Forward, times, opts)
+	require.Error(t, err)
+}
+
+func TestReversePin(t *testing.T) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, rp.Value())
+	require.NoError(t, rp.SetDirection(Backward))
+	require.Equal(t, 1, rp.Value())
+	require.NoError(t, rp.Close())
+
+	chip := gpio.NewFakeChip()
+	rp, err = NewReversePin(chip, &cfg.ReversePinConfig{Pin: 5, ForwardHigh: true})
+	require.NoError(t, err)
+	line := chip.Line(5)
+	require.Equal(t, 1, line.Level())
+	require.Equal(t, 1, rp.Value())
+
+	require.NoError(t, rp.SetDirection(Forward))
+	require.Equal(t, []int{1}, line.Values())
+
+	require.NoError(t, rp.SetDirection(Backward))
+	require.NoError(t, rp.SetDirection(Backward))
+	require.Equal(t, []int{1, 0}, line.Values())
+	require.Equal(t, 0, rp.Value())
+
+	require.NoError(t, rp.Close())
+	require.True(t, line.Closed())
+	require.Error(t, rp.SetDirection(Forward))
+
+	rp, err = NewReversePin(chip, &cfg.ReversePinConfig{Pin: 6})
+	require.NoError(t, err)
+	require.Equal(t, 0, chip.Line(6).Level())
+}
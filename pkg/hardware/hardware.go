@@ -1,8 +1,11 @@
 package hardware
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -30,6 +33,11 @@ func (ps PumpState) String() string {
 	}
 }
 
+// running returns true if a pump in this state is running in either direction, which counts toward its runtime
+func (ps PumpState) running() bool {
+	return ps == Forward || ps == Backward
+}
+
 // Hardware interface is the interface for interacting with the pumps and other Barpi hardware
 type Hardware interface {
 	// Name gets the name of the hardware
@@ -56,9 +64,16 @@ type Hardware interface {
 	// TimeRun returns the total time the pump has been run for since the program started
 	TimeRun(idx int) time.Duration
 
+	// SetTimeRun sets the total time the pump has been run for. It is used to restore persisted runtimes at startup
+	SetTimeRun(idx int, runtime time.Duration)
+
 	// RunForTimes runs the pumps for the given times
 	RunForTimes(direction PumpState, times []time.Duration) error
 
+	// RunForTimesCtx runs the pumps for the given times with opts, turning all pumps off as soon as the context is
+	// cancelled. It returns how long each pump actually ran
+	RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error)
+
 	// GetReversePin gets the reverse Pin object
 	GetReversePin() *ReversePin
 }
@@ -74,170 +89,221 @@ func TurnPumpsOff(h Hardware) error {
 	return nil
 }
 
-func runForTimes(hw Hardware, direction PumpState, times []time.Duration) error {
+// PumpObserver is notified whenever a pump is turned on or off
+type PumpObserver func(idx int, state PumpState)
+
+// RunOptions are the optional settings of a run of RunForTimesCtx. The zero value runs every pump at full speed without
+// observing them.
+type RunOptions struct {
+	// Observer is notified of every pump state change the run makes
+	Observer PumpObserver
+
+	// Profiles gives pump i the speed profile Profiles[i] on hardware that supports speed. Pumps without a profile, and
+	// all pumps on hardware without speed control, run at full speed.
+	Profiles []SpeedProfile
+
+	// Directions runs pump i in Directions[i] rather than in the direction of the run, which remains the direction of
+	// the reverse pin. Pumps that run in a different direction from the reverse pin must have their own direction
+	// control, see HasPumpDirection.
+	Directions []PumpState
+
+	// heartbeat is called while the run is in progress, so that a Watchdog knows its pours are still running
+	heartbeat func()
+}
+
+// beat calls the heartbeat, if there is one
+func (opts RunOptions) beat() {
+	if opts.heartbeat != nil {
+		opts.heartbeat()
+	}
+}
+
+// notify notifies the observer, if there is one, of a pump state change
+func (opts RunOptions) notify(idx int, state PumpState) {
+	if opts.Observer != nil {
+		opts.Observer(idx, state)
+	}
+}
+
+// runForTimes runs each pump for its time, starting pumps when the hardware's scheduler allows. ran[i] is measured from
+// when pump i was turned on. On hardware that supports speed, pumps follow the speed profiles of opts, and pumps
+// with direction control run in the pump directions of opts.
+//
+// mu is the lock guarding the hardware's pump state. It is only held while pumps are switched, so that pumps which
+// aren't part of the run can be switched while it waits. Callers must keep runs of the same hardware from overlapping.
+func runForTimes(ctx context.Context, hw Hardware, mu sync.Locker, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
 	numPumps := hw.NumPumps()
 	if len(times) != numPumps {
-		return fmt.Errorf("expected %d times, but got %d", numPumps, len(times))
+		return nil, fmt.Errorf("expected %d times, but got %d", numPumps, len(times))
 	}
 
+	mu.Lock()
+	defer mu.Unlock()
+
+	dirs, err := pumpDirections(hw, direction, times, opts.Directions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkPumpHealth(hw, func(idx int) bool {
+		return times[idx] > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sched := schedulerOf(hw)
+	batch := newSwitchBatcher(hw, sched)
+	notify := opts.notify
+	speeds := newPumpSpeeds(hw, opts.Profiles)
+	beat := opts.beat
+	running := make([]bool, numPumps)
 	defer func() {
+		// only the pumps of this run are turned off, so that pumps leased to others aren't disturbed
 		for i := 0; i < numPumps; i++ {
+			if times[i] <= 0 {
+				continue
+			}
+
 			err := hw.pump(i, Off)
 			if err != nil {
 				log.Println(err)
+			} else if running[i] {
+				notify(i, Off)
 			}
 
-			if i%3 == 0 {
-				hw.update()
-				time.Sleep(time.Millisecond)
-			}
+			batch.changed()
 		}
 
-		hw.update()
+		batch.flush()
+
+		if err := speeds.reset(); err != nil {
+			log.Println(err)
+		}
 	}()
 
+	ran := make([]time.Duration, numPumps)
+	if err := ctx.Err(); err != nil {
+		return ran, fmt.Errorf("pour cancelled: %w", err)
+	}
+
 	hw.GetReversePin().SetDirection(direction)
 
-	start := time.Now()
-	onCount := 0
-	running := make([]bool, numPumps)
+	// pumps are started in the order the scheduler starts them
+	starts := sched.Starts(times)
+	var order []int
 	for i := 0; i < numPumps; i++ {
 		if times[i] > 0 {
-			if err := hw.pump(i, direction); err != nil {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return starts[order[i]] < starts[order[j]]
+	})
+
+	start := time.Now()
+	startedAt := make([]time.Time, numPumps)
+	numRunning := 0
+	current := 0.0
+	startDue := func() error {
+		elapsed := time.Since(start)
+		var queued []int
+		for _, i := range order {
+			if starts[i] > elapsed || !sched.fits(numRunning, current, i) {
+				queued = append(queued, i)
+				continue
+			}
+
+			if err := speeds.update(i, 0, times[i]); err != nil {
+				return err
+			}
+
+			if err := hw.pump(i, dirs[i]); err != nil {
 				return fmt.Errorf("error turning pump %d on: %w", i, err)
 			}
 
-			onCount++
 			running[i] = true
-
-			if onCount%3 == 0 {
-				hw.update()
-				time.Sleep(time.Millisecond)
+			startedAt[i] = time.Now()
+			numRunning++
+			if sched != nil {
+				current += sched.current(i)
 			}
+			notify(i, dirs[i])
+			batch.changed()
 		}
 
-		if onCount%3 != 0 {
-			hw.update()
-		}
+		order = queued
+		batch.flush()
+		return nil
 	}
 
-	for onCount > 0 {
-		time.Sleep(5 * time.Millisecond)
-
-		elapsed := time.Since(start)
-		onCount = 0
-		changes := 0
-		for i := 0; i < numPumps; i++ {
-			if elapsed <= times[i] {
-				onCount++
-			} else if running[i] {
-				if err := hw.pump(i, Off); err != nil {
-					return fmt.Errorf("error turning pump %d off: %w", i, err)
-				}
+	if err := startDue(); err != nil {
+		return ran, err
+	}
 
-				running[i] = false
-				changes++
+	for numRunning > 0 || len(order) > 0 {
+		mu.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Millisecond):
+		}
+		mu.Lock()
 
-				if changes%3 == 0 {
-					hw.update()
-					time.Sleep(time.Millisecond)
+		if err := ctx.Err(); err != nil {
+			for i := 0; i < numPumps; i++ {
+				if running[i] {
+					ran[i] = time.Since(startedAt[i])
 				}
 			}
-		}
 
-		if changes%3 != 0 {
-			hw.update()
+			return ran, fmt.Errorf("pour cancelled: %w", err)
 		}
-	}
-
-	return nil
-}
-
-type asyncPumpTimes struct {
-	times     []time.Time
-	direction PumpState
-}
-
-func startAsyncHWRoutine(hw Hardware) chan asyncPumpTimes {
-	timeCh := make(chan asyncPumpTimes, 32)
-	numPumps := hw.NumPumps()
 
-	go func() {
-		latestOffTimes := make([]time.Time, numPumps)
-		latestDirection := Forward
+		beat()
 
-		currentState := make([]PumpState, numPumps)
 		for i := 0; i < numPumps; i++ {
-			currentState[i] = Undefined
-		}
-
-		for {
-			select {
-			case apt := <-timeCh:
-				if len(apt.times) == numPumps {
-					latestOffTimes = apt.times
-
-					if apt.direction != Off {
-						latestDirection = apt.direction
-					}
-				}
-
-			case <-time.After(10 * time.Millisecond):
+			if !running[i] {
+				continue
 			}
 
-			now := time.Now()
-			for i, t := range latestOffTimes {
-				newState := latestDirection
-
-				if t.Before(now) {
-					newState = Off
+			elapsed := time.Since(startedAt[i])
+			if elapsed > times[i] {
+				if err := hw.pump(i, Off); err != nil {
+					return ran, fmt.Errorf("error turning pump %d off: %w", i, err)
 				}
 
-				if newState != currentState[i] {
-					if err := hw.Pump(i, newState); err != nil {
-						log.Println(err)
-					}
-					currentState[i] = newState
+				running[i] = false
+				ran[i] = elapsed
+				numRunning--
+				if sched != nil {
+					current -= sched.current(i)
 				}
+				notify(i, Off)
+				batch.changed()
+			} else if err := speeds.update(i, elapsed, times[i]); err != nil {
+				return ran, err
 			}
 		}
-	}()
-
-	return timeCh
-}
-
-type AsyncHWRunner struct {
-	hw Hardware
-	ch chan asyncPumpTimes
-}
-
-func NewAsyncHWRunner(hw Hardware) *AsyncHWRunner {
-	return &AsyncHWRunner{
-		hw: hw,
-		ch: startAsyncHWRoutine(hw),
-	}
-}
-
-func (ahwr *AsyncHWRunner) RunPumps(direction PumpState, times []time.Duration) error {
-	numPumps := ahwr.hw.NumPumps()
-	if len(times) != numPumps {
-		return fmt.Errorf("expected %d times, but got %d", numPumps, len(times))
-	} else if direction == Off {
-		return fmt.Errorf("direction cannot be Off")
-	} else if direction == Undefined {
-		return fmt.Errorf("direction cannot be Undefined")
-	}
+		batch.flush()
+
+		// a pump whose board faulted may not be running as expected, so the pour is stopped
+		err := checkPumpHealth(hw, func(idx int) bool {
+			return running[idx]
+		})
+		if err != nil {
+			for i := 0; i < numPumps; i++ {
+				if running[i] {
+					ran[i] = time.Since(startedAt[i])
+				}
+			}
 
-	apt := asyncPumpTimes{
-		times:     make([]time.Time, numPumps),
-		direction: direction,
-	}
+			return ran, err
+		}
 
-	t := time.Now()
-	for i := 0; i < numPumps; i++ {
-		apt.times[i] = t.Add(times[i])
+		if err := startDue(); err != nil {
+			return ran, err
+		}
 	}
 
-	ahwr.ch <- apt
-	return nil
+	return ran, nil
 }
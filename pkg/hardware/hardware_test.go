@@ -0,0 +1,135 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunForTimesCtx(t *testing.T) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw := NewTestHardware(4, rp)
+	ran, err := hw.RunForTimesCtx(context.Background(), Forward, []time.Duration{50 * time.Millisecond, 0, 100 * time.Millisecond, 0}, RunOptions{})
+	require.NoError(t, err)
+	require.Len(t, ran, 4)
+	require.InDelta(t, 50*time.Millisecond, ran[0], float64(10*time.Millisecond))
+	require.Equal(t, time.Duration(0), ran[1])
+	require.InDelta(t, 100*time.Millisecond, ran[2], float64(10*time.Millisecond))
+
+	hw.ResetRuntimes()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	ran, err = hw.RunForTimesCtx(ctx, Forward, []time.Duration{time.Second, 20 * time.Millisecond, time.Second, 0}, RunOptions{})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.InDelta(t, 50*time.Millisecond, ran[0], float64(10*time.Millisecond))
+	require.InDelta(t, 20*time.Millisecond, ran[1], float64(10*time.Millisecond))
+	require.InDelta(t, 50*time.Millisecond, ran[2], float64(10*time.Millisecond))
+	require.Equal(t, time.Duration(0), ran[3])
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, Off, hw.state[i])
+	}
+	require.InDelta(t, 50*time.Millisecond, hw.TimeRun(0), float64(10*time.Millisecond))
+
+	// pumps that weren't part of the run are left alone
+	require.NoError(t, hw.Pump(3, Forward))
+	_, err = hw.RunForTimesCtx(context.Background(), Forward, []time.Duration{10 * time.Millisecond, 0, 0, 0}, RunOptions{})
+	require.NoError(t, err)
+	require.Equal(t, Off, hw.state[0])
+	require.Equal(t, Forward, hw.state[3])
+}
+
+func TestRunForTimesCtxObserver(t *testing.T) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	type change struct {
+		idx   int
+		state PumpState
+	}
+
+	var changes []change
+	opts := RunOptions{Observer: func(idx int, state PumpState) {
+		changes = append(changes, change{idx, state})
+	}}
+
+	hw := NewTestHardware(4, rp)
+	_, err = hw.RunForTimesCtx(context.Background(), Forward, []time.Duration{20 * time.Millisecond, 0, 40 * time.Millisecond, 0}, opts)
+	require.NoError(t, err)
+	require.Equal(t, []change{
+		{0, Forward},
+		{2, Forward},
+		{0, Off},
+		{2, Off},
+	}, changes)
+
+	changes = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = hw.RunForTimesCtx(ctx, Forward, []time.Duration{0, time.Second, 0, 0}, opts)
+	require.Error(t, err)
+	require.Equal(t, []change{
+		{1, Forward},
+		{1, Off},
+	}, changes)
+}
+
+func TestRunStepsCtx(t *testing.T) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	type change struct {
+		idx   int
+		state PumpState
+	}
+
+	var changes []change
+	opts := RunOptions{Observer: func(idx int, state PumpState) {
+		changes = append(changes, change{idx, state})
+	}}
+
+	ms := time.Millisecond
+	hw := NewTestHardware(4, rp)
+	steps := []PourStep{
+		{Times: []time.Duration{30 * ms, 0, 20 * ms, 0}},
+		{Delay: 30 * ms, Times: []time.Duration{0, 20 * ms, 0, 0}},
+		{Times: []time.Duration{10 * ms, 0, 0, 0}},
+	}
+
+	start := time.Now()
+	ran, err := RunStepsCtx(context.Background(), hw, Forward, steps, opts)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), StepsDuration(hw, steps))
+	require.Equal(t, 90*ms, StepsDuration(hw, steps))
+	require.InDelta(t, 40*ms, ran[0], float64(10*ms))
+	require.InDelta(t, 20*ms, ran[1], float64(10*ms))
+	require.InDelta(t, 20*ms, ran[2], float64(10*ms))
+	require.Equal(t, []change{
+		{0, Forward},
+		{2, Forward},
+		{2, Off},
+		{0, Off},
+		{1, Forward},
+		{1, Off},
+		{0, Forward},
+		{0, Off},
+	}, changes)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*ms)
+	defer cancel()
+
+	ran, err = RunStepsCtx(ctx, hw, Forward, steps[1:], RunOptions{})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.Equal(t, time.Duration(0), ran[1])
+}
@@ -0,0 +1,113 @@
+package hardware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Health is the health of a pump or of a board that drives pumps
+type Health int
+
+const (
+	// Healthy pumps and boards are working as expected
+	Healthy Health = iota
+	// WriteFailed boards could be read but the last write to them failed
+	WriteFailed
+	// ReadbackMismatch pumps didn't read back in the state they were last set to
+	ReadbackMismatch
+	// Missing boards don't respond
+	Missing
+)
+
+func (h Health) String() string {
+	switch h {
+	case Healthy:
+		return "ok"
+	case WriteFailed:
+		return "write-failed"
+	case ReadbackMismatch:
+		return "readback-mismatch"
+	case Missing:
+		return "missing"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrPumpFaulted is returned when a pump that isn't healthy is asked to run
+var ErrPumpFaulted = errors.New("pump is faulted")
+
+// BoardStatus is the health of a board that drives pumps. Present is false for boards that weren't found. Err is the
+// error that faulted the board, and is nil if the board is healthy.
+type BoardStatus struct {
+	Name    string
+	Present bool
+	Health  Health
+	Err     error
+	Pumps   []int
+}
+
+// Status is the health of each pump of some hardware and of the boards that drive them
+type Status struct {
+	Pumps  []Health
+	Boards []BoardStatus
+}
+
+// HealthReporter is implemented by hardware that can detect faults in the boards driving its pumps
+type HealthReporter interface {
+	// Status returns the health of the pumps and boards
+	Status() Status
+
+	// pumpHealth returns the health of a single pump without locking for package internal use
+	pumpHealth(idx int) Health
+}
+
+// GetStatus returns the health of the pumps and boards of hw. Hardware that can't detect faults reports every pump as
+// healthy and has no boards.
+func GetStatus(hw Hardware) Status {
+	if hr, ok := unwrap(hw).(HealthReporter); ok {
+		return hr.Status()
+	}
+
+	return Status{Pumps: make([]Health, hw.NumPumps())}
+}
+
+// CheckPumps returns an error wrapping ErrPumpFaulted if any pump that would run for its time in times isn't healthy
+func CheckPumps(hw Hardware, times []time.Duration) error {
+	return checkPumps(GetStatus(hw), func(idx int) bool {
+		return idx < len(times) && times[idx] > 0
+	})
+}
+
+// checkPumps returns an error wrapping ErrPumpFaulted if any pump that is used isn't healthy
+func checkPumps(status Status, used func(idx int) bool) error {
+	for i, health := range status.Pumps {
+		if health != Healthy && used(i) {
+			return fmt.Errorf("pump %d is %s: %w", i, health, ErrPumpFaulted)
+		}
+	}
+
+	return nil
+}
+
+// checkPumpHealth is a lock free version of checkPumps for package internal use. Only the health of the pumps that are
+// used is queried, so it is cheap enough to call on every tick of a run.
+func checkPumpHealth(hw Hardware, used func(idx int) bool) error {
+	hr, ok := unwrap(hw).(HealthReporter)
+	if !ok {
+		return nil
+	}
+
+	for i := 0; i < hw.NumPumps(); i++ {
+		if !used(i) {
+			continue
+		}
+
+		if health := hr.pumpHealth(i); health != Healthy {
+			return fmt.Errorf("pump %d is %s: %w", i, health, ErrPumpFaulted)
+		}
+	}
+
+	return nil
+}
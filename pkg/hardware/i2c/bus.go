@@ -0,0 +1,18 @@
+//go:build !linux
+
+package i2c
+
+import "fmt"
+
+type unsupportedBus struct {
+	num int
+}
+
+// NewBus returns a bus that fails to open any device, as I2C is only supported on Linux
+func NewBus(num int) Bus {
+	return unsupportedBus{num: num}
+}
+
+func (b unsupportedBus) Open(addr byte) (Device, error) {
+	return nil, fmt.Errorf("error opening I2C device 0x%02x on bus %d: I2C is only supported on linux", addr, b.num)
+}
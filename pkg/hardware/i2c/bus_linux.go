@@ -0,0 +1,25 @@
+package i2c
+
+import (
+	"fmt"
+
+	"github.com/d2r2/go-i2c"
+)
+
+type linuxBus struct {
+	num int
+}
+
+// NewBus returns the Linux I2C bus with the given number, i.e. /dev/i2c-{num}
+func NewBus(num int) Bus {
+	return linuxBus{num: num}
+}
+
+func (b linuxBus) Open(addr byte) (Device, error) {
+	dev, err := i2c.NewI2C(addr, b.num)
+	if err != nil {
+		return nil, fmt.Errorf("error opening I2C device 0x%02x on bus %d: %w", addr, b.num, err)
+	}
+
+	return dev, nil
+}
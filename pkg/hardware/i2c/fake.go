@@ -0,0 +1,217 @@
+package i2c
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakeBus is an in-memory Bus for testing drivers. Devices added with AddDevice can be opened, and opening any other
+// address fails the way it would if nothing answered at that address.
+type FakeBus struct {
+	mu      *sync.Mutex
+	devices map[byte]*FakeDevice
+}
+
+// NewFakeBus creates a FakeBus with no devices
+func NewFakeBus() *FakeBus {
+	return &FakeBus{
+		mu:      &sync.Mutex{},
+		devices: make(map[byte]*FakeDevice),
+	}
+}
+
+// AddDevice adds a device at addr with all of its registers set to 0
+func (b *FakeBus) AddDevice(addr byte) *FakeDevice {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dev := &FakeDevice{mu: &sync.Mutex{}, addr: addr}
+	b.devices[addr] = dev
+	return dev
+}
+
+// Device returns the device at addr, or nil if there isn't one
+func (b *FakeBus) Device(addr byte) *FakeDevice {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.devices[addr]
+}
+
+func (b *FakeBus) Open(addr byte) (Device, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dev, ok := b.devices[addr]
+	if !ok {
+		return nil, fmt.Errorf("no I2C device at 0x%02x", addr)
+	}
+
+	dev.mu.Lock()
+	defer dev.mu.Unlock()
+
+	dev.closed = false
+	return dev, nil
+}
+
+// FakeDevice emulates an I2C device as a map of 256 registers. Reads and writes of more than one byte auto-increment the
+// register address. OnWrite, if set, is called after every register write so that device behavior can be emulated. Bus faults
+// can be injected with FailReads, FailWrites and IgnoreWrites.
+type FakeDevice struct {
+	mu           *sync.Mutex
+	addr         byte
+	regs         [256]byte
+	closed       bool
+	writes       int
+	failReads    int
+	failWrites   int
+	ignoreWrites int
+	OnWrite      func(regs *[256]byte, reg, value byte)
+}
+
+// FailReads causes the next n reads to fail
+func (d *FakeDevice) FailReads(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.failReads = n
+}
+
+// FailWrites causes the next n writes to fail
+func (d *FakeDevice) FailWrites(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.failWrites = n
+}
+
+// IgnoreWrites causes the next n writes to succeed without changing the device, as if they were lost on the bus
+func (d *FakeDevice) IgnoreWrites(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.ignoreWrites = n
+}
+
+// Reg returns the value of a register
+func (d *FakeDevice) Reg(reg byte) byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.regs[reg]
+}
+
+// SetReg sets the value of a register without calling OnWrite
+func (d *FakeDevice) SetReg(reg, value byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.regs[reg] = value
+}
+
+// Writes returns the number of register writes made to the device
+func (d *FakeDevice) Writes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.writes
+}
+
+// Closed returns true if the device was closed after it was last opened
+func (d *FakeDevice) Closed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.closed
+}
+
+func (d *FakeDevice) ReadRegBytes(reg byte, n int) ([]byte, int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, 0, fmt.Errorf("I2C device 0x%02x is closed", d.addr)
+	} else if d.failReads > 0 {
+		d.failReads--
+		return nil, 0, fmt.Errorf("read from I2C device 0x%02x failed", d.addr)
+	}
+
+	buff := make([]byte, n)
+	for i := range buff {
+		buff[i] = d.regs[byte(int(reg)+i)]
+	}
+
+	return buff, n, nil
+}
+
+func (d *FakeDevice) ReadRegU8(reg byte) (byte, error) {
+	buff, _, err := d.ReadRegBytes(reg, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return buff[0], nil
+}
+
+func (d *FakeDevice) WriteRegU8(reg byte, value byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return fmt.Errorf("I2C device 0x%02x is closed", d.addr)
+	}
+
+	d.writes++
+	if d.failWrites > 0 {
+		d.failWrites--
+		return fmt.Errorf("write to I2C device 0x%02x failed", d.addr)
+	} else if d.ignoreWrites > 0 {
+		d.ignoreWrites--
+		return nil
+	}
+
+	d.regs[reg] = value
+	if d.OnWrite != nil {
+		d.OnWrite(&d.regs, reg, value)
+	}
+
+	return nil
+}
+
+func (d *FakeDevice) WriteBytes(buf []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return 0, fmt.Errorf("I2C device 0x%02x is closed", d.addr)
+	} else if len(buf) == 0 {
+		return 0, nil
+	}
+
+	d.writes++
+	if d.failWrites > 0 {
+		d.failWrites--
+		return 0, fmt.Errorf("write to I2C device 0x%02x failed", d.addr)
+	} else if d.ignoreWrites > 0 {
+		d.ignoreWrites--
+		return len(buf), nil
+	}
+
+	for i, value := range buf[1:] {
+		reg := byte(int(buf[0]) + i)
+		d.regs[reg] = value
+		if d.OnWrite != nil {
+			d.OnWrite(&d.regs, reg, value)
+		}
+	}
+
+	return len(buf), nil
+}
+
+func (d *FakeDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	return nil
+}
@@ -0,0 +1,28 @@
+// Package i2c provides an interface to devices on an I2C bus so that drivers can be run against real hardware or an
+// in-memory fake.
+package i2c
+
+// Device is a device at a single address on an I2C bus, accessed through its registers
+type Device interface {
+	// ReadRegBytes reads n bytes starting at reg, returning the bytes and how many were read
+	ReadRegBytes(reg byte, n int) ([]byte, int, error)
+
+	// ReadRegU8 reads the byte at reg
+	ReadRegU8(reg byte) (byte, error)
+
+	// WriteRegU8 writes value to reg
+	WriteRegU8(reg byte, value byte) error
+
+	// WriteBytes writes buf in a single transfer, returning how many bytes were written. The first byte addresses a
+	// register, and on devices that auto-increment the register address the rest are written to consecutive registers
+	WriteBytes(buf []byte) (int, error)
+
+	// Close closes the device
+	Close() error
+}
+
+// Bus opens devices on an I2C bus
+type Bus interface {
+	// Open opens the device at addr
+	Open(addr byte) (Device, error)
+}
@@ -0,0 +1,316 @@
+package hardware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+)
+
+const (
+	mcp23017DefaultAddr = 0x20
+	mcp23017NumPins     = 16
+	mcp23017Attempts    = 10
+
+	// register addresses with IOCON.BANK = 0, where the A and B registers of a port pair are adjacent
+	mcp23017IodirAReg = 0x00
+	mcp23017GpioAReg  = 0x12
+	mcp23017OlatAReg  = 0x14
+)
+
+var _ Hardware = &MCP23017Hardware{}
+
+type mcp23017Chip struct {
+	dev             i2c.Device
+	addr            byte
+	activeLow       uint16
+	state           uint16
+	stateLastUpdate uint16
+}
+
+// outputs returns the values of the chip's output pins for a state where set bits are pumps that are on
+func (c *mcp23017Chip) outputs(state uint16) uint16 {
+	return state ^ c.activeLow
+}
+
+// MCP23017Hardware drives pumps from the pins of MCP23017 I/O expanders on an I2C bus. Pump changes are written to the
+// chips on Update, and every write is read back until the pins match.
+type MCP23017Hardware struct {
+	schedulerHolder
+
+	mu             *sync.Mutex
+	runMu          *sync.Mutex
+	chips          []mcp23017Chip
+	pinMapping     []int
+	runTimes       []time.Duration
+	stateChangedAt []time.Time
+	rp             *ReversePin
+}
+
+// NewMCP23017Hardware initializes the MCP23017 chips on bus described by config, making every pin an output with its
+// pump off
+func NewMCP23017Hardware(bus i2c.Bus, config *cfg.MCP23017HardwareConfig, rp *ReversePin) (*MCP23017Hardware, error) {
+	addresses := []int{mcp23017DefaultAddr}
+	if len(config.Addresses) > 0 {
+		addresses = config.Addresses
+	}
+
+	numPins := len(addresses) * mcp23017NumPins
+	mapping := config.PinMapping
+	if mapping == nil {
+		mapping = make([]int, numPins)
+		for i := range mapping {
+			mapping[i] = i
+		}
+	}
+
+	used := make(map[int]bool)
+	for i, pin := range mapping {
+		if pin < 0 || pin >= numPins {
+			return nil, fmt.Errorf("pump %d is mapped to pin %d but there are %d pins", i, pin, numPins)
+		} else if used[pin] {
+			return nil, fmt.Errorf("pin %d is mapped to more than one pump", pin)
+		}
+
+		used[pin] = true
+	}
+
+	chips := make([]mcp23017Chip, len(addresses))
+	for i, addr := range addresses {
+		if addr < 0 || addr > 0x7F {
+			return nil, fmt.Errorf("invalid I2C address 0x%x", addr)
+		}
+
+		chips[i].addr = byte(addr)
+	}
+
+	for _, pin := range config.ActiveLowPins {
+		if pin < 0 || pin >= numPins {
+			return nil, fmt.Errorf("active low pin %d is out of range", pin)
+		}
+
+		chips[pin/mcp23017NumPins].activeLow |= 1 << (pin % mcp23017NumPins)
+	}
+
+	hw := &MCP23017Hardware{
+		mu:             &sync.Mutex{},
+		runMu:          &sync.Mutex{},
+		pinMapping:     mapping,
+		runTimes:       make([]time.Duration, len(mapping)),
+		stateChangedAt: make([]time.Time, len(mapping)),
+		rp:             rp,
+	}
+
+	for i := range chips {
+		chip := &chips[i]
+		dev, err := bus.Open(chip.addr)
+		if err != nil {
+			_ = hw.Close()
+			return nil, fmt.Errorf("error opening MCP23017 at 0x%02x: %w", chip.addr, err)
+		}
+
+		chip.dev = dev
+		hw.chips = append(hw.chips, *chip)
+		err = initMCP23017(chip)
+		if err != nil {
+			_ = hw.Close()
+			return nil, fmt.Errorf("error initializing MCP23017 at 0x%02x: %w", chip.addr, err)
+		}
+	}
+
+	return hw, nil
+}
+
+// initMCP23017 sets the output latches so every pump is off before making the pins outputs, so pumps don't turn on
+// while the chip is configured
+func initMCP23017(chip *mcp23017Chip) error {
+	if err := writeMCP23017Pair(chip.dev, mcp23017OlatAReg, chip.outputs(0)); err != nil {
+		return fmt.Errorf("error writing output latches: %w", err)
+	}
+
+	if err := writeMCP23017Pair(chip.dev, mcp23017IodirAReg, 0); err != nil {
+		return fmt.Errorf("error making pins outputs: %w", err)
+	}
+
+	return verifyMCP23017(chip.dev, chip.outputs(0), mcp23017Attempts)
+}
+
+func writeMCP23017Pair(dev i2c.Device, regA byte, val uint16) error {
+	if err := dev.WriteRegU8(regA, byte(val)); err != nil {
+		return err
+	}
+
+	return dev.WriteRegU8(regA+1, byte(val>>8))
+}
+
+func readMCP23017Pins(dev i2c.Device) (uint16, error) {
+	buff, n, err := dev.ReadRegBytes(mcp23017GpioAReg, 2)
+	if err != nil {
+		return 0, err
+	} else if n != 2 {
+		return 0, fmt.Errorf("only %d of 2 bytes were read", n)
+	}
+
+	return uint16(buff[0]) | uint16(buff[1])<<8, nil
+}
+
+// verifyMCP23017 reads the pins of a chip back, rewriting the output latches until the pins match the desired outputs
+// or it runs out of attempts
+func verifyMCP23017(dev i2c.Device, desired uint16, attempts int) error {
+	for i := attempts - 1; i >= 0; i-- {
+		read, err := readMCP23017Pins(dev)
+		if err != nil {
+			if i == 0 {
+				return fmt.Errorf("error reading pins: %w", err)
+			}
+		} else if read == desired {
+			return nil
+		}
+
+		err = writeMCP23017Pair(dev, mcp23017OlatAReg, desired)
+		if err != nil && i == 0 {
+			return fmt.Errorf("error writing output latches: %w", err)
+		}
+	}
+
+	return fmt.Errorf("never achieved desired pins 0x%04x", desired)
+}
+
+func (m *MCP23017Hardware) Name() string {
+	return "MCP23017"
+}
+
+// Close turns every pump off and closes the chips
+func (m *MCP23017Hardware) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for idx, pin := range m.pinMapping {
+		// chips that failed to open while initializing were never added
+		if pin/mcp23017NumPins < len(m.chips) {
+			_ = m.pump(idx, Off)
+		}
+	}
+
+	var firstErr error
+	for i := range m.chips {
+		chip := &m.chips[i]
+		err := verifyMCP23017(chip.dev, chip.outputs(chip.state), mcp23017Attempts)
+		if firstErr == nil && err != nil {
+			firstErr = fmt.Errorf("error turning off MCP23017 at 0x%02x: %w", chip.addr, err)
+		}
+
+		err = chip.dev.Close()
+		if firstErr == nil && err != nil {
+			firstErr = fmt.Errorf("error closing MCP23017 at 0x%02x: %w", chip.addr, err)
+		}
+	}
+
+	return firstErr
+}
+
+func (m *MCP23017Hardware) NumPumps() int {
+	return len(m.pinMapping)
+}
+
+// Pump turns a pump off or on and updates the chips
+func (m *MCP23017Hardware) Pump(idx int, state PumpState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.pump(idx, state)
+	if err != nil {
+		return err
+	}
+
+	m.update()
+	return nil
+}
+
+func (m *MCP23017Hardware) pump(idx int, state PumpState) error {
+	if idx < 0 || idx >= m.NumPumps() {
+		return fmt.Errorf("invalid pump index %d", idx)
+	}
+
+	pin := m.pinMapping[idx]
+	chip := &m.chips[pin/mcp23017NumPins]
+	bit := uint16(1) << (pin % mcp23017NumPins)
+
+	currOn := chip.state&bit != 0
+	newOn := state != Off
+	if currOn != newOn {
+		now := time.Now()
+		if currOn {
+			m.runTimes[idx] += now.Sub(m.stateChangedAt[idx])
+		}
+
+		m.stateChangedAt[idx] = now
+	}
+
+	if newOn {
+		chip.state |= bit
+	} else {
+		chip.state &^= bit
+	}
+
+	return nil
+}
+
+func (m *MCP23017Hardware) Update() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.update()
+}
+
+func (m *MCP23017Hardware) update() {
+	for i := range m.chips {
+		chip := &m.chips[i]
+		if chip.state == chip.stateLastUpdate {
+			continue
+		}
+
+		err := verifyMCP23017(chip.dev, chip.outputs(chip.state), mcp23017Attempts)
+		if err != nil {
+			// the state isn't marked as applied so the next update writes it again
+			log.Println(fmt.Errorf("error updating MCP23017 at 0x%02x: %w", chip.addr, err))
+			continue
+		}
+
+		chip.stateLastUpdate = chip.state
+	}
+}
+
+func (m *MCP23017Hardware) TimeRun(idx int) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.runTimes[idx]
+}
+
+func (m *MCP23017Hardware) SetTimeRun(idx int, runtime time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.runTimes[idx] = runtime
+}
+
+func (m *MCP23017Hardware) RunForTimes(direction PumpState, times []time.Duration) error {
+	_, err := m.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
+}
+
+func (m *MCP23017Hardware) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	m.runMu.Lock()
+	defer m.runMu.Unlock()
+
+	return runForTimes(ctx, m, m.mu, direction, times, opts)
+}
+
+func (m *MCP23017Hardware) GetReversePin() *ReversePin {
+	return m.rp
+}
@@ -0,0 +1,117 @@
+package hardware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+	"github.com/stretchr/testify/require"
+)
+
+// addFakeMCP23017 adds an MCP23017 to bus whose pins follow its output latches, except for stuck pins which always
+// read as stuckVal
+func addFakeMCP23017(bus *i2c.FakeBus, addr byte, stuck, stuckVal uint16) *i2c.FakeDevice {
+	dev := bus.AddDevice(addr)
+	dev.SetReg(mcp23017IodirAReg, 0xFF)
+	dev.SetReg(mcp23017IodirAReg+1, 0xFF)
+	dev.OnWrite = func(regs *[256]byte, reg, value byte) {
+		if reg == mcp23017OlatAReg || reg == mcp23017OlatAReg+1 {
+			gpioReg := mcp23017GpioAReg + reg - mcp23017OlatAReg
+			shift := 8 * (reg - mcp23017OlatAReg)
+			mask := byte(stuck >> shift)
+			regs[gpioReg] = value&^mask | byte(stuckVal>>shift)&mask
+		}
+	}
+
+	return dev
+}
+
+func mcp23017Pins(dev *i2c.FakeDevice) uint16 {
+	return uint16(dev.Reg(mcp23017GpioAReg)) | uint16(dev.Reg(mcp23017GpioAReg+1))<<8
+}
+
+func TestMCP23017Hardware(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	chip0 := addFakeMCP23017(bus, 0x20, 0, 0)
+	chip1 := addFakeMCP23017(bus, 0x21, 0, 0)
+
+	_, err := NewMCP23017Hardware(bus, &cfg.MCP23017HardwareConfig{Addresses: []int{0x20, 0x22}}, nil)
+	require.Error(t, err)
+
+	_, err = NewMCP23017Hardware(bus, &cfg.MCP23017HardwareConfig{PinMapping: []int{1, 1}}, nil)
+	require.Error(t, err)
+
+	_, err = NewMCP23017Hardware(bus, &cfg.MCP23017HardwareConfig{ActiveLowPins: []int{16}}, nil)
+	require.Error(t, err)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw, err := NewMCP23017Hardware(bus, &cfg.MCP23017HardwareConfig{
+		Addresses:     []int{0x20, 0x21},
+		PinMapping:    []int{0, 9, 16, 31},
+		ActiveLowPins: []int{16, 31},
+	}, rp)
+	require.NoError(t, err)
+	require.Equal(t, 4, hw.NumPumps())
+	require.Equal(t, byte(0), chip0.Reg(mcp23017IodirAReg))
+	require.Equal(t, byte(0), chip1.Reg(mcp23017IodirAReg+1))
+	require.Equal(t, uint16(0x0000), mcp23017Pins(chip0))
+	require.Equal(t, uint16(0x8001), mcp23017Pins(chip1))
+
+	require.NoError(t, hw.Pump(1, Forward))
+	require.NoError(t, hw.Pump(2, Forward))
+	require.Equal(t, uint16(0x0200), mcp23017Pins(chip0))
+	require.Equal(t, uint16(0x8000), mcp23017Pins(chip1))
+
+	// pumps changed with the lock free pump aren't written until update
+	require.NoError(t, hw.pump(3, Forward))
+	require.Equal(t, uint16(0x8000), mcp23017Pins(chip1))
+	hw.Update()
+	require.Equal(t, uint16(0x0000), mcp23017Pins(chip1))
+
+	require.NoError(t, TurnPumpsOff(hw))
+	require.Equal(t, uint16(0x0000), mcp23017Pins(chip0))
+	require.Equal(t, uint16(0x8001), mcp23017Pins(chip1))
+
+	ran, err := hw.RunForTimesCtx(context.Background(), Forward, []time.Duration{20 * time.Millisecond, 0, 0, 0}, RunOptions{})
+	require.NoError(t, err)
+	require.InDelta(t, 20*time.Millisecond, ran[0], float64(10*time.Millisecond))
+	require.Equal(t, uint16(0x0000), mcp23017Pins(chip0))
+
+	// a state that couldn't be read back is written again on the next update
+	chip0.FailReads(mcp23017Attempts)
+	require.NoError(t, hw.Pump(0, Forward))
+	chip0.SetReg(mcp23017GpioAReg, 0)
+	hw.Update()
+	require.Equal(t, uint16(0x0001), mcp23017Pins(chip0))
+
+	// closing turns every pump off
+	require.NoError(t, hw.Pump(2, Forward))
+	require.Equal(t, uint16(0x8000), mcp23017Pins(chip1))
+	require.NoError(t, hw.Close())
+	require.Equal(t, uint16(0x0000), mcp23017Pins(chip0))
+	require.Equal(t, uint16(0x8001), mcp23017Pins(chip1))
+	require.True(t, chip0.Closed())
+	require.True(t, chip1.Closed())
+}
+
+func TestVerifyMCP23017(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	addFakeMCP23017(bus, 0x20, 0x0004, 0x0004)
+
+	dev, err := bus.Open(0x20)
+	require.NoError(t, err)
+
+	require.NoError(t, verifyMCP23017(dev, 0x0005, 3))
+
+	writes := bus.Device(0x20).Writes()
+	err = verifyMCP23017(dev, 0x0001, 3)
+	require.Error(t, err)
+	require.Equal(t, writes+6, bus.Device(0x20).Writes())
+
+	_, err = NewMCP23017Hardware(bus, &cfg.MCP23017HardwareConfig{}, nil)
+	require.Error(t, err)
+}
@@ -1,6 +1,7 @@
 package hardware
 
 import (
+	"context"
 	"time"
 )
 
@@ -41,10 +42,16 @@ func (nhw NullHw) TimeRun(idx int) time.Duration {
 	return 0
 }
 
-func (nhw NullHw) RunForTimes(times []time.Duration) error {
+func (nhw NullHw) SetTimeRun(idx int, runtime time.Duration) {}
+
+func (nhw NullHw) RunForTimes(direction PumpState, times []time.Duration) error {
 	return nil
 }
 
+func (nhw NullHw) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	return make([]time.Duration, len(times)), nil
+}
+
 func (nhw NullHw) GetReversePin() *ReversePin {
 	return nhw.rp
 }
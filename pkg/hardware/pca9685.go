@@ -0,0 +1,348 @@
+package hardware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+)
+
+const (
+	pca9685DefaultAddr   = 0x40
+	pca9685NumChannels   = 16
+	pca9685OscillatorHz  = 25_000_000
+	pca9685Resolution    = 4096
+	pca9685MinFrequency  = 24
+	pca9685MaxFrequency  = 1526
+	pca9685OscillatorSet = 500 * time.Microsecond
+
+	pca9685Mode1Reg    = 0x00
+	pca9685Mode2Reg    = 0x01
+	pca9685Led0Reg     = 0x06
+	pca9685AllLedOffH  = 0xFD
+	pca9685PrescaleReg = 0xFE
+
+	pca9685Mode1Sleep   = 0x10
+	pca9685Mode1AutoInc = 0x20
+	pca9685Mode2OutDrv  = 0x04
+	pca9685FullOnOff    = 0x10
+)
+
+var _ Hardware = &PCA9685Hardware{}
+var _ SpeedController = &PCA9685Hardware{}
+
+type pca9685Pump struct {
+	board     int
+	channel   int
+	state     PumpState
+	speed     float64
+	updatedAt time.Time
+}
+
+// PCA9685Hardware drives pumps from the PWM channels of PCA9685 boards. The duty cycle of a pump's channel is its speed
+// scaled by the configured full speed duty cycle.
+type PCA9685Hardware struct {
+	schedulerHolder
+
+	mu        *sync.Mutex
+	runMu     *sync.Mutex
+	boards    []i2c.Device
+	addresses []byte
+	pumps     []pca9685Pump
+	dutyCycle float64
+	runTimes  []time.Duration
+	rp        *ReversePin
+}
+
+// NewPCA9685Hardware initializes the PCA9685 boards on bus described by config, turning every channel off
+func NewPCA9685Hardware(bus i2c.Bus, config *cfg.PCA9685HardwareConfig, rp *ReversePin) (*PCA9685Hardware, error) {
+	addresses := []byte{pca9685DefaultAddr}
+	if len(config.Addresses) > 0 {
+		addresses = make([]byte, len(config.Addresses))
+		for i, addr := range config.Addresses {
+			if addr < 0 || addr > 0x7F {
+				return nil, fmt.Errorf("invalid I2C address 0x%x", addr)
+			}
+
+			addresses[i] = byte(addr)
+		}
+	}
+
+	frequency := config.FrequencyHz
+	if frequency == 0 {
+		frequency = defaultPwmFrequency
+	} else if frequency < pca9685MinFrequency || frequency > pca9685MaxFrequency {
+		return nil, fmt.Errorf("pwm frequency %d is not between %d and %d", frequency, pca9685MinFrequency, pca9685MaxFrequency)
+	}
+
+	dutyCycle := config.DutyCycle
+	if dutyCycle == 0 {
+		dutyCycle = 1
+	} else if dutyCycle < 0 || dutyCycle > 1 {
+		return nil, fmt.Errorf("duty cycle %f is not between 0 and 1", dutyCycle)
+	}
+
+	numChannels := len(addresses) * pca9685NumChannels
+	mapping := config.ChannelMapping
+	if mapping == nil {
+		mapping = make([]int, numChannels)
+		for i := range mapping {
+			mapping[i] = i
+		}
+	}
+
+	used := make(map[int]bool)
+	pumps := make([]pca9685Pump, len(mapping))
+	for i, ch := range mapping {
+		if ch < 0 || ch >= numChannels {
+			return nil, fmt.Errorf("pump %d is mapped to channel %d but there are %d channels", i, ch, numChannels)
+		} else if used[ch] {
+			return nil, fmt.Errorf("channel %d is mapped to more than one pump", ch)
+		}
+
+		used[ch] = true
+		pumps[i] = pca9685Pump{
+			board:     ch / pca9685NumChannels,
+			channel:   ch % pca9685NumChannels,
+			state:     Off,
+			speed:     FullSpeed,
+			updatedAt: time.Now(),
+		}
+	}
+
+	hw := &PCA9685Hardware{
+		mu:        &sync.Mutex{},
+		runMu:     &sync.Mutex{},
+		addresses: addresses,
+		pumps:     pumps,
+		dutyCycle: dutyCycle,
+		runTimes:  make([]time.Duration, len(pumps)),
+		rp:        rp,
+	}
+
+	prescale := byte(math.Round(float64(pca9685OscillatorHz)/float64(pca9685Resolution*frequency)) - 1)
+	for _, addr := range addresses {
+		dev, err := bus.Open(addr)
+		if err != nil {
+			_ = hw.Close()
+			return nil, fmt.Errorf("error opening PCA9685 at 0x%02x: %w", addr, err)
+		}
+
+		hw.boards = append(hw.boards, dev)
+		err = initPCA9685(dev, prescale)
+		if err != nil {
+			_ = hw.Close()
+			return nil, fmt.Errorf("error initializing PCA9685 at 0x%02x: %w", addr, err)
+		}
+	}
+
+	return hw, nil
+}
+
+// initPCA9685 turns every channel of a board off and sets its pwm frequency. The prescaler can only be set while the
+// oscillator is asleep.
+func initPCA9685(dev i2c.Device, prescale byte) error {
+	if err := dev.WriteRegU8(pca9685AllLedOffH, pca9685FullOnOff); err != nil {
+		return fmt.Errorf("error turning channels off: %w", err)
+	}
+
+	if err := dev.WriteRegU8(pca9685Mode2Reg, pca9685Mode2OutDrv); err != nil {
+		return fmt.Errorf("error setting output mode: %w", err)
+	}
+
+	if err := dev.WriteRegU8(pca9685Mode1Reg, pca9685Mode1Sleep|pca9685Mode1AutoInc); err != nil {
+		return fmt.Errorf("error putting oscillator to sleep: %w", err)
+	}
+
+	if err := dev.WriteRegU8(pca9685PrescaleReg, prescale); err != nil {
+		return fmt.Errorf("error setting prescaler: %w", err)
+	}
+
+	if err := dev.WriteRegU8(pca9685Mode1Reg, pca9685Mode1AutoInc); err != nil {
+		return fmt.Errorf("error waking oscillator: %w", err)
+	}
+
+	time.Sleep(pca9685OscillatorSet)
+	return nil
+}
+
+// writeChannel sets the duty cycle of a channel. Duty cycles of 0 and 1 use the full off and full on bits so the output
+// doesn't pulse.
+func writeChannel(dev i2c.Device, channel int, duty float64) error {
+	var on, off uint16
+	switch offCount := uint16(math.Round(duty * pca9685Resolution)); {
+	case offCount == 0:
+		off = pca9685FullOnOff << 8
+	case offCount >= pca9685Resolution:
+		on = pca9685FullOnOff << 8
+	default:
+		off = offCount
+	}
+
+	// the 4 registers of the channel are written in one transfer, relying on the register auto-increment, so the output
+	// never has a mix of old and new counts
+	reg := byte(pca9685Led0Reg + 4*channel)
+	if _, err := dev.WriteBytes([]byte{reg, byte(on), byte(on >> 8), byte(off), byte(off >> 8)}); err != nil {
+		return fmt.Errorf("error writing channel %d: %w", channel, err)
+	}
+
+	return nil
+}
+
+func (p *PCA9685Hardware) Name() string {
+	return "PCA9685"
+}
+
+func (p *PCA9685Hardware) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for i, dev := range p.boards {
+		err := dev.WriteRegU8(pca9685AllLedOffH, pca9685FullOnOff)
+		if closeErr := dev.Close(); err == nil {
+			err = closeErr
+		}
+
+		if firstErr == nil && err != nil {
+			firstErr = fmt.Errorf("error closing PCA9685 at 0x%02x: %w", p.addresses[i], err)
+		}
+	}
+
+	return firstErr
+}
+
+func (p *PCA9685Hardware) NumPumps() int {
+	return len(p.pumps)
+}
+
+func (p *PCA9685Hardware) Pump(idx int, state PumpState) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pump(idx, state)
+}
+
+func (p *PCA9685Hardware) pump(idx int, state PumpState) error {
+	if idx < 0 || idx >= p.NumPumps() {
+		return fmt.Errorf("invalid pump index %d", idx)
+	}
+
+	switch state {
+	case Off, Forward, Backward:
+	default:
+		return fmt.Errorf("unknown state %d", state)
+	}
+
+	pump := &p.pumps[idx]
+	if state == pump.state {
+		return nil
+	}
+
+	if err := p.writeDuty(pump, state, pump.speed); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if pump.state.running() {
+		p.runTimes[idx] += now.Sub(pump.updatedAt)
+	}
+
+	pump.state = state
+	pump.updatedAt = now
+	return nil
+}
+
+// writeDuty sets the duty cycle of a pump's channel for the pump in the given state running at speed. The direction of
+// a pump is set by the reverse pin, so pumps running backward are driven the same as pumps running forward.
+func (p *PCA9685Hardware) writeDuty(pump *pca9685Pump, state PumpState, speed float64) error {
+	var duty float64
+	if state != Off {
+		duty = speed * p.dutyCycle
+	}
+
+	err := writeChannel(p.boards[pump.board], pump.channel, duty)
+	if err != nil {
+		return fmt.Errorf("error setting PCA9685 at 0x%02x duty cycle to %f: %w", p.addresses[pump.board], duty, err)
+	}
+
+	return nil
+}
+
+// SetPumpSpeed sets the speed a pump runs at. A pump that is on changes speed immediately.
+func (p *PCA9685Hardware) SetPumpSpeed(idx int, speed float64) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.setPumpSpeed(idx, speed)
+}
+
+func (p *PCA9685Hardware) setPumpSpeed(idx int, speed float64) error {
+	if idx < 0 || idx >= p.NumPumps() {
+		return fmt.Errorf("invalid pump index %d", idx)
+	} else if err := validateSpeed(speed); err != nil {
+		return err
+	}
+
+	pump := &p.pumps[idx]
+	if pump.state != Off && speed != pump.speed {
+		if err := p.writeDuty(pump, pump.state, speed); err != nil {
+			return err
+		}
+	}
+
+	pump.speed = speed
+	return nil
+}
+
+func (p *PCA9685Hardware) Update() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.update()
+}
+
+func (p *PCA9685Hardware) update() {
+}
+
+func (p *PCA9685Hardware) TimeRun(idx int) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if idx < 0 || idx >= p.NumPumps() {
+		panic(fmt.Errorf("invalid pump index %d", idx))
+	}
+
+	return p.runTimes[idx]
+}
+
+func (p *PCA9685Hardware) SetTimeRun(idx int, runtime time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if idx < 0 || idx >= p.NumPumps() {
+		panic(fmt.Errorf("invalid pump index %d", idx))
+	}
+
+	p.runTimes[idx] = runtime
+}
+
+func (p *PCA9685Hardware) RunForTimes(direction PumpState, times []time.Duration) error {
+	_, err := p.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
+}
+
+func (p *PCA9685Hardware) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+
+	return runForTimes(ctx, p, p.mu, direction, times, opts)
+}
+
+func (p *PCA9685Hardware) GetReversePin() *ReversePin {
+	return p.rp
+}
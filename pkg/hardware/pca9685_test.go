@@ -0,0 +1,111 @@
+package hardware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+	"github.com/stretchr/testify/require"
+)
+
+// pca9685Channel returns the on and off counts of a channel of a fake PCA9685
+func pca9685Channel(dev *i2c.FakeDevice, channel int) (uint16, uint16) {
+	reg := byte(pca9685Led0Reg + 4*channel)
+	on := uint16(dev.Reg(reg)) | uint16(dev.Reg(reg+1))<<8
+	off := uint16(dev.Reg(reg+2)) | uint16(dev.Reg(reg+3))<<8
+	return on, off
+}
+
+func TestNewPCA9685Hardware(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	bus.AddDevice(0x40)
+
+	tests := []struct {
+		name   string
+		config *cfg.PCA9685HardwareConfig
+	}{
+		{name: "missing board", config: &cfg.PCA9685HardwareConfig{Addresses: []int{0x40, 0x41}}},
+		{name: "invalid address", config: &cfg.PCA9685HardwareConfig{Addresses: []int{0x80}}},
+		{name: "channel out of range", config: &cfg.PCA9685HardwareConfig{ChannelMapping: []int{0, 16}}},
+		{name: "channel mapped twice", config: &cfg.PCA9685HardwareConfig{ChannelMapping: []int{3, 3}}},
+		{name: "frequency too high", config: &cfg.PCA9685HardwareConfig{FrequencyHz: 2000}},
+		{name: "invalid duty cycle", config: &cfg.PCA9685HardwareConfig{DutyCycle: 1.5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPCA9685Hardware(bus, tt.config, nil)
+			require.Error(t, err)
+		})
+	}
+
+	hw, err := NewPCA9685Hardware(bus, &cfg.PCA9685HardwareConfig{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 16, hw.NumPumps())
+
+	dev := bus.Device(0x40)
+	require.Equal(t, byte(5), dev.Reg(pca9685PrescaleReg))
+	require.Equal(t, byte(pca9685Mode1AutoInc), dev.Reg(pca9685Mode1Reg))
+	require.Equal(t, byte(pca9685FullOnOff), dev.Reg(pca9685AllLedOffH))
+}
+
+func TestPCA9685Hardware(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	board0 := bus.AddDevice(0x40)
+	board1 := bus.AddDevice(0x41)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw, err := NewPCA9685Hardware(bus, &cfg.PCA9685HardwareConfig{
+		Addresses:      []int{0x40, 0x41},
+		ChannelMapping: []int{17, 0, 5},
+		DutyCycle:      0.5,
+	}, rp)
+	require.NoError(t, err)
+	require.Equal(t, 3, hw.NumPumps())
+
+	require.NoError(t, hw.Pump(0, Forward))
+	on, off := pca9685Channel(board1, 1)
+	require.Equal(t, uint16(0), on)
+	require.Equal(t, uint16(2048), off)
+
+	require.NoError(t, hw.SetPumpSpeed(0, 0.5))
+	_, off = pca9685Channel(board1, 1)
+	require.Equal(t, uint16(1024), off)
+
+	require.NoError(t, hw.Pump(0, Off))
+	_, off = pca9685Channel(board1, 1)
+	require.Equal(t, uint16(pca9685FullOnOff)<<8, off)
+
+	hw.dutyCycle = 1
+	require.NoError(t, hw.SetPumpSpeed(1, FullSpeed))
+	require.NoError(t, hw.Pump(1, Forward))
+	on, off = pca9685Channel(board0, 0)
+	require.Equal(t, uint16(pca9685FullOnOff)<<8, on)
+	require.Equal(t, uint16(0), off)
+	require.NoError(t, hw.Pump(1, Off))
+
+	writes := board0.Writes()
+	require.NoError(t, hw.Pump(1, Off))
+	require.Equal(t, writes, board0.Writes())
+
+	// each channel update is a single block write
+	require.NoError(t, hw.Pump(1, Forward))
+	require.Equal(t, writes+1, board0.Writes())
+	require.NoError(t, hw.Pump(1, Off))
+
+	ran, err := hw.RunForTimesCtx(context.Background(), Forward, []time.Duration{0, 0, 20 * time.Millisecond}, RunOptions{})
+	require.NoError(t, err)
+	require.InDelta(t, 20*time.Millisecond, ran[2], float64(10*time.Millisecond))
+	require.InDelta(t, 20*time.Millisecond, hw.TimeRun(2), float64(10*time.Millisecond))
+	_, off = pca9685Channel(board0, 5)
+	require.Equal(t, uint16(pca9685FullOnOff)<<8, off)
+
+	require.Error(t, hw.Pump(3, Forward))
+	require.NoError(t, hw.Close())
+	require.True(t, board0.Closed())
+	require.True(t, board1.Closed())
+}
@@ -0,0 +1,64 @@
+package hardware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// pourRegistry tracks running pours, such as those of a Watchdog or a Lease, so that they can all be stopped with a
+// cause. A running pour turns its pumps back on at its next step, so its pours are stopped before pumps are forced off.
+type pourRegistry struct {
+	mu    sync.Mutex
+	pours map[int]context.CancelCauseFunc
+	next  int
+}
+
+// add starts tracking a pour, returning its context and the function which stops it. The pour is tracked until it is
+// stopped, so stop must be called once the pour completes, with a nil cause if it wasn't stopped early.
+func (r *pourRegistry) add(ctx context.Context) (context.Context, context.CancelCauseFunc) {
+	pourCtx, cancel := context.WithCancelCause(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pours == nil {
+		r.pours = make(map[int]context.CancelCauseFunc)
+	}
+
+	id := r.next
+	r.next++
+	r.pours[id] = cancel
+
+	return pourCtx, func(cause error) {
+		r.mu.Lock()
+		delete(r.pours, id)
+		r.mu.Unlock()
+
+		cancel(cause)
+	}
+}
+
+// stopAll stops every running pour with cause
+func (r *pourRegistry) stopAll(cause error) {
+	r.mu.Lock()
+	cancels := make([]context.CancelCauseFunc, 0, len(r.pours))
+	for _, cancel := range r.pours {
+		cancels = append(cancels, cancel)
+	}
+	r.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel(cause)
+	}
+}
+
+// pourStoppedErr returns the error of a pour run with ctx. A pour stopped with a cause failed rather than being
+// cancelled, so unless ctx was cancelled too, its error wraps the cause instead of the cancellation.
+func pourStoppedErr(ctx context.Context, err, cause error) error {
+	if err == nil || cause == nil || ctx.Err() != nil {
+		return err
+	}
+
+	return fmt.Errorf("pour stopped: %w", cause)
+}
@@ -0,0 +1,282 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sysfsPwmDir         = "/sys/class/pwm"
+	defaultPwmFrequency = 1000
+	pwmExportTimeout    = time.Second
+)
+
+var _ Hardware = &PwmHardware{}
+var _ SpeedController = &PwmHardware{}
+
+type pwmPump struct {
+	channel   int
+	dir       string
+	state     PumpState
+	speed     float64
+	updatedAt time.Time
+}
+
+// PwmHardware drives each pump from a channel of a Linux sysfs PWM chip, so pumps can run at less than full speed. The
+// speed of a pump is the duty cycle of its channel.
+type PwmHardware struct {
+	schedulerHolder
+
+	mu       *sync.Mutex
+	runMu    *sync.Mutex
+	chipDir  string
+	periodNs int64
+	pumps    []pwmPump
+	runTimes []time.Duration
+	rp       *ReversePin
+}
+
+// NewPwmHardware creates PwmHardware for the given channels of a PWM chip. chip is either the name of a chip in
+// /sys/class/pwm, such as pwmchip0, or the path to the chip's directory. A frequencyHz of 0 uses 1kHz.
+func NewPwmHardware(chip string, channels []int, frequencyHz int, rp *ReversePin) (*PwmHardware, error) {
+	if chip == "" {
+		chip = "pwmchip0"
+	}
+
+	chipDir := chip
+	if !strings.ContainsRune(chip, os.PathSeparator) {
+		chipDir = filepath.Join(sysfsPwmDir, chip)
+	}
+
+	if frequencyHz < 0 {
+		return nil, fmt.Errorf("invalid pwm frequency %d", frequencyHz)
+	} else if frequencyHz == 0 {
+		frequencyHz = defaultPwmFrequency
+	}
+
+	pwm := &PwmHardware{
+		mu:       &sync.Mutex{},
+		runMu:    &sync.Mutex{},
+		chipDir:  chipDir,
+		periodNs: int64(time.Second) / int64(frequencyHz),
+		runTimes: make([]time.Duration, len(channels)),
+		rp:       rp,
+	}
+
+	for _, ch := range channels {
+		p := pwmPump{
+			channel:   ch,
+			dir:       filepath.Join(chipDir, fmt.Sprintf("pwm%d", ch)),
+			state:     Off,
+			speed:     FullSpeed,
+			updatedAt: time.Now(),
+		}
+
+		err := pwm.initChannel(p)
+		if err != nil {
+			_ = pwm.Close()
+			return nil, err
+		}
+
+		pwm.pumps = append(pwm.pumps, p)
+	}
+
+	return pwm, nil
+}
+
+// initChannel exports the channel of p if needed, then sets its period and enables it with a duty cycle of 0
+func (pwm *PwmHardware) initChannel(p pwmPump) error {
+	if _, err := os.Stat(p.dir); errors.Is(err, os.ErrNotExist) {
+		err = writeSysfs(filepath.Join(pwm.chipDir, "export"), int64(p.channel))
+		if err != nil {
+			return fmt.Errorf("error exporting pwm channel %d: %w", p.channel, err)
+		}
+
+		// the channel directory is created asynchronously after the export
+		deadline := time.Now().Add(pwmExportTimeout)
+		for _, err = os.Stat(p.dir); err != nil; _, err = os.Stat(p.dir) {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("pwm channel %d was not exported: %w", p.channel, err)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// the duty cycle can never exceed the period, so it is cleared before the period is set
+	if err := writeSysfs(filepath.Join(p.dir, "duty_cycle"), 0); err != nil {
+		return fmt.Errorf("error clearing pwm channel %d duty cycle: %w", p.channel, err)
+	}
+
+	if err := writeSysfs(filepath.Join(p.dir, "period"), pwm.periodNs); err != nil {
+		return fmt.Errorf("error setting pwm channel %d period: %w", p.channel, err)
+	}
+
+	if err := writeSysfs(filepath.Join(p.dir, "enable"), 1); err != nil {
+		return fmt.Errorf("error enabling pwm channel %d: %w", p.channel, err)
+	}
+
+	return nil
+}
+
+func writeSysfs(path string, val int64) error {
+	return os.WriteFile(path, []byte(strconv.FormatInt(val, 10)), 0644)
+}
+
+func (pwm *PwmHardware) Name() string {
+	return "PWM"
+}
+
+func (pwm *PwmHardware) Close() error {
+	pwm.mu.Lock()
+	defer pwm.mu.Unlock()
+
+	var firstErr error
+	for _, p := range pwm.pumps {
+		err := writeSysfs(filepath.Join(p.dir, "duty_cycle"), 0)
+		if err == nil {
+			err = writeSysfs(filepath.Join(p.dir, "enable"), 0)
+		}
+
+		if firstErr == nil && err != nil {
+			firstErr = fmt.Errorf("error disabling pwm channel %d: %w", p.channel, err)
+		}
+	}
+
+	return firstErr
+}
+
+func (pwm *PwmHardware) NumPumps() int {
+	return len(pwm.pumps)
+}
+
+func (pwm *PwmHardware) Pump(idx int, state PumpState) error {
+	pwm.mu.Lock()
+	defer pwm.mu.Unlock()
+
+	return pwm.pump(idx, state)
+}
+
+func (pwm *PwmHardware) pump(idx int, state PumpState) error {
+	if idx < 0 || idx >= pwm.NumPumps() {
+		return fmt.Errorf("invalid pump index %d", idx)
+	}
+
+	p := &pwm.pumps[idx]
+	switch state {
+	case Off, Forward:
+	case Backward:
+		return fmt.Errorf("Not implemented")
+	default:
+		return fmt.Errorf("unknown state %d", state)
+	}
+
+	if err := pwm.writeDuty(p, state, p.speed); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if p.state == Forward && state != Forward {
+		pwm.runTimes[idx] += now.Sub(p.updatedAt)
+	}
+
+	p.state = state
+	p.updatedAt = now
+	return nil
+}
+
+// writeDuty sets the duty cycle of the channel of p for a pump in the given state running at speed
+func (pwm *PwmHardware) writeDuty(p *pwmPump, state PumpState, speed float64) error {
+	var duty int64
+	if state == Forward {
+		duty = int64(float64(pwm.periodNs) * speed)
+	}
+
+	err := writeSysfs(filepath.Join(p.dir, "duty_cycle"), duty)
+	if err != nil {
+		return fmt.Errorf("error setting pwm channel %d duty cycle to %d: %w", p.channel, duty, err)
+	}
+
+	return nil
+}
+
+// SetPumpSpeed sets the speed a pump runs at. A pump that is on changes speed immediately.
+func (pwm *PwmHardware) SetPumpSpeed(idx int, speed float64) error {
+	pwm.mu.Lock()
+	defer pwm.mu.Unlock()
+
+	return pwm.setPumpSpeed(idx, speed)
+}
+
+func (pwm *PwmHardware) setPumpSpeed(idx int, speed float64) error {
+	if idx < 0 || idx >= pwm.NumPumps() {
+		return fmt.Errorf("invalid pump index %d", idx)
+	} else if err := validateSpeed(speed); err != nil {
+		return err
+	}
+
+	p := &pwm.pumps[idx]
+	if p.state == Forward {
+		if err := pwm.writeDuty(p, p.state, speed); err != nil {
+			return err
+		}
+	}
+
+	p.speed = speed
+	return nil
+}
+
+func (pwm *PwmHardware) Update() {
+	pwm.mu.Lock()
+	defer pwm.mu.Unlock()
+
+	pwm.update()
+}
+
+func (pwm *PwmHardware) update() {
+}
+
+func (pwm *PwmHardware) TimeRun(idx int) time.Duration {
+	pwm.mu.Lock()
+	defer pwm.mu.Unlock()
+
+	if idx < 0 || idx >= pwm.NumPumps() {
+		panic(fmt.Errorf("invalid pump index %d", idx))
+	}
+
+	return pwm.runTimes[idx]
+}
+
+func (pwm *PwmHardware) SetTimeRun(idx int, runtime time.Duration) {
+	pwm.mu.Lock()
+	defer pwm.mu.Unlock()
+
+	if idx < 0 || idx >= pwm.NumPumps() {
+		panic(fmt.Errorf("invalid pump index %d", idx))
+	}
+
+	pwm.runTimes[idx] = runtime
+}
+
+func (pwm *PwmHardware) RunForTimes(direction PumpState, times []time.Duration) error {
+	_, err := pwm.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
+}
+
+func (pwm *PwmHardware) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	pwm.runMu.Lock()
+	defer pwm.runMu.Unlock()
+
+	return runForTimes(ctx, pwm, pwm.mu, direction, times, opts)
+}
+
+func (pwm *PwmHardware) GetReversePin() *ReversePin {
+	return pwm.rp
+}
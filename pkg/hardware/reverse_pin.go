@@ -1,45 +1,103 @@
-//go:build !linux
-
 package hardware
 
 import (
-	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"fmt"
 	"sync"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/gpio"
 )
 
+// ReversePin is a GPIO line that sets the direction all pumps run in. Without a pin configured it only tracks the value
+// the line would have.
 type ReversePin struct {
 	mu         *sync.Mutex
+	pin        int
 	forwardVal int
+	backVal    int
 	currentVal int
+	line       gpio.Line
 }
 
-func NewReversePin(config *cfg.ReversePinConfig) (*ReversePin, error) {
-	fv := 0
+// NewReversePin requests the line of chip described by config as an output set to run pumps forward. chip is unused
+// and may be nil if config is nil or has no pin.
+func NewReversePin(chip gpio.Chip, config *cfg.ReversePinConfig) (*ReversePin, error) {
+	forwardVal, backVal := 0, 1
 	if config != nil && config.ForwardHigh {
-		fv = 1
+		forwardVal, backVal = 1, 0
 	}
 
-	return &ReversePin{
+	rp := &ReversePin{
 		mu:         &sync.Mutex{},
-		forwardVal: fv,
-	}, nil
+		pin:        -1,
+		forwardVal: forwardVal,
+		backVal:    backVal,
+		currentVal: forwardVal,
+	}
+
+	if config == nil || config.Pin == -1 {
+		return rp, nil
+	}
+
+	l, err := chip.RequestOutput(config.Pin, forwardVal)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting reverse pin line: %w", err)
+	}
+
+	rp.pin = config.Pin
+	rp.line = l
+	return rp, nil
 }
 
 func (rp *ReversePin) SetDirection(direction PumpState) error {
 	rp.mu.Lock()
 	defer rp.mu.Unlock()
 
-	rp.currentVal = rp.forwardVal
-	if direction == Backward {
-		rp.currentVal = 1 - rp.forwardVal
+	var val int
+	if direction == Forward {
+		val = rp.forwardVal
+	} else {
+		val = rp.backVal
 	}
 
+	if rp.line != nil && val != rp.currentVal {
+		err := rp.line.SetValue(val)
+		if err != nil {
+			return fmt.Errorf("error setting value %d on line %d: %w", val, rp.pin, err)
+		}
+	}
+
+	rp.currentVal = val
 	return nil
 }
 
+// Direction returns the direction the pin is set to run pumps in
+func (rp *ReversePin) Direction() PumpState {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.currentVal == rp.backVal {
+		return Backward
+	}
+
+	return Forward
+}
+
 func (rp *ReversePin) Value() int {
 	rp.mu.Lock()
 	defer rp.mu.Unlock()
 
 	return rp.currentVal
 }
+
+// Close releases the line of the reverse pin
+func (rp *ReversePin) Close() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.line == nil {
+		return nil
+	}
+
+	return rp.line.Close()
+}
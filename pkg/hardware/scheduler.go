@@ -0,0 +1,266 @@
+package hardware
+
+import (
+	"errors"
+	"fmt"
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSwitchBatchSize = 3
+	defaultSwitchDelay     = time.Millisecond
+
+	// currentEpsilon allows for floating point error when summing pump currents
+	currentEpsilon = 1e-9
+)
+
+// ErrSchedulerNotSupported is returned when a scheduler is set on hardware that always starts every pump at once
+var ErrSchedulerNotSupported = errors.New("hardware does not support pump scheduling")
+
+// Scheduled is implemented by hardware whose pumps are started by a Scheduler
+type Scheduled interface {
+	// SetScheduler sets the scheduler that decides when RunForTimes turns each pump on. A nil scheduler starts every
+	// pump at once
+	SetScheduler(s *Scheduler)
+
+	// scheduler returns the scheduler set with SetScheduler for internal use
+	scheduler() *Scheduler
+}
+
+// SupportsScheduling returns true if the pumps of hw can be started by a Scheduler
+func SupportsScheduling(hw Hardware) bool {
+	_, ok := unwrap(hw).(Scheduled)
+	return ok
+}
+
+// SetScheduler sets the scheduler that decides when hw turns each pump on, returning ErrSchedulerNotSupported if hw
+// always starts every pump at once
+func SetScheduler(hw Hardware, s *Scheduler) error {
+	sc, ok := unwrap(hw).(Scheduled)
+	if !ok {
+		return ErrSchedulerNotSupported
+	}
+
+	sc.SetScheduler(s)
+	return nil
+}
+
+// schedulerOf returns the scheduler of hw, or nil if it has none
+func schedulerOf(hw Hardware) *Scheduler {
+	if sc, ok := unwrap(hw).(Scheduled); ok {
+		return sc.scheduler()
+	}
+
+	return nil
+}
+
+// schedulerHolder implements Scheduled for the hardware it is embedded in
+type schedulerHolder struct {
+	sched atomic.Pointer[Scheduler]
+}
+
+// SetScheduler sets the scheduler that decides when RunForTimes turns each pump on. A nil scheduler starts every pump
+// at once
+func (h *schedulerHolder) SetScheduler(s *Scheduler) {
+	h.sched.Store(s)
+}
+
+func (h *schedulerHolder) scheduler() *Scheduler {
+	return h.sched.Load()
+}
+
+// Scheduler decides when each pump in a pour is turned on so that the pumps running at the same time never draw more
+// current, and never number more, than the power budget allows. Pumps that don't fit in the budget are queued and
+// started as soon as running pumps finish. A nil Scheduler has no budget and starts every pump at once.
+type Scheduler struct {
+	pumpCurrent []float64
+	maxCurrent  float64
+	maxPumps    int
+	batchSize   int
+	batchDelay  time.Duration
+}
+
+// NewScheduler creates a Scheduler for numPumps pumps from the power budget config. A nil config has no budget.
+func NewScheduler(config *cfg.PowerBudgetConfig, numPumps int) (*Scheduler, error) {
+	s := &Scheduler{
+		pumpCurrent: make([]float64, numPumps),
+		batchSize:   defaultSwitchBatchSize,
+		batchDelay:  defaultSwitchDelay,
+	}
+
+	if config == nil {
+		return s, nil
+	}
+
+	if config.PumpCurrentAmps < 0 || config.MaxCurrentAmps < 0 || config.MaxPumps < 0 || config.SwitchBatchSize < 0 || config.SwitchDelayMs < 0 {
+		return nil, fmt.Errorf("power budget values cannot be negative")
+	}
+
+	if config.PumpCurrentsAmps != nil && len(config.PumpCurrentsAmps) != numPumps {
+		return nil, fmt.Errorf("pump currents size (%d) does not match the number of pumps (%d)", len(config.PumpCurrentsAmps), numPumps)
+	}
+
+	for i := range s.pumpCurrent {
+		s.pumpCurrent[i] = config.PumpCurrentAmps
+		if config.PumpCurrentsAmps != nil {
+			s.pumpCurrent[i] = config.PumpCurrentsAmps[i]
+		}
+
+		if s.pumpCurrent[i] < 0 {
+			return nil, fmt.Errorf("pump %d current cannot be negative", i)
+		} else if config.MaxCurrentAmps > 0 && s.pumpCurrent[i] > config.MaxCurrentAmps {
+			return nil, fmt.Errorf("pump %d draws %.2fA which exceeds the max current of %.2fA", i, s.pumpCurrent[i], config.MaxCurrentAmps)
+		}
+	}
+
+	s.maxCurrent = config.MaxCurrentAmps
+	s.maxPumps = config.MaxPumps
+
+	if config.SwitchBatchSize > 0 {
+		s.batchSize = config.SwitchBatchSize
+	}
+
+	if config.SwitchDelayMs > 0 {
+		s.batchDelay = time.Duration(config.SwitchDelayMs) * time.Millisecond
+	}
+
+	return s, nil
+}
+
+func (s *Scheduler) current(idx int) float64 {
+	if idx >= len(s.pumpCurrent) {
+		return 0
+	}
+
+	return s.pumpCurrent[idx]
+}
+
+// fits returns true if pump idx can be turned on while numRunning pumps drawing current amps are running
+func (s *Scheduler) fits(numRunning int, current float64, idx int) bool {
+	if s == nil {
+		return true
+	}
+
+	if s.maxPumps > 0 && numRunning >= s.maxPumps {
+		return false
+	}
+
+	return s.maxCurrent <= 0 || current+s.current(idx) <= s.maxCurrent+currentEpsilon
+}
+
+// Starts returns the offset from the start of a pour at which each pump should be turned on. Whenever the budget allows
+// another pump to be started the pump with the longest remaining run time that fits is started first, which keeps the
+// total pour time close to the minimum. Pumps that don't run start at 0.
+func (s *Scheduler) Starts(times []time.Duration) []time.Duration {
+	starts := make([]time.Duration, len(times))
+	if s == nil || (s.maxCurrent <= 0 && s.maxPumps <= 0) {
+		return starts
+	}
+
+	var pending []int
+	for i, t := range times {
+		if t > 0 {
+			pending = append(pending, i)
+		}
+	}
+
+	sort.SliceStable(pending, func(i, j int) bool {
+		return times[pending[i]] > times[pending[j]]
+	})
+
+	var running []int
+	var now time.Duration
+	current := 0.0
+	for len(pending) > 0 {
+		var queued []int
+		for _, idx := range pending {
+			// a pump that doesn't fit when nothing is running would never be started, so it is started anyway
+			if len(running) == 0 || s.fits(len(running), current, idx) {
+				starts[idx] = now
+				running = append(running, idx)
+				current += s.current(idx)
+			} else {
+				queued = append(queued, idx)
+			}
+		}
+
+		pending = queued
+		if len(pending) == 0 {
+			break
+		}
+
+		now = starts[running[0]] + times[running[0]]
+		for _, idx := range running[1:] {
+			now = min(now, starts[idx]+times[idx])
+		}
+
+		var stillRunning []int
+		for _, idx := range running {
+			if starts[idx]+times[idx] > now {
+				stillRunning = append(stillRunning, idx)
+			} else {
+				current -= s.current(idx)
+			}
+		}
+		running = stillRunning
+	}
+
+	return starts
+}
+
+// Duration returns how long a pour of the given times takes once it has been scheduled
+func (s *Scheduler) Duration(times []time.Duration) time.Duration {
+	var total time.Duration
+	for i, start := range s.Starts(times) {
+		if times[i] > 0 {
+			total = max(total, start+times[i])
+		}
+	}
+
+	return total
+}
+
+// switchBatcher updates the hardware after every batch of pump changes, pausing between batches so that the inrush
+// current of pumps turned on together is spread out
+type switchBatcher struct {
+	hw      Hardware
+	size    int
+	delay   time.Duration
+	changes int
+}
+
+func newSwitchBatcher(hw Hardware, s *Scheduler) *switchBatcher {
+	b := &switchBatcher{hw: hw, size: defaultSwitchBatchSize, delay: defaultSwitchDelay}
+	if s != nil {
+		b.size = s.batchSize
+		b.delay = s.batchDelay
+	}
+
+	return b
+}
+
+// changed records a pump change, updating the hardware if it completes a batch
+func (b *switchBatcher) changed() {
+	b.changes++
+	if b.changes%b.size == 0 {
+		b.hw.update()
+		time.Sleep(b.delay)
+	}
+}
+
+// flush updates the hardware with any changes not yet applied
+func (b *switchBatcher) flush() {
+	if b.changes%b.size != 0 {
+		b.hw.update()
+	}
+
+	b.changes = 0
+}
+
+// PourDuration returns how long running the pumps of hw for the given times takes under its power budget
+func PourDuration(hw Hardware, times []time.Duration) time.Duration {
+	return schedulerOf(hw).Duration(times)
+}
@@ -0,0 +1,139 @@
+package hardware
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewScheduler(t *testing.T) {
+	_, err := NewScheduler(&cfg.PowerBudgetConfig{PumpCurrentsAmps: []float64{1, 2}}, 4)
+	require.Error(t, err)
+
+	_, err = NewScheduler(&cfg.PowerBudgetConfig{PumpCurrentAmps: 3, MaxCurrentAmps: 2}, 4)
+	require.Error(t, err)
+
+	_, err = NewScheduler(&cfg.PowerBudgetConfig{MaxPumps: -1}, 4)
+	require.Error(t, err)
+
+	s, err := NewScheduler(&cfg.PowerBudgetConfig{PumpCurrentAmps: 1, PumpCurrentsAmps: []float64{1, 2, 1, 1}, MaxCurrentAmps: 3}, 4)
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 2, 1, 1}, s.pumpCurrent)
+	require.Equal(t, defaultSwitchBatchSize, s.batchSize)
+}
+
+func TestSchedulerStarts(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name     string
+		config   *cfg.PowerBudgetConfig
+		times    []time.Duration
+		expected []time.Duration
+		duration time.Duration
+	}{
+		{
+			name:     "no budget",
+			times:    []time.Duration{100 * ms, 0, 300 * ms, 200 * ms},
+			expected: []time.Duration{0, 0, 0, 0},
+			duration: 300 * ms,
+		},
+		{
+			name:     "max pumps runs longest first",
+			config:   &cfg.PowerBudgetConfig{MaxPumps: 2},
+			times:    []time.Duration{100 * ms, 0, 300 * ms, 200 * ms},
+			expected: []time.Duration{200 * ms, 0, 0, 0},
+			duration: 300 * ms,
+		},
+		{
+			name:     "max current",
+			config:   &cfg.PowerBudgetConfig{PumpCurrentsAmps: []float64{1, 1, 2, 1}, MaxCurrentAmps: 2},
+			times:    []time.Duration{100 * ms, 100 * ms, 300 * ms, 200 * ms},
+			expected: []time.Duration{300 * ms, 400 * ms, 0, 300 * ms},
+			duration: 500 * ms,
+		},
+		{
+			name:     "queued pumps start as running pumps finish",
+			config:   &cfg.PowerBudgetConfig{PumpCurrentsAmps: []float64{1, 1, 2, 1}, MaxCurrentAmps: 3},
+			times:    []time.Duration{100 * ms, 100 * ms, 300 * ms, 200 * ms},
+			expected: []time.Duration{200 * ms, 300 * ms, 0, 0},
+			duration: 400 * ms,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s *Scheduler
+			if tt.config != nil {
+				var err error
+				s, err = NewScheduler(tt.config, len(tt.times))
+				require.NoError(t, err)
+			}
+
+			require.Equal(t, tt.expected, s.Starts(tt.times))
+			require.Equal(t, tt.duration, s.Duration(tt.times))
+		})
+	}
+}
+
+func TestRunForTimesCtxPowerBudget(t *testing.T) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw := NewTestHardware(4, rp)
+	s, err := NewScheduler(&cfg.PowerBudgetConfig{MaxPumps: 2}, 4)
+	require.NoError(t, err)
+	hw.SetScheduler(s)
+
+	mu := &sync.Mutex{}
+	numOn, maxOn := 0, 0
+	opts := RunOptions{Observer: func(idx int, state PumpState) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if state == Off {
+			numOn--
+		} else {
+			numOn++
+			maxOn = max(maxOn, numOn)
+		}
+	}}
+
+	times := []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 60 * time.Millisecond, 0}
+	start := time.Now()
+	ran, err := hw.RunForTimesCtx(context.Background(), Forward, times, opts)
+	require.NoError(t, err)
+	require.Equal(t, 2, maxOn)
+	require.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+	require.InDelta(t, PourDuration(hw, times), time.Since(start), float64(20*time.Millisecond))
+
+	for i := range times {
+		require.InDelta(t, times[i], ran[i], float64(10*time.Millisecond))
+	}
+}
+
+func TestSetScheduler(t *testing.T) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	s, err := NewScheduler(&cfg.PowerBudgetConfig{MaxPumps: 1}, 4)
+	require.NoError(t, err)
+
+	// the scheduler of wrapped hardware is set on the hardware it wraps
+	w, hw := newTestWatchdog(t, &cfg.WatchdogConfig{})
+	defer w.Close()
+
+	require.True(t, SupportsScheduling(w))
+	require.NoError(t, SetScheduler(w, s))
+	require.Same(t, s, hw.scheduler())
+
+	times := []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 0, 0}
+	require.Equal(t, 20*time.Millisecond, PourDuration(w, times))
+
+	require.False(t, SupportsScheduling(Null(rp)))
+	require.ErrorIs(t, SetScheduler(Null(rp), s), ErrSchedulerNotSupported)
+	require.Equal(t, 10*time.Millisecond, PourDuration(Null(rp), times))
+}
@@ -0,0 +1,28 @@
+package sequent
+
+import "github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+
+// AddFakeRelay8 adds an emulated Relay8 board at the given stack level to bus, at the board's alternate address if alt
+// is true. Like a real board its I/O pins start as inputs, and reading the input port returns the output port for pins
+// configured as outputs.
+func AddFakeRelay8(bus *i2c.FakeBus, stack byte, alt bool) *i2c.FakeDevice {
+	addr := (stack + relay8HwI2cBaseAddr) ^ 0x07
+	if alt {
+		addr = (stack + relay8HwI2cAltBaseAddr) ^ 0x07
+	}
+
+	dev := bus.AddDevice(addr)
+	dev.SetReg(relay8CfgRegAddr, 0xFF)
+	dev.OnWrite = func(regs *[256]byte, reg, value byte) {
+		if reg == relay8CfgRegAddr || reg == relay8OutportRegAddr {
+			regs[relay8InportRegAddr] = regs[relay8OutportRegAddr] &^ regs[relay8CfgRegAddr]
+		}
+	}
+
+	return dev
+}
+
+// FakeRelay8States returns the relay states read back from an emulated Relay8 board
+func FakeRelay8States(dev *i2c.FakeDevice) Relay8States {
+	return fromByte(dev.Reg(relay8InportRegAddr))
+}
@@ -1,8 +1,9 @@
 package sequent
 
 import (
+	"errors"
 	"fmt"
-	"github.com/d2r2/go-i2c"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
 	"github.com/d2r2/go-logger"
 	"log"
 	"strings"
@@ -102,9 +103,9 @@ func bytesAsHex(buff []byte) string {
 	return sb.String()
 }
 
-func boardCheck(hwAdd byte) (bool, error) {
+func boardCheck(bus i2c.Bus, hwAdd byte) (bool, error) {
 	hwAdd ^= 0x07
-	dev, err := i2c.NewI2C(hwAdd, 1)
+	dev, err := bus.Open(hwAdd)
 	if err != nil {
 		return false, fmt.Errorf("error creating I2C device: %w", err)
 	}
@@ -119,30 +120,34 @@ func boardCheck(hwAdd byte) (bool, error) {
 	return true, nil
 }
 
-func DeinitBoard(dev *i2c.I2C) {
+func DeinitBoard(dev i2c.Device) {
 	err := dev.Close()
 	if err != nil && verbose {
 		log.Println("error closing device:", err)
 	}
 }
 
-func InitBoard(stack byte) (*i2c.I2C, error) {
+// InitBoard opens the Relay8 board with the given stack level on bus, trying the board's alternate address if it isn't
+// found at its base address. Boards which haven't been initialized have every relay made an output and turned off.
+func InitBoard(bus i2c.Bus, stack byte) (i2c.Device, error) {
 	if stack < 0 || stack > 7 {
 		panic(fmt.Errorf("stack %d is not between 0 and 7", stack))
 	}
 
+	var buff []byte
+	var n int
 	addr := (stack + relay8HwI2cBaseAddr) ^ 0x07
-	dev, err := i2c.NewI2C(addr, 1)
-	if err != nil {
-		return nil, fmt.Errorf("error creating I2C device with addr 0x%x: %w", addr, err)
+	dev, err := bus.Open(addr)
+	if err == nil {
+		buff, n, err = dev.ReadRegBytes(relay8CfgRegAddr, 1)
+		if err != nil {
+			dev.Close()
+		}
 	}
 
-	buff, n, err := dev.ReadRegBytes(relay8CfgRegAddr, 1)
 	if err != nil {
-		dev.Close()
-
 		addr = (stack + relay8HwI2cAltBaseAddr) ^ 0x07
-		dev, err = i2c.NewI2C(addr, 1)
+		dev, err = bus.Open(addr)
 		if err != nil {
 			return nil, fmt.Errorf("error creating I2C device with addr 0x%x: %w", addr, err)
 		}
@@ -176,7 +181,7 @@ func InitBoard(stack byte) (*i2c.I2C, error) {
 	return dev, nil
 }
 
-func writeRelay8(dev *i2c.I2C, states byte) error {
+func writeRelay8(dev i2c.Device, states byte) error {
 	logf("writing states 0x%02x", states)
 	if err := dev.WriteRegU8(relay8OutportRegAddr, states); err != nil {
 		return fmt.Errorf("error writing to device: %w", err)
@@ -185,7 +190,7 @@ func writeRelay8(dev *i2c.I2C, states byte) error {
 	return nil
 }
 
-func readRelay8(dev *i2c.I2C) (byte, error) {
+func readRelay8(dev i2c.Device) (byte, error) {
 	buff, _, err := dev.ReadRegBytes(relay8InportRegAddr, 1)
 	if err != nil {
 		return 0, fmt.Errorf("error reading from device: %w", err)
@@ -194,30 +199,50 @@ func readRelay8(dev *i2c.I2C) (byte, error) {
 	return buff[0], nil
 }
 
-func UpdateBoard(dev *i2c.I2C, states Relay8States, attempts int) error {
+// ErrReadFailed is wrapped by the error returned from UpdateBoard when the board's relays couldn't be read back
+var ErrReadFailed = errors.New("error reading relays")
+
+// ErrWriteFailed is wrapped by the error returned from UpdateBoard when the board's relays couldn't be written
+var ErrWriteFailed = errors.New("error writing relays")
+
+// MismatchError is returned by UpdateBoard when the relays of a board never read back as the states written to it
+type MismatchError struct {
+	Desired Relay8States
+	Read    Relay8States
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("never achieved desired state 0x%02x, read 0x%02x", e.Desired.toByte(), e.Read.toByte())
+}
+
+// UpdateBoard writes the relay states to a board, reading the relays back and rewriting them until they match or it
+// runs out of attempts. If the final attempt fails the error wraps ErrReadFailed or ErrWriteFailed, and if the relays
+// never match it is a *MismatchError.
+func UpdateBoard(dev i2c.Device, states Relay8States, attempts int) error {
 	desired := states.toByte()
 
+	var lastRead byte
 	for i := attempts - 1; i >= 0; i-- {
 		read, err := readRelay8(dev)
 		if err != nil {
 			logf("error reading from device: %s", err.Error())
 			if i == 0 {
-				return fmt.Errorf("error reading from device: %w", err)
+				return fmt.Errorf("%w: %w", ErrReadFailed, err)
 			}
-		}
-
-		if read == desired {
+		} else if read == desired {
 			return nil
+		} else {
+			lastRead = read
 		}
 
 		err = writeRelay8(dev, desired)
 		if err != nil {
 			logf("error writing to device: %s", err.Error())
 			if i == 0 {
-				return fmt.Errorf("error writing to device: %w", err)
+				return fmt.Errorf("%w: %w", ErrWriteFailed, err)
 			}
 		}
 	}
 
-	return fmt.Errorf("never achieved desired state 0x%02x", desired)
+	return &MismatchError{Desired: states, Read: fromByte(lastRead)}
 }
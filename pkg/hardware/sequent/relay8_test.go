@@ -0,0 +1,112 @@
+package sequent
+
+import (
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRelay8States(t *testing.T) {
+	r8s := Relay8States{}
+	require.Equal(t, r8s, fromByte(0))
+	require.Equal(t, r8s.toByte(), byte(0))
+
+	// test that set does not mutate the original
+	_ = r8s.Set(0, relayOn)
+	require.Equal(t, r8s.toByte(), byte(0))
+
+	r8s = r8s.Set(0, relayOn)
+	require.Equal(t, r8s, fromByte(relayMaskRemap[0]))
+	require.Equal(t, r8s.toByte(), relayMaskRemap[0])
+
+	r8s = r8s.Set(4, relayOn)
+	require.Equal(t, r8s, fromByte(relayMaskRemap[0]|relayMaskRemap[4]))
+	require.Equal(t, r8s.toByte(), relayMaskRemap[0]|relayMaskRemap[4])
+
+	r8s = r8s.Set(0, relayOff)
+	require.Equal(t, r8s, fromByte(relayMaskRemap[4]))
+	require.Equal(t, r8s.toByte(), relayMaskRemap[4])
+}
+
+func TestInitBoard(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	base := AddFakeRelay8(bus, 0, false)
+	alt := AddFakeRelay8(bus, 1, true)
+
+	dev, err := InitBoard(bus, 0)
+	require.NoError(t, err)
+	require.Equal(t, byte(0), base.Reg(relay8CfgRegAddr))
+	require.Equal(t, byte(0), base.Reg(relay8OutportRegAddr))
+	DeinitBoard(dev)
+	require.True(t, base.Closed())
+
+	dev, err = InitBoard(bus, 1)
+	require.NoError(t, err)
+	require.Equal(t, byte(0), alt.Reg(relay8CfgRegAddr))
+	DeinitBoard(dev)
+
+	// boards that are already initialized keep their relay states
+	base.SetReg(relay8OutportRegAddr, 0x05)
+	writes := base.Writes()
+	_, err = InitBoard(bus, 0)
+	require.NoError(t, err)
+	require.Equal(t, writes, base.Writes())
+	require.Equal(t, byte(0x05), base.Reg(relay8OutportRegAddr))
+
+	_, err = InitBoard(bus, 2)
+	require.Error(t, err)
+
+	base.FailReads(1)
+	_, err = InitBoard(bus, 0)
+	require.Error(t, err)
+
+	ok, err := boardCheck(bus, relay8HwI2cBaseAddr)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestUpdateBoard(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	fake := AddFakeRelay8(bus, 0, false)
+
+	dev, err := InitBoard(bus, 0)
+	require.NoError(t, err)
+
+	states := Relay8States{}.Set(0, relayOn).Set(5, relayOn)
+	require.NoError(t, UpdateBoard(dev, states, 3))
+	require.Equal(t, states, FakeRelay8States(fake))
+
+	// writes that are lost or fail are retried until the relays read back as desired
+	states = states.Set(2, relayOn)
+	fake.IgnoreWrites(1)
+	fake.FailWrites(0)
+	require.NoError(t, UpdateBoard(dev, states, 3))
+	require.Equal(t, states, FakeRelay8States(fake))
+
+	states = states.Set(0, relayOff)
+	fake.FailWrites(1)
+	require.NoError(t, UpdateBoard(dev, states, 3))
+	require.Equal(t, states, FakeRelay8States(fake))
+
+	states = states.Set(7, relayOn)
+	fake.FailReads(1)
+	require.NoError(t, UpdateBoard(dev, states, 3))
+	require.Equal(t, states, FakeRelay8States(fake))
+
+	fake.IgnoreWrites(3)
+	err = UpdateBoard(dev, Relay8States{}, 3)
+	require.Error(t, err)
+	require.Equal(t, states, FakeRelay8States(fake))
+	var mismatch *MismatchError
+	require.ErrorAs(t, err, &mismatch)
+	require.Equal(t, Relay8States{}, mismatch.Desired)
+	require.Equal(t, states, mismatch.Read)
+
+	fake.FailReads(3)
+	err = UpdateBoard(dev, Relay8States{}, 3)
+	require.ErrorIs(t, err, ErrReadFailed)
+
+	fake.FailWrites(3)
+	err = UpdateBoard(dev, states, 3)
+	require.ErrorIs(t, err, ErrWriteFailed)
+}
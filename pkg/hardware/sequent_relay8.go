@@ -1,14 +1,161 @@
-//go:build !linux
-
 package hardware
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
 	"time"
+
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/sequent"
 )
 
+type relay8Board struct {
+	dev             i2c.Device
+	stack           byte
+	state           sequent.Relay8States
+	stateLastUpdate sequent.Relay8States
+	rp              *ReversePin
+	health          Health
+	err             error
+	mismatched      sequent.Relay8States
+}
+
+// setHealth records the health of the board from the result of updating it. When the relays don't read back as written
+// only the mismatched relays are faulted.
+func (b *relay8Board) setHealth(err error) {
+	b.err = err
+	b.mismatched = sequent.Relay8States{}
+
+	var mismatch *sequent.MismatchError
+	switch {
+	case err == nil:
+		b.health = Healthy
+	case errors.As(err, &mismatch):
+		b.health = ReadbackMismatch
+		for i := range b.mismatched {
+			b.mismatched[i] = mismatch.Desired[i] != mismatch.Read[i]
+		}
+	case errors.Is(err, sequent.ErrReadFailed):
+		b.health = Missing
+	default:
+		b.health = WriteFailed
+	}
+}
+
+// setMissing records that the board couldn't be found
+func (b *relay8Board) setMissing(err error) {
+	b.health = Missing
+	b.err = fmt.Errorf("board not found: %w", err)
+	b.mismatched = sequent.Relay8States{}
+}
+
+// relayHealth returns the health of a relay of the board
+func (b *relay8Board) relayHealth(relay int) Health {
+	if b.health == ReadbackMismatch && !b.mismatched[relay] {
+		return Healthy
+	}
+
+	return b.health
+}
+
+// relay8ReprobeInterval is how often missing boards are probed for by default
+const relay8ReprobeInterval = 5 * time.Second
+
+var _ Hardware = &SequentRelay8Hardware{}
+var _ HealthReporter = &SequentRelay8Hardware{}
+
+// SequentRelay8Hardware drives pumps from the relays of Sequent Microsystems Relay8 boards. Every update reads the
+// relays back, and boards that fail to reach their desired state are faulted until an update succeeds. Boards that are
+// missing are probed for again on update every reprobe interval.
 type SequentRelay8Hardware struct {
-	rp           *ReversePin
-	relayMapping []int
+	schedulerHolder
+
+	mu              *sync.Mutex
+	runMu           *sync.Mutex
+	bus             i2c.Bus
+	boards          []relay8Board
+	runTimes        []time.Duration
+	stateChangedAt  []time.Time
+	rp              *ReversePin
+	relayMapping    []int
+	reprobeInterval time.Duration
+	lastProbe       time.Time
+	now             func() time.Time
+}
+
+// NewSR8Hardware finds the Relay8 boards on bus at each of the 8 stack levels, failing if the number found isn't
+// expBoardCount
+func NewSR8Hardware(bus i2c.Bus, expBoardCount int, relayMapping []int, rp *ReversePin) (*SequentRelay8Hardware, error) {
+	var relay8s []relay8Board
+	for i := byte(0); i < 8; i++ {
+		dev, err := sequent.InitBoard(bus, i)
+		if err != nil {
+			continue
+		}
+
+		relay8s = append(relay8s, relay8Board{
+			dev:             dev,
+			stack:           i,
+			state:           sequent.Relay8States{},
+			stateLastUpdate: sequent.Relay8States{},
+			rp:              rp,
+		})
+	}
+
+	if len(relay8s) != expBoardCount {
+		return nil, fmt.Errorf("%d relay8 boards found. %d expected", len(relay8s), expBoardCount)
+	}
+
+	return newSR8Hardware(bus, relay8s, relayMapping, relay8ReprobeInterval, rp), nil
+}
+
+// NewDegradedSR8Hardware is like NewSR8Hardware, but expects the boards at stack levels 0 to expBoardCount-1 and starts
+// with whichever of them are found. The pumps of missing boards are unavailable until a re-probe finds the board. A
+// reprobeInterval of 0 re-probes every 5 seconds.
+func NewDegradedSR8Hardware(bus i2c.Bus, expBoardCount int, relayMapping []int, reprobeInterval time.Duration, rp *ReversePin) (*SequentRelay8Hardware, error) {
+	if expBoardCount < 1 || expBoardCount > 8 {
+		return nil, fmt.Errorf("expected board count %d is not between 1 and 8", expBoardCount)
+	} else if reprobeInterval <= 0 {
+		reprobeInterval = relay8ReprobeInterval
+	}
+
+	relay8s := make([]relay8Board, expBoardCount)
+	for i := range relay8s {
+		board := &relay8s[i]
+		board.stack = byte(i)
+		board.rp = rp
+
+		dev, err := sequent.InitBoard(bus, board.stack)
+		if err != nil {
+			log.Println(fmt.Errorf("relay8 board %d not found, its pumps are unavailable: %w", i, err))
+			board.setMissing(err)
+			continue
+		}
+
+		board.dev = dev
+	}
+
+	hw := newSR8Hardware(bus, relay8s, relayMapping, reprobeInterval, rp)
+	hw.lastProbe = hw.now()
+	return hw, nil
+}
+
+func newSR8Hardware(bus i2c.Bus, relay8s []relay8Board, relayMapping []int, reprobeInterval time.Duration, rp *ReversePin) *SequentRelay8Hardware {
+	return &SequentRelay8Hardware{
+		mu:              &sync.Mutex{},
+		runMu:           &sync.Mutex{},
+		bus:             bus,
+		boards:          relay8s,
+		runTimes:        make([]time.Duration, len(relay8s)*8),
+		stateChangedAt:  make([]time.Time, len(relay8s)*8),
+		rp:              rp,
+		relayMapping:    relayMapping,
+		reprobeInterval: reprobeInterval,
+		now:             time.Now,
+	}
 }
 
 func (s *SequentRelay8Hardware) Name() string {
@@ -16,39 +163,182 @@ func (s *SequentRelay8Hardware) Name() string {
 }
 
 func (s *SequentRelay8Hardware) Close() error {
+	for i := range s.boards {
+		board := &s.boards[i]
+		if board.dev != nil {
+			sequent.DeinitBoard(board.dev)
+			board.dev = nil
+		}
+	}
+
 	return nil
 }
 
 func (s *SequentRelay8Hardware) NumPumps() int {
-	return 0
+	return len(s.boards) * 8
 }
 
 func (s *SequentRelay8Hardware) Pump(idx int, state PumpState) error {
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pump(idx, state)
 }
 
 func (s *SequentRelay8Hardware) pump(idx int, state PumpState) error {
+	if idx < 0 || idx >= s.NumPumps() {
+		return fmt.Errorf("invalid pump index %d", idx)
+	}
+
+	relayIdx := s.relayMapping[idx]
+
+	boardIdx := relayIdx / 8
+	boardRelayIdx := relayIdx % 8
+
+	currOn := bool(s.boards[boardIdx].state.Get(boardRelayIdx))
+	newOn := state != Off
+	if newOn && !currOn {
+		if health := s.boards[boardIdx].relayHealth(boardRelayIdx); health != Healthy {
+			return fmt.Errorf("pump %d is %s: %w", idx, health, ErrPumpFaulted)
+		}
+	}
+
+	if currOn != newOn {
+		now := time.Now()
+		if currOn {
+			s.runTimes[relayIdx] += now.Sub(s.stateChangedAt[relayIdx])
+		}
+
+		s.stateChangedAt[relayIdx] = now
+	}
+
+	s.boards[boardIdx].state = s.boards[boardIdx].state.Set(boardRelayIdx, state != Off)
+
 	return nil
 }
 
-func (s *SequentRelay8Hardware) Update() {}
-func (s *SequentRelay8Hardware) update() {}
+func (s *SequentRelay8Hardware) Update() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.update()
+}
+
+// update writes the relays of boards whose state has changed, and retries boards that are faulted
+func (s *SequentRelay8Hardware) update() {
+	s.reprobe()
+
+	for i := range s.boards {
+		board := &s.boards[i]
+
+		if board.dev == nil || (board.state.Equal(board.stateLastUpdate) && board.health == Healthy) {
+			continue
+		}
+
+		err := sequent.UpdateBoard(board.dev, board.state, 10)
+		if err != nil {
+			log.Println(fmt.Errorf("error updating board %d: %w", board.stack, err))
+		}
+
+		board.setHealth(err)
+		board.stateLastUpdate = board.state
+	}
+}
+
+// reprobe initializes missing boards again, at most once every reprobe interval. Boards that are found are written on
+// the same update, restoring their relays.
+func (s *SequentRelay8Hardware) reprobe() {
+	if s.now().Sub(s.lastProbe) < s.reprobeInterval {
+		return
+	}
+
+	for i := range s.boards {
+		board := &s.boards[i]
+		if board.health != Missing {
+			continue
+		}
+
+		s.lastProbe = s.now()
+		if board.dev != nil {
+			sequent.DeinitBoard(board.dev)
+			board.dev = nil
+		}
+
+		dev, err := sequent.InitBoard(s.bus, board.stack)
+		if err != nil {
+			board.setMissing(err)
+			continue
+		}
+
+		log.Printf("relay8 board %d found", board.stack)
+		board.dev = dev
+	}
+}
+
+// Status returns the health of each pump and board as of the last update
+func (s *SequentRelay8Hardware) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := Status{
+		Pumps:  make([]Health, s.NumPumps()),
+		Boards: make([]BoardStatus, len(s.boards)),
+	}
+
+	for i := range s.boards {
+		board := &s.boards[i]
+		status.Boards[i] = BoardStatus{
+			Name:    fmt.Sprintf("relay8 stack %d", board.stack),
+			Present: board.dev != nil,
+			Health:  board.health,
+			Err:     board.err,
+		}
+	}
+
+	for idx, relayIdx := range s.relayMapping {
+		board := &s.boards[relayIdx/8]
+		status.Pumps[idx] = board.relayHealth(relayIdx % 8)
+		status.Boards[relayIdx/8].Pumps = append(status.Boards[relayIdx/8].Pumps, idx)
+	}
+
+	return status
+}
+
+func (s *SequentRelay8Hardware) pumpHealth(idx int) Health {
+	relayIdx := s.relayMapping[idx]
+	return s.boards[relayIdx/8].relayHealth(relayIdx % 8)
+}
 
 func (s *SequentRelay8Hardware) TimeRun(idx int) time.Duration {
-	return 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	relayIdx := s.relayMapping[idx]
+
+	return s.runTimes[relayIdx]
+}
+
+func (s *SequentRelay8Hardware) SetTimeRun(idx int, runtime time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	relayIdx := s.relayMapping[idx]
+
+	s.runTimes[relayIdx] = runtime
 }
 
 func (s *SequentRelay8Hardware) RunForTimes(direction PumpState, times []time.Duration) error {
-	return nil
+	_, err := s.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
 }
 
-func (s *SequentRelay8Hardware) GetReversePin() *ReversePin {
-	return s.rp
+func (s *SequentRelay8Hardware) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	return runForTimes(ctx, s, s.mu, direction, times, opts)
 }
 
-func NewSR8Hardware(expBoardCount int, relayMapping []int, rp *ReversePin) (*SequentRelay8Hardware, error) {
-	return &SequentRelay8Hardware{
-		rp:           rp,
-		relayMapping: relayMapping,
-	}, nil
+func (s *SequentRelay8Hardware) GetReversePin() *ReversePin {
+	return s.rp
 }
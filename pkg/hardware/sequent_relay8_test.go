@@ -0,0 +1,205 @@
+package hardware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/sequent"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequentRelay8Hardware(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	board0 := sequent.AddFakeRelay8(bus, 0, false)
+	board1 := sequent.AddFakeRelay8(bus, 1, true)
+
+	_, err := NewSR8Hardware(bus, 1, nil, nil)
+	require.Error(t, err)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	mapping := make([]int, 16)
+	for i := range mapping {
+		mapping[i] = 15 - i
+	}
+
+	hw, err := NewSR8Hardware(bus, 2, mapping, rp)
+	require.NoError(t, err)
+	require.Equal(t, 16, hw.NumPumps())
+
+	// pump changes are written when the hardware is updated
+	require.NoError(t, hw.Pump(0, Forward))
+	require.Equal(t, sequent.Relay8States{}, sequent.FakeRelay8States(board1))
+	hw.Update()
+	require.Equal(t, sequent.Relay8States{}.Set(7, true), sequent.FakeRelay8States(board1))
+
+	require.NoError(t, hw.Pump(0, Off))
+	hw.Update()
+
+	// lost writes are retried until the relays read back as desired
+	board0.IgnoreWrites(2)
+	ran, err := hw.RunForTimesCtx(context.Background(), Forward, []time.Duration{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 20 * time.Millisecond}, RunOptions{})
+	require.NoError(t, err)
+	require.InDelta(t, 20*time.Millisecond, ran[15], float64(10*time.Millisecond))
+	require.InDelta(t, 20*time.Millisecond, hw.TimeRun(15), float64(10*time.Millisecond))
+	require.Equal(t, sequent.Relay8States{}, sequent.FakeRelay8States(board0))
+
+	require.NoError(t, hw.Close())
+	require.True(t, board0.Closed())
+}
+
+func TestSequentRelay8HardwareHealth(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	board := sequent.AddFakeRelay8(bus, 0, false)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	mapping := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	hw, err := NewSR8Hardware(bus, 1, mapping, rp)
+	require.NoError(t, err)
+	defer hw.Close()
+
+	status := hw.Status()
+	require.Equal(t, make([]Health, 8), status.Pumps)
+	require.Len(t, status.Boards, 1)
+	require.Equal(t, "relay8 stack 0", status.Boards[0].Name)
+	require.Equal(t, Healthy, status.Boards[0].Health)
+	require.Equal(t, mapping, status.Boards[0].Pumps)
+
+	// a relay that never reads back as written faults only its pump
+	board.IgnoreWrites(10)
+	require.NoError(t, hw.Pump(2, Forward))
+	hw.Update()
+	status = hw.Status()
+	require.Equal(t, ReadbackMismatch, status.Boards[0].Health)
+	require.Error(t, status.Boards[0].Err)
+	require.Equal(t, ReadbackMismatch, status.Pumps[2])
+	require.Equal(t, Healthy, status.Pumps[3])
+	for i, health := range status.Pumps {
+		require.Equal(t, health, hw.pumpHealth(i))
+	}
+
+	require.NoError(t, hw.Pump(2, Off))
+	require.ErrorIs(t, hw.Pump(2, Forward), ErrPumpFaulted)
+	require.NoError(t, hw.Pump(3, Forward))
+	require.NoError(t, hw.Pump(3, Off))
+
+	times := make([]time.Duration, 8)
+	times[2] = 10 * time.Millisecond
+	require.ErrorIs(t, CheckPumps(hw, times), ErrPumpFaulted)
+	_, err = hw.RunForTimesCtx(context.Background(), Forward, times, RunOptions{})
+	require.ErrorIs(t, err, ErrPumpFaulted)
+
+	// faulted boards are retried on every update until they recover
+	hw.Update()
+	require.Equal(t, make([]Health, 8), hw.Status().Pumps)
+	require.NoError(t, CheckPumps(hw, times))
+
+	board.FailReads(10)
+	require.NoError(t, hw.Pump(0, Forward))
+	hw.Update()
+	require.Equal(t, Missing, hw.Status().Boards[0].Health)
+	require.Equal(t, Missing, hw.Status().Pumps[7])
+
+	board.FailWrites(10)
+	require.NoError(t, hw.Pump(0, Off))
+	hw.Update()
+	require.Equal(t, WriteFailed, hw.Status().Boards[0].Health)
+
+	hw.Update()
+	require.Equal(t, Healthy, hw.Status().Boards[0].Health)
+	require.Nil(t, hw.Status().Boards[0].Err)
+}
+
+func TestRunForTimesStopsOnFault(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	board := sequent.AddFakeRelay8(bus, 0, false)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw, err := NewSR8Hardware(bus, 1, []int{0, 1, 2, 3, 4, 5, 6, 7}, rp)
+	require.NoError(t, err)
+	defer hw.Close()
+
+	// the board stops responding once the pumps have started, which is found when pump 5 is turned off
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		board.FailReads(1000)
+	}()
+
+	times := make([]time.Duration, 8)
+	times[4] = time.Second
+	times[5] = 50 * time.Millisecond
+	start := time.Now()
+	_, err = hw.RunForTimesCtx(context.Background(), Forward, times, RunOptions{})
+	require.ErrorIs(t, err, ErrPumpFaulted)
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestDegradedSequentRelay8Hardware(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	board0 := sequent.AddFakeRelay8(bus, 0, false)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	_, err = NewDegradedSR8Hardware(bus, 0, nil, 0, rp)
+	require.Error(t, err)
+
+	mapping := make([]int, 16)
+	for i := range mapping {
+		mapping[i] = i
+	}
+
+	hw, err := NewDegradedSR8Hardware(bus, 2, mapping, 20*time.Millisecond, rp)
+	require.NoError(t, err)
+	defer hw.Close()
+
+	// re-probes follow a fake clock so the test doesn't depend on how long updates take
+	clock := hw.lastProbe
+	hw.now = func() time.Time {
+		return clock
+	}
+	require.Equal(t, 16, hw.NumPumps())
+
+	status := hw.Status()
+	require.True(t, status.Boards[0].Present)
+	require.Equal(t, Healthy, status.Boards[0].Health)
+	require.False(t, status.Boards[1].Present)
+	require.Equal(t, Missing, status.Boards[1].Health)
+	require.Error(t, status.Boards[1].Err)
+	require.Equal(t, Healthy, status.Pumps[7])
+	require.Equal(t, Missing, status.Pumps[8])
+
+	// pumps on the boards that were found still work
+	require.ErrorIs(t, hw.Pump(8, Forward), ErrPumpFaulted)
+	require.NoError(t, hw.Pump(8, Off))
+	require.NoError(t, hw.Pump(1, Forward))
+	hw.Update()
+	require.Equal(t, sequent.Relay8States{}.Set(1, true), sequent.FakeRelay8States(board0))
+	require.NoError(t, hw.Pump(1, Off))
+	hw.Update()
+
+	// the missing board is found by a re-probe once it is connected
+	board1 := sequent.AddFakeRelay8(bus, 1, false)
+	hw.Update()
+	require.False(t, hw.Status().Boards[1].Present)
+
+	clock = clock.Add(20 * time.Millisecond)
+	hw.Update()
+	status = hw.Status()
+	require.True(t, status.Boards[1].Present)
+	require.Equal(t, Healthy, status.Boards[1].Health)
+	require.Equal(t, make([]Health, 16), status.Pumps)
+
+	require.NoError(t, hw.Pump(8, Forward))
+	hw.Update()
+	require.Equal(t, sequent.Relay8States{}.Set(0, true), sequent.FakeRelay8States(board1))
+	require.NoError(t, hw.Pump(8, Off))
+	hw.Update()
+}
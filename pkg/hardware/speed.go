@@ -0,0 +1,137 @@
+package hardware
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// FullSpeed is the speed of a pump running flat out
+const FullSpeed = 1.0
+
+// ErrSpeedNotSupported is returned when a speed is requested from hardware that can't vary the speed of its pumps
+var ErrSpeedNotSupported = errors.New("hardware does not support pump speed")
+
+// SpeedController is implemented by hardware that can run pumps at less than full speed. Speeds are a fraction of full
+// speed greater than 0 and at most 1, and apply whenever the pump is on.
+type SpeedController interface {
+	// SetPumpSpeed sets the speed a pump runs at
+	SetPumpSpeed(idx int, speed float64) error
+
+	// setPumpSpeed is a lock free version of SetPumpSpeed for package internal use
+	setPumpSpeed(idx int, speed float64) error
+}
+
+// SupportsSpeed returns true if the pumps of hw can run at less than full speed
+func SupportsSpeed(hw Hardware) bool {
+	_, ok := unwrap(hw).(SpeedController)
+	return ok
+}
+
+// SetPumpSpeed sets the speed a pump runs at, returning ErrSpeedNotSupported if hw can't vary its pump speed
+func SetPumpSpeed(hw Hardware, idx int, speed float64) error {
+	sc, ok := unwrap(hw).(SpeedController)
+	if !ok {
+		return ErrSpeedNotSupported
+	}
+
+	return sc.SetPumpSpeed(idx, speed)
+}
+
+func validateSpeed(speed float64) error {
+	if speed <= 0 || speed > FullSpeed {
+		return fmt.Errorf("invalid pump speed %f: must be greater than 0 and at most 1", speed)
+	}
+
+	return nil
+}
+
+// SpeedProfile is how fast a pump runs during a pour. The pump runs at Speed, then slows to FinishSpeed for the final
+// FinishDuration of its run time. A Speed or FinishSpeed of 0 is full speed.
+type SpeedProfile struct {
+	Speed          float64
+	FinishSpeed    float64
+	FinishDuration time.Duration
+}
+
+// speedAt returns the speed a pump that runs for runTime should be at once it has been running for elapsed
+func (sp SpeedProfile) speedAt(elapsed, runTime time.Duration) float64 {
+	if sp.FinishDuration > 0 && elapsed >= runTime-sp.FinishDuration {
+		return speedOrFull(sp.FinishSpeed)
+	}
+
+	return speedOrFull(sp.Speed)
+}
+
+func speedOrFull(speed float64) float64 {
+	if speed <= 0 {
+		return FullSpeed
+	}
+
+	return speed
+}
+
+// pumpSpeeds tracks the speed of each pump during runForTimes so that speeds are only written when they change
+type pumpSpeeds struct {
+	sc       SpeedController
+	profiles []SpeedProfile
+	current  []float64
+}
+
+func newPumpSpeeds(hw Hardware, profiles []SpeedProfile) *pumpSpeeds {
+	sc, _ := hw.(SpeedController)
+	if sc == nil || profiles == nil {
+		return nil
+	}
+
+	// pumps are assumed to be at full speed, as every run returns them to it
+	current := make([]float64, hw.NumPumps())
+	for i := range current {
+		current[i] = FullSpeed
+	}
+
+	return &pumpSpeeds{sc: sc, profiles: profiles, current: current}
+}
+
+// update sets the speed of pump idx for how long it has been running
+func (ps *pumpSpeeds) update(idx int, elapsed, runTime time.Duration) error {
+	if ps == nil {
+		return nil
+	}
+
+	speed := FullSpeed
+	if idx < len(ps.profiles) {
+		speed = ps.profiles[idx].speedAt(elapsed, runTime)
+	}
+
+	if speed == ps.current[idx] {
+		return nil
+	}
+
+	err := ps.sc.setPumpSpeed(idx, speed)
+	if err != nil {
+		return fmt.Errorf("error setting pump %d speed: %w", idx, err)
+	}
+
+	ps.current[idx] = speed
+	return nil
+}
+
+// reset returns every pump that isn't at full speed to full speed
+func (ps *pumpSpeeds) reset() error {
+	if ps == nil {
+		return nil
+	}
+
+	var firstErr error
+	for i, speed := range ps.current {
+		if speed != FullSpeed {
+			err := ps.sc.setPumpSpeed(i, FullSpeed)
+			if firstErr == nil && err != nil {
+				firstErr = fmt.Errorf("error resetting pump %d speed: %w", i, err)
+			}
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,87 @@
+package hardware
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunForTimesCtxSpeedProfiles(t *testing.T) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw := NewTestHardware(4, rp)
+	require.True(t, SupportsSpeed(hw))
+	require.False(t, SupportsSpeed(Null(rp)))
+	require.ErrorIs(t, SetPumpSpeed(Null(rp), 0, 0.5), ErrSpeedNotSupported)
+	require.Error(t, hw.SetPumpSpeed(0, 0))
+	require.Error(t, hw.SetPumpSpeed(0, 1.5))
+
+	opts := RunOptions{Profiles: []SpeedProfile{
+		{Speed: 0.8, FinishSpeed: 0.2, FinishDuration: 30 * time.Millisecond},
+		{Speed: 0.5},
+		{},
+	}}
+	times := []time.Duration{60 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond}
+	_, err = hw.RunForTimesCtx(context.Background(), Forward, times, opts)
+	require.NoError(t, err)
+
+	require.Equal(t, []float64{0.8, 0.2, FullSpeed}, hw.SpeedChanges(0))
+	require.Equal(t, []float64{0.5, FullSpeed}, hw.SpeedChanges(1))
+	require.Empty(t, hw.SpeedChanges(2))
+	require.Empty(t, hw.SpeedChanges(3))
+
+	_, err = hw.RunForTimesCtx(context.Background(), Forward, times, RunOptions{})
+	require.NoError(t, err)
+	require.Len(t, hw.SpeedChanges(0), 3)
+}
+
+func TestPwmHardware(t *testing.T) {
+	chipDir := t.TempDir()
+	for _, ch := range []int{0, 2} {
+		require.NoError(t, os.Mkdir(filepath.Join(chipDir, fmt.Sprintf("pwm%d", ch)), 0755))
+	}
+
+	readSysfs := func(ch int, name string) string {
+		data, err := os.ReadFile(filepath.Join(chipDir, fmt.Sprintf("pwm%d", ch), name))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	_, err := NewPwmHardware(chipDir, []int{0, 1}, 1000, nil)
+	require.Error(t, err)
+
+	_, err = NewPwmHardware(chipDir, []int{0}, -1, nil)
+	require.Error(t, err)
+
+	pwm, err := NewPwmHardware(chipDir, []int{2, 0}, 2000, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, pwm.NumPumps())
+	require.Equal(t, "500000", readSysfs(2, "period"))
+	require.Equal(t, "0", readSysfs(2, "duty_cycle"))
+	require.Equal(t, "1", readSysfs(2, "enable"))
+
+	require.NoError(t, pwm.Pump(0, Forward))
+	require.Equal(t, "500000", readSysfs(2, "duty_cycle"))
+
+	require.NoError(t, pwm.SetPumpSpeed(0, 0.5))
+	require.Equal(t, "250000", readSysfs(2, "duty_cycle"))
+
+	require.NoError(t, pwm.SetPumpSpeed(1, 0.25))
+	require.Equal(t, "0", readSysfs(0, "duty_cycle"))
+	require.NoError(t, pwm.Pump(1, Forward))
+	require.Equal(t, "125000", readSysfs(0, "duty_cycle"))
+
+	require.NoError(t, pwm.Pump(0, Off))
+	require.Equal(t, "0", readSysfs(2, "duty_cycle"))
+	require.Error(t, pwm.Pump(0, Backward))
+	require.Error(t, pwm.SetPumpSpeed(2, 0.5))
+
+	require.NoError(t, pwm.Close())
+	require.Equal(t, "0", readSysfs(0, "enable"))
+}
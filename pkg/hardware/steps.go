@@ -0,0 +1,59 @@
+package hardware
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PourStep is a set of pump run times that are run together. Delay is how long to wait before the step starts.
+// Profiles optionally gives the speed profile of each pump in the step, see RunOptions.
+type PourStep struct {
+	Delay    time.Duration
+	Times    []time.Duration
+	Profiles []SpeedProfile
+}
+
+// RunStepsCtx runs each step with RunForTimesCtx and opts after waiting for its delay, using the profiles of the step
+// if it has any. Pumps within a step run in parallel, and a step doesn't start until every pump in the previous step has
+// finished. It returns how long each pump ran in total across all steps.
+func RunStepsCtx(ctx context.Context, hw Hardware, direction PumpState, steps []PourStep, opts RunOptions) ([]time.Duration, error) {
+	ran := make([]time.Duration, hw.NumPumps())
+	for _, step := range steps {
+		if step.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ran, fmt.Errorf("pour cancelled: %w", ctx.Err())
+			case <-time.After(step.Delay):
+			}
+		}
+
+		stepOpts := opts
+		if step.Profiles != nil {
+			stepOpts.Profiles = step.Profiles
+		}
+
+		stepRan, err := hw.RunForTimesCtx(ctx, direction, step.Times, stepOpts)
+		for i := range stepRan {
+			if i < len(ran) {
+				ran[i] += stepRan[i]
+			}
+		}
+
+		if err != nil {
+			return ran, err
+		}
+	}
+
+	return ran, nil
+}
+
+// StepsDuration returns how long running the steps on hw takes, including the delays between them
+func StepsDuration(hw Hardware, steps []PourStep) time.Duration {
+	var total time.Duration
+	for _, step := range steps {
+		total += step.Delay + PourDuration(hw, step.Times)
+	}
+
+	return total
+}
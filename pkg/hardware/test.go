@@ -1,28 +1,41 @@
 package hardware
 
 import (
+	"context"
 	"sync"
 	"time"
 )
 
 // Hardware interface is the interface for interacting with the pumps and other Barpi hardware
 type TestHardware struct {
+	schedulerHolder
+
 	mu        *sync.Mutex
+	runMu     *sync.Mutex
 	numPumps  int
 	state     []PumpState
 	runTimes  []time.Duration
 	changedAt []time.Time
 	rp        *ReversePin
+	speeds    [][]float64
+	dirMu     *sync.Mutex
+	hasDir    []bool
+	health    []Health
 }
 
 func NewTestHardware(numPumps int, rp *ReversePin) *TestHardware {
 	return &TestHardware{
 		mu:        &sync.Mutex{},
+		runMu:     &sync.Mutex{},
 		numPumps:  numPumps,
 		state:     make([]PumpState, 8),
 		runTimes:  make([]time.Duration, 8),
 		changedAt: make([]time.Time, 8),
 		rp:        rp,
+		speeds:    make([][]float64, 8),
+		dirMu:     &sync.Mutex{},
+		hasDir:    make([]bool, 8),
+		health:    make([]Health, 8),
 	}
 }
 
@@ -62,7 +75,7 @@ func (thw *TestHardware) pump(idx int, state PumpState) error {
 		return nil
 	}
 
-	if currState == Forward {
+	if currState.running() {
 		thw.runTimes[idx] += time.Now().Sub(thw.changedAt[idx])
 	}
 
@@ -88,13 +101,83 @@ func (thw *TestHardware) TimeRun(idx int) time.Duration {
 	return thw.runTimes[idx]
 }
 
+func (thw *TestHardware) SetTimeRun(idx int, runtime time.Duration) {
+	thw.SetRuntime(idx, runtime)
+}
+
 func (thw *TestHardware) RunForTimes(direction PumpState, times []time.Duration) error {
-	thw.mu.Lock()
-	defer thw.mu.Unlock()
+	_, err := thw.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
+}
+
+func (thw *TestHardware) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	thw.runMu.Lock()
+	defer thw.runMu.Unlock()
 
-	return runForTimes(thw, direction, times)
+	return runForTimes(ctx, thw, thw.mu, direction, times, opts)
 }
 
 func (thw *TestHardware) GetReversePin() *ReversePin {
 	return thw.rp
 }
+
+// SetPumpSpeed sets the speed a pump runs at
+func (thw *TestHardware) SetPumpSpeed(idx int, speed float64) error {
+	thw.mu.Lock()
+	defer thw.mu.Unlock()
+
+	return thw.setPumpSpeed(idx, speed)
+}
+
+func (thw *TestHardware) setPumpSpeed(idx int, speed float64) error {
+	if err := validateSpeed(speed); err != nil {
+		return err
+	}
+
+	thw.speeds[idx] = append(thw.speeds[idx], speed)
+	return nil
+}
+
+// SpeedChanges returns every speed a pump has been set to, in order
+func (thw *TestHardware) SpeedChanges(idx int) []float64 {
+	thw.mu.Lock()
+	defer thw.mu.Unlock()
+
+	return append([]float64(nil), thw.speeds[idx]...)
+}
+
+// SetHasPumpDirection sets whether a pump sets its own direction
+func (thw *TestHardware) SetHasPumpDirection(idx int, hasDir bool) {
+	thw.dirMu.Lock()
+	defer thw.dirMu.Unlock()
+
+	thw.hasDir[idx] = hasDir
+}
+
+// HasPumpDirection returns true if the pump was given direction control with SetHasPumpDirection
+func (thw *TestHardware) HasPumpDirection(idx int) bool {
+	thw.dirMu.Lock()
+	defer thw.dirMu.Unlock()
+
+	return thw.hasDir[idx]
+}
+
+// SetPumpHealth sets the health reported for a pump
+func (thw *TestHardware) SetPumpHealth(idx int, health Health) {
+	thw.mu.Lock()
+	defer thw.mu.Unlock()
+
+	thw.health[idx] = health
+}
+
+// Status returns the pump health set with SetPumpHealth. TestHardware has no boards.
+func (thw *TestHardware) Status() Status {
+	thw.mu.Lock()
+	defer thw.mu.Unlock()
+
+	return Status{Pumps: append([]Health(nil), thw.health[:thw.numPumps]...)}
+}
+
+func (thw *TestHardware) pumpHealth(idx int) Health {
+	return thw.health[idx]
+}
@@ -0,0 +1,307 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+)
+
+const (
+	// watchdogInterval is how often the watchdog checks its limits
+	watchdogInterval = 20 * time.Millisecond
+
+	// watchdogKickInterval is how often the watchdog device is kicked
+	watchdogKickInterval = time.Second
+)
+
+// ErrWatchdog is wrapped by the errors returned when the watchdog stops or refuses to run a pump
+var ErrWatchdog = errors.New("watchdog")
+
+// Watchdog wraps hardware and forces its pumps off independently of whatever turned them on. A pump that is on for
+// longer than the maximum pump on time is forced off, and can't be turned on again until it has been turned off. A pour
+// that runs for longer than the maximum pour time is stopped. If heartbeats stop for longer than the heartbeat timeout
+// every pump is forced off, and none can be turned on until they resume. Heartbeats are sent by calling Heartbeat, and
+// by pours while they run.
+//
+// If a watchdog device is configured, it is kicked only while heartbeats are being received so that a process that
+// hangs, or a watchdog that can't turn the pumps off, triggers a hardware reset.
+type Watchdog struct {
+	Hardware
+
+	maxPumpOn        time.Duration
+	maxPour          time.Duration
+	heartbeatTimeout time.Duration
+	device           io.WriteCloser
+
+	mu       *sync.Mutex
+	onSince  []time.Time
+	tripped  []bool
+	lastBeat time.Time
+	stale    bool
+	lastKick time.Time
+	pours    pourRegistry
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+var _ Hardware = (*Watchdog)(nil)
+
+// NewWatchdog wraps hw in a Watchdog enforcing the limits of config, and starts it
+func NewWatchdog(hw Hardware, config *cfg.WatchdogConfig) (*Watchdog, error) {
+	numPumps := hw.NumPumps()
+	w := &Watchdog{
+		Hardware:         hw,
+		maxPumpOn:        time.Duration(config.MaxPumpOnTimeMs) * time.Millisecond,
+		maxPour:          time.Duration(config.MaxPourTimeMs) * time.Millisecond,
+		heartbeatTimeout: time.Duration(config.HeartbeatTimeoutMs) * time.Millisecond,
+		mu:               &sync.Mutex{},
+		onSince:          make([]time.Time, numPumps),
+		tripped:          make([]bool, numPumps),
+		lastBeat:         time.Now(),
+		done:             make(chan struct{}),
+		stopped:          make(chan struct{}),
+	}
+
+	if config.Device != "" {
+		dev, err := os.OpenFile(config.Device, os.O_WRONLY, 0)
+		if err != nil {
+			return nil, fmt.Errorf("error opening watchdog device %s: %w", config.Device, err)
+		}
+
+		w.device = dev
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Unwrap returns the hardware the watchdog wraps
+func (w *Watchdog) Unwrap() Hardware {
+	return w.Hardware
+}
+
+// Heartbeat tells the watchdog that the process is still running
+func (w *Watchdog) Heartbeat() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.lastBeat = time.Now()
+}
+
+// Close stops the watchdog, disarming the watchdog device, and closes the hardware it wraps
+func (w *Watchdog) Close() error {
+	close(w.done)
+	<-w.stopped
+
+	if w.device != nil {
+		// writing the magic character before closing disarms the device, so a clean shutdown doesn't reset
+		if _, err := w.device.Write([]byte("V")); err != nil {
+			log.Println("error disarming watchdog device:", err)
+		}
+
+		if err := w.device.Close(); err != nil {
+			log.Println("error closing watchdog device:", err)
+		}
+	}
+
+	return w.Hardware.Close()
+}
+
+func (w *Watchdog) Pump(idx int, state PumpState) error {
+	if state != Off {
+		if err := w.checkRun(idx); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Hardware.Pump(idx, state); err != nil {
+		return err
+	}
+
+	w.pumpChanged(idx, state)
+	return nil
+}
+
+func (w *Watchdog) RunForTimes(direction PumpState, times []time.Duration) error {
+	_, err := w.RunForTimesCtx(context.Background(), direction, times, RunOptions{})
+	return err
+}
+
+func (w *Watchdog) RunForTimesCtx(ctx context.Context, direction PumpState, times []time.Duration, opts RunOptions) ([]time.Duration, error) {
+	for i, t := range times {
+		if t <= 0 {
+			continue
+		} else if w.maxPumpOn > 0 && t > w.maxPumpOn {
+			return nil, fmt.Errorf("pump %d would run for %s which is longer than the maximum pump on time of %s: %w", i, t, w.maxPumpOn, ErrWatchdog)
+		} else if err := w.checkRun(i); err != nil {
+			return nil, err
+		}
+	}
+
+	pourCtx, stop := w.pours.add(ctx)
+	defer stop(nil)
+
+	if w.maxPour > 0 {
+		timer := time.AfterFunc(w.maxPour, func() {
+			log.Printf("watchdog: stopping pour that ran for longer than %s", w.maxPour)
+			stop(fmt.Errorf("pour ran for longer than the maximum pour time of %s: %w", w.maxPour, ErrWatchdog))
+		})
+		defer timer.Stop()
+	}
+
+	wrappedOpts := opts
+	wrappedOpts.Observer = func(idx int, state PumpState) {
+		w.pumpChanged(idx, state)
+		opts.notify(idx, state)
+	}
+	wrappedOpts.heartbeat = w.Heartbeat
+
+	ran, err := w.Hardware.RunForTimesCtx(pourCtx, direction, times, wrappedOpts)
+	return ran, pourStoppedErr(ctx, err, context.Cause(pourCtx))
+}
+
+// checkRun returns an error if the watchdog won't allow pump idx to be turned on
+func (w *Watchdog) checkRun(idx int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stale {
+		return fmt.Errorf("pump %d can't run as heartbeats have stopped: %w", idx, ErrWatchdog)
+	} else if idx >= 0 && idx < len(w.tripped) && w.tripped[idx] {
+		return fmt.Errorf("pump %d was forced off and must be turned off before it can run again: %w", idx, ErrWatchdog)
+	}
+
+	return nil
+}
+
+// pumpChanged records when pump idx was turned on, and clears its trip once it has been turned off
+func (w *Watchdog) pumpChanged(idx int, state PumpState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if idx < 0 || idx >= len(w.onSince) {
+		return
+	}
+
+	if state == Off {
+		w.onSince[idx] = time.Time{}
+		w.tripped[idx] = false
+	} else if w.onSince[idx].IsZero() {
+		w.onSince[idx] = time.Now()
+	}
+}
+
+func (w *Watchdog) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		w.check(time.Now())
+	}
+}
+
+// check forces off any pump that has been on for too long, and every pump if heartbeats have stopped, then kicks the
+// watchdog device if heartbeats are being received. Pumps are forced off through the wrapped hardware, so if it is hung
+// check blocks and the device stops being kicked.
+func (w *Watchdog) check(now time.Time) {
+	w.mu.Lock()
+	var overdue []int
+	for i, since := range w.onSince {
+		if w.maxPumpOn > 0 && !since.IsZero() && now.Sub(since) > w.maxPumpOn {
+			overdue = append(overdue, i)
+			w.tripped[i] = true
+		}
+	}
+
+	stale := w.heartbeatTimeout > 0 && now.Sub(w.lastBeat) > w.heartbeatTimeout
+	stopped := stale && !w.stale
+	w.stale = stale
+	w.mu.Unlock()
+
+	var cause error
+	if stopped {
+		log.Printf("watchdog: no heartbeat for %s, forcing all pumps off", w.heartbeatTimeout)
+		cause = fmt.Errorf("heartbeats stopped: %w", ErrWatchdog)
+	} else if len(overdue) > 0 {
+		log.Printf("watchdog: pumps %v were on for longer than %s, forcing them off", overdue, w.maxPumpOn)
+		cause = fmt.Errorf("pump %d was on for longer than the maximum pump on time of %s: %w", overdue[0], w.maxPumpOn, ErrWatchdog)
+	}
+
+	if cause != nil {
+		w.pours.stopAll(cause)
+	}
+
+	if stopped {
+		for i := 0; i < w.NumPumps(); i++ {
+			w.forceOff(i)
+		}
+	} else {
+		for _, i := range overdue {
+			w.forceOff(i)
+		}
+	}
+
+	// hardware that stages pump changes only writes them on update, which the stalled process may never call
+	if cause != nil {
+		w.Hardware.Update()
+	}
+
+	if !stale {
+		w.kick(now)
+	}
+}
+
+// forceOff turns pump idx off without clearing its trip
+func (w *Watchdog) forceOff(idx int) {
+	if err := w.Hardware.Pump(idx, Off); err != nil {
+		log.Printf("watchdog: error forcing pump %d off: %s", idx, err.Error())
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.onSince[idx] = time.Time{}
+}
+
+func (w *Watchdog) kick(now time.Time) {
+	if w.device == nil || now.Sub(w.lastKick) < watchdogKickInterval {
+		return
+	}
+
+	if _, err := w.device.Write([]byte{0}); err != nil {
+		log.Println("error kicking watchdog device:", err)
+		return
+	}
+
+	w.lastKick = now
+}
+
+// unwrap returns the hardware wrapped by hw, such as by a Watchdog, so that the optional interfaces of the wrapped
+// hardware are found
+func unwrap(hw Hardware) Hardware {
+	for {
+		u, ok := hw.(interface{ Unwrap() Hardware })
+		if !ok {
+			return hw
+		}
+
+		hw = u.Unwrap()
+	}
+}
@@ -0,0 +1,181 @@
+package hardware
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cfg "github.com/cocktailrobots/openbar-server/pkg/config"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/i2c"
+	"github.com/cocktailrobots/openbar-server/pkg/hardware/sequent"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWatchdog(t *testing.T, config *cfg.WatchdogConfig) (*Watchdog, *TestHardware) {
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	hw := NewTestHardware(4, rp)
+	w, err := NewWatchdog(hw, config)
+	require.NoError(t, err)
+	return w, hw
+}
+
+func testPumpState(hw *TestHardware, idx int) PumpState {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+
+	return hw.state[idx]
+}
+
+func TestWatchdogMaxPumpOnTime(t *testing.T) {
+	w, hw := newTestWatchdog(t, &cfg.WatchdogConfig{MaxPumpOnTimeMs: 50})
+	defer w.Close()
+
+	require.NoError(t, w.Pump(0, Forward))
+	require.NoError(t, w.Pump(1, Forward))
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, w.Pump(1, Off))
+	require.Equal(t, Forward, testPumpState(hw, 0))
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, Off, testPumpState(hw, 0))
+	require.Equal(t, Off, testPumpState(hw, 1))
+
+	// a pump that was forced off can't run until it is turned off
+	err := w.Pump(0, Forward)
+	require.True(t, errors.Is(err, ErrWatchdog))
+	_, err = w.RunForTimesCtx(context.Background(), Forward, []time.Duration{10 * time.Millisecond, 0, 0, 0}, RunOptions{})
+	require.True(t, errors.Is(err, ErrWatchdog))
+	require.NoError(t, w.Pump(1, Forward))
+	require.NoError(t, w.Pump(1, Off))
+
+	require.NoError(t, w.Pump(0, Off))
+	require.NoError(t, w.Pump(0, Forward))
+	require.NoError(t, w.Pump(0, Off))
+
+	// runs longer than the maximum pump on time are refused
+	_, err = w.RunForTimesCtx(context.Background(), Forward, []time.Duration{0, 100 * time.Millisecond, 0, 0}, RunOptions{})
+	require.True(t, errors.Is(err, ErrWatchdog))
+
+	ran, err := w.RunForTimesCtx(context.Background(), Forward, []time.Duration{0, 30 * time.Millisecond, 0, 0}, RunOptions{})
+	require.NoError(t, err)
+	require.InDelta(t, 30*time.Millisecond, ran[1], float64(10*time.Millisecond))
+}
+
+func TestWatchdogMaxPourTime(t *testing.T) {
+	w, hw := newTestWatchdog(t, &cfg.WatchdogConfig{MaxPourTimeMs: 50})
+	defer w.Close()
+
+	var changes []PumpState
+	opts := RunOptions{Observer: func(idx int, state PumpState) {
+		changes = append(changes, state)
+	}}
+
+	start := time.Now()
+	ran, err := w.RunForTimesCtx(context.Background(), Forward, []time.Duration{time.Second, 0, 0, 0}, opts)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrWatchdog))
+	require.False(t, errors.Is(err, context.Canceled))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	require.InDelta(t, 50*time.Millisecond, ran[0], float64(20*time.Millisecond))
+	require.Equal(t, Off, testPumpState(hw, 0))
+	require.Equal(t, []PumpState{Forward, Off}, changes)
+
+	// cancelling the pour is still reported as a cancellation
+	cancelCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = w.RunForTimesCtx(cancelCtx, Forward, []time.Duration{time.Second, 0, 0, 0}, RunOptions{})
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.False(t, errors.Is(err, ErrWatchdog))
+}
+
+func TestWatchdogHeartbeat(t *testing.T) {
+	w, hw := newTestWatchdog(t, &cfg.WatchdogConfig{HeartbeatTimeoutMs: 50})
+	defer w.Close()
+
+	require.NoError(t, w.Pump(0, Forward))
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		w.Heartbeat()
+	}
+	require.Equal(t, Forward, testPumpState(hw, 0))
+
+	// pours send heartbeats while they run
+	_, err := w.RunForTimesCtx(context.Background(), Forward, []time.Duration{0, 150 * time.Millisecond, 0, 0}, RunOptions{})
+	require.NoError(t, err)
+	require.NoError(t, w.Pump(0, Forward))
+
+	time.Sleep(120 * time.Millisecond)
+	require.Equal(t, Off, testPumpState(hw, 0))
+	require.True(t, errors.Is(w.Pump(0, Forward), ErrWatchdog))
+
+	w.Heartbeat()
+	time.Sleep(2 * watchdogInterval)
+	require.NoError(t, w.Pump(0, Forward))
+}
+
+func TestWatchdogUpdatesHardware(t *testing.T) {
+	bus := i2c.NewFakeBus()
+	board := sequent.AddFakeRelay8(bus, 0, false)
+
+	rp, err := NewReversePin(nil, nil)
+	require.NoError(t, err)
+
+	mapping := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	hw, err := NewSR8Hardware(bus, 1, mapping, rp)
+	require.NoError(t, err)
+
+	w, err := NewWatchdog(hw, &cfg.WatchdogConfig{HeartbeatTimeoutMs: 50})
+	require.NoError(t, err)
+	defer w.Close()
+
+	require.NoError(t, w.Pump(2, Forward))
+	w.Update()
+	require.Equal(t, sequent.Relay8States{}.Set(2, true), sequent.FakeRelay8States(board))
+
+	// the relays are cleared when heartbeats stop, without anything else updating the hardware
+	require.Eventually(t, func() bool {
+		return sequent.FakeRelay8States(board) == sequent.Relay8States{}
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWatchdogDevice(t *testing.T) {
+	device := filepath.Join(t.TempDir(), "watchdog")
+	require.NoError(t, os.WriteFile(device, nil, 0644))
+
+	w, _ := newTestWatchdog(t, &cfg.WatchdogConfig{HeartbeatTimeoutMs: 50, Device: device})
+	time.Sleep(2 * watchdogInterval)
+
+	data, err := os.ReadFile(device)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0}, data)
+
+	require.NoError(t, w.Close())
+	data, err = os.ReadFile(device)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 'V'}, data)
+
+	_, err = NewWatchdog(NewTestHardware(4, nil), &cfg.WatchdogConfig{Device: filepath.Join(t.TempDir(), "missing", "watchdog")})
+	require.Error(t, err)
+}
+
+func TestWatchdogUnwrap(t *testing.T) {
+	w, hw := newTestWatchdog(t, &cfg.WatchdogConfig{})
+	defer w.Close()
+
+	require.True(t, SupportsSpeed(w))
+	require.NoError(t, SetPumpSpeed(w, 0, 0.5))
+	require.Equal(t, []float64{0.5}, hw.SpeedChanges(0))
+
+	hw.SetHasPumpDirection(2, true)
+	require.True(t, HasPumpDirection(w, 2))
+	require.False(t, HasPumpDirection(w, 1))
+
+	hw.SetPumpHealth(3, WriteFailed)
+	require.Equal(t, WriteFailed, GetStatus(w).Pumps[3])
+}
@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0006_create_pump_calibrations.down.sql', '--allow-empty');
+
+DROP TABLE pump_calibrations;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0006_create_pump_calibrations.down.sql');
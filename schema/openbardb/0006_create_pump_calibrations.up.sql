@@ -0,0 +1,16 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0006_create_pump_calibrations.up.sql', '--allow-empty');
+
+CREATE TABLE pump_calibrations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    pump_idx INT NOT NULL,
+    calibrated_at DATETIME NOT NULL,
+    duration_ms INT NOT NULL,
+    volume_ml float NOT NULL,
+    ml_per_sec float NOT NULL,
+
+    KEY (pump_idx, calibrated_at)
+);
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0006_create_pump_calibrations.up.sql');
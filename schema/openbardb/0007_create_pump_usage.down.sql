@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0007_create_pump_usage.down.sql', '--allow-empty');
+
+DROP TABLE pump_usage;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0007_create_pump_usage.down.sql');
@@ -0,0 +1,18 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0007_create_pump_usage.up.sql', '--allow-empty');
+
+CREATE TABLE pump_usage (
+    idx INT primary key,
+    runtime_ms BIGINT NOT NULL DEFAULT 0,
+    dispensed_ml double NOT NULL DEFAULT 0.0,
+    service_runtime_ms BIGINT NOT NULL DEFAULT 0,
+    service_dispensed_ml double NOT NULL DEFAULT 0.0,
+    serviced_at DATETIME,
+    service_interval_ml double,
+    service_interval_runtime_ms BIGINT
+);
+
+INSERT INTO pump_usage (idx) SELECT idx FROM pumps;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0007_create_pump_usage.up.sql');
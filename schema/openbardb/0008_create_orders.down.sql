@@ -0,0 +1,8 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0008_create_orders.down.sql', '--allow-empty');
+
+DROP TABLE order_fluids;
+DROP TABLE orders;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0008_create_orders.down.sql');
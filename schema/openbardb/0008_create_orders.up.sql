@@ -0,0 +1,25 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0008_create_orders.up.sql', '--allow-empty');
+
+CREATE TABLE orders (
+    id varchar(36) PRIMARY KEY NOT NULL,
+    position BIGINT NOT NULL,
+    status varchar(16) NOT NULL,
+    created_at DATETIME NOT NULL,
+    started_at DATETIME,
+    finished_at DATETIME,
+    error varchar(255),
+
+    KEY (status, position)
+);
+
+CREATE TABLE order_fluids (
+    order_id_fk varchar(36) NOT NULL,
+    fluid varchar(32) NOT NULL,
+    volume_ml INT NOT NULL,
+
+    FOREIGN KEY (order_id_fk) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0008_create_orders.up.sql');
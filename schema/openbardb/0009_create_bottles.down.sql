@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0009_create_bottles.down.sql', '--allow-empty');
+
+DROP TABLE bottles;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0009_create_bottles.down.sql');
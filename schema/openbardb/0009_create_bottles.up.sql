@@ -0,0 +1,15 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0009_create_bottles.up.sql', '--allow-empty');
+
+CREATE TABLE bottles (
+    idx INT primary key,
+    capacity_ml double,
+    remaining_ml double NOT NULL DEFAULT 0.0,
+    low_threshold_ml double,
+    replaced_at DATETIME
+);
+
+INSERT INTO bottles (idx) SELECT idx FROM pumps;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0009_create_bottles.up.sql');
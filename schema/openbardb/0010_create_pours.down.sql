@@ -0,0 +1,8 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0010_create_pours.down.sql', '--allow-empty');
+
+DROP TABLE pour_fluids;
+DROP TABLE pours;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0010_create_pours.down.sql');
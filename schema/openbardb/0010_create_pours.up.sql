@@ -0,0 +1,26 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0010_create_pours.up.sql', '--allow-empty');
+
+CREATE TABLE pours (
+    id varchar(36) PRIMARY KEY NOT NULL,
+    poured_at DATETIME NOT NULL,
+    recipe_id varchar(36),
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    outcome varchar(16) NOT NULL,
+    error varchar(255),
+
+    KEY (poured_at)
+);
+
+CREATE TABLE pour_fluids (
+    pour_id_fk varchar(36) NOT NULL,
+    fluid varchar(32) NOT NULL,
+    pump_idx INT,
+    requested_ml double NOT NULL,
+    dispensed_ml double NOT NULL DEFAULT 0.0,
+
+    FOREIGN KEY (pour_id_fk) REFERENCES pours(id) ON DELETE CASCADE
+);
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0010_create_pours.up.sql');
@@ -0,0 +1,8 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0011_create_recipe_steps.down.sql', '--allow-empty');
+
+DROP TABLE recipe_step_ingredients;
+DROP TABLE recipe_steps;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0011_create_recipe_steps.down.sql');
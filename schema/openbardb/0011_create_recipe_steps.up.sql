@@ -0,0 +1,22 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0011_create_recipe_steps.up.sql', '--allow-empty');
+
+CREATE TABLE recipe_steps (
+    recipe_id varchar(36) NOT NULL COLLATE utf8mb4_0900_ai_ci,
+    step INT NOT NULL,
+    delay_ms BIGINT NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (recipe_id, step)
+);
+
+CREATE TABLE recipe_step_ingredients (
+    recipe_id varchar(36) NOT NULL COLLATE utf8mb4_0900_ai_ci,
+    step INT NOT NULL,
+    ingredient_name varchar(36) NOT NULL COLLATE utf8mb4_0900_ai_ci,
+
+    PRIMARY KEY (recipe_id, ingredient_name),
+    FOREIGN KEY (recipe_id, step) REFERENCES recipe_steps(recipe_id, step) ON DELETE CASCADE
+);
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0011_create_recipe_steps.up.sql');
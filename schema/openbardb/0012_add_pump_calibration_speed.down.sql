@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0012_add_pump_calibration_speed.down.sql', '--allow-empty');
+
+ALTER TABLE pump_calibrations DROP COLUMN speed;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0012_add_pump_calibration_speed.down.sql');
@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0012_add_pump_calibration_speed.up.sql', '--allow-empty');
+
+ALTER TABLE pump_calibrations ADD COLUMN speed double NOT NULL DEFAULT 1;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0012_add_pump_calibration_speed.up.sql');
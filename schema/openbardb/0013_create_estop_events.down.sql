@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0013_create_estop_events.down.sql', '--allow-empty');
+
+DROP TABLE estop_events;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0013_create_estop_events.down.sql');
@@ -0,0 +1,15 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0013_create_estop_events.up.sql', '--allow-empty');
+
+CREATE TABLE estop_events (
+    id varchar(36) PRIMARY KEY NOT NULL,
+    triggered_at DATETIME NOT NULL,
+    source varchar(16) NOT NULL,
+    reason varchar(255),
+    reset_at DATETIME,
+
+    KEY (triggered_at)
+);
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0013_create_estop_events.up.sql');
@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0014_add_pump_tube_volume.down.sql', '--allow-empty');
+
+ALTER TABLE pumps DROP COLUMN tube_volume_ml;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0014_add_pump_tube_volume.down.sql');
@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0014_add_pump_tube_volume.up.sql', '--allow-empty');
+
+ALTER TABLE pumps ADD COLUMN tube_volume_ml double NOT NULL DEFAULT 0;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0014_add_pump_tube_volume.up.sql');
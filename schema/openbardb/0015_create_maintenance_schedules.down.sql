@@ -0,0 +1,7 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0015_create_maintenance_schedules.down.sql', '--allow-empty');
+
+DROP TABLE maintenance_schedules;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0015_create_maintenance_schedules.down.sql');
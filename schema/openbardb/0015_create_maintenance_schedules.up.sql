@@ -0,0 +1,16 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0015_create_maintenance_schedules.up.sql', '--allow-empty');
+
+CREATE TABLE maintenance_schedules (
+    id varchar(36) PRIMARY KEY NOT NULL,
+    program varchar(16) NOT NULL,
+    params varchar(1024) NOT NULL,
+    next_run_at DATETIME NOT NULL,
+    interval_sec BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+
+    KEY (next_run_at)
+);
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0015_create_maintenance_schedules.up.sql');
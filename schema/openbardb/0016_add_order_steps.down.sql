@@ -0,0 +1,11 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0016_add_order_steps.down.sql', '--allow-empty');
+
+ALTER TABLE order_fluids DROP COLUMN speed;
+ALTER TABLE order_fluids DROP COLUMN step_delay_ms;
+ALTER TABLE order_fluids DROP COLUMN step;
+
+ALTER TABLE orders DROP COLUMN recipe_id;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0016_add_order_steps.down.sql');
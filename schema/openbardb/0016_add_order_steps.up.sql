@@ -0,0 +1,11 @@
+call dolt_add('.');
+call dolt_commit('-m', 'Pre-migration 0016_add_order_steps.up.sql', '--allow-empty');
+
+ALTER TABLE orders ADD COLUMN recipe_id varchar(36);
+
+ALTER TABLE order_fluids ADD COLUMN step INT NOT NULL DEFAULT 0;
+ALTER TABLE order_fluids ADD COLUMN step_delay_ms BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_fluids ADD COLUMN speed double NOT NULL DEFAULT 0;
+
+call dolt_add('.');
+call dolt_commit('-m', 'Post-migration 0016_add_order_steps.up.sql');